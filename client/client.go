@@ -0,0 +1,984 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+// Package client provides a typed Go client for the dns-control HTTP API
+// described in server/openapi.json. Requests and responses use the same
+// model types as the server so that the two can't drift apart.
+//
+// The client is written by hand rather than generated from the spec. A
+// generator would produce a second copy of every model type that has to be
+// converted to and from the server's, and wouldn't cope with the parts of
+// the API that aren't plain JSON: the server-sent event stream, zone file,
+// zip and raw JSON bodies, and async operations that answer with either a
+// result or a job. TestClientCoversOpenApi fails if an operation in the
+// spec has no matching method, so new endpoints can't be missed.
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SidingsMedia/unified-control-rdns/server/model"
+)
+
+// Error returned when the API responds with an unexpected status. The
+// fields of whichever error shape the API sent are populated.
+type Error struct {
+	StatusCode int
+	model.GeneralError
+	AffectedServers []model.AffectedServer `json:"servers"`
+	Fields          []model.Fields         `json:"fields"`
+	// Lines of an imported zone file that were invalid
+	Lines []model.ZoneFileLineError `json:"lines"`
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("dns-control returned %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("dns-control returned %d: %s", e.StatusCode, e.Message)
+}
+
+// Request body that is sent as is rather than encoded as JSON
+type rawBody struct {
+	contentType string
+	data        []byte
+}
+
+type Client struct {
+	endpoint   string
+	httpClient *http.Client
+	header     http.Header
+}
+
+// Set a header that is sent with every request, for example to
+// authenticate with a proxy in front of the API.
+func (c *Client) SetHeader(key string, value string) {
+	c.header.Set(key, value)
+}
+
+// Decode the error sent with an unexpected status
+func apiError(status int, data []byte) *Error {
+	apiErr := &Error{StatusCode: status}
+	json.Unmarshal(data, apiErr)
+	apiErr.StatusCode = status
+	return apiErr
+}
+
+// Send a request, leaving the response for the caller to read and close
+func (c *Client) send(ctx context.Context, method string, path string, query url.Values, body any, accept string) (*http.Response, error) {
+	var reader io.Reader
+	contentType := "application/json"
+	if raw, ok := body.(rawBody); ok {
+		reader = bytes.NewReader(raw.data)
+		contentType = raw.contentType
+	} else if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	target := c.endpoint + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, values := range c.header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Accept", accept)
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	return c.httpClient.Do(req)
+}
+
+// Send a request to the API and decode the response body into out if the
+// response has one of the accepted status codes. Any other status is
+// returned as an *Error. The status code of the response is returned so
+// that callers can tell partial success apart from full success.
+func (c *Client) do(ctx context.Context, method string, path string, query url.Values, body any, out any, accepted ...int) (int, error) {
+	res, err := c.send(ctx, method, path, query, body, "application/json")
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return res.StatusCode, err
+	}
+
+	if !slices.Contains(accepted, res.StatusCode) {
+		return res.StatusCode, apiError(res.StatusCode, data)
+	}
+
+	// Responses that aren't JSON are returned as is
+	if raw, ok := out.(*[]byte); ok {
+		*raw = data
+		return res.StatusCode, nil
+	}
+
+	if out != nil && len(data) > 0 {
+		if err := json.Unmarshal(data, out); err != nil {
+			return res.StatusCode, err
+		}
+	}
+
+	return res.StatusCode, nil
+}
+
+// Build the query parameters selecting the servers to send a request to
+func serverQuery(servers []string) url.Values {
+	query := url.Values{}
+	for _, server := range servers {
+		query.Add("server", server)
+	}
+	return query
+}
+
+// Interpret the response to an operation performed on several servers. A
+// 500 response that doesn't list any servers is a general failure rather
+// than a partial one.
+func perServerResult(code int, failed *model.PerServerFail) (*model.PerServerFail, error) {
+	if code != http.StatusInternalServerError {
+		return nil, nil
+	}
+
+	if len(failed.AffectedServers) == 0 {
+		return nil, &Error{StatusCode: code, GeneralError: failed.GeneralError}
+	}
+	return failed, nil
+}
+
+func (c *Client) Health(ctx context.Context) error {
+	_, err := c.do(ctx, http.MethodGet, "/health", nil, nil, nil, http.StatusOK)
+	return err
+}
+
+func (c *Client) ListServers(ctx context.Context) (*model.List[model.Server], error) {
+	var servers model.List[model.Server]
+	if _, err := c.do(ctx, http.MethodGet, "/servers", nil, nil, &servers, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &servers, nil
+}
+
+// Optional parameters for GetCache
+type GetCacheOptions struct {
+	// Bypass the response cache of the API
+	Fresh bool
+	// Only include records of this type
+	Type string
+	// Number of levels of subdomains to include
+	Depth int
+	// Only include records with names matching this glob pattern
+	Match string
+}
+
+// Get the merged cache of the servers for domain. If some of the servers
+// failed the response is still returned, with the failures listed in its
+// Errors field.
+func (c *Client) GetCache(ctx context.Context, domain string, servers []string, options GetCacheOptions) (*model.CacheResponse, error) {
+	query := serverQuery(servers)
+	query.Set("domain", domain)
+	if options.Fresh {
+		query.Set("fresh", "true")
+	}
+	if options.Type != "" {
+		query.Set("type", options.Type)
+	}
+	if options.Depth > 0 {
+		query.Set("depth", strconv.Itoa(options.Depth))
+	}
+	if options.Match != "" {
+		query.Set("match", options.Match)
+	}
+
+	var cache model.CacheResponse
+	_, err := c.do(ctx, http.MethodGet, "/cache", query, nil, &cache,
+		http.StatusOK, http.StatusMultiStatus, http.StatusBadGateway)
+	if err != nil {
+		return nil, err
+	}
+	return &cache, nil
+}
+
+// Delete domain from the cache of the servers. A non nil *model.PerServerFail
+// is returned if the deletion failed on some of them.
+func (c *Client) DeleteCacheEntry(ctx context.Context, domain string, servers []string) (*model.PerServerFail, error) {
+	var failed model.PerServerFail
+	code, err := c.do(ctx, http.MethodDelete, "/cache", deleteCacheQuery(domain, servers), nil, &failed,
+		http.StatusNoContent, http.StatusInternalServerError)
+	if err != nil {
+		return nil, err
+	}
+
+	return perServerResult(code, &failed)
+}
+
+// Start deleting domain from the cache of the servers as a job
+func (c *Client) DeleteCacheEntryAsync(ctx context.Context, domain string, servers []string) (*model.Job, error) {
+	return c.startJob(ctx, http.MethodDelete, "/cache", deleteCacheQuery(domain, servers), nil)
+}
+
+// Delete many domains from the cache at once. Deletes that failed are
+// marked in the response and the servers they failed on are listed in its
+// Errors field.
+func (c *Client) DeleteCacheEntries(ctx context.Context, request model.CacheDeleteRequest) (*model.CacheDeleteResponse, error) {
+	var deleted model.CacheDeleteResponse
+	_, err := c.do(ctx, http.MethodPost, "/cache/delete", nil, request, &deleted,
+		http.StatusOK, http.StatusMultiStatus, http.StatusBadGateway)
+	if err != nil {
+		return nil, err
+	}
+	return &deleted, nil
+}
+
+// Start deleting many domains from the cache as a job. The result of the
+// job is a model.CacheDeleteResponse once it has finished.
+func (c *Client) DeleteCacheEntriesAsync(ctx context.Context, request model.CacheDeleteRequest) (*model.Job, error) {
+	return c.startJob(ctx, http.MethodPost, "/cache/delete", url.Values{}, request)
+}
+
+func deleteCacheQuery(domain string, servers []string) url.Values {
+	query := serverQuery(servers)
+	query.Set("domain", domain)
+	return query
+}
+
+// Optional parameters for PurgeCache
+type PurgeCacheOptions struct {
+	// Only delete names matching this glob pattern
+	Match string
+	// Number of levels of subdomains to walk when discovering names. The
+	// server default is used if nil.
+	Depth *int
+	// Return the names that would be deleted without deleting them
+	DryRun bool
+}
+
+// Delete every cached name below domain, or matching options.Match, from
+// the servers. Servers that failed are listed in the Errors field of the
+// response.
+func (c *Client) PurgeCache(ctx context.Context, domain string, servers []string, options PurgeCacheOptions) (*model.CachePurgeResponse, error) {
+	var purged model.CachePurgeResponse
+	_, err := c.do(ctx, http.MethodPost, "/cache/purge", purgeCacheQuery(domain, servers, options), nil, &purged,
+		http.StatusOK, http.StatusMultiStatus, http.StatusBadGateway)
+	if err != nil {
+		return nil, err
+	}
+	return &purged, nil
+}
+
+// Start purging the cache of the servers as a job. The result of the job
+// is a model.CachePurgeResponse once it has finished.
+func (c *Client) PurgeCacheAsync(ctx context.Context, domain string, servers []string, options PurgeCacheOptions) (*model.Job, error) {
+	return c.startJob(ctx, http.MethodPost, "/cache/purge", purgeCacheQuery(domain, servers, options), nil)
+}
+
+func purgeCacheQuery(domain string, servers []string, options PurgeCacheOptions) url.Values {
+	query := serverQuery(servers)
+	if domain != "" {
+		query.Set("domain", domain)
+	}
+	if options.Match != "" {
+		query.Set("match", options.Match)
+	}
+	if options.Depth != nil {
+		query.Set("depth", strconv.Itoa(*options.Depth))
+	}
+	if options.DryRun {
+		query.Set("dryRun", "true")
+	}
+	return query
+}
+
+// Remove every entry from the cache of the servers. A non nil
+// *model.PerServerFail is returned if the flush failed on some of them.
+func (c *Client) FlushCache(ctx context.Context, servers []string) (*model.PerServerFail, error) {
+	var failed model.PerServerFail
+	code, err := c.do(ctx, http.MethodPost, "/cache/flush", serverQuery(servers), nil, &failed,
+		http.StatusNoContent, http.StatusInternalServerError)
+	if err != nil {
+		return nil, err
+	}
+
+	return perServerResult(code, &failed)
+}
+
+// Start flushing the cache of the servers as a job
+func (c *Client) FlushCacheAsync(ctx context.Context, servers []string) (*model.Job, error) {
+	return c.startJob(ctx, http.MethodPost, "/cache/flush", serverQuery(servers), nil)
+}
+
+// Resolve name through the resolver of each of the servers. If typ is
+// empty, A records are requested.
+func (c *Client) Resolve(ctx context.Context, name string, typ string, servers []string) (*model.ResolveResponse, error) {
+	query := serverQuery(servers)
+	query.Set("name", name)
+	if typ != "" {
+		query.Set("type", typ)
+	}
+
+	var resolved model.ResolveResponse
+	_, err := c.do(ctx, http.MethodGet, "/resolve", query, nil, &resolved,
+		http.StatusOK, http.StatusMultiStatus, http.StatusBadGateway)
+	if err != nil {
+		return nil, err
+	}
+	return &resolved, nil
+}
+
+func (c *Client) GetUpstreamStats(ctx context.Context) (*model.UpstreamStats, error) {
+	var stats model.UpstreamStats
+	if _, err := c.do(ctx, http.MethodGet, "/stats", nil, nil, &stats, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// Get the results of the most recent scheduled DNS probe of a server
+func (c *Client) GetProbes(ctx context.Context, id string) (*model.ProbeResponse, error) {
+	var probes model.ProbeResponse
+	if _, err := c.do(ctx, http.MethodGet, "/servers/"+url.PathEscape(id)+"/probes", nil, nil, &probes, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &probes, nil
+}
+
+// Probe a server over DNS straight away
+func (c *Client) RunProbes(ctx context.Context, id string) (*model.ProbeResponse, error) {
+	var probes model.ProbeResponse
+	if _, err := c.do(ctx, http.MethodPost, "/servers/"+url.PathEscape(id)+"/probes", nil, nil, &probes, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &probes, nil
+}
+
+// Path of an endpoint below a zone
+func zonePath(zone string, endpoint string) string {
+	return "/zones/" + url.PathEscape(zone) + endpoint
+}
+
+// Get the DNSSEC status of zone and the keys used to sign it on each of
+// the servers
+func (c *Client) GetDnssecStatus(ctx context.Context, zone string, servers []string) (*model.DnssecStatusResponse, error) {
+	var status model.DnssecStatusResponse
+	_, err := c.do(ctx, http.MethodGet, zonePath(zone, "/dnssec"), serverQuery(servers), nil, &status,
+		http.StatusOK, http.StatusMultiStatus, http.StatusBadGateway)
+	if err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Get the DS records for zone gathered from each of the servers
+func (c *Client) GetDsRecords(ctx context.Context, zone string, servers []string) (*model.DsResponse, error) {
+	var records model.DsResponse
+	_, err := c.do(ctx, http.MethodGet, zonePath(zone, "/dnssec/ds"), serverQuery(servers), nil, &records,
+		http.StatusOK, http.StatusMultiStatus, http.StatusBadGateway)
+	if err != nil {
+		return nil, err
+	}
+	return &records, nil
+}
+
+// Optional parameters for SignZone. Zero values use the server defaults.
+type SignZoneOptions struct {
+	HashAlgorithm   string
+	KskKeySize      int
+	ZskKeySize      int
+	Curve           string
+	DnsKeyTtl       int
+	ZskRolloverDays int
+	NxProof         string
+	Iterations      int
+	SaltLength      int
+}
+
+// Sign zone on each of the servers using algorithm, which is one of RSA,
+// ECDSA or EDDSA. A non nil *model.PerServerFail is returned if signing
+// failed on some of them.
+func (c *Client) SignZone(ctx context.Context, zone string, algorithm string, servers []string, options SignZoneOptions) (*model.PerServerFail, error) {
+	query := serverQuery(servers)
+	query.Set("algorithm", algorithm)
+	for name, value := range map[string]string{
+		"hashAlgorithm": options.HashAlgorithm,
+		"curve":         options.Curve,
+		"nxProof":       options.NxProof,
+	} {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+	for name, value := range map[string]int{
+		"kskKeySize":      options.KskKeySize,
+		"zskKeySize":      options.ZskKeySize,
+		"dnsKeyTtl":       options.DnsKeyTtl,
+		"zskRolloverDays": options.ZskRolloverDays,
+		"iterations":      options.Iterations,
+		"saltLength":      options.SaltLength,
+	} {
+		if value != 0 {
+			query.Set(name, strconv.Itoa(value))
+		}
+	}
+
+	var failed model.PerServerFail
+	code, err := c.do(ctx, http.MethodPost, zonePath(zone, "/dnssec/sign"), query, nil, &failed,
+		http.StatusNoContent, http.StatusInternalServerError)
+	if err != nil {
+		return nil, err
+	}
+
+	return perServerResult(code, &failed)
+}
+
+// Remove DNSSEC from zone on each of the servers
+func (c *Client) UnsignZone(ctx context.Context, zone string, servers []string) (*model.PerServerFail, error) {
+	var failed model.PerServerFail
+	code, err := c.do(ctx, http.MethodPost, zonePath(zone, "/dnssec/unsign"), serverQuery(servers), nil, &failed,
+		http.StatusNoContent, http.StatusInternalServerError)
+	if err != nil {
+		return nil, err
+	}
+
+	return perServerResult(code, &failed)
+}
+
+// Start rolling over the key of zone with keyTag on each of the servers
+func (c *Client) RolloverDnsKey(ctx context.Context, zone string, keyTag int, servers []string) (*model.PerServerFail, error) {
+	query := serverQuery(servers)
+	query.Set("keyTag", strconv.Itoa(keyTag))
+
+	var failed model.PerServerFail
+	code, err := c.do(ctx, http.MethodPost, zonePath(zone, "/dnssec/rollover"), query, nil, &failed,
+		http.StatusNoContent, http.StatusInternalServerError)
+	if err != nil {
+		return nil, err
+	}
+
+	return perServerResult(code, &failed)
+}
+
+// Get zone from server as an RFC 1035 zone file
+func (c *Client) ExportZone(ctx context.Context, zone string, server string) (string, error) {
+	query := url.Values{}
+	query.Set("server", server)
+
+	var zoneFile []byte
+	if _, err := c.do(ctx, http.MethodGet, zonePath(zone, "/export"), query, nil, &zoneFile, http.StatusOK); err != nil {
+		return "", err
+	}
+	return string(zoneFile), nil
+}
+
+// Import the records in zoneFile into zone on each of the servers. If the
+// file is invalid, the returned *Error lists each invalid line in its Lines
+// field.
+func (c *Client) ImportZone(ctx context.Context, zone string, zoneFile string, servers []string, overwrite bool) (*model.PerServerFail, error) {
+	query := serverQuery(servers)
+	if overwrite {
+		query.Set("overwrite", "true")
+	}
+
+	var failed model.PerServerFail
+	code, err := c.do(ctx, http.MethodPost, zonePath(zone, "/import"), query, rawBody{contentType: "text/dns", data: []byte(zoneFile)}, &failed,
+		http.StatusNoContent, http.StatusInternalServerError)
+	if err != nil {
+		return nil, err
+	}
+
+	return perServerResult(code, &failed)
+}
+
+// Bring the servers in line with a desired state written in YAML or JSON.
+// If dryRun is set, the changes are planned but not made. Servers that
+// failed are listed in the Errors field of the response.
+func (c *Client) Apply(ctx context.Context, state []byte, dryRun bool) (*model.ApplyResponse, error) {
+	query := url.Values{}
+	if dryRun {
+		query.Set("dryRun", "true")
+	}
+
+	var applied model.ApplyResponse
+	_, err := c.do(ctx, http.MethodPost, "/apply", query, rawBody{contentType: "application/yaml", data: state}, &applied,
+		http.StatusOK, http.StatusMultiStatus, http.StatusBadGateway)
+	if err != nil {
+		return nil, err
+	}
+	return &applied, nil
+}
+
+// Get the outcome of the most recent check for drift from the desired state
+func (c *Client) GetDrift(ctx context.Context) (*model.DriftResponse, error) {
+	var drift model.DriftResponse
+	if _, err := c.do(ctx, http.MethodGet, "/drift", nil, nil, &drift, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &drift, nil
+}
+
+// Check for drift from the desired state straight away, correcting it
+// where the state is in enforce mode
+func (c *Client) CheckDrift(ctx context.Context) (*model.DriftResponse, error) {
+	var drift model.DriftResponse
+	if _, err := c.do(ctx, http.MethodPost, "/drift", nil, nil, &drift, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &drift, nil
+}
+
+// Options for following the event stream
+type StreamEventsOptions struct {
+	// Only receive events involving these servers. Statistics snapshots are
+	// always received.
+	Servers []string
+	// Only receive events of these types, such as model.EventServerDown
+	Types []string
+	// Seconds between statistics snapshots, or 0 for the server default
+	StatsInterval int
+}
+
+// Follow the stream of events from the API, calling handle with each one.
+// It returns when ctx is done, handle returns an error or the stream ends.
+func (c *Client) StreamEvents(ctx context.Context, options StreamEventsOptions, handle func(model.Event) error) error {
+	query := serverQuery(options.Servers)
+	for _, typ := range options.Types {
+		query.Add("type", typ)
+	}
+	if options.StatsInterval > 0 {
+		query.Set("statsInterval", strconv.Itoa(options.StatsInterval))
+	}
+
+	res, err := c.send(ctx, http.MethodGet, "/events", query, nil, "text/event-stream")
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(res.Body)
+		return apiError(res.StatusCode, data)
+	}
+
+	scanner := bufio.NewScanner(res.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	data := []string{}
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// A blank line ends each event
+		if line == "" {
+			if len(data) == 0 {
+				continue
+			}
+
+			var event model.Event
+			if err := json.Unmarshal([]byte(strings.Join(data, "\n")), &event); err != nil {
+				return err
+			}
+			data = data[:0]
+
+			if err := handle(event); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if value, ok := strings.CutPrefix(line, "data:"); ok {
+			data = append(data, strings.TrimPrefix(value, " "))
+		}
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.ErrUnexpectedEOF
+}
+
+// Start an operation as a job rather than waiting for it to finish
+func (c *Client) startJob(ctx context.Context, method string, path string, query url.Values, body any) (*model.Job, error) {
+	query.Set("async", "true")
+
+	var job model.Job
+	if _, err := c.do(ctx, method, path, query, body, &job, http.StatusAccepted); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Get the progress of a job, and its result once it has finished
+func (c *Client) GetJob(ctx context.Context, id string) (*model.Job, error) {
+	var job model.Job
+	if _, err := c.do(ctx, http.MethodGet, "/jobs/"+url.PathEscape(id), nil, nil, &job, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Cancel a running job, returning it once it has stopped
+func (c *Client) CancelJob(ctx context.Context, id string) (*model.Job, error) {
+	var job model.Job
+	if _, err := c.do(ctx, http.MethodDelete, "/jobs/"+url.PathEscape(id), nil, nil, &job, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Poll a job every interval until it has finished
+func (c *Client) WaitForJob(ctx context.Context, id string, interval time.Duration) (*model.Job, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		job, err := c.GetJob(ctx, id)
+		if err != nil || job.FinishedAt != nil {
+			return job, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func dhcpScopePath(scope string, endpoint string) string {
+	return "/dhcp/scopes/" + url.PathEscape(scope) + endpoint
+}
+
+// Send a change to each of the servers and report the servers it failed on
+func (c *Client) change(ctx context.Context, method string, path string, servers []string, body any) (*model.PerServerFail, error) {
+	var failed model.PerServerFail
+	code, err := c.do(ctx, method, path, serverQuery(servers), body, &failed,
+		http.StatusNoContent, http.StatusInternalServerError)
+	if err != nil {
+		return nil, err
+	}
+
+	return perServerResult(code, &failed)
+}
+
+// List the DHCP scopes of each of the servers
+func (c *Client) ListDhcpScopes(ctx context.Context, servers []string) (*model.DhcpScopesResponse, error) {
+	var scopes model.DhcpScopesResponse
+	_, err := c.do(ctx, http.MethodGet, "/dhcp/scopes", serverQuery(servers), nil, &scopes,
+		http.StatusOK, http.StatusMultiStatus, http.StatusBadGateway)
+	if err != nil {
+		return nil, err
+	}
+	return &scopes, nil
+}
+
+// Create a DHCP scope on each of the servers, or update its settings if
+// it already exists
+func (c *Client) SetDhcpScope(ctx context.Context, scope string, settings model.DhcpScopeSettings, servers []string) (*model.PerServerFail, error) {
+	return c.change(ctx, http.MethodPut, dhcpScopePath(scope, ""), servers, settings)
+}
+
+// Start setting a DHCP scope on the servers as a job
+func (c *Client) SetDhcpScopeAsync(ctx context.Context, scope string, settings model.DhcpScopeSettings, servers []string) (*model.Job, error) {
+	return c.startJob(ctx, http.MethodPut, dhcpScopePath(scope, ""), serverQuery(servers), settings)
+}
+
+func (c *Client) EnableDhcpScope(ctx context.Context, scope string, servers []string) (*model.PerServerFail, error) {
+	return c.change(ctx, http.MethodPost, dhcpScopePath(scope, "/enable"), servers, nil)
+}
+
+func (c *Client) DisableDhcpScope(ctx context.Context, scope string, servers []string) (*model.PerServerFail, error) {
+	return c.change(ctx, http.MethodPost, dhcpScopePath(scope, "/disable"), servers, nil)
+}
+
+// List the DHCP leases of the servers, merged into one list. If scope is
+// not empty, only leases from that scope are listed.
+func (c *Client) ListDhcpLeases(ctx context.Context, scope string, servers []string) (*model.DhcpLeasesResponse, error) {
+	query := serverQuery(servers)
+	if scope != "" {
+		query.Set("scope", scope)
+	}
+
+	var leases model.DhcpLeasesResponse
+	_, err := c.do(ctx, http.MethodGet, "/dhcp/leases", query, nil, &leases,
+		http.StatusOK, http.StatusMultiStatus, http.StatusBadGateway)
+	if err != nil {
+		return nil, err
+	}
+	return &leases, nil
+}
+
+// Remove the lease of the client with hardwareAddress from scope on each of
+// the servers
+func (c *Client) RemoveDhcpLease(ctx context.Context, scope string, hardwareAddress string, servers []string) (*model.PerServerFail, error) {
+	return c.change(ctx, http.MethodDelete, dhcpScopePath(scope, "/leases/"+url.PathEscape(hardwareAddress)), servers, nil)
+}
+
+// Turn the dynamic lease of the client with hardwareAddress into a
+// reserved lease on each of the servers
+func (c *Client) ReserveDhcpLease(ctx context.Context, scope string, hardwareAddress string, servers []string) (*model.PerServerFail, error) {
+	return c.change(ctx, http.MethodPost, dhcpScopePath(scope, "/leases/"+url.PathEscape(hardwareAddress)+"/reserve"), servers, nil)
+}
+
+// List the operations run on cron schedules
+func (c *Client) ListSchedules(ctx context.Context) (*model.List[model.Schedule], error) {
+	var schedules model.List[model.Schedule]
+	if _, err := c.do(ctx, http.MethodGet, "/schedules", nil, nil, &schedules, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &schedules, nil
+}
+
+// Get the recent runs of a schedule, newest first
+func (c *Client) GetScheduleRuns(ctx context.Context, id string) (*model.List[model.ScheduleRun], error) {
+	var runs model.List[model.ScheduleRun]
+	if _, err := c.do(ctx, http.MethodGet, "/schedules/"+url.PathEscape(id)+"/runs", nil, nil, &runs, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &runs, nil
+}
+
+// Run a schedule straight away, returning the outcome once it has finished
+func (c *Client) RunSchedule(ctx context.Context, id string) (*model.ScheduleRun, error) {
+	var run model.ScheduleRun
+	if _, err := c.do(ctx, http.MethodPost, "/schedules/"+url.PathEscape(id)+"/runs", nil, nil, &run, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// Get the OpenAPI document describing the API
+func (c *Client) GetOpenApi(ctx context.Context) (json.RawMessage, error) {
+	var document json.RawMessage
+	if _, err := c.do(ctx, http.MethodGet, "/openapi.json", nil, nil, &document, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return document, nil
+}
+
+// Create a client for the API served at endpoint, such as
+// http://localhost:3000. If httpClient is nil, http.DefaultClient is used.
+func NewClient(endpoint string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &Client{
+		endpoint:   strings.TrimSuffix(endpoint, "/"),
+		httpClient: httpClient,
+		header:     http.Header{},
+	}
+}
+
+// Get the settings of a single server as reported by Technetium
+func (c *Client) GetServerSettings(ctx context.Context, id string) (*model.ServerSettings, error) {
+	var settings model.ServerSettings
+	if _, err := c.do(ctx, http.MethodGet, "/servers/"+url.PathEscape(id)+"/settings", nil, nil, &settings, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// Compare the settings of the servers. If keys is empty, every setting
+// apart from those specific to a server is compared.
+func (c *Client) DiffSettings(ctx context.Context, keys []string, servers []string) (*model.SettingsDiffResponse, error) {
+	query := serverQuery(servers)
+	for _, key := range keys {
+		query.Add("key", key)
+	}
+
+	var diff model.SettingsDiffResponse
+	_, err := c.do(ctx, http.MethodGet, "/settings/diff", query, nil, &diff,
+		http.StatusOK, http.StatusMultiStatus, http.StatusBadGateway)
+	if err != nil {
+		return nil, err
+	}
+	return &diff, nil
+}
+
+// Change the given settings on each of the servers, leaving the rest as
+// they are
+func (c *Client) SetSettings(ctx context.Context, settings map[string]any, servers []string) (*model.PerServerFail, error) {
+	return c.change(ctx, http.MethodPost, "/settings", servers, settings)
+}
+
+// Start changing settings on the servers as a job
+func (c *Client) SetSettingsAsync(ctx context.Context, settings map[string]any, servers []string) (*model.Job, error) {
+	return c.startJob(ctx, http.MethodPost, "/settings", serverQuery(servers), settings)
+}
+
+// List which domains the servers forward where. Servers that failed are
+// listed in the Errors field of the response.
+func (c *Client) GetForwarders(ctx context.Context, servers []string) (*model.ForwardersResponse, error) {
+	var forwarders model.ForwardersResponse
+	_, err := c.do(ctx, http.MethodGet, "/forwarders", serverQuery(servers), nil, &forwarders,
+		http.StatusOK, http.StatusMultiStatus, http.StatusBadGateway)
+	if err != nil {
+		return nil, err
+	}
+	return &forwarders, nil
+}
+
+// Replace the global forwarders of the servers. An empty list of
+// forwarders makes the servers resolve queries recursively.
+func (c *Client) SetForwarders(ctx context.Context, settings model.ForwarderSettings, servers []string) (*model.PerServerFail, error) {
+	return c.change(ctx, http.MethodPut, "/forwarders", servers, settings)
+}
+
+// Forward zone to forwarders on each of the servers, creating the
+// conditional forwarder zone if it doesn't exist
+func (c *Client) SetForwarderZone(ctx context.Context, zone string, forwarders []model.Forwarder, servers []string) (*model.PerServerFail, error) {
+	return c.change(ctx, http.MethodPut, "/forwarders/zones/"+url.PathEscape(zone), servers, model.ForwarderZoneSettings{Forwarders: forwarders})
+}
+
+func (c *Client) DeleteForwarderZone(ctx context.Context, zone string, servers []string) (*model.PerServerFail, error) {
+	return c.change(ctx, http.MethodDelete, "/forwarders/zones/"+url.PathEscape(zone), servers, nil)
+}
+
+func appPath(name string, endpoint string) string {
+	return "/apps/" + url.PathEscape(name) + endpoint
+}
+
+// List the DNS apps installed on the servers. Servers that failed are
+// listed in the Errors field of the response.
+func (c *Client) ListApps(ctx context.Context, servers []string) (*model.AppsResponse, error) {
+	var apps model.AppsResponse
+	_, err := c.do(ctx, http.MethodGet, "/apps", serverQuery(servers), nil, &apps,
+		http.StatusOK, http.StatusMultiStatus, http.StatusBadGateway)
+	if err != nil {
+		return nil, err
+	}
+	return &apps, nil
+}
+
+// Install the app in the zip archive on each of the servers, or update it
+// where it is already installed
+func (c *Client) InstallApp(ctx context.Context, name string, archive []byte, servers []string) (*model.PerServerFail, error) {
+	return c.change(ctx, http.MethodPut, appPath(name, ""), servers, rawBody{contentType: "application/zip", data: archive})
+}
+
+func (c *Client) UninstallApp(ctx context.Context, name string, servers []string) (*model.PerServerFail, error) {
+	return c.change(ctx, http.MethodDelete, appPath(name, ""), servers, nil)
+}
+
+func (c *Client) GetAppConfig(ctx context.Context, name string, servers []string) (*model.AppConfigResponse, error) {
+	var configs model.AppConfigResponse
+	_, err := c.do(ctx, http.MethodGet, appPath(name, "/config"), serverQuery(servers), nil, &configs,
+		http.StatusOK, http.StatusMultiStatus, http.StatusBadGateway)
+	if err != nil {
+		return nil, err
+	}
+	return &configs, nil
+}
+
+// Replace the config of an app on each of the servers. The config is sent
+// as is so that its formatting is kept.
+func (c *Client) SetAppConfig(ctx context.Context, name string, config json.RawMessage, servers []string) (*model.PerServerFail, error) {
+	return c.change(ctx, http.MethodPut, appPath(name, "/config"), servers, rawBody{contentType: "application/json", data: config})
+}
+
+func serverPath(id string, endpoint string) string {
+	return "/servers/" + url.PathEscape(id) + endpoint
+}
+
+func backupQuery(store bool, logs bool) url.Values {
+	query := url.Values{}
+	if store {
+		query.Set("store", "true")
+	}
+	if logs {
+		query.Set("logs", "true")
+	}
+	return query
+}
+
+// Take a backup of a server and return it as a zip archive. Query logs are
+// only included if logs is set.
+func (c *Client) BackupServer(ctx context.Context, id string, logs bool) ([]byte, error) {
+	var archive []byte
+	if _, err := c.do(ctx, http.MethodPost, serverPath(id, "/backup"), backupQuery(false, logs), nil, &archive, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return archive, nil
+}
+
+// Take a backup of a server and keep it in the backup directory of the
+// service
+func (c *Client) StoreBackup(ctx context.Context, id string, logs bool) (*model.Backup, error) {
+	var backup model.Backup
+	if _, err := c.do(ctx, http.MethodPost, serverPath(id, "/backup"), backupQuery(true, logs), nil, &backup, http.StatusCreated); err != nil {
+		return nil, err
+	}
+	return &backup, nil
+}
+
+func restoreQuery(deleteExisting bool) url.Values {
+	query := url.Values{}
+	if deleteExisting {
+		query.Set("deleteExisting", "true")
+	}
+	return query
+}
+
+// Restore a server from a backup archive. Files that aren't in the backup
+// are deleted if deleteExisting is set.
+func (c *Client) RestoreServer(ctx context.Context, id string, archive []byte, deleteExisting bool) (*model.PerServerFail, error) {
+	var failed model.PerServerFail
+	code, err := c.do(ctx, http.MethodPost, serverPath(id, "/restore"), restoreQuery(deleteExisting), rawBody{contentType: "application/zip", data: archive}, &failed,
+		http.StatusNoContent, http.StatusInternalServerError)
+	if err != nil {
+		return nil, err
+	}
+
+	return perServerResult(code, &failed)
+}
+
+func (c *Client) RestoreServerAsync(ctx context.Context, id string, archive []byte, deleteExisting bool) (*model.Job, error) {
+	return c.startJob(ctx, http.MethodPost, serverPath(id, "/restore"), restoreQuery(deleteExisting), rawBody{contentType: "application/zip", data: archive})
+}
+
+// List the stored backups of a server, or of every server if server is
+// empty, newest first
+func (c *Client) ListBackups(ctx context.Context, server string) (*model.List[model.Backup], error) {
+	query := url.Values{}
+	if server != "" {
+		query.Set("server", server)
+	}
+
+	var backups model.List[model.Backup]
+	if _, err := c.do(ctx, http.MethodGet, "/backups", query, nil, &backups, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return &backups, nil
+}
+
+// Download a stored backup as a zip archive
+func (c *Client) GetBackup(ctx context.Context, server string, name string) ([]byte, error) {
+	var archive []byte
+	if _, err := c.do(ctx, http.MethodGet, "/backups/"+url.PathEscape(server)+"/"+url.PathEscape(name), nil, nil, &archive, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return archive, nil
+}
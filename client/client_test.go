@@ -0,0 +1,45 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package client
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Every operation in the OpenAPI document must have a matching method on
+// Client named after its operationId.
+func TestClientCoversOpenApi(t *testing.T) {
+	data, err := os.ReadFile("../server/openapi.json")
+	if err != nil {
+		t.Fatalf("failed to read openapi.json: %v", err)
+	}
+
+	var document struct {
+		Paths map[string]map[string]struct {
+			OperationId string `json:"operationId"`
+		} `json:"paths"`
+	}
+	if err := json.Unmarshal(data, &document); err != nil {
+		t.Fatalf("failed to parse openapi.json: %v", err)
+	}
+
+	typ := reflect.TypeOf(&Client{})
+	for path, operations := range document.Paths {
+		for method, operation := range operations {
+			if operation.OperationId == "" {
+				t.Errorf("%s %s has no operationId", strings.ToUpper(method), path)
+				continue
+			}
+
+			name := strings.ToUpper(operation.OperationId[:1]) + operation.OperationId[1:]
+			if _, ok := typ.MethodByName(name); !ok {
+				t.Errorf("client has no method %s for %s %s", name, strings.ToUpper(method), path)
+			}
+		}
+	}
+}
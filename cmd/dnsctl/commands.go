@@ -0,0 +1,1797 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SidingsMedia/unified-control-rdns/client"
+	"github.com/SidingsMedia/unified-control-rdns/server/model"
+)
+
+var commands = []*command{
+	{
+		name:    "servers",
+		summary: "list the servers managed by dns-control",
+		run:     runServers,
+	},
+	{
+		name:    "cache",
+		summary: "inspect and clear the cache of servers",
+		subcommands: []*command{
+			{
+				name:    "get",
+				summary: "list cached records for a domain",
+				run:     runCacheGet,
+			},
+			{
+				name:    "delete",
+				summary: "delete a domain from the cache",
+				run:     runCacheDelete,
+			},
+			{
+				name:    "purge",
+				summary: "delete every cached name below a domain or matching a pattern",
+				run:     runCachePurge,
+			},
+			{
+				name:    "flush",
+				summary: "remove every entry from the cache",
+				run:     runCacheFlush,
+			},
+		},
+	},
+	{
+		name:    "resolve",
+		summary: "resolve a name through each server and compare the answers",
+		run:     runResolve,
+	},
+	{
+		name:    "zone",
+		summary: "export and import zone files",
+		subcommands: []*command{
+			{
+				name:    "export",
+				summary: "print a zone from a server as a zone file",
+				run:     runZoneExport,
+			},
+			{
+				name:    "import",
+				summary: "import a zone file into a zone",
+				run:     runZoneImport,
+			},
+		},
+	},
+	{
+		name:    "dnssec",
+		summary: "inspect the DNSSEC signing of zones",
+		subcommands: []*command{
+			{
+				name:    "status",
+				summary: "show the DNSSEC status and keys of a zone",
+				run:     runDnssecStatus,
+			},
+			{
+				name:    "ds",
+				summary: "list the DS records to publish in the parent zone",
+				run:     runDnssecDs,
+			},
+		},
+	},
+	{
+		name:    "apply",
+		summary: "bring servers in line with a desired state file",
+		run:     runApply,
+	},
+	{
+		name:    "drift",
+		summary: "show drift of servers from the desired state directory",
+		run:     runDrift,
+	},
+	{
+		name:    "stats",
+		summary: "show upstream concurrency statistics",
+		run:     runStats,
+	},
+	{
+		name:    "job",
+		summary: "show, wait for or cancel a job",
+		run:     runJob,
+	},
+	{
+		name:    "events",
+		summary: "follow events as they happen",
+		run:     runEvents,
+	},
+	{
+		name:    "dhcp",
+		summary: "manage DHCP scopes and leases",
+		subcommands: []*command{
+			{
+				name:    "scopes",
+				summary: "list the DHCP scopes of servers",
+				run:     runDhcpScopes,
+			},
+			{
+				name:    "set",
+				summary: "create or update a scope from a JSON settings file",
+				run:     runDhcpSet,
+			},
+			{
+				name:    "enable",
+				summary: "start handing out leases from a scope",
+				run:     runDhcpEnable,
+			},
+			{
+				name:    "disable",
+				summary: "stop handing out leases from a scope",
+				run:     runDhcpDisable,
+			},
+			{
+				name:    "leases",
+				summary: "list leases merged across servers",
+				run:     runDhcpLeases,
+			},
+			{
+				name:    "reserve",
+				summary: "turn a dynamic lease into a reserved lease",
+				run:     runDhcpReserve,
+			},
+			{
+				name:    "remove",
+				summary: "remove a lease",
+				run:     runDhcpRemove,
+			},
+		},
+	},
+	{
+		name:    "schedule",
+		summary: "inspect and run scheduled operations",
+		subcommands: []*command{
+			{
+				name:    "list",
+				summary: "list schedules and when they next run",
+				run:     runScheduleList,
+			},
+			{
+				name:    "runs",
+				summary: "show the recent runs of a schedule",
+				run:     runScheduleRuns,
+			},
+			{
+				name:    "run",
+				summary: "run a schedule now",
+				run:     runScheduleRun,
+			},
+		},
+	},
+	{
+		name:    "settings",
+		summary: "read, compare and change server settings",
+		subcommands: []*command{
+			{
+				name:    "get",
+				summary: "show the settings of a server",
+				run:     runSettingsGet,
+			},
+			{
+				name:    "diff",
+				summary: "list settings that differ between servers",
+				run:     runSettingsDiff,
+			},
+			{
+				name:    "set",
+				summary: "change settings from a JSON file",
+				run:     runSettingsSet,
+			},
+		},
+	},
+	{
+		name:    "forwarders",
+		summary: "manage forwarders and conditional forwarder zones",
+		subcommands: []*command{
+			{
+				name:    "list",
+				summary: "show which domains servers forward where",
+				run:     runForwardersList,
+			},
+			{
+				name:    "set",
+				summary: "replace the global forwarders",
+				run:     runForwardersSet,
+			},
+			{
+				name:    "set-zone",
+				summary: "create or replace a conditional forwarder zone",
+				run:     runForwardersSetZone,
+			},
+			{
+				name:    "delete-zone",
+				summary: "delete a conditional forwarder zone",
+				run:     runForwardersDeleteZone,
+			},
+		},
+	},
+	{
+		name:    "apps",
+		summary: "manage DNS apps",
+		subcommands: []*command{
+			{
+				name:    "list",
+				summary: "show installed apps and their versions",
+				run:     runAppsList,
+			},
+			{
+				name:    "install",
+				summary: "install or update an app from a zip archive",
+				run:     runAppsInstall,
+			},
+			{
+				name:    "uninstall",
+				summary: "uninstall an app",
+				run:     runAppsUninstall,
+			},
+			{
+				name:    "config",
+				summary: "show the config of an app",
+				run:     runAppsConfig,
+			},
+			{
+				name:    "set-config",
+				summary: "replace the config of an app from a JSON file",
+				run:     runAppsSetConfig,
+			},
+		},
+	},
+	{
+		name:    "backup",
+		summary: "back up and restore servers",
+		subcommands: []*command{
+			{
+				name:    "create",
+				summary: "back up a server",
+				run:     runBackupCreate,
+			},
+			{
+				name:    "list",
+				summary: "list stored backups",
+				run:     runBackupList,
+			},
+			{
+				name:    "get",
+				summary: "download a stored backup",
+				run:     runBackupGet,
+			},
+			{
+				name:    "restore",
+				summary: "restore a server from a backup",
+				run:     runBackupRestore,
+			},
+		},
+	},
+}
+
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// Servers chosen on the command line with --server or --all
+type serverSelector struct {
+	ids stringList
+	all bool
+}
+
+func addServerFlags(flags *flag.FlagSet) *serverSelector {
+	selector := &serverSelector{}
+	flags.Var(&selector.ids, "server", "ID of a server to operate on. May be repeated")
+	flags.BoolVar(&selector.all, "all", false, "operate on every server")
+	return selector
+}
+
+// Get the IDs of the selected servers, asking the API for the full list if
+// --all was given.
+func (s *serverSelector) resolve(app *app) ([]string, error) {
+	if s.all && len(s.ids) > 0 {
+		fmt.Fprintln(app.stderr, "--server and --all can't be used together")
+		return nil, errUsage
+	}
+
+	if !s.all {
+		if len(s.ids) == 0 {
+			fmt.Fprintln(app.stderr, "select servers with --server or --all")
+			return nil, errUsage
+		}
+		return s.ids, nil
+	}
+
+	servers, err := app.client.ListServers(app.ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []string{}
+	for _, server := range servers.Results {
+		ids = append(ids, server.Id)
+	}
+	return ids, nil
+}
+
+// Create the flag set for a command. Usage errors are reported by
+// returning errUsage from parse.
+func newFlags(app *app, cmd string, usage string) *flag.FlagSet {
+	flags := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	flags.SetOutput(app.stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(app.stderr, "Usage: dnsctl %s\n", usage)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// Parse the arguments of a command, checking that exactly count positional
+// arguments were given.
+func parse(app *app, flags *flag.FlagSet, args []string, count int) ([]string, error) {
+	positional, err := parseInterspersed(flags, args)
+	if err != nil {
+		return nil, errUsage
+	}
+
+	if len(positional) != count {
+		fmt.Fprintf(app.stderr, "expected %d arguments but got %d\n", count, len(positional))
+		flags.Usage()
+		return nil, errUsage
+	}
+
+	return positional, nil
+}
+
+func runServers(app *app, args []string) int {
+	flags := newFlags(app, "servers", "servers")
+	if _, err := parse(app, flags, args, 0); err != nil {
+		return app.fail(err)
+	}
+
+	servers, err := app.client.ListServers(app.ctx)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	err = app.print(servers, func(w io.Writer) {
+		fmt.Fprintln(w, "ID\tNAME\tTARGET")
+		for _, server := range servers.Results {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", server.Id, server.Name, server.Target)
+		}
+	})
+	if err != nil {
+		return app.fail(err)
+	}
+	return exitOk
+}
+
+// Format the data of a cached record as a single line
+func formatRData(data map[string]any) string {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = fmt.Sprintf("%s=%v", key, data[key])
+	}
+	return strings.Join(parts, " ")
+}
+
+func runCacheGet(app *app, args []string) int {
+	flags := newFlags(app, "cache get", "cache get [<domain>] (--server <id>... | --all) [--fresh] [--type <type>] [--depth <n>] [--match <pattern>]")
+	selector := addServerFlags(flags)
+	options := client.GetCacheOptions{}
+	flags.BoolVar(&options.Fresh, "fresh", false, "bypass the response cache of the API")
+	flags.StringVar(&options.Type, "type", "", "only include records of this type")
+	flags.IntVar(&options.Depth, "depth", 0, "number of levels of subdomains to include")
+	flags.StringVar(&options.Match, "match", "", "only include records with names matching this glob pattern")
+
+	positional, err := parseInterspersed(flags, args)
+	if err != nil {
+		return app.fail(errUsage)
+	}
+
+	// The domain may be left out when it can be worked out from --match
+	if len(positional) > 1 || len(positional) == 0 && options.Match == "" {
+		fmt.Fprintln(app.stderr, "expected a domain or --match")
+		flags.Usage()
+		return exitUsage
+	}
+	positional = append(positional, "")
+
+	servers, err := selector.resolve(app)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	cache, err := app.client.GetCache(app.ctx, positional[0], servers, options)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	err = app.print(cache, func(w io.Writer) {
+		fmt.Fprintln(w, "NAME\tTYPE\tSERVER\tTTL\tDATA")
+		for _, entry := range cache.Entries {
+			for _, result := range entry.CachedResult {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", entry.Name, entry.Type, result.Id, result.Ttl, formatRData(result.RData))
+			}
+		}
+	})
+	if err != nil {
+		return app.fail(err)
+	}
+
+	return app.partialExit(cache.Errors)
+}
+
+func runCacheDelete(app *app, args []string) int {
+	flags := newFlags(app, "cache delete", "cache delete <domain>... (--server <id>... | --all) [--file <path>] [--async]")
+	selector := addServerFlags(flags)
+	file := flags.String("file", "", "also delete the domains listed one per line in this file, or - for stdin")
+	async := flags.Bool("async", false, "start the deletion as a job rather than waiting for it")
+
+	domains, err := parseInterspersed(flags, args)
+	if err != nil {
+		return app.fail(errUsage)
+	}
+
+	if *file != "" {
+		var data []byte
+		if *file == "-" {
+			data, err = io.ReadAll(app.stdin)
+		} else {
+			data, err = os.ReadFile(*file)
+		}
+		if err != nil {
+			return app.fail(err)
+		}
+
+		for _, line := range strings.Split(string(data), "\n") {
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+				domains = append(domains, line)
+			}
+		}
+	}
+
+	if len(domains) == 0 {
+		fmt.Fprintln(app.stderr, "expected at least one domain")
+		flags.Usage()
+		return exitUsage
+	}
+
+	servers, err := selector.resolve(app)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	if len(domains) > 1 || *file != "" {
+		return runCacheDeleteMany(app, domains, servers, *async)
+	}
+
+	if *async {
+		job, err := app.client.DeleteCacheEntryAsync(app.ctx, domains[0], servers)
+		if err != nil {
+			return app.fail(err)
+		}
+		return app.printJob(job)
+	}
+
+	failed, err := app.client.DeleteCacheEntry(app.ctx, domains[0], servers)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	return app.printOperation(servers, failed)
+}
+
+// Delete several domains in a single bulk request
+func runCacheDeleteMany(app *app, domains []string, servers []string, async bool) int {
+	request := model.CacheDeleteRequest{Servers: servers}
+	for _, domain := range domains {
+		request.Domains = append(request.Domains, model.CacheDeleteDomain{Domain: domain})
+	}
+
+	if async {
+		job, err := app.client.DeleteCacheEntriesAsync(app.ctx, request)
+		if err != nil {
+			return app.fail(err)
+		}
+		return app.printJob(job)
+	}
+
+	deleted, err := app.client.DeleteCacheEntries(app.ctx, request)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	err = app.print(deleted, func(w io.Writer) {
+		fmt.Fprintln(w, "DOMAIN\tSERVER\tSTATUS\tMESSAGE")
+		for _, domain := range deleted.Domains {
+			for _, server := range domain.Servers {
+				status := "ok"
+				if !server.Deleted {
+					status = "failed"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", domain.Domain, server.Id, status, server.Message)
+			}
+		}
+	})
+	if err != nil {
+		return app.fail(err)
+	}
+
+	return app.partialExit(deleted.Errors)
+}
+
+func runCachePurge(app *app, args []string) int {
+	flags := newFlags(app, "cache purge", "cache purge [<domain>] (--server <id>... | --all) [--match <pattern>] [--depth <n>] [--dry-run]")
+	selector := addServerFlags(flags)
+	options := client.PurgeCacheOptions{}
+	flags.StringVar(&options.Match, "match", "", "only delete names matching this glob pattern")
+	depth := flags.Int("depth", -1, "number of levels of subdomains to walk when discovering names")
+	flags.BoolVar(&options.DryRun, "dry-run", false, "list the names that would be deleted without deleting them")
+
+	positional, err := parseInterspersed(flags, args)
+	if err != nil {
+		return app.fail(errUsage)
+	}
+
+	if len(positional) > 1 || len(positional) == 0 && options.Match == "" {
+		fmt.Fprintln(app.stderr, "expected a domain or --match")
+		flags.Usage()
+		return exitUsage
+	}
+	positional = append(positional, "")
+
+	if *depth >= 0 {
+		options.Depth = depth
+	}
+
+	servers, err := selector.resolve(app)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	purged, err := app.client.PurgeCache(app.ctx, positional[0], servers, options)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	err = app.print(purged, func(w io.Writer) {
+		fmt.Fprintln(w, "SERVER\tNAME")
+		for _, server := range purged.Servers {
+			for _, name := range server.Names {
+				fmt.Fprintf(w, "%s\t%s\n", server.Id, name)
+			}
+			for _, fail := range server.Failed {
+				fmt.Fprintf(w, "%s\t%s (failed: %s)\n", server.Id, fail.Name, fail.Message)
+			}
+		}
+	})
+	if err != nil {
+		return app.fail(err)
+	}
+
+	return app.partialExit(purged.Errors)
+}
+
+func runCacheFlush(app *app, args []string) int {
+	flags := newFlags(app, "cache flush", "cache flush (--server <id>... | --all) [--async]")
+	selector := addServerFlags(flags)
+	async := flags.Bool("async", false, "start the flush as a job rather than waiting for it")
+
+	if _, err := parse(app, flags, args, 0); err != nil {
+		return app.fail(err)
+	}
+
+	servers, err := selector.resolve(app)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	if *async {
+		job, err := app.client.FlushCacheAsync(app.ctx, servers)
+		if err != nil {
+			return app.fail(err)
+		}
+		return app.printJob(job)
+	}
+
+	failed, err := app.client.FlushCache(app.ctx, servers)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	return app.printOperation(servers, failed)
+}
+
+func runResolve(app *app, args []string) int {
+	flags := newFlags(app, "resolve", "resolve <name> [<type>] (--server <id>... | --all)")
+	selector := addServerFlags(flags)
+
+	positional, err := parseInterspersed(flags, args)
+	if err != nil {
+		return app.fail(errUsage)
+	}
+
+	if len(positional) == 0 || len(positional) > 2 {
+		fmt.Fprintln(app.stderr, "expected a name and optional type")
+		flags.Usage()
+		return exitUsage
+	}
+	positional = append(positional, "")
+
+	servers, err := selector.resolve(app)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	resolved, err := app.client.Resolve(app.ctx, positional[0], positional[1], servers)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	err = app.print(resolved, func(w io.Writer) {
+		fmt.Fprintln(w, "SERVER\tRCODE\tFLAGS\tLATENCY")
+		for _, server := range resolved.Servers {
+			latency := "-"
+			if server.LatencyMs != nil {
+				latency = fmt.Sprintf("%.2fms", *server.LatencyMs)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", server.Id, server.Rcode, strings.Join(server.Flags, " "), latency)
+		}
+
+		fmt.Fprintln(w, "\nNAME\tTYPE\tSERVER\tTTL\tDATA\tAGREED")
+		for _, answer := range resolved.Answers {
+			for _, result := range answer.ResolvedResult {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%t\n", answer.Name, answer.Type, result.Id, result.Ttl, formatRData(result.RData), answer.Agreed)
+			}
+		}
+	})
+	if err != nil {
+		return app.fail(err)
+	}
+
+	return app.partialExit(resolved.Errors)
+}
+
+func runZoneExport(app *app, args []string) int {
+	flags := newFlags(app, "zone export", "zone export <zone> --server <id>")
+	server := flags.String("server", "", "ID of the server to export the zone from")
+
+	positional, err := parse(app, flags, args, 1)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	if *server == "" {
+		fmt.Fprintln(app.stderr, "select a server with --server")
+		return exitUsage
+	}
+
+	zoneFile, err := app.client.ExportZone(app.ctx, positional[0], *server)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	// The zone file is printed as is whatever the output format
+	fmt.Fprint(app.stdout, zoneFile)
+	return exitOk
+}
+
+func runZoneImport(app *app, args []string) int {
+	flags := newFlags(app, "zone import", "zone import <zone> <file> (--server <id>... | --all) [--overwrite]")
+	selector := addServerFlags(flags)
+	overwrite := flags.Bool("overwrite", false, "replace existing records with the same name and type")
+
+	positional, err := parse(app, flags, args, 2)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	var zoneFile []byte
+	if positional[1] == "-" {
+		zoneFile, err = io.ReadAll(app.stdin)
+	} else {
+		zoneFile, err = os.ReadFile(positional[1])
+	}
+	if err != nil {
+		return app.fail(err)
+	}
+
+	servers, err := selector.resolve(app)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	failed, err := app.client.ImportZone(app.ctx, positional[0], string(zoneFile), servers, *overwrite)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	return app.printOperation(servers, failed)
+}
+
+func runApply(app *app, args []string) int {
+	flags := newFlags(app, "apply", "apply <file> [--dry-run]")
+	dryRun := flags.Bool("dry-run", false, "show the changes that would be made without making them")
+
+	positional, err := parse(app, flags, args, 1)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	var state []byte
+	if positional[0] == "-" {
+		state, err = io.ReadAll(app.stdin)
+	} else {
+		state, err = os.ReadFile(positional[0])
+	}
+	if err != nil {
+		return app.fail(err)
+	}
+
+	applied, err := app.client.Apply(app.ctx, state, *dryRun)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	err = app.print(applied, func(w io.Writer) {
+		printPlans(w, applied.Servers)
+	})
+	if err != nil {
+		return app.fail(err)
+	}
+
+	return app.partialExit(applied.Errors)
+}
+
+func runDrift(app *app, args []string) int {
+	flags := newFlags(app, "drift", "drift [--check]")
+	check := flags.Bool("check", false, "check for drift now rather than showing the last check")
+
+	if _, err := parse(app, flags, args, 0); err != nil {
+		return app.fail(err)
+	}
+
+	var drift *model.DriftResponse
+	var err error
+	if *check {
+		drift, err = app.client.CheckDrift(app.ctx)
+	} else {
+		drift, err = app.client.GetDrift(app.ctx)
+	}
+	if err != nil {
+		return app.fail(err)
+	}
+
+	if drift.Error != "" {
+		return app.fail(errors.New(drift.Error))
+	}
+
+	err = app.print(drift, func(w io.Writer) {
+		printPlans(w, drift.Servers)
+	})
+	if err != nil {
+		return app.fail(err)
+	}
+
+	return app.partialExit(drift.Errors)
+}
+
+// Print the changes planned for each server as a table
+func printPlans(w io.Writer, servers []model.ServerPlan) {
+	fmt.Fprintln(w, "SERVER\tACTION\tKIND\tNAME\tTYPE\tVALUES\tSTATUS")
+	for _, server := range servers {
+		for _, change := range server.Changes {
+			set := change.After
+			if set == nil {
+				set = change.Before
+			}
+
+			values, typ := "-", change.Type
+			if set != nil {
+				values = strings.Join(set.Values, ", ")
+			}
+			if typ == "" {
+				typ = "-"
+			}
+
+			status := change.Status
+			if change.Error != "" {
+				status += ": " + change.Error
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", server.Id, change.Action, change.Kind, change.Name, typ, values, status)
+		}
+	}
+}
+
+func runDnssecStatus(app *app, args []string) int {
+	flags := newFlags(app, "dnssec status", "dnssec status <zone> (--server <id>... | --all)")
+	selector := addServerFlags(flags)
+
+	positional, err := parse(app, flags, args, 1)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	servers, err := selector.resolve(app)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	status, err := app.client.GetDnssecStatus(app.ctx, positional[0], servers)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	err = app.print(status, func(w io.Writer) {
+		fmt.Fprintln(w, "SERVER\tSTATUS\tKEY TAG\tTYPE\tALGORITHM\tSTATE")
+		for _, server := range status.Servers {
+			if len(server.Keys) == 0 {
+				fmt.Fprintf(w, "%s\t%s\t-\t-\t-\t-\n", server.Id, server.Status)
+			}
+			for _, key := range server.Keys {
+				state := key.State
+				if key.Retiring {
+					state += " (retiring)"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\n", server.Id, server.Status, key.KeyTag, key.KeyType, key.Algorithm, state)
+			}
+		}
+	})
+	if err != nil {
+		return app.fail(err)
+	}
+
+	return app.partialExit(status.Errors)
+}
+
+func runDnssecDs(app *app, args []string) int {
+	flags := newFlags(app, "dnssec ds", "dnssec ds <zone> (--server <id>... | --all)")
+	selector := addServerFlags(flags)
+
+	positional, err := parse(app, flags, args, 1)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	servers, err := selector.resolve(app)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	records, err := app.client.GetDsRecords(app.ctx, positional[0], servers)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	err = app.print(records, func(w io.Writer) {
+		fmt.Fprintln(w, "RECORD\tSERVERS")
+		for _, record := range records.Records {
+			ids := make([]string, len(record.Servers))
+			for i, server := range record.Servers {
+				ids[i] = server.Id
+			}
+
+			presentation := record.Record
+			if presentation == "" {
+				presentation = fmt.Sprintf("%d %s %s %s", record.KeyTag, record.Algorithm, record.DigestType, record.Digest)
+			}
+			fmt.Fprintf(w, "%s\t%s\n", presentation, strings.Join(ids, ","))
+		}
+	})
+	if err != nil {
+		return app.fail(err)
+	}
+
+	if !records.Agreed && len(records.Errors) == 0 {
+		fmt.Fprintln(app.stderr, "warning: the servers do not publish the same DS records")
+	}
+	return app.partialExit(records.Errors)
+}
+
+func runStats(app *app, args []string) int {
+	flags := newFlags(app, "stats", "stats")
+	if _, err := parse(app, flags, args, 0); err != nil {
+		return app.fail(err)
+	}
+
+	stats, err := app.client.GetUpstreamStats(app.ctx)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	err = app.print(stats, func(w io.Writer) {
+		fmt.Fprintf(w, "Global limit\t%d\n", stats.GlobalLimit)
+		fmt.Fprintf(w, "Per request limit\t%d\n", stats.PerRequestLimit)
+		fmt.Fprintf(w, "Queued\t%d\n", stats.Queued)
+		fmt.Fprintf(w, "In flight\t%d\n", stats.InFlight)
+		fmt.Fprintf(w, "Completed\t%d\n", stats.Completed)
+		fmt.Fprintf(w, "Average wait\t%.2fms\n", stats.AverageWaitMs)
+		fmt.Fprintf(w, "Max wait\t%.2fms\n", stats.MaxWaitMs)
+	})
+	if err != nil {
+		return app.fail(err)
+	}
+	return exitOk
+}
+
+// Returned from the event handler once enough events have been shown
+var errEnoughEvents = errors.New("enough events")
+
+func runEvents(app *app, args []string) int {
+	flags := newFlags(app, "events", "events [--server id]... [--type type]... [--stats-interval seconds] [--count n]")
+	var servers, types stringList
+	flags.Var(&servers, "server", "only show events involving this server. May be repeated")
+	flags.Var(&types, "type", "only show events of this type. May be repeated")
+	statsInterval := flags.Int("stats-interval", 0, "seconds between statistics snapshots")
+	count := flags.Int("count", 0, "stop after this many events")
+
+	if _, err := parse(app, flags, args, 0); err != nil {
+		return app.fail(err)
+	}
+
+	// Follow the stream until interrupted rather than until the timeout
+	ctx := context.WithoutCancel(app.ctx)
+
+	shown := 0
+	err := app.client.StreamEvents(ctx, client.StreamEventsOptions{
+		Servers:       servers,
+		Types:         types,
+		StatsInterval: *statsInterval,
+	}, func(event model.Event) error {
+		if err := app.printEvent(event); err != nil {
+			return err
+		}
+
+		shown++
+		if *count > 0 && shown >= *count {
+			return errEnoughEvents
+		}
+		return nil
+	})
+	if errors.Is(err, errEnoughEvents) {
+		return exitOk
+	}
+	return app.fail(err)
+}
+
+func runJob(app *app, args []string) int {
+	flags := newFlags(app, "job", "job <id> [--wait | --cancel]")
+	wait := flags.Bool("wait", false, "wait for the job to finish")
+	cancel := flags.Bool("cancel", false, "cancel the job")
+
+	positional, err := parse(app, flags, args, 1)
+	if err != nil {
+		return app.fail(err)
+	}
+	if *wait && *cancel {
+		fmt.Fprintln(app.stderr, "--wait and --cancel can't be used together")
+		flags.Usage()
+		return exitUsage
+	}
+
+	var job *model.Job
+	switch {
+	case *wait:
+		job, err = app.client.WaitForJob(app.ctx, positional[0], time.Second)
+	case *cancel:
+		job, err = app.client.CancelJob(app.ctx, positional[0])
+	default:
+		job, err = app.client.GetJob(app.ctx, positional[0])
+	}
+	if err != nil {
+		return app.fail(err)
+	}
+
+	return app.printJob(job)
+}
+
+func runScheduleList(app *app, args []string) int {
+	flags := newFlags(app, "schedule list", "schedule list")
+	if _, err := parse(app, flags, args, 0); err != nil {
+		return app.fail(err)
+	}
+
+	schedules, err := app.client.ListSchedules(app.ctx)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	err = app.print(schedules, func(w io.Writer) {
+		fmt.Fprintln(w, "ID\tCRON\tOPERATION\tSERVERS\tNEXT RUN\tLAST STATUS")
+		for _, schedule := range schedules.Results {
+			servers := "all"
+			if len(schedule.Servers) > 0 {
+				servers = strings.Join(schedule.Servers, ",")
+			}
+			next := "never"
+			if schedule.NextRun != nil {
+				next = schedule.NextRun.Format(time.RFC3339)
+			}
+			last := "-"
+			if schedule.LastRun != nil {
+				last = schedule.LastRun.Status
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", schedule.Id, schedule.Cron, schedule.Operation, servers, next, last)
+		}
+	})
+	if err != nil {
+		return app.fail(err)
+	}
+	return exitOk
+}
+
+// Print runs of a schedule as a table, one line per failed server
+func printScheduleRuns(w io.Writer, runs []model.ScheduleRun) {
+	fmt.Fprintln(w, "STARTED\tDURATION\tMANUAL\tSTATUS\tSERVER\tMESSAGE")
+	for _, run := range runs {
+		prefix := fmt.Sprintf("%s\t%s\t%t\t%s", run.StartedAt.Format(time.RFC3339), run.FinishedAt.Sub(run.StartedAt).Round(time.Millisecond), run.Manual, run.Status)
+		switch {
+		case run.Failure == nil:
+			fmt.Fprintf(w, "%s\t\t\n", prefix)
+		case len(run.Failure.AffectedServers) == 0:
+			fmt.Fprintf(w, "%s\t\t%s\n", prefix, run.Failure.Message)
+		default:
+			for _, server := range run.Failure.AffectedServers {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", prefix, server.Id, server.Message)
+			}
+		}
+	}
+}
+
+func runScheduleRuns(app *app, args []string) int {
+	flags := newFlags(app, "schedule runs", "schedule runs <id>")
+	positional, err := parse(app, flags, args, 1)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	runs, err := app.client.GetScheduleRuns(app.ctx, positional[0])
+	if err != nil {
+		return app.fail(err)
+	}
+
+	err = app.print(runs, func(w io.Writer) {
+		printScheduleRuns(w, runs.Results)
+	})
+	if err != nil {
+		return app.fail(err)
+	}
+	return exitOk
+}
+
+func runScheduleRun(app *app, args []string) int {
+	flags := newFlags(app, "schedule run", "schedule run <id>")
+	positional, err := parse(app, flags, args, 1)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	run, err := app.client.RunSchedule(app.ctx, positional[0])
+	if err != nil {
+		return app.fail(err)
+	}
+
+	err = app.print(run, func(w io.Writer) {
+		printScheduleRuns(w, []model.ScheduleRun{*run})
+	})
+	if err != nil {
+		return app.fail(err)
+	}
+
+	switch run.Status {
+	case model.RunPartial:
+		return exitPartial
+	case model.RunFailed:
+		return exitError
+	}
+	return exitOk
+}
+
+func runDhcpScopes(app *app, args []string) int {
+	flags := newFlags(app, "dhcp scopes", "dhcp scopes (--server <id>... | --all)")
+	selector := addServerFlags(flags)
+
+	if _, err := parse(app, flags, args, 0); err != nil {
+		return app.fail(err)
+	}
+
+	servers, err := selector.resolve(app)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	scopes, err := app.client.ListDhcpScopes(app.ctx, servers)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	err = app.print(scopes, func(w io.Writer) {
+		fmt.Fprintln(w, "SERVER\tSCOPE\tENABLED\tRANGE\tSUBNET MASK")
+		for _, scope := range scopes.Scopes {
+			fmt.Fprintf(w, "%s\t%s\t%t\t%s-%s\t%s\n", scope.Server, scope.Name, scope.Enabled, scope.StartingAddress, scope.EndingAddress, scope.SubnetMask)
+		}
+	})
+	if err != nil {
+		return app.fail(err)
+	}
+
+	return app.partialExit(scopes.Errors)
+}
+
+func runDhcpSet(app *app, args []string) int {
+	flags := newFlags(app, "dhcp set", "dhcp set <scope> <file> (--server <id>... | --all)")
+	selector := addServerFlags(flags)
+
+	positional, err := parse(app, flags, args, 2)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	var data []byte
+	if positional[1] == "-" {
+		data, err = io.ReadAll(app.stdin)
+	} else {
+		data, err = os.ReadFile(positional[1])
+	}
+	if err != nil {
+		return app.fail(err)
+	}
+
+	var settings model.DhcpScopeSettings
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return app.fail(fmt.Errorf("invalid scope settings: %w", err))
+	}
+
+	servers, err := selector.resolve(app)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	failed, err := app.client.SetDhcpScope(app.ctx, positional[0], settings, servers)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	return app.printOperation(servers, failed)
+}
+
+// Run a change to a scope, or to a lease in it if lease is set, on the
+// selected servers
+func runDhcpChange(app *app, args []string, name string, lease bool, change func(scope string, lease string, servers []string) (*model.PerServerFail, error)) int {
+	usage, count := "dhcp "+name+" <scope> (--server <id>... | --all)", 1
+	if lease {
+		usage, count = "dhcp "+name+" <scope> <hardware address> (--server <id>... | --all)", 2
+	}
+	flags := newFlags(app, "dhcp "+name, usage)
+	selector := addServerFlags(flags)
+
+	positional, err := parse(app, flags, args, count)
+	if err != nil {
+		return app.fail(err)
+	}
+	positional = append(positional, "")
+
+	servers, err := selector.resolve(app)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	failed, err := change(positional[0], positional[1], servers)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	return app.printOperation(servers, failed)
+}
+
+func runDhcpEnable(app *app, args []string) int {
+	return runDhcpChange(app, args, "enable", false, func(scope string, _ string, servers []string) (*model.PerServerFail, error) {
+		return app.client.EnableDhcpScope(app.ctx, scope, servers)
+	})
+}
+
+func runDhcpDisable(app *app, args []string) int {
+	return runDhcpChange(app, args, "disable", false, func(scope string, _ string, servers []string) (*model.PerServerFail, error) {
+		return app.client.DisableDhcpScope(app.ctx, scope, servers)
+	})
+}
+
+func runDhcpReserve(app *app, args []string) int {
+	return runDhcpChange(app, args, "reserve", true, func(scope string, lease string, servers []string) (*model.PerServerFail, error) {
+		return app.client.ReserveDhcpLease(app.ctx, scope, lease, servers)
+	})
+}
+
+func runDhcpRemove(app *app, args []string) int {
+	return runDhcpChange(app, args, "remove", true, func(scope string, lease string, servers []string) (*model.PerServerFail, error) {
+		return app.client.RemoveDhcpLease(app.ctx, scope, lease, servers)
+	})
+}
+
+func runDhcpLeases(app *app, args []string) int {
+	flags := newFlags(app, "dhcp leases", "dhcp leases (--server <id>... | --all) [--scope <name>]")
+	selector := addServerFlags(flags)
+	scope := flags.String("scope", "", "only list leases from this scope")
+
+	if _, err := parse(app, flags, args, 0); err != nil {
+		return app.fail(err)
+	}
+
+	servers, err := selector.resolve(app)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	leases, err := app.client.ListDhcpLeases(app.ctx, *scope, servers)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	err = app.print(leases, func(w io.Writer) {
+		fmt.Fprintln(w, "SERVER\tSCOPE\tTYPE\tADDRESS\tHARDWARE ADDRESS\tHOST NAME\tEXPIRES")
+		for _, lease := range leases.Leases {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", lease.Server, lease.Scope, lease.Type, lease.Address, lease.HardwareAddress, lease.HostName, lease.LeaseExpires)
+		}
+	})
+	if err != nil {
+		return app.fail(err)
+	}
+
+	return app.partialExit(leases.Errors)
+}
+
+// Format a setting for a table. Strings are shown as they are and
+// anything else as JSON.
+func formatSetting(value any) string {
+	if value, ok := value.(string); ok {
+		return value
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
+
+func runSettingsGet(app *app, args []string) int {
+	flags := newFlags(app, "settings get", "settings get --server <id>")
+	server := flags.String("server", "", "ID of the server to get the settings of")
+
+	if _, err := parse(app, flags, args, 0); err != nil {
+		return app.fail(err)
+	}
+
+	if *server == "" {
+		fmt.Fprintln(app.stderr, "select a server with --server")
+		return exitUsage
+	}
+
+	settings, err := app.client.GetServerSettings(app.ctx, *server)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	err = app.print(settings, func(w io.Writer) {
+		keys := make([]string, 0, len(settings.Settings))
+		for key := range settings.Settings {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		fmt.Fprintln(w, "KEY\tVALUE")
+		for _, key := range keys {
+			fmt.Fprintf(w, "%s\t%s\n", key, formatSetting(settings.Settings[key]))
+		}
+	})
+	if err != nil {
+		return app.fail(err)
+	}
+
+	return exitOk
+}
+
+func runSettingsDiff(app *app, args []string) int {
+	flags := newFlags(app, "settings diff", "settings diff (--server <id>... | --all) [--key <key>]...")
+	selector := addServerFlags(flags)
+	var keys stringList
+	flags.Var(&keys, "key", "only compare this setting. May be repeated")
+
+	if _, err := parse(app, flags, args, 0); err != nil {
+		return app.fail(err)
+	}
+
+	servers, err := selector.resolve(app)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	diff, err := app.client.DiffSettings(app.ctx, keys, servers)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	err = app.print(diff, func(w io.Writer) {
+		fmt.Fprintln(w, "KEY\tSERVERS\tVALUE")
+		for _, difference := range diff.Differences {
+			for _, value := range difference.Values {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", difference.Key, strings.Join(value.Servers, ","), formatSetting(value.Value))
+			}
+		}
+	})
+	if err != nil {
+		return app.fail(err)
+	}
+
+	return app.partialExit(diff.Errors)
+}
+
+func runSettingsSet(app *app, args []string) int {
+	flags := newFlags(app, "settings set", "settings set <file> (--server <id>... | --all) [--async]")
+	selector := addServerFlags(flags)
+	async := flags.Bool("async", false, "start the change as a job rather than waiting for it")
+
+	positional, err := parse(app, flags, args, 1)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	var data []byte
+	if positional[0] == "-" {
+		data, err = io.ReadAll(app.stdin)
+	} else {
+		data, err = os.ReadFile(positional[0])
+	}
+	if err != nil {
+		return app.fail(err)
+	}
+
+	var settings map[string]any
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return app.fail(fmt.Errorf("invalid settings: %w", err))
+	}
+
+	servers, err := selector.resolve(app)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	if *async {
+		job, err := app.client.SetSettingsAsync(app.ctx, settings, servers)
+		if err != nil {
+			return app.fail(err)
+		}
+		return app.printJob(job)
+	}
+
+	failed, err := app.client.SetSettings(app.ctx, settings, servers)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	return app.printOperation(servers, failed)
+}
+
+func runForwardersList(app *app, args []string) int {
+	flags := newFlags(app, "forwarders list", "forwarders list (--server <id>... | --all)")
+	selector := addServerFlags(flags)
+
+	if _, err := parse(app, flags, args, 0); err != nil {
+		return app.fail(err)
+	}
+
+	servers, err := selector.resolve(app)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	forwarders, err := app.client.GetForwarders(app.ctx, servers)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	err = app.print(forwarders, func(w io.Writer) {
+		fmt.Fprintln(w, "DOMAIN\tPROTOCOL\tADDRESS\tSERVERS")
+		for _, rule := range forwarders.Rules {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", rule.Domain, rule.Protocol, rule.Address, strings.Join(rule.Servers, ","))
+		}
+	})
+	if err != nil {
+		return app.fail(err)
+	}
+
+	return app.partialExit(forwarders.Errors)
+}
+
+func runForwardersSet(app *app, args []string) int {
+	flags := newFlags(app, "forwarders set", "forwarders set [<address>...] --protocol <protocol> (--server <id>... | --all)")
+	selector := addServerFlags(flags)
+	protocol := flags.String("protocol", "", "protocol of the forwarders: Udp, Tcp, Tls, Https or Quic")
+
+	// Giving no addresses turns forwarding off
+	addresses, err := parseInterspersed(flags, args)
+	if err != nil {
+		return app.fail(errUsage)
+	}
+
+	servers, err := selector.resolve(app)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	failed, err := app.client.SetForwarders(app.ctx, model.ForwarderSettings{Protocol: *protocol, Forwarders: addresses}, servers)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	return app.printOperation(servers, failed)
+}
+
+func runForwardersSetZone(app *app, args []string) int {
+	flags := newFlags(app, "forwarders set-zone", "forwarders set-zone <zone> <address>... --protocol <protocol> (--server <id>... | --all)")
+	selector := addServerFlags(flags)
+	protocol := flags.String("protocol", "Udp", "protocol of the forwarders: Udp, Tcp, Tls, Https or Quic")
+
+	positional, err := parseInterspersed(flags, args)
+	if err != nil {
+		return app.fail(errUsage)
+	}
+
+	if len(positional) < 2 {
+		fmt.Fprintln(app.stderr, "expected a zone and at least one forwarder")
+		flags.Usage()
+		return exitUsage
+	}
+
+	servers, err := selector.resolve(app)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	forwarders := []model.Forwarder{}
+	for _, address := range positional[1:] {
+		forwarders = append(forwarders, model.Forwarder{Protocol: *protocol, Address: address})
+	}
+
+	failed, err := app.client.SetForwarderZone(app.ctx, positional[0], forwarders, servers)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	return app.printOperation(servers, failed)
+}
+
+func runForwardersDeleteZone(app *app, args []string) int {
+	flags := newFlags(app, "forwarders delete-zone", "forwarders delete-zone <zone> (--server <id>... | --all)")
+	selector := addServerFlags(flags)
+
+	positional, err := parse(app, flags, args, 1)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	servers, err := selector.resolve(app)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	failed, err := app.client.DeleteForwarderZone(app.ctx, positional[0], servers)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	return app.printOperation(servers, failed)
+}
+
+func runAppsList(app *app, args []string) int {
+	flags := newFlags(app, "apps list", "apps list (--server <id>... | --all)")
+	selector := addServerFlags(flags)
+
+	if _, err := parse(app, flags, args, 0); err != nil {
+		return app.fail(err)
+	}
+
+	servers, err := selector.resolve(app)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	apps, err := app.client.ListApps(app.ctx, servers)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	err = app.print(apps, func(w io.Writer) {
+		fmt.Fprintln(w, "NAME\tVERSION\tSERVERS")
+		for _, installed := range apps.Apps {
+			for _, version := range installed.Versions {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", installed.Name, version.Version, strings.Join(version.Servers, ","))
+			}
+			if len(installed.Missing) > 0 {
+				fmt.Fprintf(w, "%s\t-\t%s\n", installed.Name, strings.Join(installed.Missing, ","))
+			}
+		}
+	})
+	if err != nil {
+		return app.fail(err)
+	}
+
+	return app.partialExit(apps.Errors)
+}
+
+func runAppsInstall(app *app, args []string) int {
+	flags := newFlags(app, "apps install", "apps install <name> <file> (--server <id>... | --all)")
+	selector := addServerFlags(flags)
+
+	positional, err := parse(app, flags, args, 2)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	var archive []byte
+	if positional[1] == "-" {
+		archive, err = io.ReadAll(app.stdin)
+	} else {
+		archive, err = os.ReadFile(positional[1])
+	}
+	if err != nil {
+		return app.fail(err)
+	}
+
+	servers, err := selector.resolve(app)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	failed, err := app.client.InstallApp(app.ctx, positional[0], archive, servers)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	return app.printOperation(servers, failed)
+}
+
+func runAppsUninstall(app *app, args []string) int {
+	flags := newFlags(app, "apps uninstall", "apps uninstall <name> (--server <id>... | --all)")
+	selector := addServerFlags(flags)
+
+	positional, err := parse(app, flags, args, 1)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	servers, err := selector.resolve(app)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	failed, err := app.client.UninstallApp(app.ctx, positional[0], servers)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	return app.printOperation(servers, failed)
+}
+
+func runAppsConfig(app *app, args []string) int {
+	flags := newFlags(app, "apps config", "apps config <name> (--server <id>... | --all)")
+	selector := addServerFlags(flags)
+
+	positional, err := parse(app, flags, args, 1)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	servers, err := selector.resolve(app)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	configs, err := app.client.GetAppConfig(app.ctx, positional[0], servers)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	err = app.print(configs, func(w io.Writer) {
+		fmt.Fprintln(w, "SERVER\tCONFIG")
+		for _, config := range configs.Configs {
+			fmt.Fprintf(w, "%s\t%s\n", config.Server, config.Config)
+		}
+	})
+	if err != nil {
+		return app.fail(err)
+	}
+
+	return app.partialExit(configs.Errors)
+}
+
+func runAppsSetConfig(app *app, args []string) int {
+	flags := newFlags(app, "apps set-config", "apps set-config <name> <file> (--server <id>... | --all)")
+	selector := addServerFlags(flags)
+
+	positional, err := parse(app, flags, args, 2)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	var config []byte
+	if positional[1] == "-" {
+		config, err = io.ReadAll(app.stdin)
+	} else {
+		config, err = os.ReadFile(positional[1])
+	}
+	if err != nil {
+		return app.fail(err)
+	}
+
+	if !json.Valid(config) {
+		return app.fail(fmt.Errorf("invalid config: not valid JSON"))
+	}
+
+	servers, err := selector.resolve(app)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	failed, err := app.client.SetAppConfig(app.ctx, positional[0], config, servers)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	return app.printOperation(servers, failed)
+}
+
+// Write a backup archive to path, or to stdout if path is empty or -
+func writeArchive(app *app, path string, archive []byte) error {
+	if path == "" || path == "-" {
+		_, err := app.stdout.Write(archive)
+		return err
+	}
+	return os.WriteFile(path, archive, 0o600)
+}
+
+func runBackupCreate(app *app, args []string) int {
+	flags := newFlags(app, "backup create", "backup create <server> [--store] [--logs] [--file <path>]")
+	store := flags.Bool("store", false, "keep the backup on the service rather than downloading it")
+	logs := flags.Bool("logs", false, "include the query logs of the server")
+	file := flags.String("file", "", "file to write the backup to instead of stdout")
+
+	positional, err := parse(app, flags, args, 1)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	if *store {
+		backup, err := app.client.StoreBackup(app.ctx, positional[0], *logs)
+		if err != nil {
+			return app.fail(err)
+		}
+
+		err = app.print(backup, func(w io.Writer) {
+			fmt.Fprintln(w, "SERVER\tNAME\tSIZE\tCREATED")
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", backup.Server, backup.Name, backup.Size, backup.CreatedAt.Format(time.RFC3339))
+		})
+		if err != nil {
+			return app.fail(err)
+		}
+		return exitOk
+	}
+
+	archive, err := app.client.BackupServer(app.ctx, positional[0], *logs)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	if err := writeArchive(app, *file, archive); err != nil {
+		return app.fail(err)
+	}
+	return exitOk
+}
+
+func runBackupList(app *app, args []string) int {
+	flags := newFlags(app, "backup list", "backup list [--server <id>]")
+	server := flags.String("server", "", "only list the backups of this server")
+
+	if _, err := parse(app, flags, args, 0); err != nil {
+		return app.fail(err)
+	}
+
+	backups, err := app.client.ListBackups(app.ctx, *server)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	err = app.print(backups, func(w io.Writer) {
+		fmt.Fprintln(w, "SERVER\tNAME\tSIZE\tCREATED")
+		for _, backup := range backups.Results {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", backup.Server, backup.Name, backup.Size, backup.CreatedAt.Format(time.RFC3339))
+		}
+	})
+	if err != nil {
+		return app.fail(err)
+	}
+
+	return exitOk
+}
+
+func runBackupGet(app *app, args []string) int {
+	flags := newFlags(app, "backup get", "backup get <server> <name> [--file <path>]")
+	file := flags.String("file", "", "file to write the backup to instead of stdout")
+
+	positional, err := parse(app, flags, args, 2)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	archive, err := app.client.GetBackup(app.ctx, positional[0], positional[1])
+	if err != nil {
+		return app.fail(err)
+	}
+
+	if err := writeArchive(app, *file, archive); err != nil {
+		return app.fail(err)
+	}
+	return exitOk
+}
+
+func runBackupRestore(app *app, args []string) int {
+	flags := newFlags(app, "backup restore", "backup restore <server> <file> [--delete-existing] [--async]")
+	deleteExisting := flags.Bool("delete-existing", false, "delete files, such as zones, that aren't in the backup")
+	async := flags.Bool("async", false, "start the restore as a job rather than waiting for it")
+
+	positional, err := parse(app, flags, args, 2)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	var archive []byte
+	if positional[1] == "-" {
+		archive, err = io.ReadAll(app.stdin)
+	} else {
+		archive, err = os.ReadFile(positional[1])
+	}
+	if err != nil {
+		return app.fail(err)
+	}
+
+	if *async {
+		job, err := app.client.RestoreServerAsync(app.ctx, positional[0], archive, *deleteExisting)
+		if err != nil {
+			return app.fail(err)
+		}
+		return app.printJob(job)
+	}
+
+	failed, err := app.client.RestoreServer(app.ctx, positional[0], archive, *deleteExisting)
+	if err != nil {
+		return app.fail(err)
+	}
+
+	return app.printOperation([]string{positional[0]}, failed)
+}
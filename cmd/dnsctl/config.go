@@ -0,0 +1,75 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	yaml "github.com/goccy/go-yaml"
+)
+
+const (
+	defaultEndpoint = "http://localhost:3000"
+	defaultOutput   = "table"
+)
+
+type cliConfig struct {
+	Endpoint string `yaml:"endpoint"`
+	ApiKey   string `yaml:"api-key"`
+	Output   string `yaml:"output"`
+}
+
+func defaultConfigPath() string {
+	if path := os.Getenv("DNSCTL_CONFIG"); path != "" {
+		return path
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "dnsctl.yaml"
+	}
+	return filepath.Join(dir, "dnsctl", "config.yaml")
+}
+
+// Read the configuration file at path. A missing file is not an error as
+// every setting has a default or can be given on the command line.
+func loadConfig(path string) (*cliConfig, error) {
+	conf := &cliConfig{}
+
+	file, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	} else if err == nil {
+		if err := yaml.Unmarshal(file, conf); err != nil {
+			return nil, err
+		}
+	}
+
+	conf.override(os.Getenv("DNSCTL_ENDPOINT"), os.Getenv("DNSCTL_API_KEY"), "")
+
+	if conf.Endpoint == "" {
+		conf.Endpoint = defaultEndpoint
+	}
+	if conf.Output == "" {
+		conf.Output = defaultOutput
+	}
+
+	return conf, nil
+}
+
+// Replace settings with any that were given explicitly
+func (c *cliConfig) override(endpoint string, apiKey string, output string) {
+	if endpoint != "" {
+		c.Endpoint = endpoint
+	}
+	if apiKey != "" {
+		c.ApiKey = apiKey
+	}
+	if output != "" {
+		c.Output = output
+	}
+}
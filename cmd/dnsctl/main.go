@@ -0,0 +1,187 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+// dnsctl is a command line client for the dns-control API.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/SidingsMedia/unified-control-rdns/client"
+)
+
+const (
+	exitOk = iota
+	exitError
+	exitUsage
+	// The operation succeeded on some servers but failed on others
+	exitPartial
+)
+
+var errUsage = errors.New("usage")
+
+// State shared by every command
+type app struct {
+	ctx    context.Context
+	client *client.Client
+	output string
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+type command struct {
+	name        string
+	summary     string
+	subcommands []*command
+	run         func(app *app, args []string) int
+}
+
+// Parse flags that may appear before, after or between positional
+// arguments, returning the positional arguments in order.
+func parseInterspersed(flags *flag.FlagSet, args []string) ([]string, error) {
+	positional := []string{}
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+
+		if args[0] == "--" {
+			return append(positional, args[1:]...), nil
+		}
+
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func printUsage(w io.Writer, prefix string, commands []*command) {
+	fmt.Fprintf(w, "Usage: %s <command> [arguments]\n\nCommands:\n", prefix)
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-12s %s\n", cmd.name, cmd.summary)
+	}
+}
+
+// Find the command named by the first argument and run it, descending
+// into subcommands as required.
+func dispatch(app *app, prefix string, commands []*command, args []string) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		printUsage(app.stderr, prefix, commands)
+		if len(args) == 0 {
+			return exitUsage
+		}
+		return exitOk
+	}
+
+	for _, cmd := range commands {
+		if cmd.name != args[0] {
+			continue
+		}
+
+		if len(cmd.subcommands) > 0 {
+			return dispatch(app, prefix+" "+cmd.name, cmd.subcommands, args[1:])
+		}
+		return cmd.run(app, args[1:])
+	}
+
+	fmt.Fprintf(app.stderr, "unknown command %q\n\n", args[0])
+	printUsage(app.stderr, prefix, commands)
+	return exitUsage
+}
+
+func run(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("dnsctl", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+
+	configPath := flags.String("config", defaultConfigPath(), "path to dnsctl configuration file")
+	endpoint := flags.String("endpoint", "", "URL of the dns-control API")
+	apiKey := flags.String("api-key", "", "API key sent as a bearer token")
+	output := flags.String("output", "", "output format: table, json or yaml")
+	flags.StringVar(output, "o", "", "shorthand for -output")
+	timeout := flags.Duration("timeout", time.Minute, "how long to wait for the API to respond")
+
+	flags.Usage = func() {
+		printUsage(stderr, "dnsctl [flags]", commands)
+		fmt.Fprintln(stderr, "\nFlags:")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOk
+		}
+		return exitUsage
+	}
+
+	conf, err := loadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to read configuration: %v\n", err)
+		return exitError
+	}
+	conf.override(*endpoint, *apiKey, *output)
+
+	switch conf.Output {
+	case "table", "json", "yaml":
+	default:
+		fmt.Fprintf(stderr, "unknown output format %q\n", conf.Output)
+		return exitUsage
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	api := client.NewClient(conf.Endpoint, nil)
+	if conf.ApiKey != "" {
+		api.SetHeader("Authorization", "Bearer "+conf.ApiKey)
+	}
+
+	return dispatch(&app{
+		ctx:    ctx,
+		client: api,
+		output: conf.Output,
+		stdin:  os.Stdin,
+		stdout: stdout,
+		stderr: stderr,
+	}, "dnsctl", commands, flags.Args())
+}
+
+// Report an error from a command and pick the matching exit code
+func (a *app) fail(err error) int {
+	if errors.Is(err, errUsage) {
+		return exitUsage
+	}
+
+	var apiErr *client.Error
+	if errors.As(err, &apiErr) {
+		fmt.Fprintln(a.stderr, apiErr.Error())
+		for _, field := range apiErr.Fields {
+			fmt.Fprintf(a.stderr, "  %s: failed %s\n", field.Field, field.Condition)
+		}
+		for _, line := range apiErr.Lines {
+			fmt.Fprintf(a.stderr, "  line %d: %s\n", line.Line, line.Message)
+		}
+		for _, server := range apiErr.AffectedServers {
+			fmt.Fprintf(a.stderr, "  %s: %s\n", server.Id, server.Message)
+		}
+		return exitError
+	}
+
+	fmt.Fprintln(a.stderr, strings.TrimSpace(err.Error()))
+	return exitError
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
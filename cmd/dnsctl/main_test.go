@@ -0,0 +1,419 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SidingsMedia/unified-control-rdns/config"
+	"github.com/SidingsMedia/unified-control-rdns/server"
+	"github.com/SidingsMedia/unified-control-rdns/server/technetiumtest"
+	"github.com/gin-gonic/gin"
+)
+
+var fixture = technetiumtest.Fixture{
+	Cache: []technetiumtest.CacheRecord{
+		{Name: "example.com", Type: "A", Ttl: "300", RData: map[string]any{"ipAddress": "192.0.2.1"}},
+	},
+	Zones: []technetiumtest.Zone{{Name: "example.com", Type: "Primary", DnssecStatus: "SignedWithNSEC"}},
+	DnssecKeys: map[string][]technetiumtest.DnssecKey{
+		"example.com": {{KeyTag: 12345, KeyType: "KeySigningKey", Algorithm: "ECDSAP256SHA256", State: "Active", Digest: "ABCDEF"}},
+	},
+	DhcpScopes: []technetiumtest.DhcpScope{{Name: "Office", Enabled: true, StartingAddress: "192.168.1.100", EndingAddress: "192.168.1.200", SubnetMask: "255.255.255.0"}},
+	DhcpLeases: []technetiumtest.DhcpLease{{Scope: "Office", Type: "Dynamic", HardwareAddress: "00-11-22-33-44-55", Address: "192.168.1.120", HostName: "laptop"}},
+	Settings:   map[string]any{"enableBlocking": true, "forwarders": []any{"1.1.1.1"}, "forwarderProtocol": "Udp"},
+}
+
+// Start the API in front of two fake servers, a and b, and return the
+// flags needed to point dnsctl at it.
+func startApi(t *testing.T) (map[string]*technetiumtest.Server, []string) {
+	gin.SetMode(gin.TestMode)
+
+	fakes := map[string]*technetiumtest.Server{
+		"a": technetiumtest.NewServer(t, fixture),
+		"b": technetiumtest.NewServer(t, fixture),
+	}
+
+	engine := gin.New()
+	server.NewController(engine, server.NewService(server.NewRepository(
+		[]config.Server{fakes["a"].Config("a"), fakes["b"].Config("b")},
+		config.Concurrency{Global: 2, PerRequest: 2},
+	)), 0)
+
+	api := httptest.NewServer(engine)
+	t.Cleanup(api.Close)
+
+	return fakes, []string{"-config", t.TempDir() + "/missing.yaml", "-endpoint", api.URL}
+}
+
+func runCli(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestServers(t *testing.T) {
+	_, flags := startApi(t)
+
+	code, stdout, stderr := runCli(append(flags, "-o", "json", "servers")...)
+	if code != exitOk {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+
+	var servers struct {
+		Results []struct {
+			Id string `json:"id"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &servers); err != nil {
+		t.Fatal(err)
+	}
+	if len(servers.Results) != 2 {
+		t.Errorf("expected two servers, got %s", stdout)
+	}
+}
+
+func TestCacheGetPartialFailure(t *testing.T) {
+	fakes, flags := startApi(t)
+	fakes["b"].SetFailure(technetiumtest.Failure{StatusCode: http.StatusInternalServerError})
+
+	code, stdout, stderr := runCli(append(flags, "cache", "get", "example.com", "--all")...)
+	if code != exitPartial {
+		t.Fatalf("expected exit code %d, got %d: %s", exitPartial, code, stderr)
+	}
+
+	if !strings.Contains(stdout, "192.0.2.1") {
+		t.Errorf("expected results from a in output, got %s", stdout)
+	}
+	if !strings.Contains(stderr, "server b failed") {
+		t.Errorf("expected failure of b to be reported, got %s", stderr)
+	}
+}
+
+func TestCacheDelete(t *testing.T) {
+	fakes, flags := startApi(t)
+
+	code, stdout, stderr := runCli(append(flags, "-o", "yaml", "cache", "delete", "--server", "a", "example.com")...)
+	if code != exitOk {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+
+	if !strings.Contains(stdout, "succeeded:") || !strings.Contains(stdout, "- a") {
+		t.Errorf("unexpected output %s", stdout)
+	}
+	if names := fakes["a"].CachedNames(); len(names) != 0 {
+		t.Errorf("expected cache on a to be empty, got %v", names)
+	}
+	if names := fakes["b"].CachedNames(); len(names) != 1 {
+		t.Errorf("expected cache on b to be untouched, got %v", names)
+	}
+}
+
+func TestUsageErrors(t *testing.T) {
+	_, flags := startApi(t)
+
+	cases := [][]string{
+		{"cache", "get", "example.com"},
+		{"cache", "get", "--all"},
+		{"cache", "flush", "--all", "--server", "a"},
+		{"unknown"},
+	}
+
+	for _, args := range cases {
+		if code, _, _ := runCli(append(flags, args...)...); code != exitUsage {
+			t.Errorf("%v: expected exit code %d, got %d", args, exitUsage, code)
+		}
+	}
+}
+
+func TestDnssecDs(t *testing.T) {
+	_, flags := startApi(t)
+
+	code, stdout, stderr := runCli(append(flags, "dnssec", "ds", "example.com", "--all")...)
+	if code != exitOk {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+
+	if !strings.Contains(stdout, "example.com. IN DS 12345 13 2 ABCDEF  a,b") {
+		t.Errorf("expected a single record published by both servers, got %s", stdout)
+	}
+}
+
+func TestZoneImportReportsLines(t *testing.T) {
+	_, flags := startApi(t)
+
+	path := t.TempDir() + "/example.com.zone"
+	if err := os.WriteFile(path, []byte("www IN A 192.0.2.1\nbad IN A nope\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	code, _, stderr := runCli(append(flags, "zone", "import", "example.com", path, "--all")...)
+	if code != exitError {
+		t.Fatalf("expected exit code %d, got %d", exitError, code)
+	}
+	if !strings.Contains(stderr, "line 2:") {
+		t.Errorf("expected the invalid line to be reported, got %s", stderr)
+	}
+
+	code, stdout, stderr := runCli(append(flags, "zone", "import", "example.com", path[:len(path)-5]+".missing", "--all")...)
+	if code != exitError || stdout != "" {
+		t.Errorf("expected missing file to fail, got %d %s %s", code, stdout, stderr)
+	}
+}
+
+func TestApplyDryRun(t *testing.T) {
+	fakes, flags := startApi(t)
+
+	path := t.TempDir() + "/state.yaml"
+	state := `servers: [a]
+zones:
+  - name: example.com
+    records:
+      - name: www
+        type: A
+        values: [192.0.2.1]
+`
+	if err := os.WriteFile(path, []byte(state), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	code, stdout, stderr := runCli(append(flags, "apply", path, "--dry-run")...)
+	if code != exitOk {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+
+	if !strings.Contains(stdout, "a       create  record  www.example.com  A     192.0.2.1  planned") {
+		t.Errorf("expected the record to be planned, got %s", stdout)
+	}
+	if len(fakes["a"].Records("example.com")) != 0 {
+		t.Errorf("expected a dry run not to change anything")
+	}
+}
+
+func TestEvents(t *testing.T) {
+	_, flags := startApi(t)
+
+	done := make(chan struct{})
+	var code int
+	var stdout, stderr string
+	go func() {
+		defer close(done)
+		code, stdout, stderr = runCli(append(flags, "events", "--type", "cache.deleted", "--server", "a", "--count", "1")...)
+	}()
+
+	// Keep deleting until the stream has connected and seen one
+	for {
+		runCli(append(flags, "cache", "delete", "--server", "a", "example.com")...)
+		select {
+		case <-done:
+		case <-time.After(50 * time.Millisecond):
+			continue
+		}
+		break
+	}
+
+	if code != exitOk {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+	if !strings.Contains(stdout, "  cache.deleted  a  example.com\n") {
+		t.Errorf("expected the deletion to be shown, got %s", stdout)
+	}
+}
+
+func TestCacheFlushAsync(t *testing.T) {
+	fakes, flags := startApi(t)
+
+	code, stdout, stderr := runCli(append(flags, "-o", "json", "cache", "flush", "--all", "--async")...)
+	if code != exitOk {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+
+	var job struct {
+		Id string `json:"id"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &job); err != nil || job.Id == "" {
+		t.Fatalf("expected the job to be printed, got %s", stdout)
+	}
+
+	code, stdout, stderr = runCli(append(flags, "job", job.Id, "--wait")...)
+	if code != exitOk {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+	if !strings.Contains(stdout, "Status     succeeded") || !strings.Contains(stdout, "b       succeeded  1") {
+		t.Errorf("expected the job to have succeeded, got %s", stdout)
+	}
+	if names := fakes["b"].CachedNames(); len(names) != 0 {
+		t.Errorf("expected cache on b to be empty, got %v", names)
+	}
+}
+
+func TestCacheDeleteMany(t *testing.T) {
+	fakes, flags := startApi(t)
+
+	file := t.TempDir() + "/domains.txt"
+	if err := os.WriteFile(file, []byte("# stale names\nexample.com\n\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	code, stdout, stderr := runCli(append(flags, "-o", "json", "cache", "delete", "other.example", "--all", "--file", file)...)
+	if code != exitOk {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+
+	var deleted struct {
+		Deleted int `json:"deleted"`
+		Domains []struct {
+			Domain string `json:"domain"`
+		} `json:"domains"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &deleted); err != nil {
+		t.Fatal(err)
+	}
+	if deleted.Deleted != 4 || len(deleted.Domains) != 2 || deleted.Domains[1].Domain != "example.com" {
+		t.Errorf("expected both domains to be deleted from both servers, got %s", stdout)
+	}
+	if names := fakes["a"].CachedNames(); len(names) != 0 {
+		t.Errorf("expected cache on a to be empty, got %v", names)
+	}
+}
+
+func TestDhcpReserve(t *testing.T) {
+	_, flags := startApi(t)
+
+	code, _, stderr := runCli(append(flags, "dhcp", "reserve", "Office", "00-11-22-33-44-55", "--server", "a")...)
+	if code != exitOk {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+
+	code, stdout, stderr := runCli(append(flags, "dhcp", "leases", "--all", "--scope", "Office")...)
+	if code != exitOk {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+	if !strings.Contains(stdout, "a       Office  Reserved") || !strings.Contains(stdout, "b       Office  Dynamic") {
+		t.Errorf("expected the lease to be reserved on a alone, got %s", stdout)
+	}
+}
+
+func TestSettingsSetAndDiff(t *testing.T) {
+	_, flags := startApi(t)
+
+	path := t.TempDir() + "/settings.json"
+	if err := os.WriteFile(path, []byte(`{"forwarders": ["9.9.9.9", "149.112.112.112"]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	code, _, stderr := runCli(append(flags, "settings", "set", path, "--server", "a")...)
+	if code != exitOk {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+
+	code, stdout, stderr := runCli(append(flags, "settings", "diff", "--all")...)
+	if code != exitOk {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+	if !strings.Contains(stdout, "forwarders  a        [\"9.9.9.9\",\"149.112.112.112\"]") || !strings.Contains(stdout, "forwarders  b        [\"1.1.1.1\"]") {
+		t.Errorf("expected the forwarders of a and b to differ, got %s", stdout)
+	}
+	if strings.Contains(stdout, "enableBlocking") {
+		t.Errorf("expected settings that are the same to be left out, got %s", stdout)
+	}
+}
+
+func TestForwardersSetZone(t *testing.T) {
+	_, flags := startApi(t)
+
+	code, _, stderr := runCli(append(flags, "forwarders", "set-zone", "corp.example", "10.0.0.53", "10.0.1.53", "--server", "a")...)
+	if code != exitOk {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+
+	code, stdout, stderr := runCli(append(flags, "forwarders", "list", "--all")...)
+	if code != exitOk {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+	if !strings.Contains(stdout, ".             Udp       1.1.1.1    a,b") || !strings.Contains(stdout, "corp.example  Udp       10.0.1.53  a") {
+		t.Errorf("expected the global forwarders and the new zone, got %s", stdout)
+	}
+
+	code, _, stderr = runCli(append(flags, "forwarders", "set-zone", "corp.example", "10.0.0.53", "--protocol", "Doh", "--all")...)
+	if code != exitError || !strings.Contains(stderr, "protocol") {
+		t.Errorf("expected an invalid protocol to be rejected, got %d %s", code, stderr)
+	}
+}
+
+func TestAppsInstallAndConfig(t *testing.T) {
+	fakes, flags := startApi(t)
+
+	var archive bytes.Buffer
+	writer := zip.NewWriter(&archive)
+	file, _ := writer.Create("version.txt")
+	file.Write([]byte("2.1"))
+	writer.Close()
+	path := t.TempDir() + "/app.zip"
+	if err := os.WriteFile(path, archive.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	code, _, stderr := runCli(append(flags, "apps", "install", "Split Horizon", path, "--server", "a")...)
+	if code != exitOk {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+
+	code, stdout, stderr := runCli(append(flags, "apps", "list", "--all")...)
+	if code != exitOk {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+	if !strings.Contains(stdout, "Split Horizon  2.1      a") || !strings.Contains(stdout, "Split Horizon  -        b") {
+		t.Errorf("expected the app to be installed on a only, got %s", stdout)
+	}
+
+	config := t.TempDir() + "/config.json"
+	if err := os.WriteFile(config, []byte(`{"enabled": true}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	code, _, _ = runCli(append(flags, "apps", "set-config", "split horizon", config, "--all")...)
+	if code != exitPartial {
+		t.Errorf("expected setting the config to fail on b, got %d", code)
+	}
+	if app, _ := fakes["a"].App("Split Horizon"); app.Config == nil || *app.Config != `{"enabled": true}` {
+		t.Errorf("expected the config to be set on a, got %v", app.Config)
+	}
+}
+
+func TestBackupAndRestore(t *testing.T) {
+	fakes, flags := startApi(t)
+
+	settings := t.TempDir() + "/settings.json"
+	if err := os.WriteFile(settings, []byte(`{"enableBlocking": false}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if code, _, stderr := runCli(append(flags, "settings", "set", settings, "--server", "a")...); code != exitOk {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+
+	backup := t.TempDir() + "/a.zip"
+	if code, _, stderr := runCli(append(flags, "backup", "create", "a", "--file", backup)...); code != exitOk {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+
+	if code, _, stderr := runCli(append(flags, "backup", "restore", "b", backup)...); code != exitOk {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+	if value, _ := fakes["b"].Setting("enableBlocking"); value != false {
+		t.Errorf("expected b to be restored from the backup of a, got %v", value)
+	}
+
+	code, _, stderr := runCli(append(flags, "backup", "list")...)
+	if code != exitError || !strings.Contains(stderr, "no backup directory") {
+		t.Errorf("expected listing backups to fail without a backup directory, got %d %s", code, stderr)
+	}
+}
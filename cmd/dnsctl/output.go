@@ -0,0 +1,162 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/SidingsMedia/unified-control-rdns/server/model"
+	yaml "github.com/goccy/go-yaml"
+)
+
+// Print value in the selected output format. For table output, table is
+// called to write the rows with columns separated by tabs.
+func (a *app) print(value any, table func(w io.Writer)) error {
+	switch a.output {
+	case "json":
+		encoder := json.NewEncoder(a.stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	case "yaml":
+		// Go through JSON so that field names match the API
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		converted, err := yaml.JSONToYAML(encoded)
+		if err != nil {
+			return err
+		}
+		_, err = a.stdout.Write(converted)
+		return err
+	default:
+		w := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+		table(w)
+		return w.Flush()
+	}
+}
+
+// Print a single event as it arrives. JSON output has one event per line
+// and YAML output one document per event.
+func (a *app) printEvent(event model.Event) error {
+	switch a.output {
+	case "json":
+		return json.NewEncoder(a.stdout).Encode(event)
+	case "yaml":
+		if _, err := io.WriteString(a.stdout, "---\n"); err != nil {
+			return err
+		}
+		return a.print(event, nil)
+	}
+
+	ids := []string{}
+	for _, server := range event.Servers {
+		ids = append(ids, server.Id)
+	}
+
+	detail := event.Domain
+	if event.Stats != nil {
+		detail = fmt.Sprintf("queued=%d inFlight=%d completed=%d", event.Stats.Queued, event.Stats.InFlight, event.Stats.Completed)
+	}
+	if event.Failure != nil {
+		for _, server := range event.Failure.AffectedServers {
+			detail = strings.TrimSpace(fmt.Sprintf("%s failed %s: %s", detail, server.Id, server.Message))
+		}
+	}
+
+	_, err := fmt.Fprintf(a.stdout, "%s  %s  %s  %s\n", event.Time.Format(time.RFC3339), event.Type, strings.Join(ids, ","), detail)
+	return err
+}
+
+// Print the progress of a job and return the exit code to use
+func (a *app) printJob(job *model.Job) int {
+	err := a.print(job, func(w io.Writer) {
+		fmt.Fprintf(w, "Job\t%s\n", job.Id)
+		fmt.Fprintf(w, "Operation\t%s\n", job.Operation)
+		fmt.Fprintf(w, "Status\t%s\n\n", job.Status)
+		fmt.Fprintln(w, "SERVER\tSTATUS\tREQUESTS\tMESSAGE")
+		for _, server := range job.Servers {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", server.Id, server.Status, server.Requests, server.Message)
+		}
+	})
+	if err != nil {
+		return a.fail(err)
+	}
+
+	switch job.Status {
+	case model.JobPartial:
+		return exitPartial
+	case model.JobFailed, model.JobCancelled:
+		return exitError
+	}
+	return exitOk
+}
+
+// Result of an operation performed on several servers
+type operationResult struct {
+	Succeeded []string               `json:"succeeded"`
+	Failed    []model.AffectedServer `json:"failed"`
+}
+
+func newOperationResult(servers []string, failed *model.PerServerFail) operationResult {
+	result := operationResult{Succeeded: []string{}, Failed: []model.AffectedServer{}}
+	if failed != nil {
+		result.Failed = failed.AffectedServers
+	}
+
+	for _, server := range servers {
+		ok := true
+		for _, failure := range result.Failed {
+			if failure.Id == server {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			result.Succeeded = append(result.Succeeded, server)
+		}
+	}
+
+	return result
+}
+
+// Print the outcome of an operation performed on several servers and
+// return the exit code to use.
+func (a *app) printOperation(servers []string, failed *model.PerServerFail) int {
+	result := newOperationResult(servers, failed)
+
+	err := a.print(result, func(w io.Writer) {
+		fmt.Fprintln(w, "SERVER\tSTATUS\tMESSAGE")
+		for _, server := range result.Succeeded {
+			fmt.Fprintf(w, "%s\tok\t\n", server)
+		}
+		for _, server := range result.Failed {
+			fmt.Fprintf(w, "%s\tfailed\t%s\n", server.Id, server.Message)
+		}
+	})
+	if err != nil {
+		return a.fail(err)
+	}
+
+	return a.partialExit(result.Failed)
+}
+
+// Report servers that failed on stderr and pick the exit code
+func (a *app) partialExit(failed []model.AffectedServer) int {
+	if len(failed) == 0 {
+		return exitOk
+	}
+
+	if a.output == "table" {
+		for _, server := range failed {
+			fmt.Fprintf(a.stderr, "server %s failed: %s\n", server.Id, server.Message)
+		}
+	}
+	return exitPartial
+}
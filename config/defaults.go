@@ -3,8 +3,32 @@
 
 package config
 
+import "time"
+
 const (
-	DefaultBindAddr = "[::]:3000"
+	DefaultBindAddr       = "[::]:3000"
+	DefaultRequestTimeout = 30 * time.Second
+
+	DefaultGlobalConcurrency     = 32
+	DefaultPerRequestConcurrency = 8
+
+	DefaultProbeInterval = time.Minute
+	DefaultProbeTimeout  = 5 * time.Second
+	DefaultCanaryType    = "A"
+
+	DefaultDriftInterval = 5 * time.Minute
+
+	DefaultHealthInterval    = 30 * time.Second
+	DefaultWebhookRetries    = 3
+	DefaultWebhookRetryDelay = time.Second
+	DefaultWebhookTimeout    = 10 * time.Second
+
+	DefaultJobTimeout   = 10 * time.Minute
+	DefaultJobRetention = time.Hour
+
+	DefaultScheduleTimeout = 5 * time.Minute
+
+	DefaultBackupRetention = 7
 )
 
 var (
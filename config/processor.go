@@ -4,11 +4,15 @@
 package config
 
 import (
+	"fmt"
 	"log/slog"
+	"net/url"
 	"os"
+	"strings"
 
 	yaml "github.com/goccy/go-yaml"
 	"github.com/jinzhu/copier"
+	"github.com/miekg/dns"
 )
 
 func populateDefaults(config *ConfigFile) {
@@ -19,12 +23,106 @@ func populateDefaults(config *ConfigFile) {
 	if config.BindAddr == "" {
 		config.BindAddr = DefaultBindAddr
 	}
+
+	if config.RequestTimeout == 0 {
+		config.RequestTimeout = DefaultRequestTimeout
+	}
+
+	if config.Concurrency.Global <= 0 {
+		config.Concurrency.Global = DefaultGlobalConcurrency
+	}
+
+	if config.Concurrency.PerRequest <= 0 {
+		config.Concurrency.PerRequest = DefaultPerRequestConcurrency
+	}
+
+	if config.Probes.Interval <= 0 {
+		config.Probes.Interval = DefaultProbeInterval
+	}
+
+	if config.Probes.Timeout <= 0 {
+		config.Probes.Timeout = DefaultProbeTimeout
+	}
+
+	for i := range config.Probes.Canaries {
+		if config.Probes.Canaries[i].Type == "" {
+			config.Probes.Canaries[i].Type = DefaultCanaryType
+		}
+	}
+
+	if config.Drift.Interval <= 0 {
+		config.Drift.Interval = DefaultDriftInterval
+	}
+
+	if config.Notifications.HealthInterval <= 0 {
+		config.Notifications.HealthInterval = DefaultHealthInterval
+	}
+
+	for i := range config.Notifications.Webhooks {
+		webhook := &config.Notifications.Webhooks[i]
+		if webhook.Retries == nil {
+			retries := DefaultWebhookRetries
+			webhook.Retries = &retries
+		}
+		if webhook.RetryDelay <= 0 {
+			webhook.RetryDelay = DefaultWebhookRetryDelay
+		}
+		if webhook.Timeout <= 0 {
+			webhook.Timeout = DefaultWebhookTimeout
+		}
+	}
+
+	if config.Jobs.Timeout <= 0 {
+		config.Jobs.Timeout = DefaultJobTimeout
+	}
+
+	if config.Jobs.Retention <= 0 {
+		config.Jobs.Retention = DefaultJobRetention
+	}
+
+	for i := range config.Schedules {
+		if config.Schedules[i].Timeout <= 0 {
+			config.Schedules[i].Timeout = DefaultScheduleTimeout
+		}
+	}
+
+	if config.Backups.Retention <= 0 {
+		config.Backups.Retention = DefaultBackupRetention
+	}
+}
+
+// Check the parts of the config that can't be checked when they are used
+// without failing part way through running
+func validate(config *ConfigFile) error {
+	for i, canary := range config.Probes.Canaries {
+		if _, ok := dns.StringToType[strings.ToUpper(canary.Type)]; !ok {
+			return fmt.Errorf("probes.canaries[%d].type: unknown record type %q", i, canary.Type)
+		}
+	}
+
+	for i, webhook := range config.Notifications.Webhooks {
+		field := fmt.Sprintf("notifications.webhooks[%d]", i)
+
+		target, err := url.Parse(webhook.Url)
+		if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+			return fmt.Errorf("%s.url: %q is not an http or https URL", field, webhook.Url)
+		}
+
+		if webhook.Retries != nil && *webhook.Retries < 0 {
+			return fmt.Errorf("%s.retries: must not be negative", field)
+		}
+	}
+
+	return nil
 }
 
 func logSanitized(config ConfigFile) {
 	for i := range config.Servers {
 		config.Servers[i].Token = "***"
 	}
+	for i := range config.Notifications.Webhooks {
+		config.Notifications.Webhooks[i].Secret = "***"
+	}
 	slog.Info("Read config file", "config", config)
 }
 
@@ -42,6 +140,10 @@ func ReadConfigFile(path string) (*ConfigFile, error) {
 	}
 
 	populateDefaults(&config)
+	if err := validate(&config); err != nil {
+		return nil, err
+	}
+
 	var sanitized ConfigFile
 	copier.CopyWithOption(&sanitized, config, copier.Option{DeepCopy: true})
 	logSanitized(sanitized)
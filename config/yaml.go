@@ -3,16 +3,111 @@
 
 package config
 
+import "time"
+
+type DnsAddress struct {
+	Address            string `yaml:"address"`
+	Tls                string `yaml:"tls"`
+	Https              string `yaml:"https"`
+	TlsServerName      string `yaml:"tls-server-name"`
+	InsecureSkipVerify bool   `yaml:"insecure-skip-verify"`
+}
+
 type Server struct {
-	Target string `yaml:"target"`
-	Name   string `yaml:"name"`
-	Token  string `yaml:"token"`
-	Id     string `yaml:"id"`
+	Target string      `yaml:"target"`
+	Name   string      `yaml:"name"`
+	Token  string      `yaml:"token"`
+	Id     string      `yaml:"id"`
+	Dns    *DnsAddress `yaml:"dns"`
+}
+
+type Canary struct {
+	Name   string   `yaml:"name"`
+	Type   string   `yaml:"type"`
+	Expect []string `yaml:"expect"`
+}
+
+type Probes struct {
+	Interval time.Duration `yaml:"interval"`
+	Timeout  time.Duration `yaml:"timeout"`
+	Canaries []Canary      `yaml:"canaries"`
+}
+
+type Drift struct {
+	// Directory of desired state files. Drift is only checked if set.
+	Directory string        `yaml:"directory"`
+	Interval  time.Duration `yaml:"interval"`
+}
+
+type Webhook struct {
+	Url string `yaml:"url"`
+	// Key used to sign the body of each request with HMAC-SHA256
+	Secret string `yaml:"secret"`
+	// Types of event to send. Every type is sent if empty.
+	Events []string `yaml:"events"`
+	// Number of times a failed delivery is retried. Nil uses
+	// DefaultWebhookRetries, while zero turns retrying off.
+	Retries *int `yaml:"retries"`
+	// Delay before the first retry, doubling for each one after
+	RetryDelay time.Duration `yaml:"retry-delay"`
+	Timeout    time.Duration `yaml:"timeout"`
+}
+
+type Notifications struct {
+	// How often each server's API is checked to see if it's answering
+	HealthInterval time.Duration `yaml:"health-interval"`
+	Webhooks       []Webhook     `yaml:"webhooks"`
+}
+
+type Jobs struct {
+	// Longest a job may run before it is cancelled
+	Timeout time.Duration `yaml:"timeout"`
+	// How long a finished job is kept for
+	Retention time.Duration `yaml:"retention"`
+}
+
+type Schedule struct {
+	Id string `yaml:"id"`
+	// Standard five field cron expression, or a macro such as @daily
+	Cron string `yaml:"cron"`
+	// One of cache.delete, cache.flush, blocklist.refresh, zone.sync or
+	// backup
+	Operation string `yaml:"operation"`
+	// Servers to run the operation on. Every server if empty.
+	Servers []string `yaml:"servers"`
+	// Domains to delete from the cache for cache.delete
+	Domains []string `yaml:"domains"`
+	// Secondary or stub zones to sync for zone.sync
+	Zones []string `yaml:"zones"`
+	// Longest a run may take before it is cancelled
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+type Backups struct {
+	// Directory backups are stored in. Backups can only be stored if set.
+	Directory string `yaml:"directory"`
+	// Number of backups kept for each server, after which the oldest are
+	// deleted
+	Retention int `yaml:"retention"`
+}
+
+type Concurrency struct {
+	Global     int `yaml:"global"`
+	PerRequest int `yaml:"per-request"`
 }
 
 type ConfigFile struct {
-	Servers        []Server `yaml:"servers"`
-	BindAddr       string   `yaml:"bind"`
-	TrustedProxies []string `yaml:"trusted-proxies"`
-	Debug          bool     `yaml:"debug"`
+	Servers          []Server      `yaml:"servers"`
+	BindAddr         string        `yaml:"bind"`
+	TrustedProxies   []string      `yaml:"trusted-proxies"`
+	Debug            bool          `yaml:"debug"`
+	RequestTimeout   time.Duration `yaml:"request-timeout"`
+	Concurrency      Concurrency   `yaml:"concurrency"`
+	ResponseCacheTtl time.Duration `yaml:"response-cache-ttl"`
+	Probes           Probes        `yaml:"probes"`
+	Drift            Drift         `yaml:"drift"`
+	Notifications    Notifications `yaml:"notifications"`
+	Jobs             Jobs          `yaml:"jobs"`
+	Schedules        []Schedule    `yaml:"schedules"`
+	Backups          Backups       `yaml:"backups"`
 }
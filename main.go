@@ -4,6 +4,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log/slog"
@@ -11,6 +12,10 @@ import (
 
 	"github.com/SidingsMedia/unified-control-rdns/config"
 	"github.com/SidingsMedia/unified-control-rdns/server"
+	"github.com/SidingsMedia/unified-control-rdns/server/events"
+	"github.com/SidingsMedia/unified-control-rdns/server/jobs"
+	"github.com/SidingsMedia/unified-control-rdns/server/notify"
+	"github.com/SidingsMedia/unified-control-rdns/server/probe"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	sloggin "github.com/samber/slog-gin"
@@ -55,13 +60,43 @@ func main() {
 	engine.Use(sloggin.New(slog.Default()))
 	engine.Use(gin.Recovery())
 	engine.Use(cors.Default())
+	engine.Use(server.RequestTimeout(conf.RequestTimeout))
 
-	server.NewController(
-		engine,
-		server.NewService(
-			server.NewRepository(conf.Servers),
-		),
-	)
+	repository := server.NewRepository(conf.Servers, conf.Concurrency)
+	if conf.ResponseCacheTtl > 0 {
+		repository = server.NewCachingRepository(repository, conf.ResponseCacheTtl)
+	}
+
+	prober := probe.NewProber(conf.Servers, conf.Probes)
+	go prober.Run(context.Background())
+
+	bus := events.NewBus()
+	go server.NewHealthMonitor(repository, conf.Notifications.HealthInterval, bus).Run(context.Background())
+	notifier, err := notify.NewNotifier(conf.Notifications)
+	if err != nil {
+		slog.Error("Invalid notifications", "error", err)
+		return
+	}
+	notifier.Start(context.Background(), bus)
+
+	reconciler := server.NewDriftReconciler(conf.Drift)
+
+	backups := server.NewBackupStore(conf.Backups, conf.Servers)
+	scheduler, err := server.NewScheduler(repository, conf.Schedules, backups)
+	if err != nil {
+		slog.Error("Invalid schedules", "error", err)
+		return
+	}
+
+	service := server.NewService(repository, server.WithProber(prober), server.WithDriftReconciler(reconciler), server.WithEvents(bus), server.WithJobs(jobs.NewManager(conf.Jobs)), server.WithScheduler(scheduler), server.WithBackups(backups))
+	if reconciler != nil {
+		go reconciler.Run(context.Background())
+	}
+	if scheduler != nil {
+		go scheduler.Run(context.Background())
+	}
+
+	server.NewController(engine, service, conf.ResponseCacheTtl)
 
 	// Set trusted proxies. If user has set it to * then we can just
 	// ignore it as GIN trusts all by default
@@ -0,0 +1,231 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package server
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SidingsMedia/unified-control-rdns/config"
+	"github.com/SidingsMedia/unified-control-rdns/server/model"
+)
+
+// Layout of the time a backup was taken in its file name, chosen so that
+// the names sort in the order the backups were taken
+const backupTimeFormat = "20060102T150405.000Z"
+
+// Stores backups of the servers in a directory, with a subdirectory for
+// each server, keeping only the newest backups of each
+type BackupStore struct {
+	directory string
+	retention int
+	// IDs of the configured servers, in the order they are configured
+	servers []string
+
+	// Held while a saved backup is moved into place so that two saves
+	// don't prune at the same time
+	mu sync.Mutex
+}
+
+// File name of a backup taken at taken
+func backupName(taken time.Time) string {
+	return taken.UTC().Format(backupTimeFormat) + ".zip"
+}
+
+// Get the time a backup was taken from its file name. Only names in the
+// form given by backupName are valid.
+func parseBackupName(name string) (time.Time, bool) {
+	stamp, ok := strings.CutSuffix(name, ".zip")
+	if !ok {
+		return time.Time{}, false
+	}
+
+	taken, err := time.Parse(backupTimeFormat, stamp)
+	return taken, err == nil
+}
+
+// Directory holding the backups of server. ErrServerNotFound is returned
+// for servers that aren't configured so that the id of a request can't
+// name a directory outside the store.
+func (b *BackupStore) serverDirectory(server string) (string, error) {
+	if !slices.Contains(b.servers, server) {
+		return "", ErrServerNotFound
+	}
+	return filepath.Join(b.directory, url.PathEscape(server)), nil
+}
+
+// Store a backup of server taken at taken, read from archive, and delete
+// the oldest backups of the server past the retention
+func (b *BackupStore) Save(server string, archive io.Reader, taken time.Time) (model.Backup, error) {
+	directory, err := b.serverDirectory(server)
+	if err != nil {
+		return model.Backup{}, err
+	}
+	if err := os.MkdirAll(directory, 0o750); err != nil {
+		return model.Backup{}, err
+	}
+
+	// Written to a temporary file first so that a partly written backup is
+	// never listed
+	file, err := os.CreateTemp(directory, ".backup-*")
+	if err != nil {
+		return model.Backup{}, err
+	}
+	defer os.Remove(file.Name())
+
+	size, err := io.Copy(file, archive)
+	if err != nil {
+		file.Close()
+		return model.Backup{}, err
+	}
+	if err := file.Close(); err != nil {
+		return model.Backup{}, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Backups taken within the same millisecond are moved on so that none
+	// is overwritten
+	name := backupName(taken)
+	for {
+		if _, err := os.Stat(filepath.Join(directory, name)); errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		taken = taken.Add(time.Millisecond)
+		name = backupName(taken)
+	}
+	if err := os.Rename(file.Name(), filepath.Join(directory, name)); err != nil {
+		return model.Backup{}, err
+	}
+
+	backups, err := b.list(server)
+	if err != nil {
+		return model.Backup{}, err
+	}
+	for _, old := range backups[min(len(backups), b.retention):] {
+		if err := os.Remove(filepath.Join(directory, old.Name)); err != nil {
+			slog.Error("Failed to delete old backup", "server", server, "name", old.Name, "error", err)
+		}
+	}
+
+	created, _ := parseBackupName(name)
+	return model.Backup{Server: server, Name: name, Size: size, CreatedAt: created}, nil
+}
+
+// Backups of a single server, newest first
+func (b *BackupStore) list(server string) ([]model.Backup, error) {
+	directory, err := b.serverDirectory(server)
+	if err != nil {
+		return nil, err
+	}
+
+	backups := []model.Backup{}
+	entries, err := os.ReadDir(directory)
+	if errors.Is(err, fs.ErrNotExist) {
+		return backups, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		created, ok := parseBackupName(entry.Name())
+		if !ok || !entry.Type().IsRegular() {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		backups = append(backups, model.Backup{Server: server, Name: entry.Name(), Size: info.Size(), CreatedAt: created})
+	}
+
+	slices.SortFunc(backups, func(a model.Backup, b model.Backup) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	return backups, nil
+}
+
+// Backups of server, or of every configured server if server is empty,
+// newest first
+func (b *BackupStore) List(server string) ([]model.Backup, error) {
+	if server != "" {
+		return b.list(server)
+	}
+
+	backups := []model.Backup{}
+	for _, server := range b.servers {
+		serverBackups, err := b.list(server)
+		if err != nil {
+			return nil, err
+		}
+		backups = append(backups, serverBackups...)
+	}
+
+	slices.SortStableFunc(backups, func(a model.Backup, b model.Backup) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	return backups, nil
+}
+
+// Open a stored backup of server for reading, returning its size along
+// with it. ErrBackupNotFound is returned if there is no backup with the
+// name.
+func (b *BackupStore) Open(server string, name string) (io.ReadCloser, int64, error) {
+	directory, err := b.serverDirectory(server)
+	if err != nil {
+		return nil, 0, err
+	}
+	if _, ok := parseBackupName(name); !ok {
+		return nil, 0, ErrBackupNotFound
+	}
+
+	file, err := os.Open(filepath.Join(directory, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, 0, ErrBackupNotFound
+	} else if err != nil {
+		return nil, 0, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	return file, info.Size(), nil
+}
+
+// Create a store for the backups of servers in backups.Directory. Nil is
+// returned if no directory is configured.
+func NewBackupStore(backups config.Backups, servers []config.Server) *BackupStore {
+	if backups.Directory == "" {
+		return nil
+	}
+
+	retention := backups.Retention
+	if retention <= 0 {
+		retention = config.DefaultBackupRetention
+	}
+
+	ids := make([]string, len(servers))
+	for i, server := range servers {
+		ids[i] = server.Id
+	}
+
+	return &BackupStore{
+		directory: backups.Directory,
+		retention: retention,
+		servers:   ids,
+	}
+}
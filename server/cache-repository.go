@@ -0,0 +1,196 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package server
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SidingsMedia/unified-control-rdns/server/domain"
+)
+
+type freshReadKey struct{}
+
+// Mark ctx so that reads made with it skip the response cache and always
+// go to the Technetium servers. The fresh results are still stored for
+// later reads.
+func WithFreshRead(ctx context.Context) context.Context {
+	return context.WithValue(ctx, freshReadKey{}, true)
+}
+
+func isFreshRead(ctx context.Context) bool {
+	fresh, _ := ctx.Value(freshReadKey{}).(bool)
+	return fresh
+}
+
+type responseCacheKey struct {
+	operation string
+	params    string
+	server    string
+}
+
+type responseCacheEntry struct {
+	value   any
+	expires time.Time
+}
+
+// Repository that keeps the results of reads in memory for a short time so
+// that clients polling the API don't cause a request to every Technetium
+// server each time. Results are cached per server so that a read against
+// several servers only needs to ask the ones without a cached result.
+// Methods that are not cached are passed straight through to the wrapped
+// repository.
+type cachingRepository struct {
+	Repository
+
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[responseCacheKey]responseCacheEntry
+	// Bumped for a server each time its cached results are invalidated so
+	// that a read which was in flight at the time isn't stored
+	generations map[string]uint64
+}
+
+func (r *cachingRepository) get(key responseCacheKey) (any, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, exists := r.entries[key]
+	if !exists {
+		return nil, false
+	}
+
+	if time.Now().After(entry.expires) {
+		delete(r.entries, key)
+		return nil, false
+	}
+
+	return entry.value, true
+}
+
+// Current generation of the cached results for server
+func (r *cachingRepository) generation(server string) uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.generations[server]
+}
+
+// Cache a result that was fetched while the server was at generation. The
+// result is dropped if the server's results have been invalidated since as
+// it may be stale.
+func (r *cachingRepository) store(key responseCacheKey, value any, generation uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.generations[key.server] != generation {
+		return
+	}
+
+	now := time.Now()
+	for existing, entry := range r.entries {
+		if now.After(entry.expires) {
+			delete(r.entries, existing)
+		}
+	}
+
+	r.entries[key] = responseCacheEntry{value: value, expires: now.Add(r.ttl)}
+}
+
+// Drop every cached result for an operation on the given servers where
+// matches returns true for the parameters it was cached with.
+func (r *cachingRepository) invalidate(operation string, servers []string, matches func(params string) bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, server := range servers {
+		r.generations[server]++
+	}
+
+	for key := range r.entries {
+		if key.operation != operation || !matches(key.params) {
+			continue
+		}
+
+		for _, server := range servers {
+			if key.server == server {
+				delete(r.entries, key)
+				break
+			}
+		}
+	}
+}
+
+// Check if two domain names are the same or one is within the other. An
+// empty name is the root of the tree and so is related to every name.
+func domainsRelated(a string, b string) bool {
+	a = strings.ToLower(strings.TrimSuffix(a, "."))
+	b = strings.ToLower(strings.TrimSuffix(b, "."))
+
+	return a == b || a == "" || b == "" ||
+		strings.HasSuffix(a, "."+b) || strings.HasSuffix(b, "."+a)
+}
+
+func (r *cachingRepository) GetCache(ctx context.Context, searchDomain string, servers []string) (map[string]domain.CacheResult, []domain.PerServerFail, error) {
+	cache := make(map[string]domain.CacheResult)
+	missing := []string{}
+	generations := make(map[string]uint64)
+
+	for _, server := range servers {
+		if !isFreshRead(ctx) {
+			if value, ok := r.get(responseCacheKey{operation: "GetCache", params: searchDomain, server: server}); ok {
+				cache[server] = value.(domain.CacheResult)
+				continue
+			}
+		}
+		missing = append(missing, server)
+		generations[server] = r.generation(server)
+	}
+
+	if len(missing) == 0 {
+		return cache, []domain.PerServerFail{}, nil
+	}
+
+	fetched, failed, err := r.Repository.GetCache(ctx, searchDomain, missing)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for server, result := range fetched {
+		r.store(responseCacheKey{operation: "GetCache", params: searchDomain, server: server}, result, generations[server])
+		cache[server] = result
+	}
+
+	return cache, failed, nil
+}
+
+func (r *cachingRepository) DeleteCacheEntry(ctx context.Context, zone string, servers []string) ([]domain.PerServerFail, error) {
+	// Invalidate even if some of the deletes failed as we can't be sure
+	// what state those servers were left in.
+	defer r.invalidate("GetCache", servers, func(params string) bool {
+		return domainsRelated(params, zone)
+	})
+
+	return r.Repository.DeleteCacheEntry(ctx, zone, servers)
+}
+
+func (r *cachingRepository) FlushCache(ctx context.Context, servers []string) ([]domain.PerServerFail, error) {
+	defer r.invalidate("GetCache", servers, func(params string) bool {
+		return true
+	})
+
+	return r.Repository.FlushCache(ctx, servers)
+}
+
+// Wrap repository with an in memory cache that keeps the results of reads
+// for ttl.
+func NewCachingRepository(repository Repository, ttl time.Duration) Repository {
+	return &cachingRepository{
+		Repository:  repository,
+		ttl:         ttl,
+		entries:     make(map[responseCacheKey]responseCacheEntry),
+		generations: make(map[string]uint64),
+	}
+}
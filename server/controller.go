@@ -4,26 +4,100 @@
 package server
 
 import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"log/slog"
+	"net"
 	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"path"
 	"reflect"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/SidingsMedia/unified-control-rdns/server/desired"
+	"github.com/SidingsMedia/unified-control-rdns/server/jobs"
 	"github.com/SidingsMedia/unified-control-rdns/server/model"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
+	"github.com/miekg/dns"
 )
 
 type Controller interface {
-	Health(ctx *gin.Context)
+	HealthCheck(ctx *gin.Context)
 	ListServers(ctx *gin.Context)
 	GetCache(ctx *gin.Context)
 	DeleteCacheEntry(ctx *gin.Context)
+	DeleteCacheEntries(ctx *gin.Context)
+	FlushCache(ctx *gin.Context)
+	PurgeCache(ctx *gin.Context)
+	Resolve(ctx *gin.Context)
+	GetUpstreamStats(ctx *gin.Context)
+	GetProbes(ctx *gin.Context)
+	RunProbes(ctx *gin.Context)
+	GetDnssecStatus(ctx *gin.Context)
+	GetDsRecords(ctx *gin.Context)
+	SignZone(ctx *gin.Context)
+	UnsignZone(ctx *gin.Context)
+	RolloverDnsKey(ctx *gin.Context)
+	ExportZone(ctx *gin.Context)
+	ImportZone(ctx *gin.Context)
+	Apply(ctx *gin.Context)
+	GetDrift(ctx *gin.Context)
+	CheckDrift(ctx *gin.Context)
+	Events(ctx *gin.Context)
+	GetJob(ctx *gin.Context)
+	CancelJob(ctx *gin.Context)
+	ListDhcpScopes(ctx *gin.Context)
+	SetDhcpScope(ctx *gin.Context)
+	EnableDhcpScope(ctx *gin.Context)
+	DisableDhcpScope(ctx *gin.Context)
+	RemoveDhcpLease(ctx *gin.Context)
+	ReserveDhcpLease(ctx *gin.Context)
+	ListDhcpLeases(ctx *gin.Context)
+	ListSchedules(ctx *gin.Context)
+	GetScheduleRuns(ctx *gin.Context)
+	RunSchedule(ctx *gin.Context)
+	GetServerSettings(ctx *gin.Context)
+	DiffSettings(ctx *gin.Context)
+	SetSettings(ctx *gin.Context)
+	GetForwarders(ctx *gin.Context)
+	SetForwarders(ctx *gin.Context)
+	SetForwarderZone(ctx *gin.Context)
+	DeleteForwarderZone(ctx *gin.Context)
+	ListApps(ctx *gin.Context)
+	InstallApp(ctx *gin.Context)
+	UninstallApp(ctx *gin.Context)
+	GetAppConfig(ctx *gin.Context)
+	SetAppConfig(ctx *gin.Context)
+	BackupServer(ctx *gin.Context)
+	RestoreServer(ctx *gin.Context)
+	ListBackups(ctx *gin.Context)
+	GetBackup(ctx *gin.Context)
+	OpenApi(ctx *gin.Context)
 }
 
+var _ Controller = controller{}
+
+// Routes that stream until the client disconnects or that transfer whole
+// backups, which can take longer than the request timeout
+var streamingRoutes = []string{"/events", "/servers/:id/backup", "/servers/:id/restore", "/backups/:server/:name"}
+
 type controller struct {
-	service Service
+	service  Service
+	cacheTtl time.Duration
 }
 
 // Format and send the JSON response. If the indent query parameter is
@@ -37,11 +111,53 @@ func formatJson(ctx *gin.Context, code int, obj any) {
 	}
 }
 
+// Format and send a JSON response that clients are allowed to cache. A
+// weak ETag is generated from the response body and if the client already
+// holds a matching copy, 304 Not Modified is sent instead. Only successful
+// responses are cacheable, with maxAge setting how long clients may reuse
+// them before revalidating.
+func formatCacheableJson(ctx *gin.Context, code int, obj any, maxAge time.Duration) {
+	if code != http.StatusOK {
+		ctx.Header("Cache-Control", "no-store")
+		formatJson(ctx, code, obj)
+		return
+	}
+
+	body, err := json.Marshal(obj)
+	if err != nil {
+		ctx.Header("Cache-Control", "no-store")
+		formatJson(ctx, code, obj)
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	etag := `W/"` + hex.EncodeToString(sum[:16]) + `"`
+	ctx.Header("ETag", etag)
+
+	if maxAge > 0 {
+		ctx.Header("Cache-Control", fmt.Sprintf("private, max-age=%d", int(maxAge.Seconds())))
+	} else {
+		ctx.Header("Cache-Control", "no-cache")
+	}
+
+	for _, candidate := range strings.Split(ctx.GetHeader("If-None-Match"), ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			ctx.Status(http.StatusNotModified)
+			return
+		}
+	}
+
+	formatJson(ctx, code, obj)
+}
+
 // Attempt to get the name of the field. Will attempt to use the form
 // tag for GET request and the json tag for all other requests, falling
 // back to a lowercase of the field name as required.
 func getFieldName(ctx *gin.Context, malformedField validator.FieldError, typ reflect.Type) (string, error) {
-	field, ok := typ.FieldByName(malformedField.StructField())
+	// Errors for elements of a slice are named with their index
+	name, _, _ := strings.Cut(malformedField.StructField(), "[")
+	field, ok := typ.FieldByName(name)
 	if !ok {
 		return "", ErrStructFieldNotFound
 	}
@@ -95,6 +211,222 @@ func sendBadRequestFieldNames(ctx *gin.Context, validationError validator.Valida
 	ctx.Abort()
 }
 
+// Bind the query parameters of the request to obj, which must be a pointer
+// to a struct. If binding fails a bad request response is sent and false
+// is returned.
+func bindQuery(ctx *gin.Context, obj any) bool {
+	err := ctx.BindQuery(obj)
+	if err != nil && errors.As(err, &validator.ValidationErrors{}) {
+		sendBadRequestFieldNames(ctx, err.(validator.ValidationErrors), reflect.TypeOf(obj).Elem())
+		return false
+	} else if err != nil {
+		formatJson(ctx, http.StatusBadRequest, model.GeneralError{
+			Code:    http.StatusBadRequest,
+			Message: "Request was malformed",
+		})
+
+		ctx.Abort()
+		return false
+	}
+
+	return true
+}
+
+// Send a bad request response for a single field that failed a check that
+// can't be expressed as a binding tag.
+func sendBadRequestField(ctx *gin.Context, field string, condition string) {
+	formatJson(ctx, http.StatusBadRequest, model.BadRequest{
+		GeneralError: model.GeneralError{
+			Code:    http.StatusBadRequest,
+			Message: "Your request is malformed",
+		},
+		Fields: []model.Fields{{Field: field, Condition: condition}},
+	})
+	ctx.Abort()
+}
+
+// Check that the match parameter is a valid glob pattern, sending a bad
+// request response if it isn't.
+func validGlob(ctx *gin.Context, pattern string) bool {
+	if _, err := path.Match(pattern, ""); err != nil {
+		sendBadRequestField(ctx, "match", "glob")
+		return false
+	}
+	return true
+}
+
+// Pick the status code and body of the response for an error returned by
+// the service
+func serviceError(err error) (int, any) {
+	var zoneFileErr *ZoneFileError
+	if errors.As(err, &zoneFileErr) {
+		return http.StatusBadRequest, model.ZoneFileErrors{
+			GeneralError: model.GeneralError{
+				Code:    http.StatusBadRequest,
+				Message: "The zone file is invalid",
+			},
+			Lines: zoneFileErr.Lines,
+		}
+	}
+
+	var settingErr *SettingError
+	if errors.As(err, &settingErr) {
+		return http.StatusBadRequest, model.BadRequest{
+			GeneralError: model.GeneralError{
+				Code:    http.StatusBadRequest,
+				Message: "Your request is malformed",
+			},
+			Fields: []model.Fields{{Field: settingErr.Field, Condition: settingErr.Condition}},
+		}
+	}
+
+	var invalidErr *desired.InvalidError
+	if errors.As(err, &invalidErr) {
+		fields := make([]model.Fields, len(invalidErr.Fields))
+		for i, field := range invalidErr.Fields {
+			fields[i] = model.Fields{Field: field.Field, Condition: field.Condition}
+		}
+
+		return http.StatusBadRequest, model.BadRequest{
+			GeneralError: model.GeneralError{
+				Code:    http.StatusBadRequest,
+				Message: "The desired state is invalid",
+			},
+			Fields: fields,
+		}
+	}
+
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge, model.GeneralError{
+			Code:    http.StatusRequestEntityTooLarge,
+			Message: "Request body is too large",
+		}
+	}
+
+	code := http.StatusInternalServerError
+	if errors.Is(err, context.DeadlineExceeded) {
+		code = http.StatusGatewayTimeout
+	}
+	switch err {
+	case ErrServerNotFound, ErrProbesNotEnabled, ErrDriftNotEnabled, ErrScheduleNotFound, ErrBackupsNotEnabled, ErrBackupNotFound, jobs.ErrNotFound:
+		code = http.StatusNotFound
+	case jobs.ErrFinished:
+		code = http.StatusConflict
+	}
+
+	return code, model.GeneralError{
+		Code:    code,
+		Message: err.Error(),
+	}
+}
+
+// Send the response for an error returned by the service
+func sendServiceError(ctx *gin.Context, err error) {
+	code, body := serviceError(err)
+	formatJson(ctx, code, body)
+	ctx.Abort()
+}
+
+// Outcome of an operation that was performed on several servers, in the
+// same form as sendPerServerResult
+func perServerOutcome(response *model.PerServerFail, err error) jobs.Outcome {
+	if err != nil {
+		return errorOutcome(err)
+	}
+	if response == nil {
+		return jobs.Outcome{Code: http.StatusNoContent}
+	}
+	return jobs.Outcome{Code: response.Code, Result: response, Failed: response.AffectedServers}
+}
+
+func errorOutcome(err error) jobs.Outcome {
+	code, body := serviceError(err)
+	return jobs.Outcome{Code: code, Result: body}
+}
+
+// Perform an operation on servers, or if the client asked for it to run
+// asynchronously, start it as a job and respond with the job straight away
+func (controller controller) runOperation(ctx *gin.Context, operation string, async bool, servers []string, run jobs.Func) {
+	if async {
+		job := controller.service.StartJob(operation, servers, func(ctx context.Context) jobs.Outcome {
+			return run(WithRequestSlots(ctx))
+		})
+		ctx.Header("Location", "/jobs/"+job.Id)
+		formatJson(ctx, http.StatusAccepted, job)
+		return
+	}
+
+	outcome := run(ctx.Request.Context())
+	if outcome.Result == nil {
+		ctx.Status(outcome.Code)
+		return
+	}
+	formatJson(ctx, outcome.Code, outcome.Result)
+}
+
+// Send the response for an operation that was performed on several
+// servers. Nothing is returned if every server succeeded, otherwise the
+// servers that failed are listed.
+func sendPerServerResult(ctx *gin.Context, response *model.PerServerFail) {
+	if response != nil {
+		formatJson(ctx, response.Code, response)
+		ctx.Abort()
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// Pick the status code for a response to a request that was sent to
+// several servers. 207 Multi-Status is used when only some of the servers
+// failed and 502 Bad Gateway when none of them answered.
+func partialStatus(failed int, total int) int {
+	switch {
+	case failed == 0:
+		return http.StatusOK
+	case failed < total:
+		return http.StatusMultiStatus
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+// Pick the status code for a response to a request that walked down the
+// cache of several servers. A response missing part of the tree on some
+// server is only a partial success even if no server failed outright.
+func walkStatus(failed int, incomplete int, total int) int {
+	status := partialStatus(failed, total)
+	if status == http.StatusOK && incomplete > 0 {
+		return http.StatusMultiStatus
+	}
+	return status
+}
+
+// Middleware that places an overall deadline on each request. Handlers pass
+// the request context down to the repository so that any requests still
+// outstanding to the Technetium servers are cancelled once the deadline
+// passes or the client disconnects. The context also carries the slot pool
+// shared by every upstream request made for the request.
+func RequestTimeout(timeout time.Duration) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		requestCtx := WithRequestSlots(ctx.Request.Context())
+
+		// Streams stay open for as long as the client wants them
+		if slices.Contains(streamingRoutes, ctx.FullPath()) {
+			ctx.Request = ctx.Request.WithContext(requestCtx)
+			ctx.Next()
+			return
+		}
+
+		requestCtx, cancel := context.WithTimeout(requestCtx, timeout)
+		defer cancel()
+
+		ctx.Request = ctx.Request.WithContext(requestCtx)
+		ctx.Next()
+	}
+}
+
 func (controller controller) HealthCheck(ctx *gin.Context) {
 	// if err := controller.service.HealthCheck(); err != nil {
 	//     ctx.String(http.StatusServiceUnavailable, "unhealthy")
@@ -105,95 +437,1267 @@ func (controller controller) HealthCheck(ctx *gin.Context) {
 }
 
 func (controller controller) ListServers(ctx *gin.Context) {
-	formatJson(ctx, http.StatusOK, controller.service.ListServers())
+	formatCacheableJson(ctx, http.StatusOK, controller.service.ListServers(), controller.cacheTtl)
 }
 
 func (controller controller) GetCache(ctx *gin.Context) {
 	queryParams := GetCacheRequest{}
+	if !bindQuery(ctx, &queryParams) {
+		return
+	}
+
+	requestCtx := ctx.Request.Context()
+	maxAge := controller.cacheTtl
+	if queryParams.Fresh {
+		requestCtx = WithFreshRead(requestCtx)
+		maxAge = 0
+	}
 
-	if err := ctx.BindQuery(&queryParams); err != nil && errors.As(err, &validator.ValidationErrors{}) {
-		sendBadRequestFieldNames(ctx, err.(validator.ValidationErrors), reflect.TypeOf(GetCacheRequest{}))
+	if !validGlob(ctx, queryParams.Match) {
 		return
-	} else if err != nil {
+	}
+
+	response, err := controller.service.GetCache(requestCtx, queryParams.Domain, queryParams.Servers, CacheFilter{
+		Type:  queryParams.Type,
+		Depth: queryParams.Depth,
+		Match: queryParams.Match,
+	})
+	if err != nil {
+		sendServiceError(ctx, err)
+		return
+	}
+
+	formatCacheableJson(ctx, walkStatus(len(response.Errors), len(response.Incomplete), len(queryParams.Servers)), response, maxAge)
+}
+
+func (controller controller) DeleteCacheEntry(ctx *gin.Context) {
+	queryParams := DeleteCacheRequest{}
+	if !bindQuery(ctx, &queryParams) {
+		return
+	}
+
+	controller.runOperation(ctx, "cache.delete", queryParams.Async, queryParams.Servers, func(ctx context.Context) jobs.Outcome {
+		return perServerOutcome(controller.service.DeleteCacheEntry(ctx, queryParams.Domain, queryParams.Servers))
+	})
+}
+
+func (controller controller) DeleteCacheEntries(ctx *gin.Context) {
+	queryParams := BulkDeleteCacheRequest{}
+	if !bindQuery(ctx, &queryParams) {
+		return
+	}
+
+	request := model.CacheDeleteRequest{}
+	if err := ctx.ShouldBindJSON(&request); err != nil {
 		formatJson(ctx, http.StatusBadRequest, model.GeneralError{
 			Code:    http.StatusBadRequest,
 			Message: "Request was malformed",
 		})
-
 		ctx.Abort()
 		return
 	}
 
-	response, err := controller.service.GetCache(queryParams.Domain, queryParams.Servers)
-	if err != nil {
-		switch err {
-		case ErrServerNotFound:
-			formatJson(ctx, http.StatusNotFound, model.GeneralError{
-				Code:    http.StatusNotFound,
-				Message: err.Error(),
-			})
-			ctx.Abort()
+	if len(request.Domains) == 0 {
+		sendBadRequestField(ctx, "domains", "required")
+		return
+	}
+	if len(request.Domains) > maxBulkDeleteDomains {
+		sendBadRequestField(ctx, "domains", fmt.Sprintf("max=%d", maxBulkDeleteDomains))
+		return
+	}
+
+	servers := slices.Clone(request.Servers)
+	for i, entry := range request.Domains {
+		if entry.Domain == "" {
+			sendBadRequestField(ctx, fmt.Sprintf("domains[%d].domain", i), "required")
+			return
+		}
+		if len(entry.Servers) == 0 && len(request.Servers) == 0 {
+			sendBadRequestField(ctx, fmt.Sprintf("domains[%d].servers", i), "required_without=servers")
 			return
 		}
 
-		formatJson(ctx, http.StatusInternalServerError, model.GeneralError{
-			Code:    http.StatusInternalServerError,
-			Message: err.Error(),
-		})
-		ctx.Abort()
+		for _, server := range entry.Servers {
+			if !slices.Contains(servers, server) {
+				servers = append(servers, server)
+			}
+		}
+	}
+
+	controller.runOperation(ctx, "cache.delete", queryParams.Async, servers, func(ctx context.Context) jobs.Outcome {
+		response, err := controller.service.DeleteCacheEntries(ctx, request)
+		if err != nil {
+			return errorOutcome(err)
+		}
+
+		return jobs.Outcome{
+			Code:   partialStatus(response.Failed, response.Deleted+response.Failed),
+			Result: response,
+			Failed: response.Errors,
+		}
+	})
+}
+
+func (controller controller) PurgeCache(ctx *gin.Context) {
+	queryParams := PurgeCacheRequest{}
+	if !bindQuery(ctx, &queryParams) {
+		return
+	}
+
+	if queryParams.Domain == "" && queryParams.Match == "" {
+		sendBadRequestField(ctx, "domain", "required_without=match")
+		return
+	}
+
+	if !validGlob(ctx, queryParams.Match) {
+		return
+	}
+
+	// A pattern with nothing after its last wildcard, such as *, would be
+	// searched for from the root and purge the whole cache, so it is only
+	// allowed below a domain or on a dry run
+	if queryParams.Domain == "" && patternDomain(queryParams.Match) == "" && !queryParams.DryRun {
+		sendBadRequestField(ctx, "match", "suffix")
+		return
+	}
+
+	depth := maxCacheDepth
+	if queryParams.Depth != nil {
+		depth = *queryParams.Depth
+	}
+
+	controller.runOperation(ctx, "cache.purge", queryParams.Async, queryParams.Servers, func(ctx context.Context) jobs.Outcome {
+		response, err := controller.service.PurgeCache(ctx, queryParams.Domain, queryParams.Servers, CacheFilter{
+			Depth: depth,
+			Match: queryParams.Match,
+		}, queryParams.DryRun)
+		if err != nil {
+			return errorOutcome(err)
+		}
+
+		return jobs.Outcome{
+			Code:   walkStatus(len(response.Errors), len(response.Incomplete), len(queryParams.Servers)),
+			Result: response,
+			Failed: response.Errors,
+		}
+	})
+}
+
+func (controller controller) Resolve(ctx *gin.Context) {
+	queryParams := ResolveRequest{}
+	if !bindQuery(ctx, &queryParams) {
+		return
+	}
+
+	if queryParams.Type == "" {
+		queryParams.Type = "A"
+	}
+
+	response, err := controller.service.Resolve(ctx.Request.Context(), queryParams.Name, strings.ToUpper(queryParams.Type), queryParams.Servers)
+	if err != nil {
+		sendServiceError(ctx, err)
+		return
+	}
+
+	formatJson(ctx, partialStatus(len(response.Errors), len(queryParams.Servers)), response)
+}
+
+func (controller controller) FlushCache(ctx *gin.Context) {
+	queryParams := FlushCacheRequest{}
+	if !bindQuery(ctx, &queryParams) {
+		return
+	}
+
+	controller.runOperation(ctx, "cache.flush", queryParams.Async, queryParams.Servers, func(ctx context.Context) jobs.Outcome {
+		return perServerOutcome(controller.service.FlushCache(ctx, queryParams.Servers))
+	})
+}
+
+func (controller controller) GetUpstreamStats(ctx *gin.Context) {
+	formatJson(ctx, http.StatusOK, controller.service.GetUpstreamStats())
+}
+
+// Results of the most recent scheduled probe of a server
+func (controller controller) GetProbes(ctx *gin.Context) {
+	response, err := controller.service.GetProbes(ctx.Param("id"))
+	if err != nil {
+		sendServiceError(ctx, err)
 		return
 	}
 
 	formatJson(ctx, http.StatusOK, response)
 }
 
-func (controller controller) DeleteCacheEntry(ctx *gin.Context) {
-	queryParams := GetCacheRequest{}
+// Probe a server straight away rather than waiting for the next interval
+func (controller controller) RunProbes(ctx *gin.Context) {
+	response, err := controller.service.RunProbes(ctx.Request.Context(), ctx.Param("id"))
+	if err != nil {
+		sendServiceError(ctx, err)
+		return
+	}
+
+	formatJson(ctx, http.StatusOK, response)
+}
 
-	if err := ctx.BindQuery(&queryParams); err != nil && errors.As(err, &validator.ValidationErrors{}) {
-		sendBadRequestFieldNames(ctx, err.(validator.ValidationErrors), reflect.TypeOf(GetCacheRequest{}))
+func (controller controller) GetDnssecStatus(ctx *gin.Context) {
+	queryParams := DnssecStatusRequest{}
+	if !bindQuery(ctx, &queryParams) {
 		return
-	} else if err != nil {
-		formatJson(ctx, http.StatusBadRequest, model.GeneralError{
-			Code:    http.StatusBadRequest,
-			Message: "Request was malformed",
-		})
+	}
 
-		ctx.Abort()
+	response, err := controller.service.GetDnssecStatus(ctx.Request.Context(), ctx.Param("zone"), queryParams.Servers)
+	if err != nil {
+		sendServiceError(ctx, err)
 		return
 	}
 
-	response, err := controller.service.DeleteCacheEntry(queryParams.Domain, queryParams.Servers)
+	formatJson(ctx, partialStatus(len(response.Errors), len(queryParams.Servers)), response)
+}
+
+func (controller controller) GetDsRecords(ctx *gin.Context) {
+	queryParams := DsRecordsRequest{}
+	if !bindQuery(ctx, &queryParams) {
+		return
+	}
+
+	response, err := controller.service.GetDsRecords(ctx.Request.Context(), ctx.Param("zone"), queryParams.Servers)
 	if err != nil {
-		switch err {
-		case ErrServerNotFound:
-			formatJson(ctx, http.StatusNotFound, model.GeneralError{
-				Code:    http.StatusNotFound,
-				Message: err.Error(),
-			})
-			ctx.Abort()
-			return
-		}
+		sendServiceError(ctx, err)
+		return
+	}
 
-		formatJson(ctx, http.StatusInternalServerError, model.GeneralError{
-			Code:    http.StatusInternalServerError,
-			Message: err.Error(),
-		})
-		ctx.Abort()
+	formatJson(ctx, partialStatus(len(response.Errors), len(queryParams.Servers)), response)
+}
+
+func (controller controller) SignZone(ctx *gin.Context) {
+	queryParams := SignZoneRequest{}
+	if !bindQuery(ctx, &queryParams) {
 		return
 	}
 
-	if response != nil {
-		formatJson(ctx, response.Code, response)
-		ctx.Abort()
+	// Each algorithm has its own set of curves
+	switch {
+	case queryParams.Algorithm == "RSA" && queryParams.Curve != "":
+		sendBadRequestField(ctx, "curve", "excluded_if=algorithm RSA")
+		return
+	case queryParams.Algorithm == "ECDSA" && queryParams.Curve != "" && queryParams.Curve != "P256" && queryParams.Curve != "P384":
+		sendBadRequestField(ctx, "curve", "oneof=P256 P384")
+		return
+	case queryParams.Algorithm == "EDDSA" && queryParams.Curve != "" && queryParams.Curve != "ED25519" && queryParams.Curve != "ED448":
+		sendBadRequestField(ctx, "curve", "oneof=ED25519 ED448")
+		return
 	}
 
-	ctx.Status(http.StatusNoContent)
+	zone := ctx.Param("zone")
+	options := DnssecSignOptions{
+		Algorithm:       queryParams.Algorithm,
+		HashAlgorithm:   queryParams.HashAlgorithm,
+		KskKeySize:      queryParams.KskKeySize,
+		ZskKeySize:      queryParams.ZskKeySize,
+		Curve:           queryParams.Curve,
+		DnsKeyTtl:       queryParams.DnsKeyTtl,
+		ZskRolloverDays: queryParams.ZskRolloverDays,
+		NxProof:         queryParams.NxProof,
+		Iterations:      queryParams.Iterations,
+		SaltLength:      queryParams.SaltLength,
+	}
+	controller.runOperation(ctx, "dnssec.sign", queryParams.Async, queryParams.Servers, func(ctx context.Context) jobs.Outcome {
+		return perServerOutcome(controller.service.SignZone(ctx, zone, queryParams.Servers, options))
+	})
+}
+
+func (controller controller) UnsignZone(ctx *gin.Context) {
+	queryParams := UnsignZoneRequest{}
+	if !bindQuery(ctx, &queryParams) {
+		return
+	}
+
+	zone := ctx.Param("zone")
+	controller.runOperation(ctx, "dnssec.unsign", queryParams.Async, queryParams.Servers, func(ctx context.Context) jobs.Outcome {
+		return perServerOutcome(controller.service.UnsignZone(ctx, zone, queryParams.Servers))
+	})
+}
+
+func (controller controller) RolloverDnsKey(ctx *gin.Context) {
+	queryParams := RolloverDnsKeyRequest{}
+	if !bindQuery(ctx, &queryParams) {
+		return
+	}
+
+	zone := ctx.Param("zone")
+	controller.runOperation(ctx, "dnssec.rollover", queryParams.Async, queryParams.Servers, func(ctx context.Context) jobs.Outcome {
+		return perServerOutcome(controller.service.RolloverDnsKey(ctx, zone, *queryParams.KeyTag, queryParams.Servers))
+	})
+}
+
+// Send the zone as an RFC 1035 zone file
+func (controller controller) ExportZone(ctx *gin.Context) {
+	queryParams := ExportZoneRequest{}
+	if !bindQuery(ctx, &queryParams) {
+		return
+	}
+
+	zoneFile, failed, err := controller.service.ExportZone(ctx.Request.Context(), ctx.Param("zone"), queryParams.Server)
+	if err != nil {
+		sendServiceError(ctx, err)
+		return
+	}
+
+	if failed != nil {
+		sendPerServerResult(ctx, failed)
+		return
+	}
+
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", ctx.Param("zone")+".zone"))
+	ctx.Data(http.StatusOK, "text/dns; charset=utf-8", []byte(zoneFile))
+}
+
+// Read a request body of up to limit bytes, sending an error response if it
+// is too large or can't be read. name describes the body in messages.
+func readBody(ctx *gin.Context, limit int64, name string) ([]byte, bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(ctx.Writer, ctx.Request.Body, limit))
+	if err != nil {
+		sendBodyError(ctx, err, name)
+		return nil, false
+	}
+	return body, true
+}
+
+// Send the response for an error reading a request body
+func sendBodyError(ctx *gin.Context, err error, name string) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		formatJson(ctx, http.StatusRequestEntityTooLarge, model.GeneralError{
+			Code:    http.StatusRequestEntityTooLarge,
+			Message: name + " is too large",
+		})
+	} else {
+		formatJson(ctx, http.StatusBadRequest, model.GeneralError{
+			Code:    http.StatusBadRequest,
+			Message: "Failed to read " + strings.ToLower(name),
+		})
+	}
+	ctx.Abort()
+}
+
+// Import the zone file in the request body
+func (controller controller) ImportZone(ctx *gin.Context) {
+	queryParams := ImportZoneRequest{}
+	if !bindQuery(ctx, &queryParams) {
+		return
+	}
+
+	zoneFile, ok := readBody(ctx, maxZoneFileSize, "Zone file")
+	if !ok {
+		return
+	}
+
+	zone := ctx.Param("zone")
+	controller.runOperation(ctx, "zone.import", queryParams.Async, queryParams.Servers, func(ctx context.Context) jobs.Outcome {
+		return perServerOutcome(controller.service.ImportZone(ctx, zone, string(zoneFile), queryParams.Overwrite, queryParams.Servers))
+	})
+}
+
+// Bring the servers in line with the desired state in the request body,
+// which may be YAML or JSON
+func (controller controller) Apply(ctx *gin.Context) {
+	queryParams := ApplyRequest{}
+	if !bindQuery(ctx, &queryParams) {
+		return
+	}
+
+	body, ok := readBody(ctx, maxDesiredStateSize, "Desired state")
+	if !ok {
+		return
+	}
+
+	state, err := desired.Parse(body)
+	if err != nil {
+		sendServiceError(ctx, err)
+		return
+	}
+
+	controller.runOperation(ctx, "apply", queryParams.Async, state.AllServers(), func(ctx context.Context) jobs.Outcome {
+		response, err := controller.service.Apply(ctx, state, queryParams.DryRun)
+		if err != nil {
+			return errorOutcome(err)
+		}
+
+		return jobs.Outcome{
+			Code:   partialStatus(len(response.Errors), len(response.Servers)),
+			Result: response,
+			Failed: response.Errors,
+		}
+	})
+}
+
+func (controller controller) GetDrift(ctx *gin.Context) {
+	response, err := controller.service.GetDrift()
+	if err != nil {
+		sendServiceError(ctx, err)
+		return
+	}
+
+	formatJson(ctx, http.StatusOK, response)
+}
+
+func (controller controller) CheckDrift(ctx *gin.Context) {
+	response, err := controller.service.CheckDrift(ctx.Request.Context())
+	if err != nil {
+		sendServiceError(ctx, err)
+		return
+	}
+
+	formatJson(ctx, http.StatusOK, response)
+}
+
+// Whether an event stream asked for events of typ about any of servers
+func wantEvent(request EventsRequest, typ string, servers []model.EventServer) bool {
+	if len(request.Types) > 0 && !slices.Contains(request.Types, typ) {
+		return false
+	}
+	if len(request.Servers) == 0 || typ == model.EventStats {
+		return true
+	}
+
+	for _, server := range servers {
+		if slices.Contains(request.Servers, server.Id) {
+			return true
+		}
+	}
+	return false
+}
+
+// Write a single event in the server-sent events format
+func writeEvent(w io.Writer, event model.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.Id, event.Type, data)
+	return err
+}
+
+// Stream events as they happen until the client disconnects
+func (controller controller) Events(ctx *gin.Context) {
+	queryParams := EventsRequest{}
+	if !bindQuery(ctx, &queryParams) {
+		return
+	}
+
+	statsInterval := defaultStatsInterval
+	if queryParams.StatsInterval > 0 {
+		statsInterval = time.Duration(queryParams.StatsInterval) * time.Second
+	}
+
+	events, unsubscribe := controller.service.SubscribeEvents(eventStreamBuffer)
+	defer unsubscribe()
+
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Header("X-Accel-Buffering", "no")
+	ctx.Status(http.StatusOK)
+	ctx.Writer.WriteHeaderNow()
+	ctx.Writer.Flush()
+
+	stats := time.NewTicker(statsInterval)
+	defer stats.Stop()
+	keepAlive := time.NewTicker(eventStreamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		var err error
+		select {
+		case <-ctx.Request.Context().Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if !wantEvent(queryParams, event.Type, event.Servers) {
+				continue
+			}
+			err = writeEvent(ctx.Writer, event)
+		case <-stats.C:
+			if !wantEvent(queryParams, model.EventStats, nil) {
+				continue
+			}
+			err = writeEvent(ctx.Writer, controller.service.StatsEvent())
+		case <-keepAlive.C:
+			_, err = io.WriteString(ctx.Writer, ": keep-alive\n\n")
+		}
+
+		if err != nil {
+			slog.Debug("Event stream closed", "error", err)
+			return
+		}
+		ctx.Writer.Flush()
+	}
+}
+
+// Progress of a job, along with its outcome once it has finished
+func (controller controller) GetJob(ctx *gin.Context) {
+	response, err := controller.service.GetJob(ctx.Param("id"))
+	if err != nil {
+		sendServiceError(ctx, err)
+		return
+	}
+
+	formatJson(ctx, http.StatusOK, response)
+}
+
+// Cancel a running job, responding once it has stopped
+func (controller controller) CancelJob(ctx *gin.Context) {
+	response, err := controller.service.CancelJob(ctx.Request.Context(), ctx.Param("id"))
+	if err != nil {
+		sendServiceError(ctx, err)
+		return
+	}
+
+	formatJson(ctx, http.StatusOK, response)
+}
+
+// Check an address is an IPv4 address in dotted form
+func isIpv4(address string) bool {
+	addr, err := netip.ParseAddr(address)
+	return err == nil && addr.Is4()
+}
+
+// Check the settings of a DHCP scope, returning the field and condition of
+// the first problem found, or an empty field if there are none.
+func checkDhcpScope(settings model.DhcpScopeSettings) (string, string) {
+	for _, required := range []struct {
+		field   string
+		address string
+	}{
+		{"startingAddress", settings.StartingAddress},
+		{"endingAddress", settings.EndingAddress},
+		{"subnetMask", settings.SubnetMask},
+	} {
+		if required.address == "" {
+			return required.field, "required"
+		}
+		if !isIpv4(required.address) {
+			return required.field, "ipv4"
+		}
+	}
+
+	starting := netip.MustParseAddr(settings.StartingAddress)
+	if netip.MustParseAddr(settings.EndingAddress).Less(starting) {
+		return "endingAddress", "gtefield=startingAddress"
+	}
+	mask := netip.MustParseAddr(settings.SubnetMask).As4()
+	if ones, bits := net.IPMask(mask[:]).Size(); ones == 0 && bits == 0 {
+		return "subnetMask", "netmask"
+	}
+
+	if settings.LeaseTimeDays < 0 || settings.LeaseTimeHours < 0 || settings.LeaseTimeMinutes < 0 {
+		return "leaseTimeDays", "min=0"
+	}
+	if settings.RouterAddress != nil && *settings.RouterAddress != "" && !isIpv4(*settings.RouterAddress) {
+		return "routerAddress", "ipv4"
+	}
+	for i, server := range settings.DnsServers {
+		if !isIpv4(server) {
+			return fmt.Sprintf("dnsServers[%d]", i), "ipv4"
+		}
+	}
+	for i, exclusion := range settings.Exclusions {
+		if !isIpv4(exclusion.StartingAddress) {
+			return fmt.Sprintf("exclusions[%d].startingAddress", i), "ipv4"
+		}
+		if !isIpv4(exclusion.EndingAddress) {
+			return fmt.Sprintf("exclusions[%d].endingAddress", i), "ipv4"
+		}
+	}
+	for i, lease := range settings.ReservedLeases {
+		if _, err := net.ParseMAC(lease.HardwareAddress); err != nil {
+			return fmt.Sprintf("reservedLeases[%d].hardwareAddress", i), "mac"
+		}
+		if !isIpv4(lease.Address) {
+			return fmt.Sprintf("reservedLeases[%d].address", i), "ipv4"
+		}
+	}
+
+	return "", ""
+}
+
+func (controller controller) ListDhcpScopes(ctx *gin.Context) {
+	queryParams := DhcpScopesRequest{}
+	if !bindQuery(ctx, &queryParams) {
+		return
+	}
+
+	response, err := controller.service.ListDhcpScopes(ctx.Request.Context(), queryParams.Servers)
+	if err != nil {
+		sendServiceError(ctx, err)
+		return
+	}
+
+	formatJson(ctx, partialStatus(len(response.Errors), len(queryParams.Servers)), response)
+}
+
+func (controller controller) SetDhcpScope(ctx *gin.Context) {
+	queryParams := DhcpChangeRequest{}
+	if !bindQuery(ctx, &queryParams) {
+		return
+	}
+
+	settings := model.DhcpScopeSettings{}
+	if err := ctx.ShouldBindJSON(&settings); err != nil {
+		formatJson(ctx, http.StatusBadRequest, model.GeneralError{
+			Code:    http.StatusBadRequest,
+			Message: "Request was malformed",
+		})
+		ctx.Abort()
+		return
+	}
+
+	if field, condition := checkDhcpScope(settings); field != "" {
+		sendBadRequestField(ctx, field, condition)
+		return
+	}
+
+	name := ctx.Param("name")
+	controller.runOperation(ctx, "dhcp.scope.set", queryParams.Async, queryParams.Servers, func(ctx context.Context) jobs.Outcome {
+		return perServerOutcome(controller.service.SetDhcpScope(ctx, name, settings, queryParams.Servers))
+	})
+}
+
+func (controller controller) setDhcpScopeEnabled(ctx *gin.Context, enabled bool) {
+	queryParams := DhcpChangeRequest{}
+	if !bindQuery(ctx, &queryParams) {
+		return
+	}
+
+	operation := "dhcp.scope.disable"
+	if enabled {
+		operation = "dhcp.scope.enable"
+	}
+
+	name := ctx.Param("name")
+	controller.runOperation(ctx, operation, queryParams.Async, queryParams.Servers, func(ctx context.Context) jobs.Outcome {
+		return perServerOutcome(controller.service.SetDhcpScopeEnabled(ctx, name, enabled, queryParams.Servers))
+	})
+}
+
+func (controller controller) EnableDhcpScope(ctx *gin.Context) {
+	controller.setDhcpScopeEnabled(ctx, true)
+}
+
+func (controller controller) DisableDhcpScope(ctx *gin.Context) {
+	controller.setDhcpScopeEnabled(ctx, false)
+}
+
+func (controller controller) ListDhcpLeases(ctx *gin.Context) {
+	queryParams := DhcpLeasesRequest{}
+	if !bindQuery(ctx, &queryParams) {
+		return
+	}
+
+	response, err := controller.service.ListDhcpLeases(ctx.Request.Context(), queryParams.Scope, queryParams.Servers)
+	if err != nil {
+		sendServiceError(ctx, err)
+		return
+	}
+
+	formatJson(ctx, partialStatus(len(response.Errors), len(queryParams.Servers)), response)
+}
+
+// Bind the servers of a change to a lease and check its hardware address
+func bindDhcpLease(ctx *gin.Context) (DhcpChangeRequest, bool) {
+	queryParams := DhcpChangeRequest{}
+	if !bindQuery(ctx, &queryParams) {
+		return queryParams, false
+	}
+
+	if _, err := net.ParseMAC(ctx.Param("hardwareAddress")); err != nil {
+		sendBadRequestField(ctx, "hardwareAddress", "mac")
+		return queryParams, false
+	}
+
+	return queryParams, true
+}
+
+func (controller controller) RemoveDhcpLease(ctx *gin.Context) {
+	queryParams, ok := bindDhcpLease(ctx)
+	if !ok {
+		return
+	}
+
+	name, hardwareAddress := ctx.Param("name"), ctx.Param("hardwareAddress")
+	controller.runOperation(ctx, "dhcp.lease.remove", queryParams.Async, queryParams.Servers, func(ctx context.Context) jobs.Outcome {
+		return perServerOutcome(controller.service.RemoveDhcpLease(ctx, name, hardwareAddress, queryParams.Servers))
+	})
+}
+
+func (controller controller) ReserveDhcpLease(ctx *gin.Context) {
+	queryParams, ok := bindDhcpLease(ctx)
+	if !ok {
+		return
+	}
+
+	name, hardwareAddress := ctx.Param("name"), ctx.Param("hardwareAddress")
+	controller.runOperation(ctx, "dhcp.lease.reserve", queryParams.Async, queryParams.Servers, func(ctx context.Context) jobs.Outcome {
+		return perServerOutcome(controller.service.ReserveDhcpLease(ctx, name, hardwareAddress, queryParams.Servers))
+	})
+}
+
+func (controller controller) ListSchedules(ctx *gin.Context) {
+	formatJson(ctx, http.StatusOK, controller.service.ListSchedules())
+}
+
+func (controller controller) GetScheduleRuns(ctx *gin.Context) {
+	response, err := controller.service.GetScheduleRuns(ctx.Param("id"))
+	if err != nil {
+		sendServiceError(ctx, err)
+		return
+	}
+
+	formatJson(ctx, http.StatusOK, response)
+}
+
+func (controller controller) RunSchedule(ctx *gin.Context) {
+	response, err := controller.service.RunSchedule(ctx.Request.Context(), ctx.Param("id"))
+	if err != nil {
+		sendServiceError(ctx, err)
+		return
+	}
+
+	formatJson(ctx, http.StatusOK, response)
+}
+
+// Settings of a single server as reported by Technetium
+func (controller controller) GetServerSettings(ctx *gin.Context) {
+	response, failed, err := controller.service.GetServerSettings(ctx.Request.Context(), ctx.Param("id"))
+	if err != nil {
+		sendServiceError(ctx, err)
+		return
+	}
+
+	if failed != nil {
+		sendPerServerResult(ctx, failed)
+		return
+	}
+
+	formatJson(ctx, http.StatusOK, response)
+}
+
+func (controller controller) DiffSettings(ctx *gin.Context) {
+	queryParams := SettingsDiffRequest{}
+	if !bindQuery(ctx, &queryParams) {
+		return
+	}
+
+	response, err := controller.service.DiffSettings(ctx.Request.Context(), queryParams.Keys, queryParams.Servers)
+	if err != nil {
+		sendServiceError(ctx, err)
+		return
+	}
+
+	formatJson(ctx, partialStatus(len(response.Errors), len(queryParams.Servers)), response)
+}
+
+// Apply the settings in the request body to the servers. Settings that
+// aren't given are left as they are.
+func (controller controller) SetSettings(ctx *gin.Context) {
+	queryParams := SetSettingsRequest{}
+	if !bindQuery(ctx, &queryParams) {
+		return
+	}
+
+	settings := map[string]any{}
+	if err := ctx.ShouldBindJSON(&settings); err != nil || len(settings) == 0 {
+		formatJson(ctx, http.StatusBadRequest, model.GeneralError{
+			Code:    http.StatusBadRequest,
+			Message: "Request was malformed",
+		})
+		ctx.Abort()
+		return
+	}
+
+	// Checked here as well as by the service so that an async request is
+	// rejected before a job is started
+	if _, err := formatSettings(settings); err != nil {
+		sendServiceError(ctx, err)
+		return
+	}
+
+	controller.runOperation(ctx, "settings.set", queryParams.Async, queryParams.Servers, func(ctx context.Context) jobs.Outcome {
+		return perServerOutcome(controller.service.SetSettings(ctx, settings, queryParams.Servers))
+	})
+}
+
+// Check a name is a host name made of letters, digits and hyphens
+func isHostName(name string) bool {
+	name = strings.TrimSuffix(name, ".")
+	if name == "" || len(name) > 253 {
+		return false
+	}
+
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Check an address is an IP address or host name with an optional port
+func isHostPort(address string) bool {
+	if _, err := netip.ParseAddr(address); err == nil {
+		return true
+	}
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		host, port = address, ""
+	} else if number, err := strconv.Atoi(port); err != nil || number < 1 || number > 65535 {
+		return false
+	}
+
+	if _, err := netip.ParseAddr(host); err == nil {
+		return true
+	}
+	return isHostName(host)
+}
+
+// Check an address is an IP address with an optional port
+func isIpPort(address string) bool {
+	if _, err := netip.ParseAddr(address); err == nil {
+		return true
+	}
+	_, err := netip.ParseAddrPort(address)
+	return err == nil
+}
+
+// Check the protocol of a forwarder, returning the condition it fails or an
+// empty string
+func checkForwarderProtocol(protocol string) string {
+	switch protocol {
+	case "":
+		return "required"
+	case model.ForwarderUdp, model.ForwarderTcp, model.ForwarderTls, model.ForwarderHttps, model.ForwarderQuic:
+		return ""
+	}
+	return "oneof=Udp Tcp Tls Https Quic"
+}
+
+// Check the address of a forwarder is valid for its protocol, returning the
+// condition it fails or an empty string. Conditional forwarder zones may
+// also use "this-server" to resolve the zone recursively.
+func checkForwarderAddress(protocol string, address string, zone bool) string {
+	if address == "" {
+		return "required"
+	}
+	if zone && address == "this-server" {
+		return ""
+	}
+
+	// Technetium takes the address to connect to in brackets after the
+	// name, so that the name doesn't need to be resolved first
+	if name, bracketed, found := strings.Cut(address, " ("); found {
+		ip, closed := strings.CutSuffix(bracketed, ")")
+		if !closed || !isIpPort(ip) {
+			return "hostname_port"
+		}
+		address = name
+	}
+
+	if protocol == model.ForwarderHttps {
+		parsed, err := url.Parse(address)
+		if err != nil || parsed.Scheme != "https" || !isHostPort(parsed.Host) {
+			return "https_url"
+		}
+		return ""
+	}
+
+	if !isHostPort(address) {
+		return "hostname_port"
+	}
+	return ""
+}
+
+// Merged view of which servers forward which domains where
+func (controller controller) GetForwarders(ctx *gin.Context) {
+	queryParams := ForwardersRequest{}
+	if !bindQuery(ctx, &queryParams) {
+		return
+	}
+
+	response, err := controller.service.GetForwarders(ctx.Request.Context(), queryParams.Servers)
+	if err != nil {
+		sendServiceError(ctx, err)
+		return
+	}
+
+	formatJson(ctx, partialStatus(len(response.Errors), len(queryParams.Servers)), response)
+}
+
+// Replace the global forwarders of the servers
+func (controller controller) SetForwarders(ctx *gin.Context) {
+	queryParams := ForwarderChangeRequest{}
+	if !bindQuery(ctx, &queryParams) {
+		return
+	}
+
+	settings := model.ForwarderSettings{}
+	if err := ctx.ShouldBindJSON(&settings); err != nil {
+		formatJson(ctx, http.StatusBadRequest, model.GeneralError{
+			Code:    http.StatusBadRequest,
+			Message: "Request was malformed",
+		})
+		ctx.Abort()
+		return
+	}
+
+	// The protocol may be left out when forwarding is being turned off
+	if len(settings.Forwarders) > 0 || settings.Protocol != "" {
+		if condition := checkForwarderProtocol(settings.Protocol); condition != "" {
+			sendBadRequestField(ctx, "protocol", condition)
+			return
+		}
+	}
+	for i, address := range settings.Forwarders {
+		if condition := checkForwarderAddress(settings.Protocol, address, false); condition != "" {
+			sendBadRequestField(ctx, fmt.Sprintf("forwarders[%d]", i), condition)
+			return
+		}
+	}
+
+	controller.runOperation(ctx, "forwarders.set", queryParams.Async, queryParams.Servers, func(ctx context.Context) jobs.Outcome {
+		return perServerOutcome(controller.service.SetForwarders(ctx, settings, queryParams.Servers))
+	})
+}
+
+// Create or replace a conditional forwarder zone on the servers
+func (controller controller) SetForwarderZone(ctx *gin.Context) {
+	queryParams := ForwarderChangeRequest{}
+	if !bindQuery(ctx, &queryParams) {
+		return
+	}
+
+	zone := ctx.Param("zone")
+	if _, ok := dns.IsDomainName(zone); !ok {
+		sendBadRequestField(ctx, "zone", "fqdn")
+		return
+	}
+
+	settings := model.ForwarderZoneSettings{}
+	if err := ctx.ShouldBindJSON(&settings); err != nil {
+		formatJson(ctx, http.StatusBadRequest, model.GeneralError{
+			Code:    http.StatusBadRequest,
+			Message: "Request was malformed",
+		})
+		ctx.Abort()
+		return
+	}
+
+	if len(settings.Forwarders) == 0 {
+		sendBadRequestField(ctx, "forwarders", "required")
+		return
+	}
+	for i, forwarder := range settings.Forwarders {
+		if condition := checkForwarderProtocol(forwarder.Protocol); condition != "" {
+			sendBadRequestField(ctx, fmt.Sprintf("forwarders[%d].protocol", i), condition)
+			return
+		}
+		if condition := checkForwarderAddress(forwarder.Protocol, forwarder.Address, true); condition != "" {
+			sendBadRequestField(ctx, fmt.Sprintf("forwarders[%d].address", i), condition)
+			return
+		}
+	}
+
+	controller.runOperation(ctx, "forwarders.zone.set", queryParams.Async, queryParams.Servers, func(ctx context.Context) jobs.Outcome {
+		return perServerOutcome(controller.service.SetForwarderZone(ctx, zone, settings.Forwarders, queryParams.Servers))
+	})
+}
+
+func (controller controller) DeleteForwarderZone(ctx *gin.Context) {
+	queryParams := ForwarderChangeRequest{}
+	if !bindQuery(ctx, &queryParams) {
+		return
+	}
+
+	zone := ctx.Param("zone")
+	controller.runOperation(ctx, "forwarders.zone.delete", queryParams.Async, queryParams.Servers, func(ctx context.Context) jobs.Outcome {
+		return perServerOutcome(controller.service.DeleteForwarderZone(ctx, zone, queryParams.Servers))
+	})
+}
+
+func (controller controller) ListApps(ctx *gin.Context) {
+	queryParams := AppsRequest{}
+	if !bindQuery(ctx, &queryParams) {
+		return
+	}
+
+	response, err := controller.service.ListApps(ctx.Request.Context(), queryParams.Servers)
+	if err != nil {
+		sendServiceError(ctx, err)
+		return
+	}
+
+	formatJson(ctx, partialStatus(len(response.Errors), len(queryParams.Servers)), response)
+}
+
+// Check that a request body is a zip archive, sending an error response if
+// it isn't. name describes the body in the message.
+func checkZip(ctx *gin.Context, body []byte, name string) bool {
+	if _, err := zip.NewReader(bytes.NewReader(body), int64(len(body))); err != nil {
+		formatJson(ctx, http.StatusBadRequest, model.GeneralError{
+			Code:    http.StatusBadRequest,
+			Message: name + " must be a zip file",
+		})
+		ctx.Abort()
+		return false
+	}
+	return true
+}
+
+// Install the app in the zip archive in the request body, or update it on
+// the servers that already have it
+func (controller controller) InstallApp(ctx *gin.Context) {
+	queryParams := AppChangeRequest{}
+	if !bindQuery(ctx, &queryParams) {
+		return
+	}
+
+	archive, ok := readBody(ctx, maxAppArchiveSize, "App archive")
+	if !ok {
+		return
+	}
+	if !checkZip(ctx, archive, "App archive") {
+		return
+	}
+
+	name := ctx.Param("name")
+	controller.runOperation(ctx, "apps.install", queryParams.Async, queryParams.Servers, func(ctx context.Context) jobs.Outcome {
+		return perServerOutcome(controller.service.InstallApp(ctx, name, archive, queryParams.Servers))
+	})
+}
+
+func (controller controller) UninstallApp(ctx *gin.Context) {
+	queryParams := AppChangeRequest{}
+	if !bindQuery(ctx, &queryParams) {
+		return
+	}
+
+	name := ctx.Param("name")
+	controller.runOperation(ctx, "apps.uninstall", queryParams.Async, queryParams.Servers, func(ctx context.Context) jobs.Outcome {
+		return perServerOutcome(controller.service.UninstallApp(ctx, name, queryParams.Servers))
+	})
+}
+
+func (controller controller) GetAppConfig(ctx *gin.Context) {
+	queryParams := AppsRequest{}
+	if !bindQuery(ctx, &queryParams) {
+		return
+	}
+
+	response, err := controller.service.GetAppConfig(ctx.Request.Context(), ctx.Param("name"), queryParams.Servers)
+	if err != nil {
+		sendServiceError(ctx, err)
+		return
+	}
+
+	formatJson(ctx, partialStatus(len(response.Errors), len(queryParams.Servers)), response)
+}
+
+// Replace the config of an app with the JSON in the request body
+func (controller controller) SetAppConfig(ctx *gin.Context) {
+	queryParams := AppChangeRequest{}
+	if !bindQuery(ctx, &queryParams) {
+		return
+	}
+
+	config, ok := readBody(ctx, maxAppConfigSize, "App config")
+	if !ok {
+		return
+	}
+	if !json.Valid(config) {
+		formatJson(ctx, http.StatusBadRequest, model.GeneralError{
+			Code:    http.StatusBadRequest,
+			Message: "App config must be valid JSON",
+		})
+		ctx.Abort()
+		return
+	}
+
+	name := ctx.Param("name")
+	controller.runOperation(ctx, "apps.config.set", queryParams.Async, queryParams.Servers, func(ctx context.Context) jobs.Outcome {
+		return perServerOutcome(controller.service.SetAppConfig(ctx, name, config, queryParams.Servers))
+	})
+}
+
+// Back up a server, either sending the archive in the response or keeping
+// it in the backup store
+func (controller controller) BackupServer(ctx *gin.Context) {
+	queryParams := BackupRequest{}
+	if !bindQuery(ctx, &queryParams) {
+		return
+	}
+
+	id := ctx.Param("id")
+	if queryParams.Store {
+		backup, failed, err := controller.service.StoreBackup(ctx.Request.Context(), id, queryParams.Logs)
+		if err != nil {
+			sendServiceError(ctx, err)
+			return
+		}
+
+		if failed != nil {
+			sendPerServerResult(ctx, failed)
+			return
+		}
+
+		ctx.Header("Location", "/backups/"+url.PathEscape(backup.Server)+"/"+backup.Name)
+		formatJson(ctx, http.StatusCreated, backup)
+		return
+	}
+
+	archive, failed, err := controller.service.BackupServer(ctx.Request.Context(), id, queryParams.Logs)
+	if err != nil {
+		sendServiceError(ctx, err)
+		return
+	}
+
+	if failed != nil {
+		sendPerServerResult(ctx, failed)
+		return
+	}
+	defer archive.Close()
+
+	// The size isn't known until the whole backup has been sent
+	ctx.DataFromReader(http.StatusOK, -1, "application/zip", archive, map[string]string{
+		"Content-Disposition": fmt.Sprintf("attachment; filename=%q", id+"-"+backupName(time.Now())),
+	})
+}
+
+// Check that a request body starts like a zip archive, sending a bad
+// request response if it doesn't. Only the start is checked so that the
+// body can still be streamed.
+func checkZipHeader(ctx *gin.Context, body *bufio.Reader, name string) bool {
+	header, _ := body.Peek(4)
+	if !bytes.Equal(header, []byte("PK\x03\x04")) && !bytes.Equal(header, []byte("PK\x05\x06")) {
+		formatJson(ctx, http.StatusBadRequest, model.GeneralError{
+			Code:    http.StatusBadRequest,
+			Message: name + " must be a zip file",
+		})
+		ctx.Abort()
+		return false
+	}
+	return true
+}
+
+// Copy a request body into a temporary file so that it can be read after
+// the request has finished, sending an error response if it can't be
+// read. name describes the body in messages.
+func spoolBody(ctx *gin.Context, body io.Reader, name string) (*os.File, bool) {
+	file, err := os.CreateTemp("", "unified-control-rdns-*")
+	if err != nil {
+		slog.Error("Failed to create temporary file", "error", err)
+		formatJson(ctx, http.StatusInternalServerError, model.GeneralError{
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to store " + strings.ToLower(name),
+		})
+		ctx.Abort()
+		return nil, false
+	}
+
+	if _, err := io.Copy(file, body); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		sendBodyError(ctx, err, name)
+		return nil, false
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		sendServiceError(ctx, err)
+		return nil, false
+	}
+	return file, true
+}
+
+// Restore a server from the backup archive in the request body
+func (controller controller) RestoreServer(ctx *gin.Context) {
+	queryParams := RestoreRequest{}
+	if !bindQuery(ctx, &queryParams) {
+		return
+	}
+
+	// The backup is streamed through to the server rather than read into
+	// memory first
+	archive := bufio.NewReader(http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxBackupSize))
+	if !checkZipHeader(ctx, archive, "Backup") {
+		return
+	}
+
+	servers := []string{ctx.Param("id")}
+	if !queryParams.Async {
+		controller.runOperation(ctx, "server.restore", false, servers, func(ctx context.Context) jobs.Outcome {
+			return perServerOutcome(controller.service.RestoreServer(ctx, servers[0], archive, queryParams.DeleteExisting))
+		})
+		return
+	}
+
+	// A job outlives the request body, so the backup is kept in a
+	// temporary file until the job has run
+	file, ok := spoolBody(ctx, archive, "Backup")
+	if !ok {
+		return
+	}
+	controller.runOperation(ctx, "server.restore", true, servers, func(ctx context.Context) jobs.Outcome {
+		defer os.Remove(file.Name())
+		defer file.Close()
+		return perServerOutcome(controller.service.RestoreServer(ctx, servers[0], file, queryParams.DeleteExisting))
+	})
+}
+
+func (controller controller) ListBackups(ctx *gin.Context) {
+	queryParams := ListBackupsRequest{}
+	if !bindQuery(ctx, &queryParams) {
+		return
+	}
+
+	backups, err := controller.service.ListBackups(queryParams.Server)
+	if err != nil {
+		sendServiceError(ctx, err)
+		return
+	}
+
+	formatJson(ctx, http.StatusOK, backups)
+}
+
+func (controller controller) GetBackup(ctx *gin.Context) {
+	server, name := ctx.Param("server"), ctx.Param("name")
+	archive, size, err := controller.service.GetBackup(server, name)
+	if err != nil {
+		sendServiceError(ctx, err)
+		return
+	}
+	defer archive.Close()
+
+	ctx.DataFromReader(http.StatusOK, size, "application/zip", archive, map[string]string{
+		"Content-Disposition": fmt.Sprintf("attachment; filename=%q", server+"-"+name),
+	})
+}
+
+// Serve the OpenAPI document describing this API
+func (controller controller) OpenApi(ctx *gin.Context) {
+	ctx.Data(http.StatusOK, "application/json", openApiSpec)
 }
 
-func NewController(engine *gin.Engine, Service Service) {
+func NewController(engine *gin.Engine, Service Service, cacheTtl time.Duration) {
 	controller := &controller{
-		service: Service,
+		service:  Service,
+		cacheTtl: cacheTtl,
 	}
 	api := engine.Group("")
 	{
@@ -201,5 +1705,52 @@ func NewController(engine *gin.Engine, Service Service) {
 		api.GET("servers", controller.ListServers)
 		api.GET("cache", controller.GetCache)
 		api.DELETE("cache", controller.DeleteCacheEntry)
+		api.POST("cache/delete", controller.DeleteCacheEntries)
+		api.POST("cache/flush", controller.FlushCache)
+		api.POST("cache/purge", controller.PurgeCache)
+		api.GET("resolve", controller.Resolve)
+		api.GET("stats", controller.GetUpstreamStats)
+		api.GET("servers/:id/probes", controller.GetProbes)
+		api.POST("servers/:id/probes", controller.RunProbes)
+		api.GET("zones/:zone/dnssec", controller.GetDnssecStatus)
+		api.GET("zones/:zone/dnssec/ds", controller.GetDsRecords)
+		api.POST("zones/:zone/dnssec/sign", controller.SignZone)
+		api.POST("zones/:zone/dnssec/unsign", controller.UnsignZone)
+		api.POST("zones/:zone/dnssec/rollover", controller.RolloverDnsKey)
+		api.GET("zones/:zone/export", controller.ExportZone)
+		api.POST("zones/:zone/import", controller.ImportZone)
+		api.POST("apply", controller.Apply)
+		api.GET("drift", controller.GetDrift)
+		api.POST("drift", controller.CheckDrift)
+		api.GET("events", controller.Events)
+		api.GET("jobs/:id", controller.GetJob)
+		api.DELETE("jobs/:id", controller.CancelJob)
+		api.GET("dhcp/scopes", controller.ListDhcpScopes)
+		api.PUT("dhcp/scopes/:name", controller.SetDhcpScope)
+		api.POST("dhcp/scopes/:name/enable", controller.EnableDhcpScope)
+		api.POST("dhcp/scopes/:name/disable", controller.DisableDhcpScope)
+		api.DELETE("dhcp/scopes/:name/leases/:hardwareAddress", controller.RemoveDhcpLease)
+		api.POST("dhcp/scopes/:name/leases/:hardwareAddress/reserve", controller.ReserveDhcpLease)
+		api.GET("dhcp/leases", controller.ListDhcpLeases)
+		api.GET("schedules", controller.ListSchedules)
+		api.GET("schedules/:id/runs", controller.GetScheduleRuns)
+		api.POST("schedules/:id/runs", controller.RunSchedule)
+		api.GET("servers/:id/settings", controller.GetServerSettings)
+		api.GET("settings/diff", controller.DiffSettings)
+		api.POST("settings", controller.SetSettings)
+		api.GET("forwarders", controller.GetForwarders)
+		api.PUT("forwarders", controller.SetForwarders)
+		api.PUT("forwarders/zones/:zone", controller.SetForwarderZone)
+		api.DELETE("forwarders/zones/:zone", controller.DeleteForwarderZone)
+		api.GET("apps", controller.ListApps)
+		api.PUT("apps/:name", controller.InstallApp)
+		api.DELETE("apps/:name", controller.UninstallApp)
+		api.GET("apps/:name/config", controller.GetAppConfig)
+		api.PUT("apps/:name/config", controller.SetAppConfig)
+		api.POST("servers/:id/backup", controller.BackupServer)
+		api.POST("servers/:id/restore", controller.RestoreServer)
+		api.GET("backups", controller.ListBackups)
+		api.GET("backups/:server/:name", controller.GetBackup)
+		api.GET("openapi.json", controller.OpenApi)
 	}
 }
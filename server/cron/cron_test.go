@@ -0,0 +1,71 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	// A Wednesday
+	from := time.Date(2025, time.January, 15, 10, 30, 20, 0, time.UTC)
+
+	cases := map[string]time.Time{
+		"* * * * *":          time.Date(2025, time.January, 15, 10, 31, 0, 0, time.UTC),
+		"*/15 * * * *":       time.Date(2025, time.January, 15, 10, 45, 0, 0, time.UTC),
+		"30 2 * * *":         time.Date(2025, time.January, 16, 2, 30, 0, 0, time.UTC),
+		"@daily":             time.Date(2025, time.January, 16, 0, 0, 0, 0, time.UTC),
+		"@hourly":            time.Date(2025, time.January, 15, 11, 0, 0, 0, time.UTC),
+		"0 9 * * mon-fri":    time.Date(2025, time.January, 16, 9, 0, 0, 0, time.UTC),
+		"0 0 * * 7":          time.Date(2025, time.January, 19, 0, 0, 0, 0, time.UTC),
+		"0 0 1 * *":          time.Date(2025, time.February, 1, 0, 0, 0, 0, time.UTC),
+		"0 0 29 feb *":       time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC),
+		"0 0 1,20 * 0":       time.Date(2025, time.January, 19, 0, 0, 0, 0, time.UTC),
+		"5-10/5 10-12 * * *": time.Date(2025, time.January, 15, 11, 5, 0, 0, time.UTC),
+	}
+
+	for expr, expected := range cases {
+		expression, err := Parse(expr)
+		if err != nil {
+			t.Errorf("%s: %v", expr, err)
+			continue
+		}
+
+		if next := expression.Next(from); !next.Equal(expected) {
+			t.Errorf("%s: expected %v, got %v", expr, expected, next)
+		}
+	}
+}
+
+func TestNextNever(t *testing.T) {
+	expression, err := Parse("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if next := expression.Next(time.Now()); !next.IsZero() {
+		t.Errorf("expected the 30th of February never to come, got %v", next)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"10-5 * * * *",
+		"a * * * *",
+		"@often",
+	} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("expected %q to be rejected", expr)
+		}
+	}
+}
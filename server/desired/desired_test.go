@@ -0,0 +1,225 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package desired_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/SidingsMedia/unified-control-rdns/server/desired"
+)
+
+const exampleState = `
+servers: [a, b]
+zones:
+  - name: Example.com.
+    records:
+      - name: "@"
+        type: mx
+        values: ["10 Mail.Example.com."]
+      - name: www
+        type: A
+        ttl: 300
+        values: [192.0.2.2, 192.0.2.1]
+      - name: txt
+        type: TXT
+        values: ["v=spf1 -all"]
+  - name: example.net
+    servers: [b]
+    type: Forwarder
+blocked: [Ads.Example.org]
+`
+
+func parse(t *testing.T, text string) *desired.State {
+	t.Helper()
+
+	state, err := desired.Parse([]byte(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := state.Validate([]string{"a", "b"}); err != nil {
+		t.Fatal(err)
+	}
+	return state
+}
+
+func TestValidateNormalises(t *testing.T) {
+	state := parse(t, exampleState)
+
+	zone := state.Zones[0]
+	if zone.Name != "example.com" || zone.Type != desired.DefaultZoneType || !slices.Equal(zone.Servers, []string{"a", "b"}) {
+		t.Errorf("unexpected zone %+v", zone)
+	}
+
+	mx := zone.Records[0]
+	if mx.Name != "example.com" || mx.Type != "MX" || mx.Ttl != desired.DefaultTtl || mx.Values[0] != "10 mail.example.com" {
+		t.Errorf("unexpected MX record %+v", mx)
+	}
+	if zone.Records[1].Name != "www.example.com" {
+		t.Errorf("expected relative names to be made absolute, got %s", zone.Records[1].Name)
+	}
+	if !slices.Equal(state.Blocked, []string{"ads.example.org"}) {
+		t.Errorf("unexpected blocked list %v", state.Blocked)
+	}
+}
+
+func TestValidateReportsEveryField(t *testing.T) {
+	state, err := desired.Parse([]byte(`
+servers: [a, missing]
+zones:
+  - name: example.com
+    records:
+      - name: www.example.org.
+        type: A
+        values: [192.0.2.1]
+      - name: v6
+        type: AAAA
+        values: [192.0.2.1]
+      - name: v6
+        type: AAAA
+        values: ["2001:db8::1"]
+      - name: x
+        type: HINFO
+        values: [a]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var invalid *desired.InvalidError
+	if !errors.As(state.Validate([]string{"a"}), &invalid) {
+		t.Fatalf("expected state to be invalid")
+	}
+
+	fields := []string{}
+	for _, field := range invalid.Fields {
+		fields = append(fields, field.Field)
+	}
+	expected := []string{
+		"servers[1]",
+		"zones[0].records[0].name",
+		"zones[0].records[1].values[0]",
+		"zones[0].records[2]",
+		"zones[0].records[3].type",
+	}
+	if !slices.Equal(fields, expected) {
+		t.Errorf("expected invalid fields %v, got %+v", expected, invalid.Fields)
+	}
+}
+
+func TestParseRejectsUnknownFields(t *testing.T) {
+	_, err := desired.Parse([]byte("zones:\n  - name: example.com\n    recrods: []\n"))
+
+	var invalid *desired.InvalidError
+	if !errors.As(err, &invalid) || invalid.Fields[0].Field != "body" {
+		t.Errorf("expected unknown field to be rejected, got %v", err)
+	}
+}
+
+func TestPlanNewServer(t *testing.T) {
+	state := parse(t, exampleState)
+
+	changes := desired.Plan(state, "b", desired.Live{Zones: map[string]desired.LiveZone{}})
+
+	summary := []string{}
+	for _, change := range changes {
+		summary = append(summary, change.Action+" "+change.Kind+" "+change.Name+" "+change.Type)
+	}
+	expected := []string{
+		"create zone example.com Primary",
+		"create record example.com MX",
+		"create record txt.example.com TXT",
+		"create record www.example.com A",
+		"create zone example.net Forwarder",
+		"create blocked ads.example.org ",
+	}
+	if !slices.Equal(summary, expected) {
+		t.Errorf("expected changes %q, got %q", expected, summary)
+	}
+
+	if values := changes[3].After.Values; !slices.Equal(values, []string{"192.0.2.1", "192.0.2.2"}) {
+		t.Errorf("expected values to be sorted, got %v", values)
+	}
+}
+
+func TestPlanExistingServer(t *testing.T) {
+	state := parse(t, exampleState)
+
+	live := desired.Live{
+		Zones: map[string]desired.LiveZone{
+			"example.com": {Type: "Primary", Records: []desired.Record{
+				{Name: "example.com", Type: "NS", Ttl: 3600, Values: []string{"ns1.example.com"}},
+				{Name: "example.com", Type: "MX", Ttl: 3600, Values: []string{"10 mail.example.com"}},
+				{Name: "www.example.com", Type: "A", Ttl: 300, Values: []string{"192.0.2.1", "192.0.2.2"}},
+				{Name: "txt.example.com", Type: "TXT", Ttl: 60, Values: []string{"v=spf1 -all"}},
+				{Name: "old.example.com", Type: "A", Ttl: 300, Values: []string{"192.0.2.9"}},
+			}},
+			"unmanaged.com": {Type: "Primary", Records: []desired.Record{
+				{Name: "unmanaged.com", Type: "A", Ttl: 300, Values: []string{"192.0.2.1"}},
+			}},
+		},
+		Blocked: []string{"ads.example.org", "tracker.example.org"},
+	}
+
+	changes := desired.Plan(state, "a", live)
+	if len(changes) != 3 {
+		t.Fatalf("expected three changes, got %+v", changes)
+	}
+
+	if changes[0].Action != desired.ActionDelete || changes[0].Name != "old.example.com" {
+		t.Errorf("expected undeclared record to be deleted first, got %+v", changes[0])
+	}
+	if changes[1].Action != desired.ActionUpdate || changes[1].Name != "txt.example.com" || changes[1].Before.Ttl != 60 || changes[1].After.Ttl != desired.DefaultTtl {
+		t.Errorf("expected TTL change to be an update, got %+v", changes[1])
+	}
+	if changes[2].Action != desired.ActionDelete || changes[2].Kind != desired.KindBlocked || changes[2].Name != "tracker.example.org" {
+		t.Errorf("expected undeclared blocked domain to be removed, got %+v", changes[2])
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	for name, state := range map[string]string{
+		"a.yaml": "servers: [a]\nmode: enforce\nzones:\n  - name: example.com\n  - name: example.net\n    mode: observe\nblocked: []\n",
+		"b.json": `{"servers": ["b"], "zones": [{"name": "example.org"}]}`,
+		"c.txt":  "ignored",
+		"d.yml":  "servers: [b]\nzones:\n  - name: Example.com\nallowed: [x.example]\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(state), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := desired.LoadDir(dir, []string{"a", "b"})
+
+	var invalid *desired.InvalidError
+	if !errors.As(err, &invalid) || len(invalid.Fields) != 2 || invalid.Fields[0].Field != "d.yml: zones[0].name" || invalid.Fields[1].Field != "d.yml" {
+		t.Fatalf("expected the duplicate zone and lists to be rejected, got %v", err)
+	}
+
+	if err := os.Remove(filepath.Join(dir, "d.yml")); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := desired.LoadDir(dir, []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	modes := []string{}
+	for _, zone := range state.Zones {
+		modes = append(modes, zone.Name+" "+zone.Mode+" "+zone.Servers[0])
+	}
+	expected := []string{"example.com enforce a", "example.net observe a", "example.org observe b"}
+	if !slices.Equal(modes, expected) {
+		t.Errorf("expected zones %v, got %v", expected, modes)
+	}
+
+	if state.Mode != desired.ModeEnforce || !slices.Equal(state.Servers, []string{"a"}) || state.Blocked == nil {
+		t.Errorf("expected the lists to come from a.yaml, got %+v", state)
+	}
+}
@@ -0,0 +1,88 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package desired
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Extensions of the files read from a state directory
+var stateExtensions = []string{".yaml", ".yml", ".json"}
+
+// Read every state file in dir and merge them into a single validated
+// state. Each file is validated on its own, so its servers and mode only
+// apply to what it declares. A zone may only be declared in one file, as
+// may the block and allow lists. Problems are reported against the name
+// of the file they were found in.
+func LoadDir(dir string, servers []string) (*State, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() && slices.Contains(stateExtensions, strings.ToLower(filepath.Ext(entry.Name()))) {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	merged := &State{Mode: ModeObserve, Zones: []Zone{}}
+	fields := []FieldError{}
+	zoneFiles := make(map[string]string)
+	listFile := ""
+
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		state, err := Parse(data)
+		if err == nil {
+			err = state.Validate(servers)
+		}
+		if invalid, ok := err.(*InvalidError); ok {
+			for _, field := range invalid.Fields {
+				fields = append(fields, FieldError{Field: name + ": " + field.Field, Condition: field.Condition})
+			}
+			continue
+		}
+
+		for i, zone := range state.Zones {
+			if other, ok := zoneFiles[zone.Name]; ok {
+				fields = append(fields, FieldError{
+					Field:     fmt.Sprintf("%s: zones[%d].name", name, i),
+					Condition: fmt.Sprintf("zone %s is already declared in %s", zone.Name, other),
+				})
+				continue
+			}
+			zoneFiles[zone.Name] = name
+			merged.Zones = append(merged.Zones, zone)
+		}
+
+		if state.Blocked != nil || state.Allowed != nil {
+			if listFile != "" {
+				fields = append(fields, FieldError{Field: name, Condition: "the block and allow lists are already declared in " + listFile})
+				continue
+			}
+			listFile = name
+			merged.Servers = state.Servers
+			merged.Mode = state.Mode
+			merged.Blocked = state.Blocked
+			merged.Allowed = state.Allowed
+		}
+	}
+
+	if len(fields) > 0 {
+		return nil, &InvalidError{Fields: fields}
+	}
+	return merged, nil
+}
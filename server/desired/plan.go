@@ -0,0 +1,195 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package desired
+
+import (
+	"slices"
+	"sort"
+	"strings"
+)
+
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+)
+
+const (
+	KindZone    = "zone"
+	KindRecord  = "record"
+	KindBlocked = "blocked"
+	KindAllowed = "allowed"
+)
+
+// Values of a record set. The values are sorted.
+type RecordSet struct {
+	Ttl    int
+	Values []string
+}
+
+// A single change needed to bring a server in line with the desired state
+type Change struct {
+	Action string
+	Kind   string
+	// Zone the change is made in. Empty for changes to the block and allow
+	// lists.
+	Zone string
+	// Name of the record, or the domain added to or removed from a list
+	Name string
+	// Type of the record, or of the zone being created
+	Type string
+	// Record set before and after the change. Before is nil for creates and
+	// After is nil for deletes.
+	Before *RecordSet
+	After  *RecordSet
+	// Mode of the zone or list the change is made to
+	Mode string
+}
+
+// A zone as it currently exists on a server
+type LiveZone struct {
+	Type string
+	// Records that can be managed, with their values normalised and
+	// grouped into one Record per name and type
+	Records []Record
+}
+
+// State of a server as currently configured. Only the parts that are
+// managed by the desired state need to be filled in.
+type Live struct {
+	// Zones keyed by their normalised name
+	Zones   map[string]LiveZone
+	Blocked []string
+	Allowed []string
+}
+
+// Check if a server should hold a zone or list
+func onServer(servers []string, server string) bool {
+	return slices.Contains(servers, server)
+}
+
+func toRecordSet(record Record) *RecordSet {
+	values := slices.Clone(record.Values)
+	slices.Sort(values)
+	return &RecordSet{Ttl: record.Ttl, Values: slices.Compact(values)}
+}
+
+func (r *RecordSet) equal(other *RecordSet) bool {
+	return r.Ttl == other.Ttl && slices.Equal(r.Values, other.Values)
+}
+
+// Work out the changes to a zone's records. Records that exist but aren't
+// declared are deleted, except for the NS records at the apex which
+// Technetium creates along with the zone and are only managed if declared.
+func planRecords(zone Zone, live []Record) []Change {
+	declared := make(map[string]*RecordSet)
+	existing := make(map[string]*RecordSet)
+	keys := []string{}
+
+	for _, record := range zone.Records {
+		key := record.Name + " " + record.Type
+		declared[key] = toRecordSet(record)
+		keys = append(keys, key)
+	}
+	for _, record := range live {
+		key := record.Name + " " + record.Type
+		existing[key] = toRecordSet(record)
+		if _, ok := declared[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	deletes, updates, creates := []Change{}, []Change{}, []Change{}
+	for _, key := range keys {
+		before, after := existing[key], declared[key]
+		name, typ, _ := strings.Cut(key, " ")
+
+		change := Change{Kind: KindRecord, Zone: zone.Name, Name: name, Type: typ, Before: before, After: after, Mode: zone.Mode}
+		switch {
+		case after == nil:
+			if name == zone.Name && typ == "NS" {
+				continue
+			}
+			change.Action = ActionDelete
+			deletes = append(deletes, change)
+		case before == nil:
+			change.Action = ActionCreate
+			creates = append(creates, change)
+		case !before.equal(after):
+			change.Action = ActionUpdate
+			updates = append(updates, change)
+		}
+	}
+
+	// Deleting first avoids conflicts such as a CNAME replacing other
+	// records with the same name
+	return append(append(deletes, updates...), creates...)
+}
+
+// Work out the changes to a block or allow list
+func planList(kind string, mode string, declared []string, live []string) []Change {
+	changes := []Change{}
+	for _, domain := range live {
+		if !slices.Contains(declared, domain) {
+			changes = append(changes, Change{Action: ActionDelete, Kind: kind, Name: domain, Mode: mode})
+		}
+	}
+
+	added := []string{}
+	for _, domain := range declared {
+		if !slices.Contains(live, domain) && !slices.Contains(added, domain) {
+			added = append(added, domain)
+			changes = append(changes, Change{Action: ActionCreate, Kind: kind, Name: domain, Mode: mode})
+		}
+	}
+	return changes
+}
+
+// Work out the changes needed to bring a server in line with a validated
+// state. The changes are in the order they should be applied. A server
+// that already matches the state needs no changes.
+//
+// Zones that aren't declared are left alone and the type of an existing
+// zone is never changed, as that would mean deleting it.
+func Plan(state *State, server string, live Live) []Change {
+	changes := []Change{}
+
+	for _, zone := range state.Zones {
+		if !onServer(zone.Servers, server) {
+			continue
+		}
+
+		liveZone, exists := live.Zones[zone.Name]
+		if !exists {
+			changes = append(changes, Change{Action: ActionCreate, Kind: KindZone, Zone: zone.Name, Name: zone.Name, Type: zone.Type, Mode: zone.Mode})
+		}
+		changes = append(changes, planRecords(zone, liveZone.Records)...)
+	}
+
+	if onServer(state.Servers, server) {
+		if state.Blocked != nil {
+			changes = append(changes, planList(KindBlocked, state.Mode, state.Blocked, live.Blocked)...)
+		}
+		if state.Allowed != nil {
+			changes = append(changes, planList(KindAllowed, state.Mode, state.Allowed, live.Allowed)...)
+		}
+	}
+
+	return changes
+}
+
+// Servers that any part of the state is applied to, in the order they are
+// first mentioned
+func (s *State) AllServers() []string {
+	servers := slices.Clone(s.Servers)
+	for _, zone := range s.Zones {
+		for _, server := range zone.Servers {
+			if !slices.Contains(servers, server) {
+				servers = append(servers, server)
+			}
+		}
+	}
+	return servers
+}
@@ -0,0 +1,136 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package desired
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// How the values of a record type are converted to and from the record
+// data used by the Technetium API. Values are written in the same way as
+// in a zone file, except that names are always fully qualified and text
+// isn't quoted.
+type recordType struct {
+	// Names of the fields of the record data, in the order they appear in
+	// the value
+	fields []string
+	// Fields holding domain names, which are compared ignoring case
+	names []string
+	// Fields holding numbers
+	numbers []string
+	// The last field takes the rest of the value, spaces included
+	rest bool
+}
+
+var recordTypes = map[string]recordType{
+	"A":     {fields: []string{"ipAddress"}},
+	"AAAA":  {fields: []string{"ipAddress"}},
+	"CNAME": {fields: []string{"cname"}, names: []string{"cname"}},
+	"NS":    {fields: []string{"nameServer"}, names: []string{"nameServer"}},
+	"PTR":   {fields: []string{"ptrName"}, names: []string{"ptrName"}},
+	"MX":    {fields: []string{"preference", "exchange"}, names: []string{"exchange"}, numbers: []string{"preference"}},
+	"TXT":   {fields: []string{"text"}, rest: true},
+	"SRV":   {fields: []string{"priority", "weight", "port", "target"}, names: []string{"target"}, numbers: []string{"priority", "weight", "port"}},
+	"CAA":   {fields: []string{"flags", "tag", "value"}, numbers: []string{"flags"}, rest: true},
+}
+
+// Check if records of a type can be managed
+func Supported(typ string) bool {
+	_, ok := recordTypes[strings.ToUpper(typ)]
+	return ok
+}
+
+// Split a value into the fields of the record data for typ
+func RecordData(typ string, value string) (map[string]string, error) {
+	rt, ok := recordTypes[typ]
+	if !ok {
+		return nil, fmt.Errorf("unsupported record type %q", typ)
+	}
+
+	parts := strings.Fields(value)
+	if rt.rest {
+		parts = strings.SplitN(strings.TrimSpace(value), " ", len(rt.fields))
+		for i := range parts[:len(parts)-1] {
+			parts[i] = strings.TrimSpace(parts[i])
+		}
+	}
+	if len(parts) != len(rt.fields) || parts[0] == "" {
+		return nil, fmt.Errorf("expected %s", strings.Join(rt.fields, " "))
+	}
+
+	data := make(map[string]string, len(rt.fields))
+	for i, field := range rt.fields {
+		part := parts[i]
+		switch {
+		case slices.Contains(rt.names, field):
+			part = normaliseName(part)
+		case slices.Contains(rt.numbers, field):
+			number, err := strconv.ParseUint(part, 10, 16)
+			if err != nil {
+				return nil, fmt.Errorf("%s must be a number between 0 and 65535", field)
+			}
+			part = strconv.FormatUint(number, 10)
+		case rt.rest && i == len(rt.fields)-1 && typ == "CAA":
+			part = strings.Trim(strings.TrimSpace(part), `"`)
+		}
+		data[field] = part
+	}
+
+	if typ == "A" || typ == "AAAA" {
+		ip := net.ParseIP(data["ipAddress"])
+		if ip == nil || (typ == "A") != (ip.To4() != nil) {
+			return nil, fmt.Errorf("%q is not an %s address", data["ipAddress"], map[string]string{"A": "IPv4", "AAAA": "IPv6"}[typ])
+		}
+		data["ipAddress"] = ip.String()
+	}
+
+	return data, nil
+}
+
+// Join the fields of record data back into a value
+func formatData(typ string, data map[string]string) string {
+	rt := recordTypes[typ]
+	parts := make([]string, len(rt.fields))
+	for i, field := range rt.fields {
+		parts[i] = data[field]
+	}
+	return strings.Join(parts, " ")
+}
+
+// Rewrite a value in its canonical form so that equal values compare equal
+func normaliseValue(typ string, value string) (string, error) {
+	data, err := RecordData(typ, value)
+	if err != nil {
+		return "", err
+	}
+	return formatData(typ, data), nil
+}
+
+// Turn the record data returned by Technetium into a value. False is
+// returned if the record can't be managed.
+func FormatRData(typ string, rData map[string]any) (string, bool) {
+	rt, ok := recordTypes[typ]
+	if !ok {
+		return "", false
+	}
+
+	parts := make([]string, len(rt.fields))
+	for i, field := range rt.fields {
+		value, ok := rData[field]
+		if !ok {
+			return "", false
+		}
+		parts[i] = fmt.Sprint(value)
+	}
+
+	value, err := normaliseValue(typ, strings.Join(parts, " "))
+	if err != nil {
+		return "", false
+	}
+	return value, true
+}
@@ -0,0 +1,230 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+// Package desired describes the state that a set of servers should be in
+// and works out the changes needed to bring each server's live state in
+// line with it. Zones, their records and the block and allow lists can be
+// declared. Only the zones that are declared are managed, but within a
+// managed zone any record that isn't declared is deleted.
+package desired
+
+import (
+	"fmt"
+	"strings"
+
+	yaml "github.com/goccy/go-yaml"
+	"github.com/miekg/dns"
+)
+
+const (
+	DefaultZoneType = "Primary"
+	DefaultTtl      = 3600
+)
+
+// How drift from the state is handled by the background reconciler. Drift
+// in observe mode is only reported, while in enforce mode it's corrected.
+// Applying a state directly always makes every change.
+const (
+	ModeObserve = "observe"
+	ModeEnforce = "enforce"
+)
+
+type Record struct {
+	// Name relative to the zone, or fully qualified if it ends with a dot.
+	// @ or an empty name is the zone apex.
+	Name   string   `yaml:"name" json:"name"`
+	Type   string   `yaml:"type" json:"type"`
+	Ttl    int      `yaml:"ttl" json:"ttl"`
+	Values []string `yaml:"values" json:"values"`
+}
+
+type Zone struct {
+	Name string `yaml:"name" json:"name"`
+	Type string `yaml:"type" json:"type"`
+	// Defaults to the mode of the state
+	Mode string `yaml:"mode" json:"mode"`
+	// Servers the zone is on. Defaults to the servers of the state.
+	Servers []string `yaml:"servers" json:"servers"`
+	Records []Record `yaml:"records" json:"records"`
+}
+
+type State struct {
+	// Servers that are managed unless a zone says otherwise
+	Servers []string `yaml:"servers" json:"servers"`
+	// Mode of the block and allow lists and default for the zones.
+	// Defaults to observe.
+	Mode  string `yaml:"mode" json:"mode"`
+	Zones []Zone `yaml:"zones" json:"zones"`
+	// Domains on the block and allow lists. The lists are only managed if
+	// they are present, so an empty list clears them but a missing one
+	// leaves them alone.
+	Blocked []string `yaml:"blocked" json:"blocked"`
+	Allowed []string `yaml:"allowed" json:"allowed"`
+}
+
+// A field of the state that failed validation
+type FieldError struct {
+	Field     string
+	Condition string
+}
+
+// Returned when a state is malformed, listing every problem found
+type InvalidError struct {
+	Fields []FieldError
+}
+
+func (e *InvalidError) Error() string {
+	conditions := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		conditions[i] = field.Field + ": " + field.Condition
+	}
+	return "invalid desired state: " + strings.Join(conditions, ", ")
+}
+
+// Normalise a domain name to lower case without a trailing dot
+func normaliseName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
+// Make a record name absolute within zone
+func absoluteName(name string, zone string) string {
+	switch {
+	case name == "" || name == "@":
+		return zone
+	case strings.HasSuffix(name, "."):
+		return normaliseName(name)
+	default:
+		return normaliseName(name) + "." + zone
+	}
+}
+
+// Parse a state from YAML or JSON. Unknown fields are rejected so that
+// typos don't silently leave something unmanaged.
+func Parse(data []byte) (*State, error) {
+	var state State
+	if err := yaml.UnmarshalWithOptions(data, &state, yaml.Strict()); err != nil {
+		return nil, &InvalidError{Fields: []FieldError{{Field: "body", Condition: yaml.FormatError(err, false, false)}}}
+	}
+	return &state, nil
+}
+
+// Check the state is valid for the known servers and fill in defaults.
+// Names are normalised and made absolute.
+func (s *State) Validate(servers []string) error {
+	fields := []FieldError{}
+	invalid := func(field string, condition string, args ...any) {
+		fields = append(fields, FieldError{Field: field, Condition: fmt.Sprintf(condition, args...)})
+	}
+
+	checkServers := func(field string, ids []string) {
+		for i, id := range ids {
+			found := false
+			for _, server := range servers {
+				found = found || server == id
+			}
+			if !found {
+				invalid(fmt.Sprintf("%s[%d]", field, i), "unknown server %s", id)
+			}
+		}
+	}
+	checkServers("servers", s.Servers)
+
+	checkMode := func(field string, mode *string, fallback string) {
+		switch *mode {
+		case "":
+			*mode = fallback
+		case ModeObserve, ModeEnforce:
+		default:
+			invalid(field, "mode must be %s or %s", ModeObserve, ModeEnforce)
+		}
+	}
+	checkMode("mode", &s.Mode, ModeObserve)
+
+	seenZones := make(map[string]bool)
+	for i := range s.Zones {
+		zone := &s.Zones[i]
+		field := fmt.Sprintf("zones[%d]", i)
+
+		zone.Name = normaliseName(zone.Name)
+		if _, ok := dns.IsDomainName(zone.Name); !ok || zone.Name == "" {
+			invalid(field+".name", "invalid zone name %q", zone.Name)
+		}
+		if seenZones[zone.Name] {
+			invalid(field+".name", "zone %s is declared more than once", zone.Name)
+		}
+		seenZones[zone.Name] = true
+
+		if zone.Type == "" {
+			zone.Type = DefaultZoneType
+		}
+		checkMode(field+".mode", &zone.Mode, s.Mode)
+
+		checkServers(field+".servers", zone.Servers)
+		if zone.Servers == nil {
+			zone.Servers = s.Servers
+		}
+		if len(zone.Servers) == 0 {
+			invalid(field+".servers", "no servers to put the zone on")
+		}
+
+		seenSets := make(map[string]bool)
+		for j := range zone.Records {
+			record := &zone.Records[j]
+			recordField := fmt.Sprintf("%s.records[%d]", field, j)
+
+			record.Type = strings.ToUpper(record.Type)
+			record.Name = absoluteName(record.Name, zone.Name)
+			if _, ok := dns.IsDomainName(record.Name); !ok || !dns.IsSubDomain(zone.Name+".", record.Name+".") {
+				invalid(recordField+".name", "%s is not a name in the zone %s", record.Name, zone.Name)
+			}
+
+			key := record.Name + " " + record.Type
+			if seenSets[key] {
+				invalid(recordField, "%s %s is declared more than once, list every value in one record", record.Name, record.Type)
+			}
+			seenSets[key] = true
+
+			if _, ok := recordTypes[record.Type]; !ok {
+				invalid(recordField+".type", "unsupported record type %q", record.Type)
+				continue
+			}
+
+			if record.Ttl == 0 {
+				record.Ttl = DefaultTtl
+			} else if record.Ttl < 0 {
+				invalid(recordField+".ttl", "TTL must not be negative")
+			}
+
+			if len(record.Values) == 0 {
+				invalid(recordField+".values", "at least one value is required")
+			}
+			for k, value := range record.Values {
+				normalised, err := normaliseValue(record.Type, value)
+				if err != nil {
+					invalid(fmt.Sprintf("%s.values[%d]", recordField, k), "%v", err)
+					continue
+				}
+				record.Values[k] = normalised
+			}
+		}
+	}
+
+	checkDomains := func(field string, list []string) {
+		for i, domain := range list {
+			list[i] = normaliseName(domain)
+			if _, ok := dns.IsDomainName(list[i]); !ok || list[i] == "" {
+				invalid(fmt.Sprintf("%s[%d]", field, i), "invalid domain %q", domain)
+			}
+		}
+		if list != nil && len(s.Servers) == 0 {
+			invalid(field, "servers must be given to manage the %s list", field)
+		}
+	}
+	checkDomains("blocked", s.Blocked)
+	checkDomains("allowed", s.Allowed)
+
+	if len(fields) > 0 {
+		return &InvalidError{Fields: fields}
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package domain
+
+type App struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type AppListResult struct {
+	TechnetiumResponse
+	Response struct {
+		Apps []App `json:"apps"`
+	} `json:"response"`
+}
+
+type AppConfigResult struct {
+	TechnetiumResponse
+	Response struct {
+		// Null if the app has no config
+		Config *string `json:"config"`
+	} `json:"response"`
+}
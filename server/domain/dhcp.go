@@ -0,0 +1,72 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package domain
+
+type DhcpExclusion struct {
+	StartingAddress string
+	EndingAddress   string
+}
+
+type DhcpReservedLease struct {
+	HostName        string
+	HardwareAddress string
+	Address         string
+	Comments        string
+}
+
+// Settings to set a DHCP scope with. Nil fields aren't sent so that
+// Technetium keeps their current value.
+type DhcpScopeSettings struct {
+	StartingAddress         string
+	EndingAddress           string
+	SubnetMask              string
+	LeaseTimeDays           int
+	LeaseTimeHours          int
+	LeaseTimeMinutes        int
+	DomainName              *string
+	RouterAddress           *string
+	UseThisDnsServer        *bool
+	DnsServers              []string
+	Exclusions              []DhcpExclusion
+	ReservedLeases          []DhcpReservedLease
+	AllowOnlyReservedLeases *bool
+}
+
+type DhcpScope struct {
+	Name             string `json:"name"`
+	Enabled          bool   `json:"enabled"`
+	StartingAddress  string `json:"startingAddress"`
+	EndingAddress    string `json:"endingAddress"`
+	SubnetMask       string `json:"subnetMask"`
+	NetworkAddress   string `json:"networkAddress"`
+	BroadcastAddress string `json:"broadcastAddress"`
+	// Only set while the scope is enabled and bound to an interface
+	InterfaceAddress string `json:"interfaceAddress"`
+}
+
+type DhcpScopeListResult struct {
+	TechnetiumResponse
+	Response struct {
+		Scopes []DhcpScope `json:"scopes"`
+	} `json:"response"`
+}
+
+type DhcpLease struct {
+	Scope string `json:"scope"`
+	// Dynamic or Reserved
+	Type             string `json:"type"`
+	HardwareAddress  string `json:"hardwareAddress"`
+	ClientIdentifier string `json:"clientIdentifier"`
+	Address          string `json:"address"`
+	HostName         string `json:"hostName"`
+	LeaseObtained    string `json:"leaseObtained"`
+	LeaseExpires     string `json:"leaseExpires"`
+}
+
+type DhcpLeaseListResult struct {
+	TechnetiumResponse
+	Response struct {
+		Leases []DhcpLease `json:"leases"`
+	} `json:"response"`
+}
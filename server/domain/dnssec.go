@@ -0,0 +1,53 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package domain
+
+import "time"
+
+type DnssecPrivateKey struct {
+	KeyTag         int        `json:"keyTag"`
+	KeyType        string     `json:"keyType"`
+	Algorithm      string     `json:"algorithm"`
+	State          string     `json:"state"`
+	StateChangedOn time.Time  `json:"stateChangedOn"`
+	StateReadyBy   *time.Time `json:"stateReadyBy"`
+	IsRetiring     bool       `json:"isRetiring"`
+	RolloverDays   int        `json:"rolloverDays"`
+}
+
+type DnssecPropertiesResult struct {
+	TechnetiumResponse
+	Response struct {
+		Name              string             `json:"name"`
+		Type              string             `json:"type"`
+		Internal          bool               `json:"internal"`
+		Disabled          bool               `json:"disabled"`
+		DnssecStatus      string             `json:"dnssecStatus"`
+		DnsKeyTtl         int                `json:"dnsKeyTtl"`
+		DnssecPrivateKeys []DnssecPrivateKey `json:"dnssecPrivateKeys"`
+	} `json:"response"`
+}
+
+type DsDigest struct {
+	DigestType string `json:"digestType"`
+	Digest     string `json:"digest"`
+}
+
+type DsRecord struct {
+	KeyTag             int        `json:"keyTag"`
+	DnsKeyState        string     `json:"dnsKeyState"`
+	DnsKeyStateReadyBy *time.Time `json:"dnsKeyStateReadyBy"`
+	Algorithm          string     `json:"algorithm"`
+	PublicKey          string     `json:"publicKey"`
+	Digests            []DsDigest `json:"digests"`
+}
+
+type DsRecordsResult struct {
+	TechnetiumResponse
+	Response struct {
+		Name         string     `json:"name"`
+		DnssecStatus string     `json:"dnssecStatus"`
+		DsRecords    []DsRecord `json:"dsRecords"`
+	} `json:"response"`
+}
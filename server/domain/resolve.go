@@ -0,0 +1,34 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package domain
+
+type DnsRecord struct {
+	Name  string         `json:"Name"`
+	Type  string         `json:"Type"`
+	Ttl   any            `json:"TTL"`
+	RData map[string]any `json:"RDATA"`
+}
+
+type DnsDatagram struct {
+	Metadata struct {
+		NameServer    string `json:"NameServer"`
+		Protocol      string `json:"Protocol"`
+		RoundTripTime string `json:"RoundTripTime"`
+	} `json:"Metadata"`
+	AuthoritativeAnswer bool        `json:"AuthoritativeAnswer"`
+	Truncation          bool        `json:"Truncation"`
+	RecursionDesired    bool        `json:"RecursionDesired"`
+	RecursionAvailable  bool        `json:"RecursionAvailable"`
+	AuthenticData       bool        `json:"AuthenticData"`
+	CheckingDisabled    bool        `json:"CheckingDisabled"`
+	Rcode               string      `json:"RCODE"`
+	Answer              []DnsRecord `json:"Answer"`
+}
+
+type ResolveResult struct {
+	TechnetiumResponse
+	Response struct {
+		Result DnsDatagram `json:"result"`
+	} `json:"response"`
+}
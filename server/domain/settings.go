@@ -0,0 +1,11 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package domain
+
+type SettingsResult struct {
+	TechnetiumResponse
+	// Settings keyed by the names used by the settings API, which vary
+	// between versions of Technetium
+	Response map[string]any `json:"response"`
+}
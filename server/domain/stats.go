@@ -0,0 +1,16 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package domain
+
+import "time"
+
+type UpstreamStats struct {
+	GlobalLimit     int
+	PerRequestLimit int
+	Queued          int64
+	InFlight        int64
+	Completed       int64
+	AverageWait     time.Duration
+	MaxWait         time.Duration
+}
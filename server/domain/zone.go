@@ -0,0 +1,35 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package domain
+
+type Zone struct {
+	Name         string `json:"name"`
+	Type         string `json:"type"`
+	Internal     bool   `json:"internal"`
+	DnssecStatus string `json:"dnssecStatus"`
+	Disabled     bool   `json:"disabled"`
+}
+
+type ZoneListResult struct {
+	TechnetiumResponse
+	Response struct {
+		Zones []Zone `json:"zones"`
+	} `json:"response"`
+}
+
+type ZoneRecord struct {
+	Name     string         `json:"name"`
+	Type     string         `json:"type"`
+	Ttl      int            `json:"ttl"`
+	RData    map[string]any `json:"rData"`
+	Disabled bool           `json:"disabled"`
+}
+
+type ZoneRecordsResult struct {
+	TechnetiumResponse
+	Response struct {
+		Zone    Zone         `json:"zone"`
+		Records []ZoneRecord `json:"records"`
+	} `json:"response"`
+}
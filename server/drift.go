@@ -0,0 +1,156 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package server
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/SidingsMedia/unified-control-rdns/config"
+	"github.com/SidingsMedia/unified-control-rdns/server/desired"
+	"github.com/SidingsMedia/unified-control-rdns/server/domain"
+	"github.com/SidingsMedia/unified-control-rdns/server/model"
+)
+
+// Compares the servers against a directory of desired state files in the
+// background. Drift in zones and lists in observe mode is only reported,
+// while in enforce mode it's corrected.
+type DriftReconciler struct {
+	// Service the corrections are made through so that they are published
+	// like any other change. Set by NewService.
+	service   *service
+	directory string
+	interval  time.Duration
+
+	// Holds a value for the whole of a check so that checks never overlap
+	checking chan struct{}
+
+	mu     sync.RWMutex
+	report model.DriftResponse
+}
+
+// Report and log the outcome of a check
+func (r *DriftReconciler) store(report *model.DriftResponse) {
+	for _, server := range report.Servers {
+		for _, change := range server.Changes {
+			attrs := []any{"server", server.Id, "action", change.Action, "kind", change.Kind, "name", change.Name, "type", change.Type, "mode", change.Mode}
+			switch change.Status {
+			case "applied":
+				slog.Info("Corrected drift from desired state", attrs...)
+			case "failed":
+				slog.Error("Failed to correct drift from desired state", append(attrs, "error", change.Error)...)
+			default:
+				slog.Warn("Drift from desired state", attrs...)
+			}
+
+			if change.Status != "applied" {
+				report.Drifted = true
+			}
+		}
+	}
+
+	r.mu.Lock()
+	r.report = *report
+	r.mu.Unlock()
+}
+
+// Load the desired state and compare every server named in it, correcting
+// drift where the state is in enforce mode. The report is stored and
+// returned. If another check is running it is waited for, and the error
+// from ctx is returned if it's done first.
+func (r *DriftReconciler) Check(ctx context.Context) (model.DriftResponse, error) {
+	select {
+	case r.checking <- struct{}{}:
+	case <-ctx.Done():
+		return model.DriftResponse{}, ctx.Err()
+	}
+	defer func() { <-r.checking }()
+
+	ids := []string{}
+	for _, server := range r.service.repository.GetServers() {
+		ids = append(ids, server.Id)
+	}
+
+	report := model.DriftResponse{Servers: []model.ServerPlan{}}
+	state, err := desired.LoadDir(r.directory, ids)
+	if err != nil {
+		slog.Error("Failed to load desired state", "directory", r.directory, "error", err)
+		report.Error = err.Error()
+	} else {
+		var failed []domain.PerServerFail
+		report.Servers, failed = r.service.apply(ctx, state, false, true)
+		report.Errors = toAffectedServers(failed)
+		for _, server := range report.Servers {
+			report.Changes += len(server.Changes)
+		}
+
+		// Only servers that corrections were made to are published
+		corrected := []string{}
+		for _, server := range report.Servers {
+			if slices.ContainsFunc(server.Changes, func(change model.PlannedChange) bool {
+				return change.Status == "applied" || change.Status == "failed"
+			}) {
+				corrected = append(corrected, server.Id)
+			}
+		}
+		if len(corrected) > 0 {
+			r.service.publish(model.EventStateApplied, "", corrected, slices.DeleteFunc(slices.Clone(failed), func(fail domain.PerServerFail) bool {
+				return !slices.Contains(corrected, fail.Id)
+			}))
+		}
+	}
+
+	now := time.Now().UTC()
+	report.CheckedAt = &now
+	r.store(&report)
+
+	return report, nil
+}
+
+// Outcome of the most recent check
+func (r *DriftReconciler) Report() model.DriftResponse {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.report
+}
+
+// Check for drift straight away and then once per interval until ctx is
+// cancelled
+func (r *DriftReconciler) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		checkCtx, cancel := context.WithTimeout(ctx, r.interval)
+		if _, err := r.Check(WithRequestSlots(checkCtx)); err != nil {
+			slog.Warn("Skipped drift check as the previous check hasn't finished", "error", err)
+		}
+		cancel()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Create a reconciler for the desired state in drift.Directory. Nil is
+// returned if no directory is configured. The reconciler must be passed to
+// NewService with WithDriftReconciler before it's run.
+func NewDriftReconciler(drift config.Drift) *DriftReconciler {
+	if drift.Directory == "" {
+		return nil
+	}
+
+	return &DriftReconciler{
+		checking:  make(chan struct{}, 1),
+		directory: drift.Directory,
+		interval:  drift.Interval,
+		report:    model.DriftResponse{Servers: []model.ServerPlan{}},
+	}
+}
@@ -0,0 +1,2603 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package server_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SidingsMedia/unified-control-rdns/client"
+	"github.com/SidingsMedia/unified-control-rdns/config"
+	"github.com/SidingsMedia/unified-control-rdns/server"
+	"github.com/SidingsMedia/unified-control-rdns/server/events"
+	"github.com/SidingsMedia/unified-control-rdns/server/model"
+	"github.com/SidingsMedia/unified-control-rdns/server/notify"
+	"github.com/SidingsMedia/unified-control-rdns/server/probe"
+	"github.com/SidingsMedia/unified-control-rdns/server/technetiumtest"
+	"github.com/gin-gonic/gin"
+)
+
+var exampleFixture = technetiumtest.Fixture{
+	Cache: []technetiumtest.CacheRecord{
+		{Name: "example.com", Type: "A", Ttl: "300", RData: map[string]any{"ipAddress": "192.0.2.1"}},
+		{Name: "www.example.com", Type: "CNAME", Ttl: "300", RData: map[string]any{"cname": "example.com"}},
+		{Name: "cdn.example.net", Type: "A", Ttl: "60", RData: map[string]any{"ipAddress": "192.0.2.2"}},
+	},
+}
+
+type testEnv struct {
+	client  *client.Client
+	fakes   map[string]*technetiumtest.Server
+	dns     map[string]*technetiumtest.DnsServer
+	monitor *server.HealthMonitor
+	bus     *events.Bus
+}
+
+type testOptions struct {
+	requestTimeout time.Duration
+	cacheTtl       time.Duration
+	// Fixtures to use instead of the shared one for specific servers
+	fixtures map[string]technetiumtest.Fixture
+	// Servers that also get a fake DNS service answering with dnsAnswers
+	dnsServers []string
+	dnsAnswers map[string][]string
+	canaries   []config.Canary
+	// Directory of desired state files to check for drift
+	driftDir  string
+	webhooks  []config.Webhook
+	schedules []config.Schedule
+	// Directory backups are stored in
+	backupDir string
+}
+
+// Start the API in front of a fake Technetium server for each of ids, all
+// seeded with fixture.
+func newTestEnv(t *testing.T, fixture technetiumtest.Fixture, options testOptions, ids ...string) *testEnv {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	env := &testEnv{
+		fakes: make(map[string]*technetiumtest.Server),
+		dns:   make(map[string]*technetiumtest.DnsServer),
+	}
+	servers := []config.Server{}
+	for _, id := range ids {
+		serverFixture, exists := options.fixtures[id]
+		if !exists {
+			serverFixture = fixture
+		}
+
+		fake := technetiumtest.NewServer(t, serverFixture)
+		env.fakes[id] = fake
+		serverConfig := fake.Config(id)
+
+		if slices.Contains(options.dnsServers, id) {
+			env.dns[id] = technetiumtest.NewDnsServer(t, options.dnsAnswers)
+			serverConfig.Dns = env.dns[id].Config()
+		}
+		servers = append(servers, serverConfig)
+	}
+
+	if options.requestTimeout == 0 {
+		options.requestTimeout = 5 * time.Second
+	}
+
+	repository := server.NewRepository(servers, config.Concurrency{Global: 4, PerRequest: 2})
+	if options.cacheTtl > 0 {
+		repository = server.NewCachingRepository(repository, options.cacheTtl)
+	}
+
+	engine := gin.New()
+	engine.Use(server.RequestTimeout(options.requestTimeout))
+	prober := probe.NewProber(servers, config.Probes{Interval: time.Minute, Timeout: time.Second, Canaries: options.canaries})
+	reconciler := server.NewDriftReconciler(config.Drift{Directory: options.driftDir, Interval: time.Minute})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	bus := events.NewBus()
+	notifier, err := notify.NewNotifier(config.Notifications{Webhooks: options.webhooks})
+	if err != nil {
+		t.Fatal(err)
+	}
+	notifier.Start(ctx, bus)
+	env.monitor = server.NewHealthMonitor(repository, time.Minute, bus)
+	env.bus = bus
+
+	for i := range options.schedules {
+		if options.schedules[i].Timeout == 0 {
+			options.schedules[i].Timeout = 5 * time.Second
+		}
+	}
+	backups := server.NewBackupStore(config.Backups{Directory: options.backupDir, Retention: 2}, servers)
+	scheduler, err := server.NewScheduler(repository, options.schedules, backups)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server.NewController(engine, server.NewService(
+		repository,
+		server.WithProber(prober),
+		server.WithDriftReconciler(reconciler),
+		server.WithEvents(bus),
+		server.WithScheduler(scheduler),
+		server.WithBackups(backups),
+	), options.cacheTtl)
+
+	api := httptest.NewServer(engine)
+	t.Cleanup(api.Close)
+	env.client = client.NewClient(api.URL, api.Client())
+
+	return env
+}
+
+func affectedIds(affected []model.AffectedServer) []string {
+	ids := []string{}
+	for _, server := range affected {
+		ids = append(ids, server.Id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func TestListServers(t *testing.T) {
+	env := newTestEnv(t, exampleFixture, testOptions{}, "a", "b")
+
+	servers, err := env.client.ListServers(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(servers.Results) != 2 || servers.Results[0].Id != "a" || servers.Results[1].Id != "b" {
+		t.Errorf("unexpected servers %+v", servers.Results)
+	}
+}
+
+func TestGetCacheMergesServers(t *testing.T) {
+	env := newTestEnv(t, exampleFixture, testOptions{}, "a", "b", "c")
+
+	cache, err := env.client.GetCache(context.Background(), "example.com", []string{"a", "b", "c"}, client.GetCacheOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cache.Errors) != 0 {
+		t.Errorf("expected no errors, got %+v", cache.Errors)
+	}
+
+	if len(cache.Entries) != 1 || cache.Entries[0].Name != "example.com" || cache.Entries[0].Type != "A" {
+		t.Fatalf("unexpected entries %+v", cache.Entries)
+	}
+
+	if len(cache.Entries[0].CachedResult) != 3 {
+		t.Errorf("expected a result from each server, got %+v", cache.Entries[0].CachedResult)
+	}
+
+	if !slices.Equal(cache.Zones, []string{"www.example.com"}) {
+		t.Errorf("unexpected zones %v", cache.Zones)
+	}
+}
+
+func TestGetCachePartialFailure(t *testing.T) {
+	failures := map[string]technetiumtest.Failure{
+		"bad status":       {StatusCode: http.StatusInternalServerError},
+		"malformed json":   {MalformedJson: true},
+		"technetium error": {ErrorMessage: "something went wrong"},
+	}
+
+	for name, failure := range failures {
+		t.Run(name, func(t *testing.T) {
+			env := newTestEnv(t, exampleFixture, testOptions{}, "a", "b")
+			env.fakes["b"].SetFailure(failure)
+
+			cache, err := env.client.GetCache(context.Background(), "example.com", []string{"a", "b"}, client.GetCacheOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if ids := affectedIds(cache.Errors); !slices.Equal(ids, []string{"b"}) {
+				t.Errorf("expected b to fail, got %+v", cache.Errors)
+			}
+
+			if len(cache.Entries) != 1 || len(cache.Entries[0].CachedResult) != 1 || cache.Entries[0].CachedResult[0].Id != "a" {
+				t.Errorf("expected results from a only, got %+v", cache.Entries)
+			}
+		})
+	}
+}
+
+func TestGetCacheAllServersFail(t *testing.T) {
+	env := newTestEnv(t, exampleFixture, testOptions{}, "a", "b")
+	env.fakes["a"].SetFailure(technetiumtest.Failure{StatusCode: http.StatusBadGateway})
+	env.fakes["b"].SetFailure(technetiumtest.Failure{MalformedJson: true})
+
+	cache, err := env.client.GetCache(context.Background(), "example.com", []string{"a", "b"}, client.GetCacheOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ids := affectedIds(cache.Errors); !slices.Equal(ids, []string{"a", "b"}) {
+		t.Errorf("expected both servers to fail, got %+v", cache.Errors)
+	}
+}
+
+func TestGetCacheSlowServer(t *testing.T) {
+	env := newTestEnv(t, exampleFixture, testOptions{requestTimeout: 200 * time.Millisecond}, "a", "b")
+	env.fakes["b"].SetFailure(technetiumtest.Failure{Delay: 5 * time.Second})
+
+	start := time.Now()
+	cache, err := env.client.GetCache(context.Background(), "example.com", []string{"a", "b"}, client.GetCacheOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("request took %s, expected it to be cut off by the deadline", elapsed)
+	}
+
+	if ids := affectedIds(cache.Errors); !slices.Equal(ids, []string{"b"}) {
+		t.Errorf("expected b to time out, got %+v", cache.Errors)
+	}
+}
+
+func TestGetCacheSubtree(t *testing.T) {
+	fixture := technetiumtest.Fixture{
+		Cache: []technetiumtest.CacheRecord{
+			{Name: "example.com", Type: "A", Ttl: "300", RData: map[string]any{"ipAddress": "192.0.2.1"}},
+			{Name: "a.example.com", Type: "A", Ttl: "300", RData: map[string]any{"ipAddress": "192.0.2.2"}},
+			{Name: "a.example.com", Type: "AAAA", Ttl: "300", RData: map[string]any{"ipAddress": "2001:db8::2"}},
+			{Name: "b.c.example.com", Type: "A", Ttl: "300", RData: map[string]any{"ipAddress": "192.0.2.3"}},
+			{Name: "d.e.f.example.com", Type: "A", Ttl: "300", RData: map[string]any{"ipAddress": "192.0.2.4"}},
+			{Name: "www.example.com", Type: "CNAME", Ttl: "300", RData: map[string]any{"cname": "example.com"}},
+		},
+	}
+	env := newTestEnv(t, fixture, testOptions{}, "a", "b")
+
+	cache, err := env.client.GetCache(context.Background(), "", []string{"a", "b"}, client.GetCacheOptions{
+		Type:  "a",
+		Depth: 2,
+		Match: "*.example.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	for _, entry := range cache.Entries {
+		names = append(names, entry.Name+" "+entry.Type)
+		if len(entry.CachedResult) != 2 {
+			t.Errorf("expected %s to be cached on both servers, got %+v", entry.Name, entry.CachedResult)
+		}
+	}
+
+	// d.e.f.example.com is three levels down so should not be reached
+	if !slices.Equal(names, []string{"a.example.com A", "b.c.example.com A"}) {
+		t.Errorf("unexpected entries %v", names)
+	}
+}
+
+func TestGetCacheSubtreeFailure(t *testing.T) {
+	fixture := technetiumtest.Fixture{
+		Cache: []technetiumtest.CacheRecord{
+			{Name: "example.com", Type: "A", Ttl: "300", RData: map[string]any{"ipAddress": "192.0.2.1"}},
+			{Name: "a.example.com", Type: "A", Ttl: "300", RData: map[string]any{"ipAddress": "192.0.2.2"}},
+			{Name: "b.example.com", Type: "A", Ttl: "300", RData: map[string]any{"ipAddress": "192.0.2.3"}},
+		},
+	}
+	env := newTestEnv(t, fixture, testOptions{}, "a", "b")
+	env.fakes["a"].SetFailure(technetiumtest.Failure{Path: "/api/cache/list", Query: "domain=b.example.com", StatusCode: http.StatusBadGateway})
+
+	cache, err := env.client.GetCache(context.Background(), "example.com", []string{"a", "b"}, client.GetCacheOptions{Depth: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the subtree that failed is missing from a
+	if len(cache.Errors) != 0 {
+		t.Errorf("expected no server to fail outright, got %+v", cache.Errors)
+	}
+	if len(cache.Incomplete) != 1 || cache.Incomplete[0].Zone != "b.example.com" || cache.Incomplete[0].Id != "a" {
+		t.Errorf("expected b.example.com to be incomplete on a, got %+v", cache.Incomplete)
+	}
+
+	servers := make(map[string][]string)
+	for _, entry := range cache.Entries {
+		for _, result := range entry.CachedResult {
+			servers[entry.Name] = append(servers[entry.Name], result.Id)
+		}
+	}
+	if !slices.Equal(servers["a.example.com"], []string{"a", "b"}) || !slices.Equal(servers["b.example.com"], []string{"b"}) {
+		t.Errorf("unexpected entries %v", servers)
+	}
+}
+
+func TestGetCacheUnknownServer(t *testing.T) {
+	env := newTestEnv(t, exampleFixture, testOptions{}, "a")
+
+	_, err := env.client.GetCache(context.Background(), "example.com", []string{"a", "missing"}, client.GetCacheOptions{})
+
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404, got %v", err)
+	}
+}
+
+func TestGetCacheInvalidToken(t *testing.T) {
+	env := newTestEnv(t, exampleFixture, testOptions{}, "a", "b")
+	env.fakes["b"].Token = "other"
+
+	cache, err := env.client.GetCache(context.Background(), "example.com", []string{"a", "b"}, client.GetCacheOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ids := affectedIds(cache.Errors); !slices.Equal(ids, []string{"b"}) {
+		t.Errorf("expected b to be rejected, got %+v", cache.Errors)
+	}
+}
+
+func TestDeleteCacheEntry(t *testing.T) {
+	env := newTestEnv(t, exampleFixture, testOptions{}, "a", "b")
+
+	failed, err := env.client.DeleteCacheEntry(context.Background(), "example.com", []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failed != nil {
+		t.Fatalf("expected success, got %+v", failed)
+	}
+
+	for id, fake := range env.fakes {
+		if names := fake.CachedNames(); !slices.Equal(names, []string{"cdn.example.net"}) {
+			t.Errorf("unexpected cache left on %s: %v", id, names)
+		}
+	}
+}
+
+func TestDeleteCacheEntryPartialFailure(t *testing.T) {
+	env := newTestEnv(t, exampleFixture, testOptions{}, "a", "b", "c")
+	env.fakes["c"].SetFailure(technetiumtest.Failure{StatusCode: http.StatusServiceUnavailable})
+
+	failed, err := env.client.DeleteCacheEntry(context.Background(), "example.com", []string{"a", "b", "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if failed == nil {
+		t.Fatal("expected a partial failure")
+	}
+	if ids := affectedIds(failed.AffectedServers); !slices.Equal(ids, []string{"c"}) {
+		t.Errorf("expected c to fail, got %+v", failed.AffectedServers)
+	}
+}
+
+func TestFlushCache(t *testing.T) {
+	env := newTestEnv(t, exampleFixture, testOptions{}, "a", "b")
+	env.fakes["b"].SetFailure(technetiumtest.Failure{Path: "/api/cache/flush", ErrorMessage: "flush failed"})
+
+	failed, err := env.client.FlushCache(context.Background(), []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if failed == nil || !slices.Equal(affectedIds(failed.AffectedServers), []string{"b"}) {
+		t.Fatalf("expected b to fail, got %+v", failed)
+	}
+	if failed.AffectedServers[0].Message != "flush failed" {
+		t.Errorf("unexpected message %q", failed.AffectedServers[0].Message)
+	}
+
+	if names := env.fakes["a"].CachedNames(); len(names) != 0 {
+		t.Errorf("expected cache on a to be empty, got %v", names)
+	}
+	if names := env.fakes["b"].CachedNames(); len(names) != 3 {
+		t.Errorf("expected cache on b to be untouched, got %v", names)
+	}
+}
+
+func TestPurgeCache(t *testing.T) {
+	fixture := technetiumtest.Fixture{
+		Cache: []technetiumtest.CacheRecord{
+			{Name: "example.net", Type: "A", Ttl: "60", RData: map[string]any{"ipAddress": "192.0.2.1"}},
+			{Name: "a.cdn.example.net", Type: "A", Ttl: "60", RData: map[string]any{"ipAddress": "192.0.2.2"}},
+			{Name: "b.x.cdn.example.net", Type: "A", Ttl: "60", RData: map[string]any{"ipAddress": "192.0.2.3"}},
+			{Name: "www.example.net", Type: "A", Ttl: "60", RData: map[string]any{"ipAddress": "192.0.2.4"}},
+		},
+	}
+	env := newTestEnv(t, fixture, testOptions{}, "a", "b")
+	ctx := context.Background()
+
+	purged, err := env.client.PurgeCache(ctx, "", []string{"a", "b"}, client.PurgeCacheOptions{
+		Match:  "*.cdn.example.net",
+		DryRun: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !purged.DryRun || len(purged.Servers) != 2 {
+		t.Fatalf("unexpected response %+v", purged)
+	}
+	for _, server := range purged.Servers {
+		if !slices.Equal(server.Names, []string{"a.cdn.example.net", "b.x.cdn.example.net"}) {
+			t.Errorf("unexpected names for %s: %v", server.Id, server.Names)
+		}
+	}
+	if names := env.fakes["a"].CachedNames(); len(names) != 4 {
+		t.Errorf("dry run should not delete anything, got %v", names)
+	}
+
+	env.fakes["b"].SetFailure(technetiumtest.Failure{Path: "/api/cache/delete", Query: "domain=a.cdn.example.net", StatusCode: http.StatusInternalServerError})
+	purged, err = env.client.PurgeCache(ctx, "", []string{"a", "b"}, client.PurgeCacheOptions{Match: "*.cdn.example.net"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ids := affectedIds(purged.Errors); !slices.Equal(ids, []string{"b"}) {
+		t.Errorf("expected b to fail, got %+v", purged.Errors)
+	}
+	if a := purged.Servers[0]; a.Id != "a" || len(a.Names) != 2 || len(a.Failed) != 0 {
+		t.Errorf("expected both names to be deleted from a, got %+v", a)
+	}
+	if b := purged.Servers[1]; !slices.Equal(b.Names, []string{"b.x.cdn.example.net"}) || len(b.Failed) != 1 || b.Failed[0].Name != "a.cdn.example.net" {
+		t.Errorf("expected only a.cdn.example.net to fail on b, got %+v", b)
+	}
+	if names := env.fakes["a"].CachedNames(); !slices.Equal(names, []string{"example.net", "www.example.net"}) {
+		t.Errorf("unexpected names left on a: %v", names)
+	}
+
+	// A pattern without a domain after its wildcard would purge the whole
+	// cache, so it needs a domain or a dry run
+	var apiErr *client.Error
+	_, err = env.client.PurgeCache(ctx, "", []string{"a"}, client.PurgeCacheOptions{Match: "*"})
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest || len(apiErr.Fields) != 1 || apiErr.Fields[0].Field != "match" {
+		t.Errorf("expected a pattern covering every name to be rejected, got %v", err)
+	}
+	if names := env.fakes["a"].CachedNames(); len(names) != 2 {
+		t.Errorf("expected nothing to be purged, got %v", names)
+	}
+	if _, err := env.client.PurgeCache(ctx, "", []string{"a"}, client.PurgeCacheOptions{Match: "*", DryRun: true}); err != nil {
+		t.Errorf("expected a dry run of the pattern to be allowed, got %v", err)
+	}
+
+	// Purging the subtree removes the rest
+	purged, err = env.client.PurgeCache(ctx, "example.net", []string{"a"}, client.PurgeCacheOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(purged.Errors) != 0 {
+		t.Errorf("unexpected errors %+v", purged.Errors)
+	}
+	if names := env.fakes["a"].CachedNames(); len(names) != 0 {
+		t.Errorf("expected cache on a to be empty, got %v", names)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	fixture := technetiumtest.Fixture{
+		Answers: map[string][]technetiumtest.DnsRecord{
+			"example.com A": {
+				{Name: "example.com", Type: "A", Ttl: 300, RData: map[string]any{"ipAddress": "192.0.2.1"}},
+				{Name: "example.com", Type: "A", Ttl: 300, RData: map[string]any{"ipAddress": "192.0.2.2"}},
+			},
+		},
+	}
+	env := newTestEnv(t, fixture, testOptions{}, "a", "b")
+	ctx := context.Background()
+
+	resolved, err := env.client.Resolve(ctx, "example.com", "a", []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !resolved.Agreed || len(resolved.Servers) != 2 || len(resolved.Answers) != 1 {
+		t.Fatalf("expected servers to agree, got %+v", resolved)
+	}
+	if len(resolved.Answers[0].ResolvedResult) != 4 {
+		t.Errorf("expected two records from each server, got %+v", resolved.Answers[0].ResolvedResult)
+	}
+	if latency := resolved.Servers[0].LatencyMs; latency == nil || *latency != 1.5 {
+		t.Errorf("unexpected latency %v", latency)
+	}
+
+	resolved, err = env.client.Resolve(ctx, "missing.example.com", "A", []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resolved.Agreed || resolved.Servers[0].Rcode != "NxDomain" {
+		t.Errorf("expected both servers to return NxDomain, got %+v", resolved)
+	}
+}
+
+func TestResolveDisagreement(t *testing.T) {
+	answer := func(ip string) technetiumtest.Fixture {
+		return technetiumtest.Fixture{
+			Answers: map[string][]technetiumtest.DnsRecord{
+				"example.com A": {{Name: "example.com", Type: "A", Ttl: 300, RData: map[string]any{"ipAddress": ip}}},
+			},
+		}
+	}
+
+	env := newTestEnv(t, answer("192.0.2.1"), testOptions{
+		fixtures: map[string]technetiumtest.Fixture{"c": answer("192.0.2.9")},
+	}, "a", "b", "c")
+
+	resolved, err := env.client.Resolve(context.Background(), "example.com", "A", []string{"a", "b", "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resolved.Agreed || len(resolved.Answers) != 1 || resolved.Answers[0].Agreed {
+		t.Errorf("expected c to disagree, got %+v", resolved)
+	}
+}
+
+func TestResponseCache(t *testing.T) {
+	env := newTestEnv(t, exampleFixture, testOptions{cacheTtl: time.Minute}, "a")
+	ctx := context.Background()
+
+	listCalls := func() int {
+		count := 0
+		for _, path := range env.fakes["a"].Requests() {
+			if path == "/api/cache/list" {
+				count++
+			}
+		}
+		return count
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := env.client.GetCache(ctx, "example.com", []string{"a"}, client.GetCacheOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls := listCalls(); calls != 1 {
+		t.Errorf("expected repeated reads to be cached, got %d upstream calls", calls)
+	}
+
+	if _, err := env.client.GetCache(ctx, "example.com", []string{"a"}, client.GetCacheOptions{Fresh: true}); err != nil {
+		t.Fatal(err)
+	}
+	if calls := listCalls(); calls != 2 {
+		t.Errorf("expected fresh read to bypass the cache, got %d upstream calls", calls)
+	}
+
+	if _, err := env.client.DeleteCacheEntry(ctx, "example.com", []string{"a"}); err != nil {
+		t.Fatal(err)
+	}
+	cache, err := env.client.GetCache(ctx, "example.com", []string{"a"}, client.GetCacheOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls := listCalls(); calls != 3 {
+		t.Errorf("expected delete to invalidate the cache, got %d upstream calls", calls)
+	}
+	if len(cache.Entries) != 0 {
+		t.Errorf("expected deleted entries to be gone, got %+v", cache.Entries)
+	}
+}
+
+func TestResponseCacheInvalidatedDuringRead(t *testing.T) {
+	env := newTestEnv(t, exampleFixture, testOptions{cacheTtl: time.Minute}, "a")
+	env.fakes["a"].SetFailure(technetiumtest.Failure{Path: "/api/cache/list", Delay: 200 * time.Millisecond})
+	ctx := context.Background()
+
+	listCalls := func() int {
+		count := 0
+		for _, path := range env.fakes["a"].Requests() {
+			if path == "/api/cache/list" {
+				count++
+			}
+		}
+		return count
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := env.client.GetCache(ctx, "example.com", []string{"a"}, client.GetCacheOptions{})
+		done <- err
+	}()
+
+	// Delete while the read is still waiting on the server
+	time.Sleep(50 * time.Millisecond)
+	if _, err := env.client.DeleteCacheEntry(ctx, "example.com", []string{"a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	env.fakes["a"].SetFailure(technetiumtest.Failure{})
+	if _, err := env.client.GetCache(ctx, "example.com", []string{"a"}, client.GetCacheOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if calls := listCalls(); calls != 2 {
+		t.Errorf("expected the read that overlapped the delete not to be cached, got %d upstream calls", calls)
+	}
+}
+
+func TestProbes(t *testing.T) {
+	env := newTestEnv(t, exampleFixture, testOptions{
+		dnsServers: []string{"a"},
+		dnsAnswers: map[string][]string{"example.com A": {"192.0.2.1"}},
+		canaries:   []config.Canary{{Name: "example.com", Type: "A", Expect: []string{"192.0.2.1"}}},
+	}, "a", "b")
+	ctx := context.Background()
+
+	probes, err := env.client.GetProbes(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if probes.Healthy != nil || len(probes.Results) != 0 {
+		t.Errorf("expected no results before the first probe, got %+v", probes)
+	}
+
+	probes, err = env.client.RunProbes(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if probes.Healthy == nil || !*probes.Healthy || len(probes.Results) != 4 {
+		t.Errorf("expected healthy results for every protocol, got %+v", probes)
+	}
+
+	env.dns["a"].SetAnswers(map[string][]string{"example.com A": {"192.0.2.99"}})
+	if _, err := env.client.RunProbes(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	probes, err = env.client.GetProbes(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if probes.Healthy == nil || *probes.Healthy {
+		t.Errorf("expected wrong answers to be unhealthy, got %+v", probes)
+	}
+	for _, result := range probes.Results {
+		if result.Correct == nil || *result.Correct || !slices.Equal(result.Answers, []string{"192.0.2.99"}) {
+			t.Errorf("unexpected result %+v", result)
+		}
+	}
+
+	var apiErr *client.Error
+	for _, id := range []string{"b", "missing"} {
+		if _, err := env.client.GetProbes(ctx, id); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+			t.Errorf("expected 404 for %s, got %v", id, err)
+		}
+	}
+}
+
+func TestProbesWithoutCanaries(t *testing.T) {
+	env := newTestEnv(t, exampleFixture, testOptions{dnsServers: []string{"a"}}, "a")
+
+	probes, err := env.client.RunProbes(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if probes.Healthy != nil || len(probes.Results) != 0 {
+		t.Errorf("expected health to be unknown without canaries, got %+v", probes)
+	}
+}
+
+var signedFixture = technetiumtest.Fixture{
+	Zones: []technetiumtest.Zone{
+		{Name: "example.com", Type: "Primary", DnssecStatus: "SignedWithNSEC"},
+		{Name: "example.net", Type: "Primary", DnssecStatus: "Unsigned"},
+	},
+	DnssecKeys: map[string][]technetiumtest.DnssecKey{
+		"example.com": {
+			{KeyTag: 12345, KeyType: "KeySigningKey", Algorithm: "ECDSAP256SHA256", State: "Active", Digest: "ABCDEF"},
+			{KeyTag: 54321, KeyType: "ZoneSigningKey", Algorithm: "ECDSAP256SHA256", State: "Active", RolloverDays: 30},
+		},
+	},
+}
+
+func TestDsRecordsMerged(t *testing.T) {
+	unsigned := signedFixture
+	unsigned.DnssecKeys = nil
+	env := newTestEnv(t, signedFixture, testOptions{
+		fixtures: map[string]technetiumtest.Fixture{"c": unsigned},
+	}, "a", "b", "c")
+	ctx := context.Background()
+
+	records, err := env.client.GetDsRecords(ctx, "example.com", []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !records.Agreed || len(records.Records) != 1 {
+		t.Fatalf("expected a single agreed record, got %+v", records)
+	}
+
+	record := records.Records[0]
+	if record.Record != "example.com. IN DS 12345 13 2 ABCDEF" {
+		t.Errorf("unexpected presentation format %q", record.Record)
+	}
+	if len(record.Servers) != 2 || record.Servers[0].Id != "a" || record.Servers[1].Id != "b" {
+		t.Errorf("expected the record to list both servers, got %+v", record.Servers)
+	}
+
+	records, err = env.client.GetDsRecords(ctx, "example.com", []string{"a", "b", "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if records.Agreed {
+		t.Errorf("expected server without keys to disagree, got %+v", records)
+	}
+}
+
+func TestSignAndRolloverZone(t *testing.T) {
+	env := newTestEnv(t, signedFixture, testOptions{}, "a", "b")
+	ctx := context.Background()
+	servers := []string{"a", "b"}
+
+	failed, err := env.client.SignZone(ctx, "example.net", "ECDSA", servers, client.SignZoneOptions{NxProof: "NSEC3"})
+	if err != nil || failed != nil {
+		t.Fatalf("expected signing to succeed, got %v %+v", err, failed)
+	}
+
+	status, err := env.client.GetDnssecStatus(ctx, "example.net", servers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Agreed || len(status.Servers) != 2 || status.Servers[0].Status != "SignedWithNSEC3" {
+		t.Fatalf("expected zone to be signed on both servers, got %+v", status)
+	}
+	if len(status.Servers[0].Keys) != 2 || status.Servers[0].Keys[0].Algorithm != "ECDSAP256SHA256" {
+		t.Errorf("expected default curve to be used, got %+v", status.Servers[0].Keys)
+	}
+
+	// Every server generates its own keys so the DS records differ
+	records, err := env.client.GetDsRecords(ctx, "example.net", servers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if records.Agreed || len(records.Records) != 2 {
+		t.Errorf("expected a DS record from each server, got %+v", records)
+	}
+
+	failed, err = env.client.RolloverDnsKey(ctx, "example.com", 54321, []string{"a"})
+	if err != nil || failed != nil {
+		t.Fatalf("expected rollover to succeed, got %v %+v", err, failed)
+	}
+
+	status, err = env.client.GetDnssecStatus(ctx, "example.com", []string{"a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := status.Servers[0].Keys
+	if len(keys) != 3 || !keys[1].Retiring {
+		t.Errorf("expected old key to be retiring alongside a new one, got %+v", keys)
+	}
+
+	failed, err = env.client.RolloverDnsKey(ctx, "example.com", 1, servers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failed == nil || len(failed.AffectedServers) != 2 {
+		t.Errorf("expected unknown key to fail on both servers, got %+v", failed)
+	}
+
+	failed, err = env.client.UnsignZone(ctx, "example.com", servers)
+	if err != nil || failed != nil {
+		t.Fatalf("expected unsigning to succeed, got %v %+v", err, failed)
+	}
+
+	records, err = env.client.GetDsRecords(ctx, "example.com", servers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records.Records) != 0 {
+		t.Errorf("expected no DS records once unsigned, got %+v", records.Records)
+	}
+}
+
+func TestSignZoneValidation(t *testing.T) {
+	env := newTestEnv(t, signedFixture, testOptions{}, "a")
+	ctx := context.Background()
+
+	var apiErr *client.Error
+	_, err := env.client.SignZone(ctx, "example.net", "ECDSA", []string{"a"}, client.SignZoneOptions{Curve: "ED25519"})
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest || len(apiErr.Fields) != 1 || apiErr.Fields[0].Field != "curve" {
+		t.Errorf("expected mismatched curve to be rejected, got %v", err)
+	}
+
+	_, err = env.client.SignZone(ctx, "example.net", "DSA", []string{"a"}, client.SignZoneOptions{})
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected unknown algorithm to be rejected, got %v", err)
+	}
+}
+
+var zoneFixture = technetiumtest.Fixture{
+	Zones: []technetiumtest.Zone{{Name: "example.com", Type: "Primary"}},
+	Records: map[string][]technetiumtest.Record{
+		"example.com": {
+			{Name: "example.com", Type: "NS", Ttl: 3600, RData: map[string]any{"nameServer": "ns1.example.com"}},
+			{Name: "www.example.com", Type: "A", Ttl: 300, RData: map[string]any{"ipAddress": "192.0.2.1"}},
+		},
+	},
+}
+
+func TestExportZone(t *testing.T) {
+	env := newTestEnv(t, zoneFixture, testOptions{}, "a")
+	ctx := context.Background()
+
+	zoneFile, err := env.client.ExportZone(ctx, "example.com", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(zoneFile, "www.example.com.\t300\tIN\tA\t192.0.2.1\n") {
+		t.Errorf("unexpected zone file %q", zoneFile)
+	}
+
+	var apiErr *client.Error
+	if _, err := env.client.ExportZone(ctx, "missing.com", "a"); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadGateway || len(apiErr.AffectedServers) != 1 {
+		t.Errorf("expected missing zone to fail, got %v", err)
+	}
+
+	if _, err := env.client.ExportZone(ctx, "example.com", "missing"); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected unknown server to be not found, got %v", err)
+	}
+}
+
+func TestImportZone(t *testing.T) {
+	env := newTestEnv(t, zoneFixture, testOptions{}, "a", "b")
+	ctx := context.Background()
+
+	zoneFile := `$TTL 600
+www	IN	A	192.0.2.2
+mail	IN	MX	10 mx1
+mx1	IN	A	192.0.2.3
+`
+	failed, err := env.client.ImportZone(ctx, "example.com", zoneFile, []string{"a", "b"}, true)
+	if err != nil || failed != nil {
+		t.Fatalf("expected import to succeed, got %v %+v", err, failed)
+	}
+
+	for _, id := range []string{"a", "b"} {
+		exported, err := env.client.ExportZone(ctx, "example.com", id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, line := range []string{
+			"www.example.com.\t600\tIN\tA\t192.0.2.2\n",
+			"mail.example.com.\t600\tIN\tMX\t10 mx1.example.com.\n",
+			"example.com.\t3600\tIN\tNS\tns1.example.com.\n",
+		} {
+			if !strings.Contains(exported, line) {
+				t.Errorf("expected %s to contain %q, got %q", id, line, exported)
+			}
+		}
+		if strings.Contains(exported, "192.0.2.1") {
+			t.Errorf("expected overwrite to replace the old record on %s, got %q", id, exported)
+		}
+	}
+}
+
+func TestImportInvalidZone(t *testing.T) {
+	env := newTestEnv(t, zoneFixture, testOptions{}, "a")
+
+	zoneFile := "www IN A 192.0.2.1\nbad IN A not-an-address\nworse IN NOPE x\n"
+	_, err := env.client.ImportZone(context.Background(), "example.com", zoneFile, []string{"a"}, false)
+
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected invalid zone file to be rejected, got %v", err)
+	}
+	if len(apiErr.Lines) != 2 || apiErr.Lines[0].Line != 2 || apiErr.Lines[1].Line != 3 {
+		t.Errorf("expected errors on lines 2 and 3, got %+v", apiErr.Lines)
+	}
+
+	if slices.Contains(env.fakes["a"].Requests(), "/api/zones/import") {
+		t.Errorf("expected nothing to be imported from an invalid file")
+	}
+}
+
+const desiredState = `
+servers: [a, b]
+zones:
+  - name: example.com
+    records:
+      - name: www
+        type: A
+        ttl: 300
+        values: [192.0.2.2]
+      - name: mail
+        type: MX
+        values: [10 mx1.example.com]
+      - name: mx1
+        type: A
+        values: [192.0.2.3, 192.0.2.4]
+blocked: [ads.example.org]
+`
+
+func TestApply(t *testing.T) {
+	fixture := zoneFixture
+	fixture.Blocked = []string{"tracker.example.org"}
+	env := newTestEnv(t, fixture, testOptions{
+		fixtures: map[string]technetiumtest.Fixture{"b": {}},
+	}, "a", "b")
+	ctx := context.Background()
+
+	applied, err := env.client.Apply(ctx, []byte(desiredState), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied.Errors) != 0 {
+		t.Fatalf("expected no errors, got %+v", applied.Errors)
+	}
+
+	for _, server := range applied.Servers {
+		for _, change := range server.Changes {
+			if change.Status != "applied" {
+				t.Errorf("expected every change to be applied on %s, got %+v", server.Id, change)
+			}
+		}
+	}
+
+	if len(applied.Servers) != 2 || applied.Servers[1].Changes[0].Kind != "zone" {
+		t.Errorf("expected the zone to be created on b first, got %+v", applied.Servers)
+	}
+
+	for _, id := range []string{"a", "b"} {
+		exported, err := env.client.ExportZone(ctx, "example.com", id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, line := range []string{
+			"www.example.com.\t300\tIN\tA\t192.0.2.2\n",
+			"mail.example.com.\t3600\tIN\tMX\t10 mx1.example.com.\n",
+			"mx1.example.com.\t3600\tIN\tA\t192.0.2.4\n",
+		} {
+			if !strings.Contains(exported, line) {
+				t.Errorf("expected %s to contain %q, got %q", id, line, exported)
+			}
+		}
+		if strings.Contains(exported, "192.0.2.1") {
+			t.Errorf("expected the old record to be replaced on %s, got %q", id, exported)
+		}
+
+		if blocked := env.fakes[id].Blocked(); !slices.Equal(blocked, []string{"ads.example.org"}) {
+			t.Errorf("unexpected blocked list on %s: %v", id, blocked)
+		}
+	}
+
+	// The apex NS records weren't declared so they're left alone
+	if !slices.ContainsFunc(env.fakes["a"].Records("example.com"), func(record technetiumtest.Record) bool {
+		return record.Type == "NS"
+	}) {
+		t.Errorf("expected the apex NS record to be kept")
+	}
+
+	again, err := env.client.Apply(ctx, []byte(desiredState), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Changes != 0 {
+		t.Errorf("expected applying twice to change nothing, got %+v", again.Servers)
+	}
+}
+
+func TestApplyDryRun(t *testing.T) {
+	env := newTestEnv(t, zoneFixture, testOptions{}, "a", "b")
+
+	applied, err := env.client.Apply(context.Background(), []byte(desiredState), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !applied.DryRun || applied.Changes != 8 {
+		t.Errorf("expected four planned changes on each server, got %+v", applied)
+	}
+	for _, server := range applied.Servers {
+		for _, change := range server.Changes {
+			if change.Status != "planned" {
+				t.Errorf("expected change to only be planned, got %+v", change)
+			}
+		}
+	}
+
+	for _, id := range []string{"a", "b"} {
+		for _, path := range env.fakes[id].Requests() {
+			if strings.HasSuffix(path, "/add") || strings.HasSuffix(path, "/delete") || strings.HasSuffix(path, "/create") {
+				t.Errorf("expected a dry run not to change anything, got a request to %s", path)
+			}
+		}
+	}
+}
+
+func TestApplyPartialFailure(t *testing.T) {
+	env := newTestEnv(t, zoneFixture, testOptions{}, "a", "b")
+	env.fakes["b"].SetFailure(technetiumtest.Failure{Path: "/api/zones/records/add", ErrorMessage: "Access was denied."})
+
+	applied, err := env.client.Apply(context.Background(), []byte(desiredState), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ids := affectedIds(applied.Errors); !slices.Equal(ids, []string{"b"}) {
+		t.Fatalf("expected b to fail, got %+v", applied.Errors)
+	}
+
+	statuses := []string{}
+	for _, change := range applied.Servers[1].Changes {
+		statuses = append(statuses, change.Status)
+	}
+	if !slices.Equal(statuses, []string{"failed", "skipped", "skipped", "skipped"}) {
+		t.Errorf("expected the first failure to stop the rest, got %v", statuses)
+	}
+}
+
+func TestApplyInvalidState(t *testing.T) {
+	env := newTestEnv(t, zoneFixture, testOptions{}, "a")
+
+	state := "servers: [a, missing]\nzones:\n  - name: example.com\n    records:\n      - {name: www, type: A, values: [nope]}\n"
+	_, err := env.client.Apply(context.Background(), []byte(state), false)
+
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected invalid state to be rejected, got %v", err)
+	}
+	if len(apiErr.Fields) != 2 || apiErr.Fields[0].Field != "servers[1]" || apiErr.Fields[1].Field != "zones[0].records[0].values[0]" {
+		t.Errorf("unexpected fields %+v", apiErr.Fields)
+	}
+
+	if len(env.fakes["a"].Requests()) != 0 {
+		t.Errorf("expected nothing to be sent to the servers")
+	}
+}
+
+func TestDrift(t *testing.T) {
+	fixture := zoneFixture
+	fixture.Zones = append(slices.Clone(fixture.Zones), technetiumtest.Zone{Name: "example.net", Type: "Primary"})
+	fixture.Records = map[string][]technetiumtest.Record{
+		"example.com": zoneFixture.Records["example.com"],
+		"example.net": {{Name: "www.example.net", Type: "A", Ttl: 300, RData: map[string]any{"ipAddress": "192.0.2.1"}}},
+	}
+
+	dir := t.TempDir()
+	for name, state := range map[string]string{
+		"example.com.yaml": "servers: [a]\nmode: enforce\nzones:\n  - name: example.com\n    records:\n      - {name: www, type: A, ttl: 300, values: [192.0.2.2]}\n",
+		"example.net.yml":  "servers: [a]\nzones:\n  - name: example.net\n    records:\n      - {name: www, type: A, ttl: 300, values: [192.0.2.2]}\n",
+		"README.md":        "not a state file",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(state), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	env := newTestEnv(t, fixture, testOptions{driftDir: dir}, "a")
+	ctx := context.Background()
+
+	drift, err := env.client.GetDrift(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if drift.CheckedAt != nil {
+		t.Errorf("expected no check to have been made yet, got %+v", drift)
+	}
+
+	received, unsubscribe := env.bus.Subscribe(4)
+	defer unsubscribe()
+
+	drift, err = env.client.CheckDrift(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if drift.Error != "" || !drift.Drifted || drift.Changes != 2 {
+		t.Fatalf("expected drift in both zones, got %+v", drift)
+	}
+
+	// Corrections are published like any other change
+	select {
+	case event := <-received:
+		if event.Type != model.EventStateApplied || len(event.Servers) != 1 || event.Servers[0].Id != "a" {
+			t.Errorf("expected the correction to be published, got %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("expected the correction to be published")
+	}
+
+	statuses := map[string]string{}
+	for _, change := range drift.Servers[0].Changes {
+		statuses[change.Zone+" "+change.Mode] = change.Status
+	}
+	if statuses["example.com enforce"] != "applied" || statuses["example.net observe"] != "planned" {
+		t.Errorf("expected only the enforced zone to be corrected, got %v", statuses)
+	}
+
+	for zone, address := range map[string]string{"example.com": "192.0.2.2", "example.net": "192.0.2.1"} {
+		records := env.fakes["a"].Records(zone)
+		if !slices.ContainsFunc(records, func(record technetiumtest.Record) bool {
+			return record.Type == "A" && record.RData["ipAddress"] == address
+		}) {
+			t.Errorf("expected %s to hold %s, got %+v", zone, address, records)
+		}
+	}
+
+	last, err := env.client.GetDrift(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last.CheckedAt == nil || last.Changes != 2 {
+		t.Errorf("expected the last check to be reported, got %+v", last)
+	}
+
+	drift, err = env.client.CheckDrift(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if drift.Changes != 1 || drift.Servers[0].Changes[0].Zone != "example.net" {
+		t.Errorf("expected only the observed zone to still drift, got %+v", drift.Servers)
+	}
+	select {
+	case event := <-received:
+		t.Errorf("expected nothing to be published without corrections, got %+v", event)
+	default:
+	}
+}
+
+func TestDriftInvalidState(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "bad.yaml"), []byte("zones:\n  - name: example.com\n    mode: fix\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	env := newTestEnv(t, zoneFixture, testOptions{driftDir: dir}, "a")
+
+	drift, err := env.client.CheckDrift(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(drift.Error, "bad.yaml: zones[0].mode") || drift.Drifted {
+		t.Errorf("expected the invalid file to be reported, got %+v", drift)
+	}
+}
+
+func TestDriftNotEnabled(t *testing.T) {
+	env := newTestEnv(t, zoneFixture, testOptions{}, "a")
+
+	var apiErr *client.Error
+	if _, err := env.client.GetDrift(context.Background()); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected drift to be not found without a directory, got %v", err)
+	}
+}
+
+// Start a local webhook that passes on every event it receives, checking
+// that each is signed with secret
+func newWebhook(t *testing.T, secret string) (config.Webhook, chan model.Event) {
+	received := make(chan model.Event, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !notify.Verify(secret, body, r.Header.Get(notify.HeaderSignature)) {
+			t.Errorf("webhook received a request with an invalid signature")
+		}
+
+		var event model.Event
+		if err := json.Unmarshal(body, &event); err != nil {
+			t.Errorf("webhook received invalid JSON: %v", err)
+		}
+		received <- event
+	}))
+	t.Cleanup(receiver.Close)
+
+	return config.Webhook{Url: receiver.URL, Secret: secret, RetryDelay: time.Millisecond, Timeout: time.Second}, received
+}
+
+func waitForEvent(t *testing.T, received chan model.Event) model.Event {
+	t.Helper()
+	select {
+	case event := <-received:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for event")
+		return model.Event{}
+	}
+}
+
+func TestWebhookCacheEvents(t *testing.T) {
+	webhook, received := newWebhook(t, "secret")
+	env := newTestEnv(t, exampleFixture, testOptions{webhooks: []config.Webhook{webhook}}, "a", "b")
+	env.fakes["b"].SetFailure(technetiumtest.Failure{StatusCode: http.StatusInternalServerError})
+	ctx := context.Background()
+
+	if _, err := env.client.DeleteCacheEntry(ctx, "example.com", []string{"a", "b"}); err != nil {
+		t.Fatal(err)
+	}
+
+	event := waitForEvent(t, received)
+	if event.Type != model.EventCacheDeleted || event.Domain != "example.com" || len(event.Servers) != 2 || event.Servers[1].Name != "b" {
+		t.Errorf("unexpected event %+v", event)
+	}
+	if event.Failure == nil || event.Failure.Code != http.StatusInternalServerError || !slices.Equal(affectedIds(event.Failure.AffectedServers), []string{"b"}) {
+		t.Errorf("expected the failure on b to be reported, got %+v", event.Failure)
+	}
+
+	if _, err := env.client.FlushCache(ctx, []string{"a"}); err != nil {
+		t.Fatal(err)
+	}
+
+	event = waitForEvent(t, received)
+	if event.Type != model.EventCacheFlushed || event.Failure != nil {
+		t.Errorf("expected a successful flush, got %+v", event)
+	}
+}
+
+func TestWebhookServerHealth(t *testing.T) {
+	webhook, received := newWebhook(t, "secret")
+	env := newTestEnv(t, exampleFixture, testOptions{webhooks: []config.Webhook{webhook}}, "a", "b")
+	ctx := context.Background()
+
+	env.monitor.Check(ctx)
+
+	env.fakes["a"].SetFailure(technetiumtest.Failure{StatusCode: http.StatusServiceUnavailable})
+	env.monitor.Check(ctx)
+	env.monitor.Check(ctx)
+
+	event := waitForEvent(t, received)
+	if event.Type != model.EventServerDown || len(event.Servers) != 1 || event.Servers[0].Id != "a" {
+		t.Fatalf("expected a to go down, got %+v", event)
+	}
+	if event.Failure == nil || event.Failure.Code != http.StatusBadGateway || event.Failure.AffectedServers[0].Id != "a" {
+		t.Errorf("expected the failure to be reported, got %+v", event.Failure)
+	}
+
+	env.fakes["a"].SetFailure(technetiumtest.Failure{})
+	env.monitor.Check(ctx)
+
+	event = waitForEvent(t, received)
+	if event.Type != model.EventServerUp || event.Servers[0].Id != "a" || event.Failure != nil {
+		t.Errorf("expected a to come back up, got %+v", event)
+	}
+
+	select {
+	case event := <-received:
+		t.Errorf("expected no more events, got %+v", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// Follow the event stream in the background, returning the received events
+// and a channel that is sent the error the stream ended with.
+func streamEvents(t *testing.T, env *testEnv, ctx context.Context, options client.StreamEventsOptions) (chan model.Event, chan error) {
+	t.Helper()
+
+	subscribers := env.bus.Subscribers()
+	received := make(chan model.Event, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- env.client.StreamEvents(ctx, options, func(event model.Event) error {
+			received <- event
+			return nil
+		})
+	}()
+
+	waitForSubscribers(t, env, subscribers+1)
+	return received, done
+}
+
+// Wait for the next event published on the bus
+func nextEvent(t *testing.T, received <-chan model.Event) model.Event {
+	t.Helper()
+	select {
+	case event := <-received:
+		return event
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for an event")
+		return model.Event{}
+	}
+}
+
+func waitForSubscribers(t *testing.T, env *testEnv, count int) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); env.bus.Subscribers() != count; {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d subscribers, got %d", count, env.bus.Subscribers())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	env := newTestEnv(t, exampleFixture, testOptions{requestTimeout: 100 * time.Millisecond}, "a", "b")
+	streamCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx := context.Background()
+
+	received, done := streamEvents(t, env, streamCtx, client.StreamEventsOptions{
+		Servers: []string{"a"},
+		Types:   []string{model.EventCacheDeleted, model.EventServerDown},
+	})
+
+	// Outlive the request timeout to show the stream isn't cut off by it
+	time.Sleep(200 * time.Millisecond)
+
+	if _, err := env.client.DeleteCacheEntry(ctx, "example.com", []string{"b"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.client.FlushCache(ctx, []string{"a"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.client.DeleteCacheEntry(ctx, "example.com", []string{"a"}); err != nil {
+		t.Fatal(err)
+	}
+
+	event := waitForEvent(t, received)
+	if event.Type != model.EventCacheDeleted || event.Domain != "example.com" || event.Servers[0].Id != "a" {
+		t.Errorf("expected only the deletion on a, got %+v", event)
+	}
+
+	env.fakes["a"].SetFailure(technetiumtest.Failure{StatusCode: http.StatusServiceUnavailable})
+	env.monitor.Check(ctx)
+
+	event = waitForEvent(t, received)
+	if event.Type != model.EventServerDown || event.Failure == nil || event.Failure.AffectedServers[0].Id != "a" {
+		t.Errorf("expected a to go down, got %+v", event)
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the stream to end when cancelled, got %v", err)
+	}
+	waitForSubscribers(t, env, 0)
+}
+
+func TestEventStreamOperationFailure(t *testing.T) {
+	env := newTestEnv(t, signedFixture, testOptions{}, "a", "b")
+	env.fakes["b"].SetFailure(technetiumtest.Failure{StatusCode: http.StatusInternalServerError})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	received, _ := streamEvents(t, env, ctx, client.StreamEventsOptions{Types: []string{model.EventDnssecUnsigned}})
+
+	if _, err := env.client.UnsignZone(ctx, "example.com", []string{"a", "b"}); err != nil {
+		t.Fatal(err)
+	}
+
+	event := waitForEvent(t, received)
+	if len(event.Servers) != 2 || event.Domain != "example.com" {
+		t.Errorf("expected both servers to be named, got %+v", event)
+	}
+	if event.Failure == nil || len(event.Failure.AffectedServers) != 1 || event.Failure.AffectedServers[0].Id != "b" {
+		t.Errorf("expected b to have failed, got %+v", event.Failure)
+	}
+}
+
+func TestEventStreamStats(t *testing.T) {
+	env := newTestEnv(t, exampleFixture, testOptions{}, "a")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	received, _ := streamEvents(t, env, ctx, client.StreamEventsOptions{
+		Servers:       []string{"b"},
+		Types:         []string{model.EventStats},
+		StatsInterval: 1,
+	})
+
+	event := waitForEvent(t, received)
+	if event.Type != model.EventStats || event.Stats == nil || event.Stats.GlobalLimit != 4 || event.Id == "" {
+		t.Errorf("expected a statistics snapshot, got %+v", event)
+	}
+}
+
+func TestEventStreamInvalidType(t *testing.T) {
+	env := newTestEnv(t, exampleFixture, testOptions{}, "a")
+
+	err := env.client.StreamEvents(context.Background(), client.StreamEventsOptions{Types: []string{"nope"}}, func(model.Event) error {
+		return nil
+	})
+
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest || len(apiErr.Fields) != 1 || apiErr.Fields[0].Field != "type" {
+		t.Errorf("expected the type to be rejected, got %v", err)
+	}
+}
+
+func TestUpstreamRequestLimit(t *testing.T) {
+	env := newTestEnv(t, exampleFixture, testOptions{}, "a")
+	env.fakes["a"].SetFailure(technetiumtest.Failure{Path: "/api/cache/delete", Delay: 50 * time.Millisecond})
+	ctx := context.Background()
+
+	domains := []model.CacheDeleteDomain{}
+	for _, domain := range []string{"a.example", "b.example", "c.example", "d.example", "e.example", "f.example"} {
+		domains = append(domains, model.CacheDeleteDomain{Domain: domain})
+	}
+	if _, err := env.client.DeleteCacheEntries(ctx, model.CacheDeleteRequest{Servers: []string{"a"}, Domains: domains}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every upstream request made for one API request shares its pool
+	if inFlight := env.fakes["a"].MaxInFlight(); inFlight != 2 {
+		t.Errorf("expected at most 2 requests in flight at once, got %d", inFlight)
+	}
+}
+
+func TestJobDeleteCache(t *testing.T) {
+	env := newTestEnv(t, exampleFixture, testOptions{requestTimeout: 100 * time.Millisecond}, "a", "b")
+	env.fakes["b"].SetFailure(technetiumtest.Failure{Path: "/api/cache/delete", Delay: 300 * time.Millisecond})
+	ctx := context.Background()
+
+	job, err := env.client.DeleteCacheEntryAsync(ctx, "example.com", []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != model.JobRunning || job.Operation != "cache.delete" || len(job.Servers) != 2 || job.FinishedAt != nil {
+		t.Fatalf("expected a running job, got %+v", job)
+	}
+
+	// a answers straight away while b is still working
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		job, err = env.client.GetJob(ctx, job.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Servers[0].Requests == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected a to finish, got %+v", job)
+		}
+	}
+	if job.Status != model.JobRunning || job.Servers[1].Status != model.JobServerRunning {
+		t.Errorf("expected b to still be running, got %+v", job)
+	}
+
+	job, err = env.client.WaitForJob(ctx, job.Id, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != model.JobSucceeded || job.Code != http.StatusNoContent || job.Result != nil {
+		t.Errorf("expected the job to succeed, got %+v", job)
+	}
+	for _, server := range job.Servers {
+		if server.Status != model.JobServerSucceeded {
+			t.Errorf("expected %s to succeed, got %+v", server.Id, server)
+		}
+	}
+	if names := env.fakes["b"].CachedNames(); slices.Contains(names, "example.com") {
+		t.Errorf("expected the job to outlive the request timeout, got %v", names)
+	}
+}
+
+func TestJobPartialFailure(t *testing.T) {
+	env := newTestEnv(t, exampleFixture, testOptions{}, "a", "b")
+	env.fakes["b"].SetFailure(technetiumtest.Failure{StatusCode: http.StatusInternalServerError})
+	ctx := context.Background()
+
+	job, err := env.client.FlushCacheAsync(ctx, []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err = env.client.WaitForJob(ctx, job.Id, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if job.Status != model.JobPartial || job.Code != http.StatusInternalServerError {
+		t.Errorf("expected the job to partially succeed, got %+v", job)
+	}
+	if job.Servers[0].Status != model.JobServerSucceeded || job.Servers[1].Status != model.JobServerFailed || job.Servers[1].Message == "" {
+		t.Errorf("expected only b to fail, got %+v", job.Servers)
+	}
+
+	result, ok := job.Result.(map[string]any)
+	if !ok || result["servers"] == nil {
+		t.Errorf("expected the per server failure as the result, got %+v", job.Result)
+	}
+}
+
+func TestJobInvalidRequest(t *testing.T) {
+	env := newTestEnv(t, exampleFixture, testOptions{}, "a")
+	ctx := context.Background()
+
+	job, err := env.client.DeleteCacheEntryAsync(ctx, "example.com", []string{"missing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err = env.client.WaitForJob(ctx, job.Id, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if job.Status != model.JobFailed || job.Code != http.StatusNotFound || job.Servers[0].Status != model.JobServerSkipped {
+		t.Errorf("expected the job to fail without contacting the server, got %+v", job)
+	}
+}
+
+func TestJobCancel(t *testing.T) {
+	env := newTestEnv(t, exampleFixture, testOptions{}, "a", "b")
+	env.fakes["b"].SetFailure(technetiumtest.Failure{Delay: 10 * time.Second})
+	ctx := context.Background()
+
+	job, err := env.client.PurgeCacheAsync(ctx, "example.com", []string{"a", "b"}, client.PurgeCacheOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	job, err = env.client.CancelJob(ctx, job.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("expected the job to stop straight away")
+	}
+	if job.Status != model.JobCancelled || job.FinishedAt == nil || job.Servers[1].Status != model.JobServerFailed {
+		t.Errorf("expected the job to be cancelled, got %+v", job)
+	}
+
+	var apiErr *client.Error
+	if _, err := env.client.CancelJob(ctx, job.Id); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusConflict {
+		t.Errorf("expected a finished job not to be cancelled again, got %v", err)
+	}
+	if _, err := env.client.GetJob(ctx, "missing"); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected an unknown job not to be found, got %v", err)
+	}
+}
+
+func TestScheduleRunNow(t *testing.T) {
+	env := newTestEnv(t, exampleFixture, testOptions{
+		schedules: []config.Schedule{
+			{Id: "purge-example", Cron: "0 3 * * *", Operation: model.ScheduleCacheDelete, Servers: []string{"a"}, Domains: []string{"example.com"}},
+		},
+	}, "a", "b")
+	ctx := context.Background()
+
+	schedules, err := env.client.ListSchedules(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schedules.Results) != 1 || schedules.Results[0].NextRun == nil || schedules.Results[0].LastRun != nil {
+		t.Fatalf("expected the schedule to be waiting for its first run, got %+v", schedules.Results)
+	}
+	if next := schedules.Results[0].NextRun.Local(); next.Hour() != 3 || next.Minute() != 0 {
+		t.Errorf("expected the next run to be at 03:00, got %v", next)
+	}
+
+	run, err := env.client.RunSchedule(ctx, "purge-example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Status != model.RunSucceeded || !run.Manual || run.Failure != nil {
+		t.Errorf("expected the run to succeed, got %+v", run)
+	}
+
+	if slices.Contains(env.fakes["a"].CachedNames(), "example.com") {
+		t.Errorf("expected example.com to be deleted from a")
+	}
+	if !slices.Contains(env.fakes["b"].CachedNames(), "example.com") {
+		t.Errorf("expected b to be left alone")
+	}
+
+	runs, err := env.client.GetScheduleRuns(ctx, "purge-example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs.Results) != 1 || runs.Results[0].StartedAt != run.StartedAt {
+		t.Errorf("expected the run to be recorded, got %+v", runs.Results)
+	}
+
+	var apiErr *client.Error
+	if _, err := env.client.GetScheduleRuns(ctx, "missing"); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected an unknown schedule not to be found, got %v", err)
+	}
+}
+
+func TestScheduleFailure(t *testing.T) {
+	secondary := technetiumtest.Fixture{
+		Zones: []technetiumtest.Zone{{Name: "example.com", Type: "Secondary"}},
+	}
+	env := newTestEnv(t, signedFixture, testOptions{
+		fixtures: map[string]technetiumtest.Fixture{"a": secondary},
+		schedules: []config.Schedule{
+			{Id: "sync", Cron: "*/5 * * * *", Operation: model.ScheduleZoneSync, Zones: []string{"example.com"}},
+		},
+	}, "a", "b")
+	ctx := context.Background()
+
+	run, err := env.client.RunSchedule(ctx, "sync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Status != model.RunPartial || run.Failure == nil {
+		t.Fatalf("expected the run to partially succeed, got %+v", run)
+	}
+	if run.Failure.Code != http.StatusInternalServerError || len(run.Failure.AffectedServers) != 1 || run.Failure.AffectedServers[0].Id != "b" {
+		t.Errorf("expected only the primary zone on b to fail, got %+v", run.Failure)
+	}
+
+	schedules, err := env.client.ListSchedules(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := schedules.Results[0].LastRun; last == nil || last.Status != model.RunPartial {
+		t.Errorf("expected the last run to be reported, got %+v", last)
+	}
+}
+
+func TestScheduleBlockListRefresh(t *testing.T) {
+	env := newTestEnv(t, exampleFixture, testOptions{
+		schedules: []config.Schedule{
+			{Id: "blocklists", Cron: "@daily", Operation: model.ScheduleBlockListRefresh},
+		},
+	}, "a", "b")
+	env.fakes["b"].SetFailure(technetiumtest.Failure{StatusCode: http.StatusBadGateway})
+	ctx := context.Background()
+
+	run, err := env.client.RunSchedule(ctx, "blocklists")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Status != model.RunPartial {
+		t.Errorf("expected the run to partially succeed, got %+v", run)
+	}
+	if !slices.Contains(env.fakes["a"].Requests(), "/api/settings/forceUpdateBlockLists") {
+		t.Errorf("expected block lists to be refreshed on a, got %v", env.fakes["a"].Requests())
+	}
+}
+
+func TestScheduleInvalid(t *testing.T) {
+	repository := server.NewRepository([]config.Server{{Id: "a", Target: "http://127.0.0.1"}}, config.Concurrency{Global: 1, PerRequest: 1})
+
+	for name, schedule := range map[string]config.Schedule{
+		"cron":      {Id: "x", Cron: "* * *", Operation: model.ScheduleCacheFlush},
+		"operation": {Id: "x", Cron: "@daily", Operation: "cache.explode"},
+		"server":    {Id: "x", Cron: "@daily", Operation: model.ScheduleCacheFlush, Servers: []string{"missing"}},
+		"domains":   {Id: "x", Cron: "@daily", Operation: model.ScheduleCacheDelete},
+		"zones":     {Id: "x", Cron: "@daily", Operation: model.ScheduleZoneSync},
+		"backups":   {Id: "x", Cron: "@daily", Operation: model.ScheduleBackup},
+	} {
+		if _, err := server.NewScheduler(repository, []config.Schedule{schedule}, nil); err == nil {
+			t.Errorf("%s: expected the schedule to be rejected", name)
+		}
+	}
+
+	duplicate := config.Schedule{Id: "x", Cron: "@daily", Operation: model.ScheduleCacheFlush}
+	if _, err := server.NewScheduler(repository, []config.Schedule{duplicate, duplicate}, nil); err == nil {
+		t.Errorf("expected duplicate ids to be rejected")
+	}
+}
+
+func TestBulkDeleteCache(t *testing.T) {
+	env := newTestEnv(t, exampleFixture, testOptions{}, "a", "b", "c")
+	env.fakes["b"].SetFailure(technetiumtest.Failure{Path: "/api/cache/delete", StatusCode: http.StatusBadGateway})
+	ctx := context.Background()
+
+	// Servers given more than once are only deleted from once
+	deleted, err := env.client.DeleteCacheEntries(ctx, model.CacheDeleteRequest{
+		Servers: []string{"a", "b", "a"},
+		Domains: []model.CacheDeleteDomain{
+			{Domain: "example.com"},
+			{Domain: "cdn.example.net", Servers: []string{"c", "c"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if deleted.Deleted != 2 || deleted.Failed != 1 || len(deleted.Domains) != 2 {
+		t.Fatalf("expected one of three deletes to fail, got %+v", deleted)
+	}
+	first := deleted.Domains[0]
+	if first.Domain != "example.com" || len(first.Servers) != 2 || !first.Servers[0].Deleted || first.Servers[1].Deleted || first.Servers[1].Message == "" {
+		t.Errorf("expected example.com to fail only on b, got %+v", first)
+	}
+	second := deleted.Domains[1]
+	if second.Domain != "cdn.example.net" || len(second.Servers) != 1 || second.Servers[0].Id != "c" || !second.Servers[0].Deleted {
+		t.Errorf("expected cdn.example.net to be deleted from c alone, got %+v", second)
+	}
+	if len(deleted.Errors) != 1 || deleted.Errors[0].Id != "b" {
+		t.Errorf("expected b to be reported as failed, got %+v", deleted.Errors)
+	}
+
+	if slices.Contains(env.fakes["a"].CachedNames(), "example.com") || !slices.Contains(env.fakes["a"].CachedNames(), "cdn.example.net") {
+		t.Errorf("unexpected cache on a %v", env.fakes["a"].CachedNames())
+	}
+	if slices.Contains(env.fakes["c"].CachedNames(), "cdn.example.net") || !slices.Contains(env.fakes["c"].CachedNames(), "example.com") {
+		t.Errorf("unexpected cache on c %v", env.fakes["c"].CachedNames())
+	}
+}
+
+func TestBulkDeleteCacheInvalid(t *testing.T) {
+	env := newTestEnv(t, exampleFixture, testOptions{}, "a")
+	ctx := context.Background()
+
+	for field, request := range map[string]model.CacheDeleteRequest{
+		"domains":            {Servers: []string{"a"}},
+		"domains[1].domain":  {Servers: []string{"a"}, Domains: []model.CacheDeleteDomain{{Domain: "example.com"}, {}}},
+		"domains[0].servers": {Domains: []model.CacheDeleteDomain{{Domain: "example.com"}}},
+	} {
+		var apiErr *client.Error
+		_, err := env.client.DeleteCacheEntries(ctx, request)
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest || len(apiErr.Fields) != 1 || apiErr.Fields[0].Field != field {
+			t.Errorf("%s: expected the field to be rejected, got %v", field, err)
+		}
+	}
+
+	var apiErr *client.Error
+	_, err := env.client.DeleteCacheEntries(ctx, model.CacheDeleteRequest{
+		Servers: []string{"a"},
+		Domains: []model.CacheDeleteDomain{{Domain: "example.com"}, {Domain: "cdn.example.net", Servers: []string{"missing"}}},
+	})
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected an unknown server not to be found, got %v", err)
+	}
+	if !slices.Contains(env.fakes["a"].CachedNames(), "example.com") {
+		t.Errorf("expected nothing to be deleted when a server is unknown")
+	}
+}
+
+func TestBulkDeleteCacheJob(t *testing.T) {
+	env := newTestEnv(t, exampleFixture, testOptions{}, "a", "b")
+	ctx := context.Background()
+
+	job, err := env.client.DeleteCacheEntriesAsync(ctx, model.CacheDeleteRequest{
+		Servers: []string{"a", "b"},
+		Domains: []model.CacheDeleteDomain{{Domain: "example.com"}, {Domain: "www.example.com"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err = env.client.WaitForJob(ctx, job.Id, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if job.Status != model.JobSucceeded || job.Code != http.StatusOK || job.Servers[0].Requests != 2 {
+		t.Errorf("expected the job to delete both domains, got %+v", job)
+	}
+	if names := env.fakes["b"].CachedNames(); !slices.Equal(names, []string{"cdn.example.net"}) {
+		t.Errorf("expected only cdn.example.net to be left on b, got %v", names)
+	}
+}
+
+var dhcpFixture = technetiumtest.Fixture{
+	DhcpScopes: []technetiumtest.DhcpScope{
+		{Name: "Office", Enabled: true, StartingAddress: "192.168.1.100", EndingAddress: "192.168.1.200", SubnetMask: "255.255.255.0", NetworkAddress: "192.168.1.0", BroadcastAddress: "192.168.1.255"},
+	},
+	DhcpLeases: []technetiumtest.DhcpLease{
+		{Scope: "Office", Type: "Dynamic", HardwareAddress: "00-11-22-33-44-55", ClientIdentifier: "1-001122334455", Address: "192.168.1.120", HostName: "laptop", LeaseObtained: "01/01/2025 09:00:00", LeaseExpires: "01/02/2025 09:00:00"},
+		{Scope: "Guest", Type: "Dynamic", HardwareAddress: "AA-BB-CC-DD-EE-FF", ClientIdentifier: "1-AABBCCDDEEFF", Address: "10.0.0.10", LeaseObtained: "01/01/2025 09:00:00", LeaseExpires: "01/01/2025 10:00:00"},
+	},
+}
+
+func TestDhcpLeasesMerged(t *testing.T) {
+	other := dhcpFixture
+	other.DhcpLeases = []technetiumtest.DhcpLease{
+		{Scope: "Office", Type: "Reserved", HardwareAddress: "00-11-22-33-44-66", ClientIdentifier: "1-001122334466", Address: "192.168.1.105", LeaseObtained: "01/01/2025 08:00:00", LeaseExpires: "01/01/2026 08:00:00"},
+	}
+	env := newTestEnv(t, dhcpFixture, testOptions{
+		fixtures: map[string]technetiumtest.Fixture{"b": other},
+	}, "a", "b", "c")
+	env.fakes["c"].SetFailure(technetiumtest.Failure{StatusCode: http.StatusBadGateway})
+	ctx := context.Background()
+
+	leases, err := env.client.ListDhcpLeases(ctx, "Office", []string{"a", "b", "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(leases.Leases) != 2 {
+		t.Fatalf("expected the Office leases of a and b, got %+v", leases.Leases)
+	}
+	if leases.Leases[0].Server != "b" || leases.Leases[0].Address != "192.168.1.105" || leases.Leases[1].Server != "a" || leases.Leases[1].HostName != "laptop" {
+		t.Errorf("expected leases ordered by address and tagged with their server, got %+v", leases.Leases)
+	}
+	if len(leases.Errors) != 1 || leases.Errors[0].Id != "c" {
+		t.Errorf("expected c to be reported as failed, got %+v", leases.Errors)
+	}
+
+	all, err := env.client.ListDhcpLeases(ctx, "", []string{"a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all.Leases) != 2 || all.Leases[0].Scope != "Guest" {
+		t.Errorf("expected every scope without a filter, got %+v", all.Leases)
+	}
+
+	scopes, err := env.client.ListDhcpScopes(ctx, []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scopes.Scopes) != 2 || scopes.Scopes[0].Server != "a" || scopes.Scopes[1].Server != "b" || !scopes.Scopes[0].Enabled {
+		t.Errorf("expected the scope of each server, got %+v", scopes.Scopes)
+	}
+}
+
+func TestDhcpScopeSet(t *testing.T) {
+	env := newTestEnv(t, dhcpFixture, testOptions{}, "a", "b")
+	ctx := context.Background()
+
+	failed, err := env.client.SetDhcpScope(ctx, "Lab", model.DhcpScopeSettings{
+		StartingAddress: "10.1.0.10",
+		EndingAddress:   "10.1.0.50",
+		SubnetMask:      "255.255.255.0",
+		LeaseTimeHours:  4,
+		DnsServers:      []string{"10.1.0.1", "10.1.0.2"},
+		Exclusions:      []model.DhcpExclusion{{StartingAddress: "10.1.0.20", EndingAddress: "10.1.0.25"}},
+		ReservedLeases:  []model.DhcpReservedLease{{HostName: "printer", HardwareAddress: "00:11:22:33:44:77", Address: "10.1.0.11"}},
+	}, []string{"a", "b"})
+	if err != nil || failed != nil {
+		t.Fatalf("expected the scope to be set, got %v %+v", err, failed)
+	}
+
+	scope, ok := env.fakes["b"].DhcpScope("Lab")
+	if !ok || scope.StartingAddress != "10.1.0.10" || scope.Enabled {
+		t.Fatalf("expected a disabled scope to be created, got %+v", scope)
+	}
+	for key, expected := range map[string]string{
+		"leaseTimeDays":  "0",
+		"leaseTimeHours": "4",
+		"dnsServers":     "10.1.0.1,10.1.0.2",
+		"exclusions":     "10.1.0.20|10.1.0.25",
+		"reservedLeases": "printer|00:11:22:33:44:77|10.1.0.11|",
+	} {
+		if scope.Options[key] != expected {
+			t.Errorf("expected %s to be %q, got %q", key, expected, scope.Options[key])
+		}
+	}
+
+	// Fields that are left out keep their value and empty lists clear it
+	failed, err = env.client.SetDhcpScope(ctx, "Lab", model.DhcpScopeSettings{
+		StartingAddress: "10.1.0.10",
+		EndingAddress:   "10.1.0.60",
+		SubnetMask:      "255.255.255.0",
+		ReservedLeases:  []model.DhcpReservedLease{},
+	}, []string{"b"})
+	if err != nil || failed != nil {
+		t.Fatalf("expected the scope to be updated, got %v %+v", err, failed)
+	}
+	scope, _ = env.fakes["b"].DhcpScope("Lab")
+	for key, expected := range map[string]string{
+		"dnsServers":     "10.1.0.1,10.1.0.2",
+		"exclusions":     "10.1.0.20|10.1.0.25",
+		"reservedLeases": "",
+	} {
+		if scope.Options[key] != expected {
+			t.Errorf("expected %s to be %q after the update, got %q", key, expected, scope.Options[key])
+		}
+	}
+
+	if failed, err := env.client.EnableDhcpScope(ctx, "Lab", []string{"a", "b"}); err != nil || failed != nil {
+		t.Fatalf("expected the scope to be enabled, got %v %+v", err, failed)
+	}
+	if scope, _ := env.fakes["a"].DhcpScope("Lab"); !scope.Enabled {
+		t.Errorf("expected the scope to be enabled on a")
+	}
+
+	failed, err = env.client.DisableDhcpScope(ctx, "Missing", []string{"a"})
+	if err != nil || failed == nil || len(failed.AffectedServers) != 1 {
+		t.Errorf("expected disabling a missing scope to fail, got %v %+v", err, failed)
+	}
+
+	for field, settings := range map[string]model.DhcpScopeSettings{
+		"startingAddress":                   {EndingAddress: "10.1.0.50", SubnetMask: "255.255.255.0"},
+		"endingAddress":                     {StartingAddress: "10.1.0.50", EndingAddress: "10.1.0.10", SubnetMask: "255.255.255.0"},
+		"subnetMask":                        {StartingAddress: "10.1.0.10", EndingAddress: "10.1.0.50", SubnetMask: "255.0.255.0"},
+		"dnsServers[0]":                     {StartingAddress: "10.1.0.10", EndingAddress: "10.1.0.50", SubnetMask: "255.255.255.0", DnsServers: []string{"2001:db8::1"}},
+		"reservedLeases[0].hardwareAddress": {StartingAddress: "10.1.0.10", EndingAddress: "10.1.0.50", SubnetMask: "255.255.255.0", ReservedLeases: []model.DhcpReservedLease{{HardwareAddress: "printer", Address: "10.1.0.11"}}},
+	} {
+		var apiErr *client.Error
+		_, err := env.client.SetDhcpScope(ctx, "Lab", settings, []string{"a"})
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest || len(apiErr.Fields) != 1 || apiErr.Fields[0].Field != field {
+			t.Errorf("%s: expected the field to be rejected, got %v", field, err)
+		}
+	}
+}
+
+func TestDhcpScopeSetAsync(t *testing.T) {
+	env := newTestEnv(t, dhcpFixture, testOptions{}, "a", "b")
+	ctx := context.Background()
+
+	job, err := env.client.SetDhcpScopeAsync(ctx, "Lab", model.DhcpScopeSettings{
+		StartingAddress: "10.1.0.10",
+		EndingAddress:   "10.1.0.50",
+		SubnetMask:      "255.255.255.0",
+	}, []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err = env.client.WaitForJob(ctx, job.Id, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if job.Status != model.JobSucceeded || job.Operation != "dhcp.scope.set" {
+		t.Errorf("expected the job to succeed, got %+v", job)
+	}
+	if _, ok := env.fakes["b"].DhcpScope("Lab"); !ok {
+		t.Errorf("expected the job to create the scope")
+	}
+}
+
+func TestDhcpLeaseChanges(t *testing.T) {
+	env := newTestEnv(t, dhcpFixture, testOptions{}, "a", "b")
+	ctx := context.Background()
+	received, unsubscribe := env.bus.Subscribe(8)
+	defer unsubscribe()
+
+	if failed, err := env.client.ReserveDhcpLease(ctx, "Office", "00:11:22:33:44:55", []string{"a"}); err != nil || failed != nil {
+		t.Fatalf("expected the lease to be reserved, got %v %+v", err, failed)
+	}
+	if leases := env.fakes["a"].DhcpLeases(); leases[0].Type != "Reserved" {
+		t.Errorf("expected the lease on a to be reserved, got %+v", leases[0])
+	}
+	if event := nextEvent(t, received); event.Type != model.EventDhcpLeaseReserved || event.Target != "Office/00:11:22:33:44:55" || event.Failure != nil {
+		t.Errorf("expected the reservation to be published, got %+v", event)
+	}
+
+	if failed, err := env.client.RemoveDhcpLease(ctx, "Office", "00-11-22-33-44-55", []string{"b"}); err != nil || failed != nil {
+		t.Fatalf("expected the lease to be removed, got %v %+v", err, failed)
+	}
+	if leases := env.fakes["b"].DhcpLeases(); len(leases) != 1 || leases[0].Scope != "Guest" {
+		t.Errorf("expected only the guest lease to be left on b, got %+v", leases)
+	}
+
+	failed, err := env.client.RemoveDhcpLease(ctx, "Office", "00-11-22-33-44-55", []string{"a", "b"})
+	if err != nil || failed == nil || len(failed.AffectedServers) != 1 || failed.AffectedServers[0].Id != "b" {
+		t.Errorf("expected removing a missing lease to fail on b, got %v %+v", err, failed)
+	}
+	nextEvent(t, received)
+	if event := nextEvent(t, received); event.Type != model.EventDhcpLeaseRemoved || len(event.Servers) != 2 || event.Failure == nil || event.Failure.AffectedServers[0].Id != "b" {
+		t.Errorf("expected the failure on b to be published, got %+v", event)
+	}
+
+	var apiErr *client.Error
+	_, err = env.client.ReserveDhcpLease(ctx, "Office", "laptop", []string{"a"})
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest || len(apiErr.Fields) != 1 || apiErr.Fields[0].Field != "hardwareAddress" {
+		t.Errorf("expected an invalid hardware address to be rejected, got %v", err)
+	}
+}
+
+var settingsFixture = technetiumtest.Fixture{
+	Settings: map[string]any{
+		"version":             "13.2",
+		"dnsServerDomain":     "dns1.example.com",
+		"recursion":           "AllowOnlyForPrivateNetworks",
+		"enableBlocking":      true,
+		"cacheMaximumEntries": float64(10000),
+		"forwarders":          []any{"1.1.1.1", "1.0.0.1"},
+		"forwarderProtocol":   "Udp",
+	},
+}
+
+func TestSettingsGet(t *testing.T) {
+	env := newTestEnv(t, settingsFixture, testOptions{}, "a")
+	ctx := context.Background()
+
+	settings, err := env.client.GetServerSettings(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.Id != "a" || settings.Settings["recursion"] != "AllowOnlyForPrivateNetworks" || settings.Settings["enableBlocking"] != true {
+		t.Errorf("expected the settings of a, got %+v", settings)
+	}
+
+	env.fakes["a"].SetFailure(technetiumtest.Failure{StatusCode: http.StatusInternalServerError})
+	var apiErr *client.Error
+	_, err = env.client.GetServerSettings(ctx, "a")
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadGateway {
+		t.Errorf("expected a failing server to give bad gateway, got %v", err)
+	}
+
+	_, err = env.client.GetServerSettings(ctx, "missing")
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected an unknown server to give not found, got %v", err)
+	}
+}
+
+func TestSettingsDiff(t *testing.T) {
+	other := settingsFixture
+	other.Settings = maps.Clone(settingsFixture.Settings)
+	other.Settings["dnsServerDomain"] = "dns2.example.com"
+	other.Settings["forwarders"] = []any{"1.0.0.1", "1.1.1.1"}
+	other.Settings["enableBlocking"] = false
+	env := newTestEnv(t, settingsFixture, testOptions{
+		fixtures: map[string]technetiumtest.Fixture{"c": other},
+	}, "a", "b", "c", "d")
+	env.fakes["d"].SetFailure(technetiumtest.Failure{StatusCode: http.StatusInternalServerError})
+	ctx := context.Background()
+
+	diff, err := env.client.DiffSettings(ctx, nil, []string{"a", "b", "c", "d"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(diff.Servers, []string{"a", "b", "c"}) {
+		t.Errorf("expected the servers that answered to be compared, got %v", diff.Servers)
+	}
+	if len(diff.Errors) != 1 || diff.Errors[0].Id != "d" {
+		t.Errorf("expected d to be reported as failed, got %+v", diff.Errors)
+	}
+
+	// The domain of each server is expected to differ so isn't compared
+	keys := []string{}
+	for _, difference := range diff.Differences {
+		keys = append(keys, difference.Key)
+	}
+	if !slices.Equal(keys, []string{"enableBlocking", "forwarders"}) {
+		t.Fatalf("expected blocking and forwarders to differ, got %+v", diff.Differences)
+	}
+	values := diff.Differences[0].Values
+	if len(values) != 2 || !slices.Equal(values[0].Servers, []string{"a", "b"}) || values[0].Value != true || !slices.Equal(values[1].Servers, []string{"c"}) {
+		t.Errorf("expected a and b to share a value, got %+v", values)
+	}
+
+	diff, err = env.client.DiffSettings(ctx, []string{"dnsServerDomain", "recursion", "missing"}, []string{"a", "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.Differences) != 1 || diff.Differences[0].Key != "dnsServerDomain" {
+		t.Errorf("expected only the requested keys to be compared, got %+v", diff.Differences)
+	}
+}
+
+func TestSettingsSet(t *testing.T) {
+	env := newTestEnv(t, settingsFixture, testOptions{}, "a", "b")
+	ctx := context.Background()
+	received, unsubscribe := env.bus.Subscribe(4)
+	defer unsubscribe()
+
+	failed, err := env.client.SetSettings(ctx, map[string]any{
+		"forwarders":          []any{"9.9.9.9", "149.112.112.112"},
+		"forwarderProtocol":   "Tls",
+		"enableBlocking":      false,
+		"cacheMaximumEntries": 20000,
+	}, []string{"a", "b"})
+	if err != nil || failed != nil {
+		t.Fatalf("expected the settings to be changed, got %v %+v", err, failed)
+	}
+	if event := nextEvent(t, received); event.Type != model.EventSettingsChanged || len(event.Servers) != 2 || event.Failure != nil {
+		t.Errorf("expected the change to be published, got %+v", event)
+	}
+
+	for key, expected := range map[string]any{
+		"forwarders":          []any{"9.9.9.9", "149.112.112.112"},
+		"forwarderProtocol":   "Tls",
+		"enableBlocking":      false,
+		"cacheMaximumEntries": float64(20000),
+		"recursion":           "AllowOnlyForPrivateNetworks",
+	} {
+		if value, _ := env.fakes["b"].Setting(key); !reflect.DeepEqual(value, expected) {
+			t.Errorf("expected %s to be %v, got %v", key, expected, value)
+		}
+	}
+
+	if failed, err := env.client.SetSettings(ctx, map[string]any{"forwarders": []any{}}, []string{"a"}); err != nil || failed != nil {
+		t.Fatalf("expected the forwarders to be cleared, got %v %+v", err, failed)
+	}
+	if value, _ := env.fakes["a"].Setting("forwarders"); !reflect.DeepEqual(value, []any{}) {
+		t.Errorf("expected no forwarders to be left, got %v", value)
+	}
+
+	for field, settings := range map[string]map[string]any{
+		"proxy":            {"proxy": map[string]any{"address": "192.0.2.1"}},
+		"forwarders[1]":    {"forwarders": []any{"9.9.9.9", []any{"1.1.1.1"}}},
+		"blockListUrls[0]": {"blockListUrls": []any{map[string]any{"url": "https://example.com/list.txt"}}},
+		"recursion":        {"enableBlocking": true, "recursion": nil},
+	} {
+		var apiErr *client.Error
+		_, err := env.client.SetSettings(ctx, settings, []string{"a"})
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest || len(apiErr.Fields) != 1 || apiErr.Fields[0].Field != field {
+			t.Errorf("%s: expected the field to be rejected, got %v", field, err)
+		}
+	}
+}
+
+var forwarderFixture = technetiumtest.Fixture{
+	Settings: map[string]any{
+		"forwarders":        []any{"1.1.1.1", "1.0.0.1"},
+		"forwarderProtocol": "Udp",
+	},
+	Zones: []technetiumtest.Zone{
+		{Name: "corp.example", Type: "Forwarder"},
+		{Name: "example.com", Type: "Primary"},
+	},
+	Records: map[string][]technetiumtest.Record{
+		"corp.example": {
+			{Name: "corp.example", Type: "FWD", RData: map[string]any{"protocol": "Udp", "forwarder": "10.0.0.53"}},
+			{Name: "corp.example", Type: "FWD", RData: map[string]any{"protocol": "Udp", "forwarder": "10.0.1.53"}},
+		},
+	},
+}
+
+func TestForwardersMerged(t *testing.T) {
+	other := forwarderFixture
+	other.Settings = map[string]any{"forwarders": []any{"dns.quad9.net:853"}, "forwarderProtocol": "Tls"}
+	other.Zones = []technetiumtest.Zone{{Name: "Corp.Example", Type: "Forwarder"}}
+	other.Records = map[string][]technetiumtest.Record{
+		"Corp.Example": {{Name: "corp.example", Type: "FWD", RData: map[string]any{"protocol": "Udp", "forwarder": "10.0.0.53"}}},
+	}
+	env := newTestEnv(t, forwarderFixture, testOptions{
+		fixtures: map[string]technetiumtest.Fixture{"b": other},
+	}, "a", "b", "c")
+	env.fakes["c"].SetFailure(technetiumtest.Failure{StatusCode: http.StatusBadGateway})
+
+	forwarders, err := env.client.GetForwarders(context.Background(), []string{"a", "b", "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []model.ForwardingRule{
+		{Domain: ".", Forwarder: model.Forwarder{Protocol: "Udp", Address: "1.1.1.1"}, Servers: []string{"a"}},
+		{Domain: ".", Forwarder: model.Forwarder{Protocol: "Udp", Address: "1.0.0.1"}, Servers: []string{"a"}},
+		{Domain: ".", Forwarder: model.Forwarder{Protocol: "Tls", Address: "dns.quad9.net:853"}, Servers: []string{"b"}},
+		{Domain: "corp.example", Forwarder: model.Forwarder{Protocol: "Udp", Address: "10.0.0.53"}, Servers: []string{"a", "b"}},
+		{Domain: "corp.example", Forwarder: model.Forwarder{Protocol: "Udp", Address: "10.0.1.53"}, Servers: []string{"a"}},
+	}
+	if !reflect.DeepEqual(forwarders.Rules, expected) {
+		t.Errorf("expected rules %+v, got %+v", expected, forwarders.Rules)
+	}
+	if len(forwarders.Errors) != 1 || forwarders.Errors[0].Id != "c" {
+		t.Errorf("expected c to be reported as failed, got %+v", forwarders.Errors)
+	}
+}
+
+func TestForwardersSet(t *testing.T) {
+	env := newTestEnv(t, forwarderFixture, testOptions{}, "a", "b")
+	ctx := context.Background()
+	received, unsubscribe := env.bus.Subscribe(4)
+	defer unsubscribe()
+
+	failed, err := env.client.SetForwarders(ctx, model.ForwarderSettings{
+		Protocol:   model.ForwarderHttps,
+		Forwarders: []string{"https://cloudflare-dns.com/dns-query (1.1.1.1)"},
+	}, []string{"a", "b"})
+	if err != nil || failed != nil {
+		t.Fatalf("expected the forwarders to be set, got %v %+v", err, failed)
+	}
+	if event := nextEvent(t, received); event.Type != model.EventForwardersChanged || len(event.Servers) != 2 {
+		t.Errorf("expected the change to be published, got %+v", event)
+	}
+	if value, _ := env.fakes["b"].Setting("forwarders"); !reflect.DeepEqual(value, []any{"https://cloudflare-dns.com/dns-query (1.1.1.1)"}) {
+		t.Errorf("expected the forwarders of b to be replaced, got %v", value)
+	}
+	if value, _ := env.fakes["b"].Setting("forwarderProtocol"); value != "Https" {
+		t.Errorf("expected the protocol of b to be Https, got %v", value)
+	}
+
+	if failed, err := env.client.SetForwarders(ctx, model.ForwarderSettings{Forwarders: []string{}}, []string{"a"}); err != nil || failed != nil {
+		t.Fatalf("expected forwarding to be turned off, got %v %+v", err, failed)
+	}
+	if value, _ := env.fakes["a"].Setting("forwarders"); !reflect.DeepEqual(value, []any{}) {
+		t.Errorf("expected no forwarders to be left on a, got %v", value)
+	}
+
+	for field, settings := range map[string]model.ForwarderSettings{
+		"protocol":      {Protocol: "Doh", Forwarders: []string{"1.1.1.1"}},
+		"forwarders[0]": {Protocol: "Https", Forwarders: []string{"1.1.1.1"}},
+		"forwarders[1]": {Protocol: "Tls", Forwarders: []string{"dns.quad9.net:853", "1.1.1.1:99999"}},
+	} {
+		var apiErr *client.Error
+		_, err := env.client.SetForwarders(ctx, settings, []string{"a"})
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest || len(apiErr.Fields) != 1 || apiErr.Fields[0].Field != field {
+			t.Errorf("%s: expected the field to be rejected, got %v", field, err)
+		}
+	}
+}
+
+func TestForwarderZones(t *testing.T) {
+	env := newTestEnv(t, forwarderFixture, testOptions{
+		fixtures: map[string]technetiumtest.Fixture{"b": {}},
+	}, "a", "b")
+	ctx := context.Background()
+	received, unsubscribe := env.bus.Subscribe(8)
+	defer unsubscribe()
+
+	forwarders := []model.Forwarder{
+		{Protocol: model.ForwarderTls, Address: "dc1.corp.example:853"},
+		{Protocol: model.ForwarderUdp, Address: "this-server"},
+	}
+	failed, err := env.client.SetForwarderZone(ctx, "corp.example", forwarders, []string{"a", "b"})
+	if err != nil || failed != nil {
+		t.Fatalf("expected the zone to be set, got %v %+v", err, failed)
+	}
+	if event := nextEvent(t, received); event.Type != model.EventForwarderZoneUpdated || event.Domain != "corp.example" || event.Failure != nil {
+		t.Errorf("expected the zone to be published, got %+v", event)
+	}
+
+	// The zone is replaced on a and created on b
+	for _, id := range []string{"a", "b"} {
+		records := env.fakes[id].Records("corp.example")
+		if len(records) != 2 || records[0].RData["forwarder"] != "dc1.corp.example:853" || records[1].RData["forwarder"] != "this-server" {
+			t.Errorf("expected %s to forward to the new forwarders, got %+v", id, records)
+		}
+	}
+
+	failed, err = env.client.SetForwarderZone(ctx, "example.com", forwarders, []string{"a", "b"})
+	if err != nil || failed == nil || len(failed.AffectedServers) != 1 || failed.AffectedServers[0].Id != "a" {
+		t.Errorf("expected a primary zone of the same name to fail, got %v %+v", err, failed)
+	}
+	if event := nextEvent(t, received); event.Failure == nil || event.Failure.AffectedServers[0].Id != "a" {
+		t.Errorf("expected the failure on a to be published, got %+v", event)
+	}
+
+	if failed, err := env.client.DeleteForwarderZone(ctx, "corp.example", []string{"a", "b"}); err != nil || failed != nil {
+		t.Fatalf("expected the zone to be deleted, got %v %+v", err, failed)
+	}
+	if event := nextEvent(t, received); event.Type != model.EventForwarderZoneDeleted || event.Domain != "corp.example" {
+		t.Errorf("expected the deletion to be published, got %+v", event)
+	}
+	if failed, err := env.client.DeleteForwarderZone(ctx, "corp.example", []string{"a"}); err != nil || failed != nil {
+		t.Errorf("expected deleting a missing zone to succeed, got %v %+v", err, failed)
+	}
+	rules, err := env.client.GetForwarders(ctx, []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rule := range rules.Rules {
+		if rule.Domain == "corp.example" {
+			t.Errorf("expected corp.example to no longer be forwarded, got %+v", rule)
+		}
+	}
+
+	for field, forwarders := range map[string][]model.Forwarder{
+		"forwarders":             nil,
+		"forwarders[0].address":  {{Protocol: "Udp", Address: "not a host"}},
+		"forwarders[1].protocol": {{Protocol: "Udp", Address: "10.0.0.53"}, {Address: "10.0.1.53"}},
+	} {
+		var apiErr *client.Error
+		_, err := env.client.SetForwarderZone(ctx, "corp.example", forwarders, []string{"a"})
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest || len(apiErr.Fields) != 1 || apiErr.Fields[0].Field != field {
+			t.Errorf("%s: expected the field to be rejected, got %v", field, err)
+		}
+	}
+}
+
+// Build an app archive in the form the fake server reads
+func appArchive(t *testing.T, version string, config string) []byte {
+	t.Helper()
+
+	var archive bytes.Buffer
+	writer := zip.NewWriter(&archive)
+	files := map[string]string{"version.txt": version}
+	if config != "" {
+		files["dnsApp.config"] = config
+	}
+	for name, contents := range files {
+		file, err := writer.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.Write([]byte(contents))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return archive.Bytes()
+}
+
+func TestAppsList(t *testing.T) {
+	env := newTestEnv(t, technetiumtest.Fixture{
+		Apps: []technetiumtest.App{{Name: "Split Horizon", Version: "1.9"}, {Name: "Geo Country", Version: "2.0"}},
+	}, testOptions{
+		fixtures: map[string]technetiumtest.Fixture{
+			"b": {Apps: []technetiumtest.App{{Name: "split horizon", Version: "1.10"}}},
+			"c": {},
+		},
+	}, "a", "b", "c")
+
+	apps, err := env.client.ListApps(context.Background(), []string{"a", "b", "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []model.App{
+		{Name: "Geo Country", Versions: []model.AppVersion{{Version: "2.0", Servers: []string{"a"}}}, Missing: []string{"b", "c"}},
+		{Name: "Split Horizon", Versions: []model.AppVersion{
+			{Version: "1.10", Servers: []string{"b"}},
+			{Version: "1.9", Servers: []string{"a"}},
+		}, Missing: []string{"c"}},
+	}
+	if !reflect.DeepEqual(apps.Apps, expected) {
+		t.Errorf("expected apps to be grouped by name with the newest version first, got %+v", apps.Apps)
+	}
+}
+
+func TestAppsInstall(t *testing.T) {
+	config := `{"enabled": true}`
+	env := newTestEnv(t, technetiumtest.Fixture{
+		Apps: []technetiumtest.App{{Name: "Split Horizon", Version: "1.0", Config: &config}},
+	}, testOptions{
+		fixtures: map[string]technetiumtest.Fixture{"b": {}},
+	}, "a", "b")
+	ctx := context.Background()
+	received, unsubscribe := env.bus.Subscribe(4)
+	defer unsubscribe()
+
+	failed, err := env.client.InstallApp(ctx, "Split Horizon", appArchive(t, "1.1", `{"enabled": false}`), []string{"a", "b"})
+	if err != nil || failed != nil {
+		t.Fatalf("expected the app to be installed, got %v %+v", err, failed)
+	}
+
+	// The app is updated on a, keeping its config, and installed on b
+	if app, ok := env.fakes["a"].App("Split Horizon"); !ok || app.Version != "1.1" || *app.Config != config {
+		t.Errorf("expected the app to be updated on a, got %+v", app)
+	}
+	if app, ok := env.fakes["b"].App("Split Horizon"); !ok || app.Version != "1.1" || *app.Config != `{"enabled": false}` {
+		t.Errorf("expected the app to be installed on b, got %+v", app)
+	}
+	if event := nextEvent(t, received); event.Type != model.EventAppInstalled || event.Target != "Split Horizon" || len(event.Servers) != 2 {
+		t.Errorf("expected the install to be published, got %+v", event)
+	}
+
+	var apiErr *client.Error
+	_, err = env.client.InstallApp(ctx, "Split Horizon", []byte("not a zip"), []string{"a"})
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected an invalid archive to be rejected, got %v", err)
+	}
+
+	if failed, err := env.client.UninstallApp(ctx, "split horizon", []string{"a", "b"}); err != nil || failed != nil {
+		t.Fatalf("expected the app to be uninstalled, got %v %+v", err, failed)
+	}
+	if event := nextEvent(t, received); event.Type != model.EventAppUninstalled || event.Target != "split horizon" {
+		t.Errorf("expected the uninstall to be published, got %+v", event)
+	}
+	if failed, err := env.client.UninstallApp(ctx, "Split Horizon", []string{"a"}); err != nil || failed != nil {
+		t.Errorf("expected uninstalling a missing app to succeed, got %v %+v", err, failed)
+	}
+	for _, id := range []string{"a", "b"} {
+		if _, ok := env.fakes[id].App("Split Horizon"); ok {
+			t.Errorf("expected the app to be uninstalled from %s", id)
+		}
+	}
+}
+
+func TestAppConfig(t *testing.T) {
+	config := `{"enabled": true}`
+	env := newTestEnv(t, technetiumtest.Fixture{
+		Apps: []technetiumtest.App{{Name: "Split Horizon", Version: "1.0", Config: &config}},
+	}, testOptions{
+		fixtures: map[string]technetiumtest.Fixture{
+			"b": {Apps: []technetiumtest.App{{Name: "Split Horizon", Version: "1.0"}}},
+			"c": {},
+		},
+	}, "a", "b", "c")
+	ctx := context.Background()
+	received, unsubscribe := env.bus.Subscribe(4)
+	defer unsubscribe()
+
+	configs, err := env.client.GetAppConfig(ctx, "Split Horizon", []string{"a", "b", "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []model.AppConfig{
+		{Server: "a", Config: json.RawMessage(`{"enabled":true}`)},
+		{Server: "b", Config: json.RawMessage("null")},
+	}
+	if !reflect.DeepEqual(configs.Configs, expected) {
+		t.Errorf("expected the config of a and b, got %+v", configs.Configs)
+	}
+	if len(configs.Errors) != 1 || configs.Errors[0].Id != "c" {
+		t.Errorf("expected c to fail without the app, got %+v", configs.Errors)
+	}
+
+	updated := json.RawMessage(`{"enabled": false, "networks": ["10.0.0.0/8"]}`)
+	if failed, err := env.client.SetAppConfig(ctx, "Split Horizon", updated, []string{"a", "b"}); err != nil || failed != nil {
+		t.Fatalf("expected the config to be set, got %v %+v", err, failed)
+	}
+	if event := nextEvent(t, received); event.Type != model.EventAppConfigChanged || event.Target != "Split Horizon" || event.Failure != nil {
+		t.Errorf("expected the config change to be published, got %+v", event)
+	}
+	for _, id := range []string{"a", "b"} {
+		if app, _ := env.fakes[id].App("Split Horizon"); app.Config == nil || *app.Config != string(updated) {
+			t.Errorf("expected the config to be set on %s, got %v", id, app.Config)
+		}
+	}
+
+	var apiErr *client.Error
+	_, err = env.client.SetAppConfig(ctx, "Split Horizon", json.RawMessage("{"), []string{"a"})
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected invalid JSON to be rejected, got %v", err)
+	}
+}
+
+var backupFixture = technetiumtest.Fixture{
+	Zones: []technetiumtest.Zone{{Name: "example.com", Type: "Primary"}},
+	Records: map[string][]technetiumtest.Record{
+		"example.com": {{Name: "example.com", Type: "A", Ttl: 300, RData: map[string]any{"ipAddress": "192.0.2.1"}}},
+	},
+	Settings: map[string]any{"enableBlocking": false},
+}
+
+func TestBackupRestore(t *testing.T) {
+	other := technetiumtest.Fixture{
+		Zones: []technetiumtest.Zone{{Name: "other.test", Type: "Primary"}},
+		Records: map[string][]technetiumtest.Record{
+			"other.test": {{Name: "other.test", Type: "A", Ttl: 300, RData: map[string]any{"ipAddress": "192.0.2.2"}}},
+		},
+		Settings: map[string]any{"enableBlocking": true},
+	}
+	env := newTestEnv(t, backupFixture, testOptions{
+		fixtures: map[string]technetiumtest.Fixture{"b": other, "c": other},
+	}, "a", "b", "c")
+	ctx := context.Background()
+	received, unsubscribe := env.bus.Subscribe(4)
+	defer unsubscribe()
+
+	archive, err := env.client.BackupServer(ctx, "a", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive))); err != nil {
+		t.Fatalf("expected the backup to be a zip archive, got %v", err)
+	}
+
+	if failed, err := env.client.RestoreServer(ctx, "b", archive, false); err != nil || failed != nil {
+		t.Fatalf("expected b to be restored, got %v %+v", err, failed)
+	}
+	if event := nextEvent(t, received); event.Type != model.EventServerRestored || len(event.Servers) != 1 || event.Servers[0].Id != "b" {
+		t.Errorf("expected the restore to be published, got %+v", event)
+	}
+	if value, _ := env.fakes["b"].Setting("enableBlocking"); value != false {
+		t.Errorf("expected the settings of a to be restored to b, got %v", value)
+	}
+	if len(env.fakes["b"].Records("example.com")) != 1 || len(env.fakes["b"].Records("other.test")) != 1 {
+		t.Errorf("expected b to keep its own zone alongside the restored one")
+	}
+
+	if failed, err := env.client.RestoreServer(ctx, "c", archive, true); err != nil || failed != nil {
+		t.Fatalf("expected c to be restored, got %v %+v", err, failed)
+	}
+	if len(env.fakes["c"].Records("example.com")) != 1 || len(env.fakes["c"].Records("other.test")) != 0 {
+		t.Errorf("expected the zones of c to be replaced by those in the backup")
+	}
+
+	// The backup outlives the request when the restore runs as a job
+	job, err := env.client.RestoreServerAsync(ctx, "b", archive, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err = env.client.WaitForJob(ctx, job.Id, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != model.JobSucceeded || len(env.fakes["b"].Records("other.test")) != 0 {
+		t.Errorf("expected b to be restored by the job, got %+v", job)
+	}
+
+	var apiErr *client.Error
+	_, err = env.client.RestoreServer(ctx, "b", []byte("not a zip"), false)
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected an invalid backup to be rejected, got %v", err)
+	}
+
+	_, err = env.client.StoreBackup(ctx, "a", false)
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected storing a backup to fail without a backup directory, got %v", err)
+	}
+
+	env.fakes["a"].SetFailure(technetiumtest.Failure{ErrorMessage: "Access was denied."})
+	_, err = env.client.BackupServer(ctx, "a", false)
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadGateway {
+		t.Errorf("expected a failed backup to be reported, got %v", err)
+	}
+}
+
+func TestBackupPastTimeout(t *testing.T) {
+	env := newTestEnv(t, backupFixture, testOptions{requestTimeout: 100 * time.Millisecond}, "a", "b")
+	ctx := context.Background()
+
+	// Transfers aren't cut off by the request timeout however long they take
+	env.fakes["a"].SetFailure(technetiumtest.Failure{Path: "/api/settings/backup", Delay: 300 * time.Millisecond})
+	archive, err := env.client.BackupServer(ctx, "a", false)
+	if err != nil {
+		t.Fatalf("expected a slow backup to finish, got %v", err)
+	}
+
+	env.fakes["b"].SetFailure(technetiumtest.Failure{Path: "/api/settings/restore", Delay: 300 * time.Millisecond})
+	if failed, err := env.client.RestoreServer(ctx, "b", archive, false); err != nil || failed != nil {
+		t.Errorf("expected a slow restore to finish, got %v %+v", err, failed)
+	}
+}
+
+func TestBackupStore(t *testing.T) {
+	env := newTestEnv(t, backupFixture, testOptions{backupDir: t.TempDir()}, "a", "b")
+	ctx := context.Background()
+	received, unsubscribe := env.bus.Subscribe(4)
+	defer unsubscribe()
+
+	// Only the newest two backups of each server are kept
+	stored := []*model.Backup{}
+	for i := 0; i < 3; i++ {
+		backup, err := env.client.StoreBackup(ctx, "a", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stored = append(stored, backup)
+		if event := nextEvent(t, received); event.Type != model.EventBackupCreated || event.Target != backup.Name || event.Servers[0].Id != "a" {
+			t.Errorf("expected the backup to be published, got %+v", event)
+		}
+	}
+	if _, err := env.client.StoreBackup(ctx, "b", false); err != nil {
+		t.Fatal(err)
+	}
+
+	backups, err := env.client.ListBackups(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups.Results) != 2 || backups.Results[0].Name != stored[2].Name || backups.Results[1].Name != stored[1].Name {
+		t.Errorf("expected the newest two backups of a, got %+v", backups.Results)
+	}
+
+	backups, err = env.client.ListBackups(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newestFirst := slices.IsSortedFunc(backups.Results, func(a model.Backup, b model.Backup) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	if len(backups.Results) != 3 || !newestFirst {
+		t.Errorf("expected the backups of every server, newest first, got %+v", backups.Results)
+	}
+
+	archive, err := env.client.GetBackup(ctx, "a", stored[2].Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(archive)) != stored[2].Size {
+		t.Errorf("expected the stored backup to be downloaded, got %d bytes", len(archive))
+	}
+
+	var apiErr *client.Error
+	for _, name := range []string{stored[0].Name, "../b/" + stored[2].Name, "backup.zip"} {
+		_, err := env.client.GetBackup(ctx, "a", name)
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+			t.Errorf("%s: expected the backup to not be found, got %v", name, err)
+		}
+	}
+
+	// Only configured servers name a directory in the store
+	for _, id := range []string{"missing", "..", "."} {
+		_, err := env.client.ListBackups(ctx, id)
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound || apiErr.Message != server.ErrServerNotFound.Error() {
+			t.Errorf("%s: expected the server to not be found, got %v", id, err)
+		}
+		_, err = env.client.GetBackup(ctx, id, stored[2].Name)
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+			t.Errorf("%s: expected the backup to not be found, got %v", id, err)
+		}
+	}
+}
+
+func TestScheduleBackup(t *testing.T) {
+	env := newTestEnv(t, backupFixture, testOptions{
+		backupDir: t.TempDir(),
+		schedules: []config.Schedule{
+			{Id: "nightly-backup", Cron: "0 2 * * *", Operation: model.ScheduleBackup},
+		},
+	}, "a", "b")
+	ctx := context.Background()
+
+	env.fakes["b"].SetFailure(technetiumtest.Failure{Path: "/api/settings/backup", StatusCode: http.StatusInternalServerError})
+	run, err := env.client.RunSchedule(ctx, "nightly-backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Status != model.RunPartial || len(run.Failure.AffectedServers) != 1 || run.Failure.AffectedServers[0].Id != "b" {
+		t.Fatalf("expected the backup of b to fail, got %+v", run)
+	}
+
+	backups, err := env.client.ListBackups(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups.Results) != 1 || backups.Results[0].Server != "a" {
+		t.Errorf("expected a to be backed up, got %+v", backups.Results)
+	}
+}
@@ -9,4 +9,9 @@ var (
 	ErrServerNotFound      = errors.New("server with provided id could not be found")
 	ErrStatusNotOk         = errors.New("server returned an response code that was not 200 OK")
 	ErrStructFieldNotFound = errors.New("attempted to lookup get name of struct field that doesn't exist")
+	ErrProbesNotEnabled    = errors.New("server does not have a DNS address to probe")
+	ErrDriftNotEnabled     = errors.New("no desired state directory is configured")
+	ErrScheduleNotFound    = errors.New("schedule with provided id could not be found")
+	ErrBackupsNotEnabled   = errors.New("no backup directory is configured")
+	ErrBackupNotFound      = errors.New("backup with provided name could not be found")
 )
@@ -0,0 +1,86 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+// Package events passes events about the servers from the parts of the
+// service that notice them to the parts that send them on.
+package events
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/SidingsMedia/unified-control-rdns/server/model"
+)
+
+// Delivers each published event to every subscriber
+type Bus struct {
+	mu          sync.Mutex
+	subscribers map[chan model.Event]struct{}
+}
+
+// Fill in the id and time of an event if they aren't set
+func Stamp(event *model.Event) {
+	if event.Id == "" {
+		id := make([]byte, 16)
+		rand.Read(id)
+		event.Id = hex.EncodeToString(id)
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+}
+
+// Send an event to every subscriber. Publishing never blocks, so a
+// subscriber that has fallen behind by more than its buffer misses events.
+// A nil bus drops every event.
+func (b *Bus) Publish(event model.Event) {
+	if b == nil {
+		return
+	}
+	Stamp(&event)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for subscriber := range b.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+			slog.Warn("Dropped event for slow subscriber", "id", event.Id, "type", event.Type)
+		}
+	}
+}
+
+// Receive every event published from now on. The returned function stops
+// the subscription and closes the channel.
+func (b *Bus) Subscribe(buffer int) (<-chan model.Event, func()) {
+	subscriber := make(chan model.Event, buffer)
+
+	b.mu.Lock()
+	b.subscribers[subscriber] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return subscriber, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subscribers, subscriber)
+			b.mu.Unlock()
+			close(subscriber)
+		})
+	}
+}
+
+// Number of subscriptions that haven't been stopped
+func (b *Bus) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subscribers)
+}
+
+func NewBus() *Bus {
+	return &Bus{subscribers: make(map[chan model.Event]struct{})}
+}
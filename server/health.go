@@ -0,0 +1,109 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/SidingsMedia/unified-control-rdns/server/domain"
+	"github.com/SidingsMedia/unified-control-rdns/server/events"
+	"github.com/SidingsMedia/unified-control-rdns/server/model"
+)
+
+// Checks that the API of each server is answering and publishes an event
+// whenever a server starts or stops answering
+type HealthMonitor struct {
+	repository Repository
+	interval   time.Duration
+	bus        *events.Bus
+
+	mu sync.Mutex
+	// Whether each server was answering at the last check
+	up map[string]bool
+}
+
+// Check every server once, publishing events for those that changed
+func (m *HealthMonitor) Check(ctx context.Context) {
+	servers := m.repository.GetServers()
+	ids := make([]string, len(servers))
+	for i, server := range servers {
+		ids[i] = server.Id
+	}
+
+	failed, err := m.repository.Ping(ctx, ids)
+	if err != nil {
+		slog.Error("Failed to check servers", "error", err)
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, id := range ids {
+		var failure *domain.PerServerFail
+		for i := range failed {
+			if failed[i].Id == id {
+				failure = &failed[i]
+			}
+		}
+
+		// A server is assumed to be up until it's first seen to be down
+		up, known := m.up[id]
+		if !known {
+			up = true
+		}
+		m.up[id] = failure == nil
+		if up == (failure == nil) {
+			continue
+		}
+
+		event := model.Event{Type: model.EventServerUp, Servers: toEventServers(servers, []string{id})}
+		if failure != nil {
+			slog.Warn("Server stopped answering", "id", id, "error", failure.Err)
+			event.Type = model.EventServerDown
+			event.Failure = &model.PerServerFail{
+				GeneralError: model.GeneralError{
+					Code:    http.StatusBadGateway,
+					Message: "Server is not answering",
+				},
+				AffectedServers: toAffectedServers([]domain.PerServerFail{*failure}),
+			}
+		} else {
+			slog.Info("Server started answering again", "id", id)
+		}
+		m.bus.Publish(event)
+	}
+}
+
+// Check the servers straight away and then once per interval until ctx is
+// cancelled
+func (m *HealthMonitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		checkCtx, cancel := context.WithTimeout(ctx, m.interval)
+		m.Check(WithRequestSlots(checkCtx))
+		cancel()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func NewHealthMonitor(repository Repository, interval time.Duration, bus *events.Bus) *HealthMonitor {
+	return &HealthMonitor{
+		repository: repository,
+		interval:   interval,
+		bus:        bus,
+		up:         make(map[string]bool),
+	}
+}
@@ -0,0 +1,255 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+// Package jobs runs operations on the servers in the background so that
+// clients don't have to wait on slow servers, keeping track of how far the
+// operation has got with each server.
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/SidingsMedia/unified-control-rdns/config"
+	"github.com/SidingsMedia/unified-control-rdns/server/model"
+)
+
+var (
+	ErrNotFound = errors.New("job with provided id could not be found")
+	ErrFinished = errors.New("job has already finished")
+)
+
+// What an operation would have responded with had it not been run as a job
+type Outcome struct {
+	Code int
+	// Body of the response, or nil if there isn't one
+	Result any
+	// Servers the operation failed on
+	Failed []model.AffectedServer
+}
+
+// Operation run as a job. Requests to the servers must be made with ctx so
+// that progress is recorded and the job can be cancelled.
+type Func func(ctx context.Context) Outcome
+
+type job struct {
+	mu        sync.Mutex
+	state     model.Job
+	cancel    context.CancelFunc
+	cancelled bool
+	done      chan struct{}
+}
+
+type jobKey struct{}
+
+// Find the progress of a server, adding it if the job wasn't started with
+// it. The lock must be held.
+func (j *job) server(id string) *model.JobServer {
+	for i := range j.state.Servers {
+		if j.state.Servers[i].Id == id {
+			return &j.state.Servers[i]
+		}
+	}
+
+	j.state.Servers = append(j.state.Servers, model.JobServer{Id: id, Status: model.JobServerPending})
+	return &j.state.Servers[len(j.state.Servers)-1]
+}
+
+func (j *job) snapshot() model.Job {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	state := j.state
+	state.Servers = slices.Clone(j.state.Servers)
+	return state
+}
+
+// Record the outcome of the operation and work out how it went on each
+// server
+func (j *job) finish(outcome Outcome) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now().UTC()
+	j.state.FinishedAt = &now
+	j.state.Code = outcome.Code
+	j.state.Result = outcome.Result
+
+	failed := map[string]bool{}
+	for _, affected := range outcome.Failed {
+		server := j.server(affected.Id)
+		server.Status = model.JobServerFailed
+		server.Message = affected.Message
+		failed[affected.Id] = true
+	}
+
+	succeeded := 0
+	for i := range j.state.Servers {
+		server := &j.state.Servers[i]
+		switch {
+		case failed[server.Id]:
+		case server.Requests > 0 || outcome.Code < http.StatusBadRequest:
+			server.Status = model.JobServerSucceeded
+			succeeded++
+		default:
+			server.Status = model.JobServerSkipped
+		}
+	}
+
+	switch {
+	case j.cancelled:
+		j.state.Status = model.JobCancelled
+	case outcome.Code == http.StatusMultiStatus, len(failed) > 0 && succeeded > 0:
+		j.state.Status = model.JobPartial
+	case outcome.Code < http.StatusBadRequest:
+		j.state.Status = model.JobSucceeded
+	default:
+		j.state.Status = model.JobFailed
+	}
+}
+
+// Record that a request to server is being sent for the job that ctx
+// belongs to, if any
+func RequestStarted(ctx context.Context, server string) {
+	j, ok := ctx.Value(jobKey{}).(*job)
+	if !ok {
+		return
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.server(server).Status = model.JobServerRunning
+}
+
+// Record that a request to server has finished for the job that ctx
+// belongs to, if any. err is the reason the request couldn't be made.
+func RequestFinished(ctx context.Context, server string, err error) {
+	j, ok := ctx.Value(jobKey{}).(*job)
+	if !ok {
+		return
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	progress := j.server(server)
+	progress.Requests++
+	if err != nil {
+		progress.Message = err.Error()
+	}
+}
+
+// Keeps track of the jobs that are running or have recently finished
+type Manager struct {
+	timeout   time.Duration
+	retention time.Duration
+
+	mu   sync.Mutex
+	jobs map[string]*job
+}
+
+// Forget jobs that finished longer ago than the retention. The lock must
+// be held.
+func (m *Manager) prune() {
+	cutoff := time.Now().Add(-m.retention)
+	for id, j := range m.jobs {
+		state := j.snapshot()
+		if state.FinishedAt != nil && state.FinishedAt.Before(cutoff) {
+			delete(m.jobs, id)
+		}
+	}
+}
+
+// Run an operation on servers in the background, returning the job
+// straight away
+func (m *Manager) Start(operation string, servers []string, run Func) model.Job {
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+	j := &job{
+		state: model.Job{
+			Id:        hex.EncodeToString(id),
+			Operation: operation,
+			Status:    model.JobRunning,
+			CreatedAt: time.Now().UTC(),
+			Servers:   []model.JobServer{},
+		},
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	for _, server := range servers {
+		j.server(server)
+	}
+
+	m.mu.Lock()
+	m.prune()
+	m.jobs[j.state.Id] = j
+	m.mu.Unlock()
+
+	state := j.snapshot()
+	slog.Info("Started job", "id", state.Id, "operation", operation)
+
+	go func() {
+		defer cancel()
+		j.finish(run(context.WithValue(ctx, jobKey{}, j)))
+		close(j.done)
+
+		state := j.snapshot()
+		slog.Info("Job finished", "id", state.Id, "operation", operation, "status", state.Status)
+	}()
+
+	return state
+}
+
+func (m *Manager) Get(id string) (model.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.prune()
+	j, ok := m.jobs[id]
+	if !ok {
+		return model.Job{}, ErrNotFound
+	}
+	return j.snapshot(), nil
+}
+
+// Cancel a running job and wait for it to stop, or for ctx to be done
+func (m *Manager) Cancel(ctx context.Context, id string) (model.Job, error) {
+	m.mu.Lock()
+	j, ok := m.jobs[id]
+	m.mu.Unlock()
+	if !ok {
+		return model.Job{}, ErrNotFound
+	}
+
+	j.mu.Lock()
+	if j.state.FinishedAt != nil {
+		j.mu.Unlock()
+		return model.Job{}, ErrFinished
+	}
+	j.cancelled = true
+	j.mu.Unlock()
+
+	j.cancel()
+	select {
+	case <-j.done:
+	case <-ctx.Done():
+	}
+
+	return j.snapshot(), nil
+}
+
+func NewManager(config config.Jobs) *Manager {
+	return &Manager{
+		timeout:   config.Timeout,
+		retention: config.Retention,
+		jobs:      make(map[string]*job),
+	}
+}
@@ -0,0 +1,128 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package server
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/SidingsMedia/unified-control-rdns/server/domain"
+)
+
+// Limits the number of requests in flight to the Technetium servers, both
+// across the whole service and within a single API request, and keeps
+// track of how long requests spend queued waiting for a slot.
+type limiter struct {
+	global     chan struct{}
+	perRequest int
+
+	queued    atomic.Int64
+	inFlight  atomic.Int64
+	completed atomic.Int64
+	totalWait atomic.Int64
+	maxWait   atomic.Int64
+}
+
+type requestSlotsKey struct{}
+
+// Slot pool shared by every upstream request made for a single API
+// request. The channel is made on first use as its size comes from the
+// limiter.
+type requestSlots struct {
+	once  sync.Once
+	slots chan struct{}
+}
+
+// Tie ctx to a single API request so that every upstream request made with
+// it, or with a context derived from it, shares one slot pool. ctx is
+// returned unchanged if it is already tied to a request.
+func WithRequestSlots(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(requestSlotsKey{}).(*requestSlots); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, requestSlotsKey{}, &requestSlots{})
+}
+
+// Slot pool of the API request that ctx belongs to. Every upstream request
+// made while handling it must acquire a slot from this pool as well as from
+// the global pool. A pool of its own is made if ctx isn't tied to a
+// request.
+func (l *limiter) requestSlots(ctx context.Context) chan struct{} {
+	pool, ok := ctx.Value(requestSlotsKey{}).(*requestSlots)
+	if !ok {
+		return make(chan struct{}, l.perRequest)
+	}
+
+	pool.once.Do(func() {
+		pool.slots = make(chan struct{}, l.perRequest)
+	})
+	return pool.slots
+}
+
+// Wait for a slot in both the request and global pools. The returned
+// function must be called to release the slots once the upstream request
+// has finished.
+func (l *limiter) acquire(ctx context.Context, local chan struct{}) (func(), error) {
+	start := time.Now()
+	l.queued.Add(1)
+	defer l.queued.Add(-1)
+
+	select {
+	case local <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	select {
+	case l.global <- struct{}{}:
+	case <-ctx.Done():
+		<-local
+		return nil, ctx.Err()
+	}
+
+	wait := time.Since(start).Nanoseconds()
+	l.totalWait.Add(wait)
+	for {
+		current := l.maxWait.Load()
+		if wait <= current || l.maxWait.CompareAndSwap(current, wait) {
+			break
+		}
+	}
+
+	l.inFlight.Add(1)
+
+	return func() {
+		l.inFlight.Add(-1)
+		l.completed.Add(1)
+		<-l.global
+		<-local
+	}, nil
+}
+
+// Snapshot of the current limits and queueing counters
+func (l *limiter) stats() domain.UpstreamStats {
+	stats := domain.UpstreamStats{
+		GlobalLimit:     cap(l.global),
+		PerRequestLimit: l.perRequest,
+		Queued:          l.queued.Load(),
+		InFlight:        l.inFlight.Load(),
+		Completed:       l.completed.Load(),
+		MaxWait:         time.Duration(l.maxWait.Load()),
+	}
+
+	if stats.Completed > 0 {
+		stats.AverageWait = time.Duration(l.totalWait.Load() / stats.Completed)
+	}
+
+	return stats
+}
+
+func newLimiter(global int, perRequest int) *limiter {
+	return &limiter{
+		global:     make(chan struct{}, global),
+		perRequest: perRequest,
+	}
+}
@@ -0,0 +1,36 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package model
+
+import "encoding/json"
+
+// Version of an app along with the servers it is installed on
+type AppVersion struct {
+	Version string   `json:"version"`
+	Servers []string `json:"servers"`
+}
+
+type App struct {
+	Name string `json:"name"`
+	// Installed versions, newest first
+	Versions []AppVersion `json:"versions"`
+	// Servers the app isn't installed on
+	Missing []string `json:"missing"`
+}
+
+type AppsResponse struct {
+	PartialFailure
+	Apps []App `json:"apps"`
+}
+
+type AppConfig struct {
+	Server string `json:"server"`
+	// Null if the app has no config, or a string if it isn't valid JSON
+	Config json.RawMessage `json:"config"`
+}
+
+type AppConfigResponse struct {
+	PartialFailure
+	Configs []AppConfig `json:"configs"`
+}
@@ -0,0 +1,54 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package model
+
+import "time"
+
+type PlannedRecordSet struct {
+	Ttl    int      `json:"ttl"`
+	Values []string `json:"values"`
+}
+
+type PlannedChange struct {
+	// One of create, update or delete
+	Action string `json:"action"`
+	// One of zone, record, blocked or allowed
+	Kind   string            `json:"kind"`
+	Zone   string            `json:"zone,omitempty"`
+	Name   string            `json:"name"`
+	Type   string            `json:"type,omitempty"`
+	Before *PlannedRecordSet `json:"before,omitempty"`
+	After  *PlannedRecordSet `json:"after,omitempty"`
+	// Mode of the zone or list, only reported for drift
+	Mode string `json:"mode,omitempty"`
+	// One of planned, applied, failed or skipped
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type ServerPlan struct {
+	Id      string          `json:"id"`
+	Changes []PlannedChange `json:"changes"`
+}
+
+type ApplyResponse struct {
+	PartialFailure
+	DryRun bool `json:"dryRun"`
+	// Total number of changes planned across every server
+	Changes int          `json:"changes"`
+	Servers []ServerPlan `json:"servers"`
+}
+
+type DriftResponse struct {
+	PartialFailure
+	// When the last check finished. Null until the first check is done.
+	CheckedAt *time.Time `json:"checkedAt"`
+	// Why the desired state couldn't be loaded, if it couldn't
+	Error string `json:"error,omitempty"`
+	// Whether any server still differs from the desired state after drift
+	// in enforce mode was corrected
+	Drifted bool         `json:"drifted"`
+	Changes int          `json:"changes"`
+	Servers []ServerPlan `json:"servers"`
+}
@@ -0,0 +1,15 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package model
+
+import "time"
+
+// Backup of a server stored by the service
+type Backup struct {
+	Server string `json:"server"`
+	// File name of the backup, unique for each server
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"createdAt"`
+}
@@ -15,7 +15,70 @@ type CacheEntry struct {
 	CachedResult []CachedResult `json:"cachedResults"`
 }
 
+// Name that couldn't be deleted from the cache of a server
+type PurgeFailure struct {
+	Name    string `json:"name"`
+	Message string `json:"message"`
+}
+
+type PurgedServer struct {
+	Id string `json:"id"`
+	// Names deleted from the server, or that would be on a dry run
+	Names  []string       `json:"names"`
+	Failed []PurgeFailure `json:"failed,omitempty"`
+}
+
+// Zone below the one asked for that couldn't be listed on a server, so the
+// results from that server are missing the zone and everything below it
+type CacheZoneError struct {
+	Zone    string `json:"zone"`
+	Id      string `json:"id"`
+	Message string `json:"message"`
+}
+
+type CachePurgeResponse struct {
+	PartialFailure
+	DryRun     bool             `json:"dryRun"`
+	Servers    []PurgedServer   `json:"servers"`
+	Incomplete []CacheZoneError `json:"incomplete,omitempty"`
+}
+
 type CacheResponse struct {
-	Zones   []string     `json:"zones"`
-	Entries []CacheEntry `json:"entries"`
+	PartialFailure
+	Zones      []string         `json:"zones"`
+	Entries    []CacheEntry     `json:"entries"`
+	Incomplete []CacheZoneError `json:"incomplete,omitempty"`
+}
+
+// Domain to delete from the cache in a bulk delete
+type CacheDeleteDomain struct {
+	Domain string `json:"domain"`
+	// Servers to delete the domain from in place of those of the request
+	Servers []string `json:"servers,omitempty"`
+}
+
+type CacheDeleteRequest struct {
+	// Servers to delete each domain from unless it names its own
+	Servers []string            `json:"servers,omitempty"`
+	Domains []CacheDeleteDomain `json:"domains"`
+}
+
+// Outcome of deleting a domain from the cache of a single server
+type CacheDeleteResult struct {
+	Id      string `json:"id"`
+	Deleted bool   `json:"deleted"`
+	Message string `json:"message,omitempty"`
+}
+
+type CacheDeletedDomain struct {
+	Domain  string              `json:"domain"`
+	Servers []CacheDeleteResult `json:"servers"`
+}
+
+type CacheDeleteResponse struct {
+	PartialFailure
+	// Number of domain and server pairs that were deleted or failed
+	Deleted int                  `json:"deleted"`
+	Failed  int                  `json:"failed"`
+	Domains []CacheDeletedDomain `json:"domains"`
 }
@@ -0,0 +1,77 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package model
+
+// Range of addresses in a DHCP scope that are never handed out
+type DhcpExclusion struct {
+	StartingAddress string `json:"startingAddress"`
+	EndingAddress   string `json:"endingAddress"`
+}
+
+// Address always handed out to the client with a hardware address
+type DhcpReservedLease struct {
+	HostName        string `json:"hostName,omitempty"`
+	HardwareAddress string `json:"hardwareAddress"`
+	Address         string `json:"address"`
+	Comments        string `json:"comments,omitempty"`
+}
+
+// Settings used to create or update a DHCP scope. Optional fields that are
+// left out or null keep their current value on an existing scope, and an
+// empty list clears the list.
+type DhcpScopeSettings struct {
+	StartingAddress string `json:"startingAddress"`
+	EndingAddress   string `json:"endingAddress"`
+	SubnetMask      string `json:"subnetMask"`
+	// Length of a lease. Technetium uses one day if all are zero.
+	LeaseTimeDays    int     `json:"leaseTimeDays,omitempty"`
+	LeaseTimeHours   int     `json:"leaseTimeHours,omitempty"`
+	LeaseTimeMinutes int     `json:"leaseTimeMinutes,omitempty"`
+	DomainName       *string `json:"domainName,omitempty"`
+	RouterAddress    *string `json:"routerAddress,omitempty"`
+	// Hand out the address of the server itself as the DNS server
+	UseThisDnsServer        *bool               `json:"useThisDnsServer,omitempty"`
+	DnsServers              []string            `json:"dnsServers"`
+	Exclusions              []DhcpExclusion     `json:"exclusions"`
+	ReservedLeases          []DhcpReservedLease `json:"reservedLeases"`
+	AllowOnlyReservedLeases *bool               `json:"allowOnlyReservedLeases,omitempty"`
+}
+
+type DhcpScope struct {
+	// ID of the server the scope is on
+	Server           string `json:"server"`
+	Name             string `json:"name"`
+	Enabled          bool   `json:"enabled"`
+	StartingAddress  string `json:"startingAddress"`
+	EndingAddress    string `json:"endingAddress"`
+	SubnetMask       string `json:"subnetMask"`
+	NetworkAddress   string `json:"networkAddress"`
+	BroadcastAddress string `json:"broadcastAddress"`
+	InterfaceAddress string `json:"interfaceAddress,omitempty"`
+}
+
+type DhcpScopesResponse struct {
+	PartialFailure
+	Scopes []DhcpScope `json:"scopes"`
+}
+
+type DhcpLease struct {
+	// ID of the server that handed out the lease
+	Server string `json:"server"`
+	Scope  string `json:"scope"`
+	// Dynamic or Reserved
+	Type             string `json:"type"`
+	HardwareAddress  string `json:"hardwareAddress"`
+	ClientIdentifier string `json:"clientIdentifier"`
+	Address          string `json:"address"`
+	HostName         string `json:"hostName,omitempty"`
+	// As reported by Technetium, in the local time of the server
+	LeaseObtained string `json:"leaseObtained"`
+	LeaseExpires  string `json:"leaseExpires"`
+}
+
+type DhcpLeasesResponse struct {
+	PartialFailure
+	Leases []DhcpLease `json:"leases"`
+}
@@ -0,0 +1,56 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package model
+
+import "time"
+
+type DnssecKey struct {
+	KeyTag         int        `json:"keyTag"`
+	KeyType        string     `json:"keyType"`
+	Algorithm      string     `json:"algorithm"`
+	State          string     `json:"state"`
+	StateChangedOn time.Time  `json:"stateChangedOn"`
+	StateReadyBy   *time.Time `json:"stateReadyBy,omitempty"`
+	Retiring       bool       `json:"retiring"`
+	RolloverDays   int        `json:"rolloverDays"`
+}
+
+type DnssecServerStatus struct {
+	Id        string      `json:"id"`
+	Status    string      `json:"status"`
+	DnsKeyTtl int         `json:"dnsKeyTtl"`
+	Keys      []DnssecKey `json:"keys"`
+}
+
+type DnssecStatusResponse struct {
+	PartialFailure
+	Zone string `json:"zone"`
+	// Every server that answered reports the same status
+	Agreed  bool                 `json:"agreed"`
+	Servers []DnssecServerStatus `json:"servers"`
+}
+
+type DsServer struct {
+	Id       string `json:"id"`
+	KeyState string `json:"keyState"`
+}
+
+type DsRecord struct {
+	KeyTag     int    `json:"keyTag"`
+	Algorithm  string `json:"algorithm"`
+	DigestType string `json:"digestType"`
+	Digest     string `json:"digest"`
+	// The record in presentation format, ready to give to a registrar.
+	// Missing if the algorithm or digest type isn't recognised.
+	Record  string     `json:"record,omitempty"`
+	Servers []DsServer `json:"servers"`
+}
+
+type DsResponse struct {
+	PartialFailure
+	Zone string `json:"zone"`
+	// Every server that answered publishes exactly the same DS records
+	Agreed  bool       `json:"agreed"`
+	Records []DsRecord `json:"records"`
+}
@@ -18,6 +18,13 @@ type PerServerFail struct {
 	AffectedServers []AffectedServer `json:"servers"`
 }
 
+// Servers that failed to answer a request that was sent to several
+// servers. Embedded in read responses so that the results from the servers
+// that did answer can still be returned.
+type PartialFailure struct {
+	Errors []AffectedServer `json:"errors,omitempty"`
+}
+
 type Fields struct {
 	Field     string `json:"field"`
 	Condition string `json:"condition"`
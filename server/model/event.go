@@ -0,0 +1,89 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package model
+
+import "time"
+
+// Types of event that are published
+const (
+	EventCacheDeleted         = "cache.deleted"
+	EventCachePurged          = "cache.purged"
+	EventCacheFlushed         = "cache.flushed"
+	EventServerDown           = "server.down"
+	EventServerUp             = "server.up"
+	EventZoneImported         = "zone.imported"
+	EventDnssecSigned         = "dnssec.signed"
+	EventDnssecUnsigned       = "dnssec.unsigned"
+	EventKeyRolledOver        = "dnssec.rolledover"
+	EventStateApplied         = "state.applied"
+	EventDhcpScopeUpdated     = "dhcp.scope.updated"
+	EventDhcpScopeEnabled     = "dhcp.scope.enabled"
+	EventDhcpScopeDisabled    = "dhcp.scope.disabled"
+	EventDhcpLeaseRemoved     = "dhcp.lease.removed"
+	EventDhcpLeaseReserved    = "dhcp.lease.reserved"
+	EventSettingsChanged      = "settings.changed"
+	EventForwardersChanged    = "forwarders.changed"
+	EventForwarderZoneUpdated = "forwarders.zone.updated"
+	EventForwarderZoneDeleted = "forwarders.zone.deleted"
+	EventAppInstalled         = "app.installed"
+	EventAppUninstalled       = "app.uninstalled"
+	EventAppConfigChanged     = "app.config.changed"
+	EventServerRestored       = "server.restored"
+	EventBackupCreated        = "backup.created"
+	EventStats                = "stats"
+)
+
+// Types of event published about operations on the servers, which webhooks
+// can ask for. Stats are only sent to the event stream.
+var PublishedEvents = []string{
+	EventCacheDeleted,
+	EventCachePurged,
+	EventCacheFlushed,
+	EventServerDown,
+	EventServerUp,
+	EventZoneImported,
+	EventDnssecSigned,
+	EventDnssecUnsigned,
+	EventKeyRolledOver,
+	EventStateApplied,
+	EventDhcpScopeUpdated,
+	EventDhcpScopeEnabled,
+	EventDhcpScopeDisabled,
+	EventDhcpLeaseRemoved,
+	EventDhcpLeaseReserved,
+	EventSettingsChanged,
+	EventForwardersChanged,
+	EventForwarderZoneUpdated,
+	EventForwarderZoneDeleted,
+	EventAppInstalled,
+	EventAppUninstalled,
+	EventAppConfigChanged,
+	EventServerRestored,
+	EventBackupCreated,
+}
+
+type EventServer struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// Something that happened to one or more servers
+type Event struct {
+	Id   string    `json:"id"`
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	// Servers the event is about
+	Servers []EventServer `json:"servers"`
+	// Domain the operation was performed on, if any
+	Domain string `json:"domain,omitempty"`
+	// What else the operation was performed on, such as a DHCP scope, or a
+	// lease in the form scope/hardware address
+	Target string `json:"target,omitempty"`
+	// Servers that failed, in the same form as an operation's response.
+	// Omitted if every server succeeded.
+	Failure *PerServerFail `json:"failure,omitempty"`
+	// Snapshot of the upstream request statistics, only sent on the event
+	// stream
+	Stats *UpstreamStats `json:"stats,omitempty"`
+}
@@ -0,0 +1,50 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package model
+
+// Protocols that Technetium can forward queries over
+const (
+	ForwarderUdp   = "Udp"
+	ForwarderTcp   = "Tcp"
+	ForwarderTls   = "Tls"
+	ForwarderHttps = "Https"
+	ForwarderQuic  = "Quic"
+)
+
+// Upstream server that queries are forwarded to
+type Forwarder struct {
+	// Udp, Tcp, Tls, Https or Quic
+	Protocol string `json:"protocol"`
+	// Host and optional port, such as 1.1.1.1 or dns.quad9.net:853, or a
+	// URL for Https. Either may be followed by the address to connect to
+	// in brackets, such as "dns.quad9.net (9.9.9.9)".
+	Address string `json:"address"`
+}
+
+// Global forwarders that every domain without a conditional forwarder
+// zone is forwarded to
+type ForwarderSettings struct {
+	Protocol string `json:"protocol"`
+	// An empty list stops forwarding so queries are resolved recursively
+	Forwarders []string `json:"forwarders"`
+}
+
+// Forwarders of a conditional forwarder zone, tried in order
+type ForwarderZoneSettings struct {
+	Forwarders []Forwarder `json:"forwarders"`
+}
+
+// Forwarding of a domain to an upstream server, along with the servers
+// that forward it there
+type ForwardingRule struct {
+	// Domain that is forwarded, or "." for the global forwarders
+	Domain string `json:"domain"`
+	Forwarder
+	Servers []string `json:"servers"`
+}
+
+type ForwardersResponse struct {
+	PartialFailure
+	Rules []ForwardingRule `json:"rules"`
+}
@@ -0,0 +1,49 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package model
+
+import "time"
+
+// States of a job
+const (
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobPartial   = "partial"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+)
+
+// States of a server within a job
+const (
+	JobServerPending   = "pending"
+	JobServerRunning   = "running"
+	JobServerSucceeded = "succeeded"
+	JobServerFailed    = "failed"
+	JobServerSkipped   = "skipped"
+)
+
+// Progress of a job on a single server
+type JobServer struct {
+	Id     string `json:"id"`
+	Status string `json:"status"`
+	// Requests to the server that have finished so far
+	Requests int `json:"requests"`
+	// Why the server failed
+	Message string `json:"message,omitempty"`
+}
+
+// Operation running in the background
+type Job struct {
+	Id         string      `json:"id"`
+	Operation  string      `json:"operation"`
+	Status     string      `json:"status"`
+	CreatedAt  time.Time   `json:"createdAt"`
+	FinishedAt *time.Time  `json:"finishedAt"`
+	Servers    []JobServer `json:"servers"`
+	// Status code the operation would have been responded to with if it
+	// hadn't been run as a job. Only set once the job has finished.
+	Code int `json:"code,omitempty"`
+	// Body the operation would have been responded to with, if any
+	Result any `json:"result,omitempty"`
+}
@@ -0,0 +1,29 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package model
+
+import "time"
+
+type ProbeResult struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	Protocol string   `json:"protocol"`
+	Rcode    string   `json:"rcode,omitempty"`
+	Answers  []string `json:"answers"`
+	// Whether the answers matched the expected ones. Only present if the
+	// canary lists the answers it expects.
+	Correct   *bool     `json:"correct,omitempty"`
+	LatencyMs float64   `json:"latencyMs"`
+	Error     string    `json:"error,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+type ProbeResponse struct {
+	Id string `json:"id"`
+	// Every probe got an answer and every answer was correct. Absent if
+	// there are no results, either because the server hasn't been probed
+	// yet or because no canaries are configured.
+	Healthy *bool         `json:"healthy,omitempty"`
+	Results []ProbeResult `json:"results"`
+}
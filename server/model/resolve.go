@@ -0,0 +1,35 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package model
+
+type ResolvedServer struct {
+	Id        string   `json:"id"`
+	Rcode     string   `json:"rcode"`
+	Flags     []string `json:"flags"`
+	LatencyMs *float64 `json:"latencyMs"`
+}
+
+type ResolvedResult struct {
+	Id    string         `json:"id"`
+	RData map[string]any `json:"data"`
+	Ttl   string         `json:"ttl"`
+}
+
+type ResolvedAnswer struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// Every server that answered returned this record with the same data
+	Agreed         bool             `json:"agreed"`
+	ResolvedResult []ResolvedResult `json:"results"`
+}
+
+type ResolveResponse struct {
+	PartialFailure
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// Every server that answered gave the same response code and answers
+	Agreed  bool             `json:"agreed"`
+	Servers []ResolvedServer `json:"servers"`
+	Answers []ResolvedAnswer `json:"answers"`
+}
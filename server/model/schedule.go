@@ -0,0 +1,47 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package model
+
+import "time"
+
+// Operations that can be scheduled
+const (
+	ScheduleCacheDelete      = "cache.delete"
+	ScheduleCacheFlush       = "cache.flush"
+	ScheduleBlockListRefresh = "blocklist.refresh"
+	ScheduleZoneSync         = "zone.sync"
+	ScheduleBackup           = "backup"
+)
+
+// Outcomes of a run of a schedule
+const (
+	RunSucceeded = "succeeded"
+	RunPartial   = "partial"
+	RunFailed    = "failed"
+)
+
+// Outcome of a single run of a schedule
+type ScheduleRun struct {
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+	// Whether the run was started by the schedule or on request
+	Manual bool   `json:"manual"`
+	Status string `json:"status"`
+	// What went wrong, omitted if every server succeeded
+	Failure *PerServerFail `json:"failure,omitempty"`
+}
+
+// Operation run on a cron schedule
+type Schedule struct {
+	Id        string   `json:"id"`
+	Cron      string   `json:"cron"`
+	Operation string   `json:"operation"`
+	Servers   []string `json:"servers"`
+	Domains   []string `json:"domains,omitempty"`
+	Zones     []string `json:"zones,omitempty"`
+	// Nil if the expression never fires again
+	NextRun *time.Time `json:"nextRun"`
+	// Nil until the schedule has run once
+	LastRun *ScheduleRun `json:"lastRun"`
+}
@@ -0,0 +1,30 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package model
+
+type ServerSettings struct {
+	Id string `json:"id"`
+	// Settings as reported by Technetium
+	Settings map[string]any `json:"settings"`
+}
+
+// Value of a setting shared by some of the servers
+type SettingValue struct {
+	Servers []string `json:"servers"`
+	// Null if the servers don't have the setting
+	Value any `json:"value"`
+}
+
+// Setting that isn't the same on every server
+type SettingDifference struct {
+	Key    string         `json:"key"`
+	Values []SettingValue `json:"values"`
+}
+
+type SettingsDiffResponse struct {
+	PartialFailure
+	// Servers whose settings were compared
+	Servers     []string            `json:"servers"`
+	Differences []SettingDifference `json:"differences"`
+}
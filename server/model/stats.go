@@ -0,0 +1,14 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package model
+
+type UpstreamStats struct {
+	GlobalLimit     int     `json:"globalLimit"`
+	PerRequestLimit int     `json:"perRequestLimit"`
+	Queued          int64   `json:"queued"`
+	InFlight        int64   `json:"inFlight"`
+	Completed       int64   `json:"completed"`
+	AverageWaitMs   float64 `json:"averageWaitMs"`
+	MaxWaitMs       float64 `json:"maxWaitMs"`
+}
@@ -0,0 +1,15 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package model
+
+type ZoneFileLineError struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+// Response sent when an imported zone file is invalid
+type ZoneFileErrors struct {
+	GeneralError
+	Lines []ZoneFileLineError `json:"lines"`
+}
@@ -0,0 +1,218 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+// Package notify sends events to webhooks. Each request is a POST of the
+// event as JSON, signed with HMAC-SHA256 so that receivers can check it
+// came from this service.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/SidingsMedia/unified-control-rdns/config"
+	"github.com/SidingsMedia/unified-control-rdns/server/events"
+	"github.com/SidingsMedia/unified-control-rdns/server/model"
+)
+
+// Headers sent with each delivery
+const (
+	HeaderSignature = "X-Signature-256"
+	HeaderEventId   = "X-Event-Id"
+	HeaderEventType = "X-Event-Type"
+)
+
+// Number of events waiting to be sent to a webhook before new ones are
+// dropped
+const queueSize = 100
+
+// Signature of body for the HMAC key secret, as sent in HeaderSignature
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Check that signature is the signature of body for secret
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+// Error from a delivery that won't succeed if it's retried
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+type webhook struct {
+	config.Webhook
+	retries int
+	client  *http.Client
+	queue   chan model.Event
+}
+
+func (w *webhook) wants(event model.Event) bool {
+	return len(w.Events) == 0 || slices.Contains(w.Events, event.Type)
+}
+
+// Make a single attempt at sending body
+func (w *webhook) send(ctx context.Context, event model.Event, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.Url, bytes.NewReader(body))
+	if err != nil {
+		return permanentError{err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEventId, event.Id)
+	req.Header.Set(HeaderEventType, event.Type)
+	if w.Secret != "" {
+		req.Header.Set(HeaderSignature, Sign(w.Secret, body))
+	}
+
+	res, err := w.client.Do(req)
+	if err != nil {
+		// Leave out the URL in case it contains a token
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return err
+	}
+	io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+
+	switch {
+	case res.StatusCode >= 200 && res.StatusCode < 300:
+		return nil
+	case res.StatusCode == http.StatusRequestTimeout || res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500:
+		return fmt.Errorf("webhook responded with %d", res.StatusCode)
+	default:
+		return permanentError{fmt.Errorf("webhook responded with %d", res.StatusCode)}
+	}
+}
+
+// Send an event, retrying with an increasing delay if it fails
+func (w *webhook) deliver(ctx context.Context, event model.Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	delay := w.RetryDelay
+	for attempt := 0; ; attempt++ {
+		err = w.send(ctx, event, body)
+
+		var permanent permanentError
+		if err == nil || errors.As(err, &permanent) || attempt >= w.retries {
+			return err
+		}
+
+		slog.Warn("Failed to deliver webhook, retrying", "id", event.Id, "type", event.Type, "attempt", attempt+1, "error", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+func (w *webhook) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-w.queue:
+			if err := w.deliver(ctx, event); err != nil {
+				slog.Error("Failed to deliver webhook", "id", event.Id, "type", event.Type, "error", err)
+			}
+		}
+	}
+}
+
+// Sends the events published on a bus to the configured webhooks. Each
+// webhook receives its events in order, one at a time, so that a slow
+// webhook doesn't hold up the others.
+type Notifier struct {
+	webhooks []*webhook
+}
+
+// Start delivering the events published on bus from now on, until ctx is
+// cancelled
+func (n *Notifier) Start(ctx context.Context, bus *events.Bus) {
+	if len(n.webhooks) == 0 {
+		return
+	}
+
+	subscription, unsubscribe := bus.Subscribe(queueSize)
+	for _, webhook := range n.webhooks {
+		go webhook.run(ctx)
+	}
+
+	go func() {
+		defer unsubscribe()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event := <-subscription:
+				n.enqueue(event)
+			}
+		}
+	}()
+}
+
+// Queue an event for each webhook that wants it
+func (n *Notifier) enqueue(event model.Event) {
+	for _, webhook := range n.webhooks {
+		if !webhook.wants(event) {
+			continue
+		}
+
+		select {
+		case webhook.queue <- event:
+		default:
+			slog.Warn("Dropped webhook, too many waiting to be sent", "id", event.Id, "type", event.Type)
+		}
+	}
+}
+
+// Create a notifier for the webhooks in notifications. An error is
+// returned if a webhook asks for an event that is never published.
+func NewNotifier(notifications config.Notifications) (*Notifier, error) {
+	notifier := &Notifier{}
+	for i, hook := range notifications.Webhooks {
+		for j, event := range hook.Events {
+			if !slices.Contains(model.PublishedEvents, event) {
+				return nil, fmt.Errorf("notifications.webhooks[%d].events[%d]: unknown event %q", i, j, event)
+			}
+		}
+
+		retries := 0
+		if hook.Retries != nil {
+			retries = *hook.Retries
+		}
+
+		notifier.webhooks = append(notifier.webhooks, &webhook{
+			Webhook: hook,
+			retries: retries,
+			client:  &http.Client{Timeout: hook.Timeout},
+			queue:   make(chan model.Event, queueSize),
+		})
+	}
+	return notifier, nil
+}
@@ -0,0 +1,172 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package notify_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SidingsMedia/unified-control-rdns/config"
+	"github.com/SidingsMedia/unified-control-rdns/server/events"
+	"github.com/SidingsMedia/unified-control-rdns/server/model"
+	"github.com/SidingsMedia/unified-control-rdns/server/notify"
+)
+
+// Request received by a webhook
+type delivery struct {
+	header http.Header
+	body   []byte
+}
+
+// Local webhook that responds with each of statuses in turn and then 204
+type receiver struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	statuses   []int
+	deliveries []delivery
+	received   chan struct{}
+}
+
+func newReceiver(t *testing.T, statuses ...int) *receiver {
+	r := &receiver{statuses: statuses, received: make(chan struct{}, 10)}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+
+		r.mu.Lock()
+		r.deliveries = append(r.deliveries, delivery{header: req.Header.Clone(), body: body})
+		status := http.StatusNoContent
+		if len(r.statuses) > 0 {
+			status, r.statuses = r.statuses[0], r.statuses[1:]
+		}
+		r.mu.Unlock()
+
+		w.WriteHeader(status)
+		r.received <- struct{}{}
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func retries(count int) *int {
+	return &count
+}
+
+// Wait for count requests to arrive
+func (r *receiver) wait(t *testing.T, count int) []delivery {
+	t.Helper()
+	for i := 0; i < count; i++ {
+		select {
+		case <-r.received:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for delivery %d", i+1)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.deliveries
+}
+
+func start(t *testing.T, webhooks ...config.Webhook) *events.Bus {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	notifier, err := notify.NewNotifier(config.Notifications{Webhooks: webhooks})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bus := events.NewBus()
+	notifier.Start(ctx, bus)
+	return bus
+}
+
+func TestUnknownEvent(t *testing.T) {
+	_, err := notify.NewNotifier(config.Notifications{Webhooks: []config.Webhook{
+		{Url: "https://example.com/hook", Events: []string{model.EventCacheFlushed, "cache.exploded"}},
+	}})
+	if err == nil || !strings.Contains(err.Error(), "events[1]") {
+		t.Errorf("expected the unknown event to be rejected, got %v", err)
+	}
+}
+
+func TestDeliverSignedEvent(t *testing.T) {
+	receiver := newReceiver(t)
+	bus := start(t, config.Webhook{Url: receiver.URL, Secret: "secret", RetryDelay: time.Millisecond, Timeout: time.Second})
+
+	bus.Publish(model.Event{
+		Type:    model.EventCacheFlushed,
+		Servers: []model.EventServer{{Id: "a", Name: "Server A"}},
+	})
+
+	deliveries := receiver.wait(t, 1)
+	header, body := deliveries[0].header, deliveries[0].body
+
+	if !notify.Verify("secret", body, header.Get(notify.HeaderSignature)) {
+		t.Errorf("expected a valid signature, got %q", header.Get(notify.HeaderSignature))
+	}
+	if notify.Verify("other", body, header.Get(notify.HeaderSignature)) {
+		t.Errorf("expected the signature not to match another secret")
+	}
+
+	var event model.Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != model.EventCacheFlushed || event.Id == "" || event.Time.IsZero() || event.Servers[0].Name != "Server A" {
+		t.Errorf("unexpected event %+v", event)
+	}
+	if header.Get(notify.HeaderEventId) != event.Id || header.Get(notify.HeaderEventType) != event.Type {
+		t.Errorf("unexpected headers %v", header)
+	}
+}
+
+func TestRetryFailedDelivery(t *testing.T) {
+	receiver := newReceiver(t, http.StatusInternalServerError, http.StatusTooManyRequests)
+	bus := start(t, config.Webhook{Url: receiver.URL, Retries: retries(3), RetryDelay: time.Millisecond, Timeout: time.Second})
+
+	bus.Publish(model.Event{Type: model.EventServerDown})
+
+	deliveries := receiver.wait(t, 3)
+	if deliveries[0].header.Get(notify.HeaderEventId) != deliveries[2].header.Get(notify.HeaderEventId) {
+		t.Errorf("expected the same event to be retried")
+	}
+	if deliveries[0].header.Get(notify.HeaderSignature) != "" {
+		t.Errorf("expected no signature without a secret")
+	}
+}
+
+func TestNoRetryOnClientError(t *testing.T) {
+	receiver := newReceiver(t, http.StatusBadRequest)
+	bus := start(t, config.Webhook{Url: receiver.URL, Retries: retries(3), RetryDelay: time.Millisecond, Timeout: time.Second})
+
+	bus.Publish(model.Event{Type: model.EventServerDown})
+	bus.Publish(model.Event{Type: model.EventServerUp})
+
+	deliveries := receiver.wait(t, 2)
+	if deliveries[1].header.Get(notify.HeaderEventType) != model.EventServerUp {
+		t.Errorf("expected the rejected event not to be retried, got %v", deliveries[1].header)
+	}
+}
+
+func TestFilterEvents(t *testing.T) {
+	receiver := newReceiver(t)
+	bus := start(t, config.Webhook{Url: receiver.URL, Events: []string{model.EventServerUp}, RetryDelay: time.Millisecond, Timeout: time.Second})
+
+	bus.Publish(model.Event{Type: model.EventCacheDeleted})
+	bus.Publish(model.Event{Type: model.EventServerUp})
+
+	deliveries := receiver.wait(t, 1)
+	if len(deliveries) != 1 || deliveries[0].header.Get(notify.HeaderEventType) != model.EventServerUp {
+		t.Errorf("expected only the wanted event, got %d deliveries", len(deliveries))
+	}
+}
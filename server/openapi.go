@@ -0,0 +1,12 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package server
+
+import _ "embed"
+
+// OpenAPI document describing every route registered in NewController. It
+// must be kept up to date with the routes and models as they change.
+//
+//go:embed openapi.json
+var openApiSpec []byte
@@ -0,0 +1,293 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package server
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/SidingsMedia/unified-control-rdns/config"
+	"github.com/SidingsMedia/unified-control-rdns/server/desired"
+	"github.com/SidingsMedia/unified-control-rdns/server/model"
+	"github.com/gin-gonic/gin"
+)
+
+// Models described under components.schemas in the OpenAPI document
+var openApiSchemas = map[string]any{
+	"GeneralError":          model.GeneralError{},
+	"AffectedServer":        model.AffectedServer{},
+	"PerServerFail":         model.PerServerFail{},
+	"Fields":                model.Fields{},
+	"BadRequest":            model.BadRequest{},
+	"Server":                model.Server{},
+	"ServerList":            model.List[model.Server]{},
+	"CachedResult":          model.CachedResult{},
+	"CacheEntry":            model.CacheEntry{},
+	"CacheResponse":         model.CacheResponse{},
+	"UpstreamStats":         model.UpstreamStats{},
+	"PurgedServer":          model.PurgedServer{},
+	"CachePurgeResponse":    model.CachePurgeResponse{},
+	"CacheZoneError":        model.CacheZoneError{},
+	"PurgeFailure":          model.PurgeFailure{},
+	"ResolvedServer":        model.ResolvedServer{},
+	"ResolvedResult":        model.ResolvedResult{},
+	"ResolvedAnswer":        model.ResolvedAnswer{},
+	"ResolveResponse":       model.ResolveResponse{},
+	"ProbeResult":           model.ProbeResult{},
+	"ProbeResponse":         model.ProbeResponse{},
+	"DnssecKey":             model.DnssecKey{},
+	"DnssecServerStatus":    model.DnssecServerStatus{},
+	"DnssecStatusResponse":  model.DnssecStatusResponse{},
+	"DsServer":              model.DsServer{},
+	"DsRecord":              model.DsRecord{},
+	"DsResponse":            model.DsResponse{},
+	"ZoneFileLineError":     model.ZoneFileLineError{},
+	"ZoneFileErrors":        model.ZoneFileErrors{},
+	"DesiredRecord":         desired.Record{},
+	"DesiredZone":           desired.Zone{},
+	"DesiredState":          desired.State{},
+	"PlannedRecordSet":      model.PlannedRecordSet{},
+	"PlannedChange":         model.PlannedChange{},
+	"ServerPlan":            model.ServerPlan{},
+	"ApplyResponse":         model.ApplyResponse{},
+	"DriftResponse":         model.DriftResponse{},
+	"EventServer":           model.EventServer{},
+	"Event":                 model.Event{},
+	"JobServer":             model.JobServer{},
+	"Job":                   model.Job{},
+	"ScheduleRun":           model.ScheduleRun{},
+	"Schedule":              model.Schedule{},
+	"ScheduleList":          model.List[model.Schedule]{},
+	"ScheduleRunList":       model.List[model.ScheduleRun]{},
+	"CacheDeleteDomain":     model.CacheDeleteDomain{},
+	"CacheDeleteRequest":    model.CacheDeleteRequest{},
+	"CacheDeleteResult":     model.CacheDeleteResult{},
+	"CacheDeletedDomain":    model.CacheDeletedDomain{},
+	"CacheDeleteResponse":   model.CacheDeleteResponse{},
+	"DhcpExclusion":         model.DhcpExclusion{},
+	"DhcpReservedLease":     model.DhcpReservedLease{},
+	"DhcpScopeSettings":     model.DhcpScopeSettings{},
+	"DhcpScope":             model.DhcpScope{},
+	"DhcpScopesResponse":    model.DhcpScopesResponse{},
+	"DhcpLease":             model.DhcpLease{},
+	"DhcpLeasesResponse":    model.DhcpLeasesResponse{},
+	"ServerSettings":        model.ServerSettings{},
+	"SettingValue":          model.SettingValue{},
+	"SettingDifference":     model.SettingDifference{},
+	"SettingsDiffResponse":  model.SettingsDiffResponse{},
+	"Forwarder":             model.Forwarder{},
+	"ForwarderSettings":     model.ForwarderSettings{},
+	"ForwarderZoneSettings": model.ForwarderZoneSettings{},
+	"ForwardingRule":        model.ForwardingRule{},
+	"ForwardersResponse":    model.ForwardersResponse{},
+	"AppVersion":            model.AppVersion{},
+	"App":                   model.App{},
+	"AppsResponse":          model.AppsResponse{},
+	"AppConfig":             model.AppConfig{},
+	"AppConfigResponse":     model.AppConfigResponse{},
+	"Backup":                model.Backup{},
+	"BackupList":            model.List[model.Backup]{},
+}
+
+// Structs that query parameters are bound to for each operation
+var openApiQueryParams = map[string]any{
+	"GET /cache":                                          GetCacheRequest{},
+	"DELETE /cache":                                       DeleteCacheRequest{},
+	"POST /cache/delete":                                  BulkDeleteCacheRequest{},
+	"POST /cache/flush":                                   FlushCacheRequest{},
+	"POST /cache/purge":                                   PurgeCacheRequest{},
+	"GET /resolve":                                        ResolveRequest{},
+	"GET /zones/{zone}/dnssec":                            DnssecStatusRequest{},
+	"GET /zones/{zone}/dnssec/ds":                         DsRecordsRequest{},
+	"POST /zones/{zone}/dnssec/sign":                      SignZoneRequest{},
+	"POST /zones/{zone}/dnssec/unsign":                    UnsignZoneRequest{},
+	"POST /zones/{zone}/dnssec/rollover":                  RolloverDnsKeyRequest{},
+	"GET /zones/{zone}/export":                            ExportZoneRequest{},
+	"POST /zones/{zone}/import":                           ImportZoneRequest{},
+	"POST /apply":                                         ApplyRequest{},
+	"GET /events":                                         EventsRequest{},
+	"GET /dhcp/scopes":                                    DhcpScopesRequest{},
+	"PUT /dhcp/scopes/{name}":                             DhcpChangeRequest{},
+	"POST /dhcp/scopes/{name}/enable":                     DhcpChangeRequest{},
+	"POST /dhcp/scopes/{name}/disable":                    DhcpChangeRequest{},
+	"GET /dhcp/leases":                                    DhcpLeasesRequest{},
+	"DELETE /dhcp/scopes/{name}/leases/{hardwareAddress}": DhcpChangeRequest{},
+	"POST /dhcp/scopes/{name}/leases/{hardwareAddress}/reserve": DhcpChangeRequest{},
+	"GET /settings/diff":         SettingsDiffRequest{},
+	"POST /settings":             SetSettingsRequest{},
+	"GET /apps":                  AppsRequest{},
+	"PUT /apps/{name}":           AppChangeRequest{},
+	"DELETE /apps/{name}":        AppChangeRequest{},
+	"GET /apps/{name}/config":    AppsRequest{},
+	"PUT /apps/{name}/config":    AppChangeRequest{},
+	"POST /servers/{id}/backup":  BackupRequest{},
+	"POST /servers/{id}/restore": RestoreRequest{},
+	"GET /backups":               ListBackupsRequest{},
+}
+
+// Query parameters handled for every route rather than bound to a struct
+var openApiCommonParams = []string{"indent"}
+
+type openApiParameter struct {
+	Ref  string `json:"$ref"`
+	Name string `json:"name"`
+	In   string `json:"in"`
+}
+
+type openApiOperation struct {
+	Parameters []openApiParameter `json:"parameters"`
+}
+
+type openApiDocument struct {
+	Paths      map[string]map[string]openApiOperation `json:"paths"`
+	Components struct {
+		Parameters map[string]openApiParameter `json:"parameters"`
+		Schemas    map[string]struct {
+			Properties map[string]any `json:"properties"`
+		} `json:"schemas"`
+	} `json:"components"`
+}
+
+func loadOpenApi(t *testing.T) openApiDocument {
+	t.Helper()
+
+	var document openApiDocument
+	if err := json.Unmarshal(openApiSpec, &document); err != nil {
+		t.Fatalf("failed to parse openapi.json: %v", err)
+	}
+	return document
+}
+
+// Convert a gin route path into the form used by OpenAPI
+func openApiPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// Collect the names of every field of typ as they appear in JSON,
+// including those promoted from embedded structs.
+func jsonFieldNames(typ reflect.Type) []string {
+	names := []string{}
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag := field.Tag.Get("json")
+		name, _, _ := strings.Cut(tag, ",")
+
+		if field.Anonymous && name == "" {
+			names = append(names, jsonFieldNames(field.Type)...)
+			continue
+		}
+
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestOpenApiRoutes(t *testing.T) {
+	document := loadOpenApi(t)
+
+	engine := gin.New()
+	NewController(engine, NewService(NewRepository(nil, config.Concurrency{Global: 1, PerRequest: 1})), 0)
+
+	registered := map[string]bool{}
+	for _, route := range engine.Routes() {
+		key := route.Method + " " + openApiPath(route.Path)
+		registered[key] = true
+
+		if _, ok := document.Paths[openApiPath(route.Path)][strings.ToLower(route.Method)]; !ok {
+			t.Errorf("route %s is not described in openapi.json", key)
+		}
+	}
+
+	for path, operations := range document.Paths {
+		for method := range operations {
+			key := strings.ToUpper(method) + " " + path
+			if !registered[key] {
+				t.Errorf("openapi.json describes %s which is not a registered route", key)
+			}
+		}
+	}
+}
+
+func TestOpenApiSchemas(t *testing.T) {
+	document := loadOpenApi(t)
+
+	for name := range document.Components.Schemas {
+		if _, ok := openApiSchemas[name]; !ok {
+			t.Errorf("schema %s in openapi.json is not mapped to a model", name)
+		}
+	}
+
+	for name, value := range openApiSchemas {
+		schema, ok := document.Components.Schemas[name]
+		if !ok {
+			t.Errorf("model for schema %s is not described in openapi.json", name)
+			continue
+		}
+
+		fields := jsonFieldNames(reflect.TypeOf(value))
+		for _, field := range fields {
+			if _, ok := schema.Properties[field]; !ok {
+				t.Errorf("schema %s is missing property %s", name, field)
+			}
+		}
+
+		for property := range schema.Properties {
+			if !slices.Contains(fields, property) {
+				t.Errorf("schema %s has property %s which is not in the model", name, property)
+			}
+		}
+	}
+}
+
+func TestOpenApiQueryParameters(t *testing.T) {
+	document := loadOpenApi(t)
+
+	for key, request := range openApiQueryParams {
+		method, path, _ := strings.Cut(key, " ")
+		operation, ok := document.Paths[path][strings.ToLower(method)]
+		if !ok {
+			t.Errorf("operation %s is not described in openapi.json", key)
+			continue
+		}
+
+		documented := []string{}
+		for _, parameter := range operation.Parameters {
+			if parameter.Ref != "" {
+				parameter = document.Components.Parameters[strings.TrimPrefix(parameter.Ref, "#/components/parameters/")]
+			}
+			if parameter.In == "query" && !slices.Contains(openApiCommonParams, parameter.Name) {
+				documented = append(documented, parameter.Name)
+			}
+		}
+
+		bound := []string{}
+		typ := reflect.TypeOf(request)
+		for i := 0; i < typ.NumField(); i++ {
+			if name := typ.Field(i).Tag.Get("form"); name != "" {
+				bound = append(bound, name)
+			}
+		}
+
+		slices.Sort(documented)
+		slices.Sort(bound)
+		if !slices.Equal(documented, bound) {
+			t.Errorf("query parameters for %s differ, documented %v but bound %v", key, documented, bound)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+// Package probe queries managed servers directly over DNS to check that they
+// answer canary names correctly and to measure how long they take to do so.
+// Unlike the rest of the API this exercises the DNS service itself rather
+// than the Technetium management API.
+package probe
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SidingsMedia/unified-control-rdns/config"
+	"github.com/miekg/dns"
+)
+
+// Outcome of querying a single canary over a single protocol
+type Result struct {
+	Name     string
+	Type     string
+	Protocol string
+	Rcode    string
+	Answers  []string
+	Latency  time.Duration
+	// Whether the answers matched the expected ones. Nil if the canary
+	// doesn't specify any.
+	Correct *bool
+	Error   error
+	Time    time.Time
+}
+
+type Prober struct {
+	servers  map[string]config.DnsAddress
+	canaries []config.Canary
+	interval time.Duration
+	timeout  time.Duration
+
+	mu      sync.RWMutex
+	results map[string][]Result
+}
+
+// Protocols that can be used to reach a server, in the order they are
+// probed
+func Protocols(address config.DnsAddress) []string {
+	protocols := []string{}
+	if address.Address != "" {
+		protocols = append(protocols, ProtocolUdp, ProtocolTcp)
+	}
+	if address.Tls != "" {
+		protocols = append(protocols, ProtocolTls)
+	}
+	if address.Https != "" {
+		protocols = append(protocols, ProtocolHttps)
+	}
+	return protocols
+}
+
+// Name of a response code as Technetium reports it so that probe results
+// can be compared with those from the resolve endpoint
+func rcodeName(rcode int) string {
+	switch rcode {
+	case dns.RcodeSuccess:
+		return "NoError"
+	case dns.RcodeNameError:
+		return "NxDomain"
+	case dns.RcodeServerFailure:
+		return "ServerFailure"
+	case dns.RcodeFormatError:
+		return "FormatError"
+	case dns.RcodeNotImplemented:
+		return "NotImplemented"
+	case dns.RcodeRefused:
+		return "Refused"
+	default:
+		return dns.RcodeToString[rcode]
+	}
+}
+
+// Check if the response answers the canary as expected. Answers are
+// compared ignoring order and case.
+func matches(rcode int, answers []string, expect []string) bool {
+	if rcode != dns.RcodeSuccess || len(answers) != len(expect) {
+		return false
+	}
+
+	normalise := func(values []string) []string {
+		normalised := make([]string, len(values))
+		for i, value := range values {
+			normalised[i] = strings.TrimSuffix(strings.ToLower(value), ".")
+		}
+		slices.Sort(normalised)
+		return normalised
+	}
+
+	return slices.Equal(normalise(answers), normalise(expect))
+}
+
+func probeCanary(ctx context.Context, address config.DnsAddress, protocol string, canary config.Canary) Result {
+	result := Result{
+		Name:     canary.Name,
+		Type:     strings.ToUpper(canary.Type),
+		Protocol: protocol,
+		Answers:  []string{},
+		Time:     time.Now(),
+	}
+
+	start := time.Now()
+	message, err := exchange(ctx, address, protocol, canary.Name, canary.Type)
+	result.Latency = time.Since(start)
+	if err != nil {
+		result.Error = err
+		return result
+	}
+
+	result.Rcode = rcodeName(message.Rcode)
+	qtype, _ := recordType(result.Type)
+	for _, answer := range message.Answer {
+		if answer.Header().Rrtype == qtype {
+			result.Answers = append(result.Answers, formatResource(answer))
+		}
+	}
+
+	if len(canary.Expect) > 0 {
+		correct := matches(message.Rcode, result.Answers, canary.Expect)
+		result.Correct = &correct
+	}
+
+	return result
+}
+
+// Servers without a DNS address are not probed
+func NewProber(servers []config.Server, probes config.Probes) *Prober {
+	addresses := make(map[string]config.DnsAddress)
+	for _, server := range servers {
+		if server.Dns != nil {
+			addresses[server.Id] = *server.Dns
+		}
+	}
+
+	return &Prober{
+		servers:  addresses,
+		canaries: probes.Canaries,
+		interval: probes.Interval,
+		timeout:  probes.Timeout,
+		results:  make(map[string][]Result),
+	}
+}
+
+// Check if a server can be probed
+func (p *Prober) Probed(id string) bool {
+	_, exists := p.servers[id]
+	return exists
+}
+
+// Results of the most recent probe of a server, or nil if it hasn't been
+// probed yet
+func (p *Prober) Results(id string) []Result {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return slices.Clone(p.results[id])
+}
+
+// Query every canary over every protocol the server supports, store the
+// results and return them
+func (p *Prober) ProbeServer(ctx context.Context, id string) []Result {
+	address, exists := p.servers[id]
+	if !exists {
+		return nil
+	}
+
+	protocols := Protocols(address)
+	results := make([]Result, len(protocols)*len(p.canaries))
+
+	var wg sync.WaitGroup
+	for i, protocol := range protocols {
+		for j, canary := range p.canaries {
+			wg.Add(1)
+			go func(index int, protocol string, canary config.Canary) {
+				defer wg.Done()
+				probeCtx, cancel := context.WithTimeout(ctx, p.timeout)
+				defer cancel()
+				results[index] = probeCanary(probeCtx, address, protocol, canary)
+			}(i*len(p.canaries)+j, protocol, canary)
+		}
+	}
+	wg.Wait()
+
+	for _, result := range results {
+		if result.Error != nil {
+			slog.Warn("DNS probe failed", "id", id, "name", result.Name, "protocol", result.Protocol, "error", result.Error)
+		} else if result.Correct != nil && !*result.Correct {
+			slog.Warn("DNS probe returned unexpected answer", "id", id, "name", result.Name, "protocol", result.Protocol, "answers", result.Answers)
+		}
+	}
+
+	p.mu.Lock()
+	p.results[id] = results
+	p.mu.Unlock()
+
+	return results
+}
+
+func (p *Prober) probeAll(ctx context.Context) {
+	var wg sync.WaitGroup
+	for id := range p.servers {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			p.ProbeServer(ctx, id)
+		}(id)
+	}
+	wg.Wait()
+}
+
+// Probe every server straight away and then once per interval until ctx is
+// cancelled
+func (p *Prober) Run(ctx context.Context) {
+	if len(p.servers) == 0 || len(p.canaries) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.probeAll(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,158 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package probe_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/SidingsMedia/unified-control-rdns/config"
+	"github.com/SidingsMedia/unified-control-rdns/server/probe"
+	"github.com/SidingsMedia/unified-control-rdns/server/technetiumtest"
+)
+
+func newProber(t *testing.T, canaries []config.Canary, timeout time.Duration) (*probe.Prober, *technetiumtest.DnsServer) {
+	t.Helper()
+
+	dns := technetiumtest.NewDnsServer(t, map[string][]string{
+		"example.com A":    {"192.0.2.1", "192.0.2.2"},
+		"example.com AAAA": {"2001:db8::1"},
+		"example.com TXT":  {"hello"},
+	})
+
+	prober := probe.NewProber([]config.Server{
+		{Id: "a", Dns: dns.Config()},
+		{Id: "b"},
+	}, config.Probes{Interval: time.Minute, Timeout: timeout, Canaries: canaries})
+
+	return prober, dns
+}
+
+func TestProbeEveryProtocol(t *testing.T) {
+	prober, _ := newProber(t, []config.Canary{
+		{Name: "example.com", Type: "A", Expect: []string{"192.0.2.2", "192.0.2.1"}},
+		{Name: "example.com", Type: "AAAA"},
+		{Name: "example.com", Type: "TXT", Expect: []string{"hello"}},
+	}, time.Second)
+
+	results := prober.ProbeServer(context.Background(), "a")
+	if len(results) != 12 {
+		t.Fatalf("expected a result for each canary and protocol, got %d", len(results))
+	}
+
+	protocols := []string{}
+	for _, result := range results {
+		if result.Error != nil {
+			t.Errorf("%s %s over %s failed: %v", result.Name, result.Type, result.Protocol, result.Error)
+			continue
+		}
+
+		if result.Rcode != "NoError" {
+			t.Errorf("%s %s over %s got rcode %s", result.Name, result.Type, result.Protocol, result.Rcode)
+		}
+
+		switch result.Type {
+		case "A":
+			if result.Correct == nil || !*result.Correct {
+				t.Errorf("expected A answers over %s to be correct, got %v", result.Protocol, result.Answers)
+			}
+		case "AAAA":
+			if result.Correct != nil {
+				t.Errorf("expected correctness to be unknown without expected answers")
+			}
+			if !slices.Equal(result.Answers, []string{"2001:db8::1"}) {
+				t.Errorf("unexpected AAAA answers %v", result.Answers)
+			}
+		}
+
+		if !slices.Contains(protocols, result.Protocol) {
+			protocols = append(protocols, result.Protocol)
+		}
+	}
+
+	if !slices.Equal(protocols, []string{probe.ProtocolUdp, probe.ProtocolTcp, probe.ProtocolTls, probe.ProtocolHttps}) {
+		t.Errorf("unexpected protocols %v", protocols)
+	}
+
+	if len(prober.Results("a")) != 12 {
+		t.Errorf("expected results to be stored")
+	}
+}
+
+func TestProbeIncorrectAnswer(t *testing.T) {
+	prober, dns := newProber(t, []config.Canary{
+		{Name: "example.com", Type: "A", Expect: []string{"192.0.2.1", "192.0.2.2"}},
+		{Name: "missing.example.com", Type: "A", Expect: []string{"192.0.2.1"}},
+	}, time.Second)
+
+	dns.SetAnswers(map[string][]string{"example.com A": {"192.0.2.99"}})
+
+	for _, result := range prober.ProbeServer(context.Background(), "a") {
+		if result.Error != nil {
+			t.Fatalf("unexpected error over %s: %v", result.Protocol, result.Error)
+		}
+
+		if result.Correct == nil || *result.Correct {
+			t.Errorf("expected %s over %s to be incorrect, got %v", result.Name, result.Protocol, result.Answers)
+		}
+
+		if result.Name == "missing.example.com" && result.Rcode != "NxDomain" {
+			t.Errorf("expected NxDomain, got %s", result.Rcode)
+		}
+	}
+}
+
+func TestProbeTimeout(t *testing.T) {
+	prober, dns := newProber(t, []config.Canary{{Name: "example.com", Type: "A"}}, 50*time.Millisecond)
+	dns.SetDelay(time.Second)
+
+	for _, result := range prober.ProbeServer(context.Background(), "a") {
+		if result.Error == nil {
+			t.Errorf("expected probe over %s to time out", result.Protocol)
+		}
+		if result.Latency > 500*time.Millisecond {
+			t.Errorf("probe over %s took %s despite the timeout", result.Protocol, result.Latency)
+		}
+	}
+}
+
+func TestProbeServerWithoutAddress(t *testing.T) {
+	prober, dns := newProber(t, []config.Canary{{Name: "example.com", Type: "A"}}, time.Second)
+
+	if prober.Probed("b") {
+		t.Errorf("expected server without a DNS address not to be probed")
+	}
+
+	if results := prober.ProbeServer(context.Background(), "b"); results != nil {
+		t.Errorf("expected no results, got %+v", results)
+	}
+
+	if dns.Queries() != 0 {
+		t.Errorf("expected no queries, got %d", dns.Queries())
+	}
+}
+
+func TestRunProbesImmediately(t *testing.T) {
+	prober, _ := newProber(t, []config.Canary{{Name: "example.com", Type: "A"}}, time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		prober.Run(ctx)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(prober.Results("a")) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if len(prober.Results("a")) != 4 {
+		t.Errorf("expected the first probe to run straight away, got %+v", prober.Results("a"))
+	}
+}
@@ -0,0 +1,151 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package probe
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/SidingsMedia/unified-control-rdns/config"
+	"github.com/miekg/dns"
+)
+
+const (
+	ProtocolUdp   = "udp"
+	ProtocolTcp   = "tcp"
+	ProtocolTls   = "tls"
+	ProtocolHttps = "https"
+)
+
+var (
+	ErrUnknownType      = errors.New("unknown record type")
+	ErrIdMismatch       = errors.New("response ID does not match query")
+	ErrDohStatusNotOk   = errors.New("DNS over HTTPS server returned a status other than 200 OK")
+	ErrResponseTooLarge = errors.New("response is too large")
+)
+
+// Look up the record type with the given name, such as "AAAA"
+func recordType(typ string) (uint16, error) {
+	qtype, ok := dns.StringToType[strings.ToUpper(typ)]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownType, typ)
+	}
+	return qtype, nil
+}
+
+// Format the data of a resource record in the usual presentation form.
+// Names are left fully qualified and TXT strings are joined without quotes
+// so that they can be compared with the answers a canary expects.
+func formatResource(rr dns.RR) string {
+	switch rr := rr.(type) {
+	case *dns.A:
+		return rr.A.String()
+	case *dns.AAAA:
+		return rr.AAAA.String()
+	case *dns.TXT:
+		return strings.Join(rr.Txt, "")
+	case *dns.SOA:
+		return fmt.Sprintf("%s %s %d", rr.Ns, rr.Mbox, rr.Serial)
+	default:
+		return strings.TrimPrefix(rr.String(), rr.Header().String())
+	}
+}
+
+func tlsConfig(address config.DnsAddress, host string) *tls.Config {
+	serverName := address.TlsServerName
+	if serverName == "" {
+		serverName = host
+	}
+
+	return &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: address.InsecureSkipVerify,
+	}
+}
+
+// Send a query using DNS over HTTPS. miekg/dns only provides the wire
+// format for this so the HTTP exchange is done here.
+func exchangeHttps(ctx context.Context, address config.DnsAddress, query *dns.Msg) (*dns.Msg, error) {
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, address.Https, bytes.NewReader(packed))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig(address, req.URL.Hostname())}}
+	defer client.CloseIdleConnections()
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, ErrDohStatusNotOk
+	}
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, dns.MaxMsgSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > dns.MaxMsgSize {
+		return nil, ErrResponseTooLarge
+	}
+
+	response := new(dns.Msg)
+	if err := response.Unpack(body); err != nil {
+		return nil, err
+	}
+	if response.Id != query.Id {
+		return nil, ErrIdMismatch
+	}
+	return response, nil
+}
+
+// Send a recursive query for name to the server using protocol and return
+// the response.
+func exchange(ctx context.Context, address config.DnsAddress, protocol string, name string, typ string) (*dns.Msg, error) {
+	qtype, err := recordType(typ)
+	if err != nil {
+		return nil, err
+	}
+
+	query := new(dns.Msg)
+	query.SetQuestion(dns.Fqdn(name), qtype)
+
+	var client *dns.Client
+	var server string
+	switch protocol {
+	case ProtocolUdp:
+		client, server = &dns.Client{Net: "udp", UDPSize: dns.MaxMsgSize}, address.Address
+	case ProtocolTcp:
+		client, server = &dns.Client{Net: "tcp"}, address.Address
+	case ProtocolTls:
+		host, _, _ := net.SplitHostPort(address.Tls)
+		client, server = &dns.Client{Net: "tcp-tls", TLSConfig: tlsConfig(address, host)}, address.Tls
+	case ProtocolHttps:
+		// The ID is left as zero as recommended by RFC 8484
+		query.Id = 0
+		return exchangeHttps(ctx, address, query)
+	default:
+		return nil, fmt.Errorf("unknown protocol %s", protocol)
+	}
+
+	response, _, err := client.ExchangeContext(ctx, query, server)
+	return response, err
+}
@@ -4,26 +4,79 @@
 package server
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"io"
 	"log/slog"
+	"mime/multipart"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/SidingsMedia/unified-control-rdns/config"
 	"github.com/SidingsMedia/unified-control-rdns/server/domain"
+	"github.com/SidingsMedia/unified-control-rdns/server/jobs"
 	"github.com/jinzhu/copier"
 )
 
 type Repository interface {
 	GetServers() []domain.Server
-	GetCache(domain string, servers []string) (map[string]domain.CacheResult, error)
-	DeleteCacheEntry(zone string, servers []string) ([]domain.PerServerFail, error)
+	GetCache(ctx context.Context, domain string, servers []string) (map[string]domain.CacheResult, []domain.PerServerFail, error)
+	DeleteCacheEntry(ctx context.Context, zone string, servers []string) ([]domain.PerServerFail, error)
+	FlushCache(ctx context.Context, servers []string) ([]domain.PerServerFail, error)
+	Resolve(ctx context.Context, name string, typ string, servers []string) (map[string]domain.ResolveResult, []domain.PerServerFail, error)
+	GetUpstreamStats() domain.UpstreamStats
+	GetDnssecProperties(ctx context.Context, zone string, servers []string) (map[string]domain.DnssecPropertiesResult, []domain.PerServerFail, error)
+	GetDsRecords(ctx context.Context, zone string, servers []string) (map[string]domain.DsRecordsResult, []domain.PerServerFail, error)
+	SignZone(ctx context.Context, zone string, options DnssecSignOptions, servers []string) ([]domain.PerServerFail, error)
+	UnsignZone(ctx context.Context, zone string, servers []string) ([]domain.PerServerFail, error)
+	RolloverDnsKey(ctx context.Context, zone string, keyTag int, servers []string) ([]domain.PerServerFail, error)
+	ExportZone(ctx context.Context, zone string, server string) (string, []domain.PerServerFail, error)
+	ImportZone(ctx context.Context, zone string, zoneFile string, overwrite bool, servers []string) ([]domain.PerServerFail, error)
+	ListZones(ctx context.Context, servers []string) (map[string]domain.ZoneListResult, []domain.PerServerFail, error)
+	GetZoneRecords(ctx context.Context, zone string, servers []string) (map[string]domain.ZoneRecordsResult, []domain.PerServerFail, error)
+	CreateZone(ctx context.Context, zone string, typ string, servers []string) ([]domain.PerServerFail, error)
+	CreateForwarderZone(ctx context.Context, zone string, protocol string, address string, servers []string) ([]domain.PerServerFail, error)
+	DeleteZone(ctx context.Context, zone string, servers []string) ([]domain.PerServerFail, error)
+	AddRecord(ctx context.Context, zone string, name string, typ string, ttl int, data map[string]string, overwrite bool, servers []string) ([]domain.PerServerFail, error)
+	DeleteRecord(ctx context.Context, zone string, name string, typ string, data map[string]string, servers []string) ([]domain.PerServerFail, error)
+	GetDomainList(ctx context.Context, list string, servers []string) (map[string][]string, []domain.PerServerFail, error)
+	AddToDomainList(ctx context.Context, list string, name string, servers []string) ([]domain.PerServerFail, error)
+	RemoveFromDomainList(ctx context.Context, list string, name string, servers []string) ([]domain.PerServerFail, error)
+	Ping(ctx context.Context, servers []string) ([]domain.PerServerFail, error)
+	UpdateBlockLists(ctx context.Context, servers []string) ([]domain.PerServerFail, error)
+	ResyncZone(ctx context.Context, zone string, servers []string) ([]domain.PerServerFail, error)
+	ListDhcpScopes(ctx context.Context, servers []string) (map[string]domain.DhcpScopeListResult, []domain.PerServerFail, error)
+	SetDhcpScope(ctx context.Context, name string, settings domain.DhcpScopeSettings, servers []string) ([]domain.PerServerFail, error)
+	SetDhcpScopeEnabled(ctx context.Context, name string, enabled bool, servers []string) ([]domain.PerServerFail, error)
+	ListDhcpLeases(ctx context.Context, servers []string) (map[string]domain.DhcpLeaseListResult, []domain.PerServerFail, error)
+	RemoveDhcpLease(ctx context.Context, scope string, hardwareAddress string, servers []string) ([]domain.PerServerFail, error)
+	ReserveDhcpLease(ctx context.Context, scope string, hardwareAddress string, servers []string) ([]domain.PerServerFail, error)
+	GetSettings(ctx context.Context, servers []string) (map[string]domain.SettingsResult, []domain.PerServerFail, error)
+	SetSettings(ctx context.Context, settings url.Values, servers []string) ([]domain.PerServerFail, error)
+	ListApps(ctx context.Context, servers []string) (map[string]domain.AppListResult, []domain.PerServerFail, error)
+	InstallApp(ctx context.Context, name string, archive []byte, update bool, servers []string) ([]domain.PerServerFail, error)
+	UninstallApp(ctx context.Context, name string, servers []string) ([]domain.PerServerFail, error)
+	GetAppConfig(ctx context.Context, name string, servers []string) (map[string]domain.AppConfigResult, []domain.PerServerFail, error)
+	SetAppConfig(ctx context.Context, name string, config string, servers []string) ([]domain.PerServerFail, error)
+	BackupSettings(ctx context.Context, server string, logs bool) (io.ReadCloser, []domain.PerServerFail, error)
+	RestoreSettings(ctx context.Context, server string, archive io.Reader, deleteExisting bool) ([]domain.PerServerFail, error)
 }
 
+// Domain lists kept by Technetium
+const (
+	BlockedList = "blocked"
+	AllowedList = "allowed"
+)
+
 type repository struct {
 	servers   []config.Server
 	serverMap map[string]config.Server
+	limiter   *limiter
 }
 
 // Return a list of all configured servers
@@ -33,34 +86,139 @@ func (r *repository) GetServers() []domain.Server {
 	return servers
 }
 
-func makeTechnetiumRequests(servers []string, urls []string) chan struct {
+type technetiumResult struct {
 	id       string
 	response *http.Response
 	err      error
-} {
-	results := make(chan (struct {
-		id       string
-		response *http.Response
-		err      error
-	}), len(urls))
-
-	for i, url := range urls {
-		go func(url string, index int) {
+}
+
+// Send a GET request to each of the urls concurrently. The requests are
+// bound to ctx so that they are abandoned if the client goes away or the
+// request deadline passes. The number of requests in flight at once is
+// bounded by the limiter, with any excess waiting for a free slot.
+func (r *repository) makeTechnetiumRequests(ctx context.Context, servers []string, urls []string) chan technetiumResult {
+	return r.postTechnetiumRequests(ctx, servers, urls, "", nil)
+}
+
+// Send a request to each of the urls concurrently in the same way as
+// makeTechnetiumRequests. If body is not nil it is sent as a POST request
+// with the given content type.
+func (r *repository) postTechnetiumRequests(ctx context.Context, servers []string, urls []string, contentType string, body []byte) chan technetiumResult {
+	results := make(chan technetiumResult, len(urls))
+	slots := r.limiter.requestSlots(ctx)
+
+	for i, apiUrl := range urls {
+		go func(apiUrl string, index int) {
+			release, err := r.limiter.acquire(ctx, slots)
+			if err != nil {
+				results <- technetiumResult{id: servers[index], err: err}
+				return
+			}
+			defer release()
+
 			slog.Info("Sending request to DNS server", "server", servers[index])
-			res, err := http.Get(url)
-			results <- struct {
-				id       string
-				response *http.Response
-				err      error
-			}{
-				id: servers[index], response: res, err: err,
+			jobs.RequestStarted(ctx, servers[index])
+			method, reader := http.MethodGet, io.Reader(nil)
+			if body != nil {
+				method, reader = http.MethodPost, bytes.NewReader(body)
+			}
+
+			req, err := http.NewRequestWithContext(ctx, method, apiUrl, reader)
+			if err != nil {
+				results <- technetiumResult{id: servers[index], err: err}
+				return
+			}
+			if body != nil {
+				req.Header.Set("Content-Type", contentType)
 			}
-		}(url, i)
+
+			res, err := http.DefaultClient.Do(req)
+
+			// The URL contains the API token so make sure it doesn't end
+			// up in error messages sent back to clients.
+			var urlErr *url.Error
+			if errors.As(err, &urlErr) {
+				err = urlErr.Err
+			}
+
+			// Read the body before giving up the slot so that the
+			// connection is no longer in use by the time another request
+			// is allowed to start.
+			if err == nil {
+				var body []byte
+				body, err = io.ReadAll(res.Body)
+				res.Body.Close()
+				res.Body = io.NopCloser(bytes.NewReader(body))
+			}
+
+			jobs.RequestFinished(ctx, servers[index], err)
+			results <- technetiumResult{id: servers[index], response: res, err: err}
+		}(apiUrl, i)
 	}
 
 	return results
 }
 
+// Body of a streamed response, which gives up the slot of its request once
+// it has been closed
+type slotBody struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (b *slotBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+// Send a single request to server without reading the response, for bodies
+// too large to hold in memory. If body is not nil it is streamed as a POST
+// request with the given content type. The request keeps its slot until
+// the body of the response is closed.
+func (r *repository) streamTechnetiumRequest(ctx context.Context, server string, apiUrl string, contentType string, body io.Reader) (*http.Response, error) {
+	release, err := r.limiter.acquire(ctx, r.limiter.requestSlots(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("Sending request to DNS server", "server", server)
+	jobs.RequestStarted(ctx, server)
+	method := http.MethodGet
+	if body != nil {
+		method = http.MethodPost
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, apiUrl, body)
+	if err != nil {
+		release()
+		jobs.RequestFinished(ctx, server, err)
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+
+	// The URL contains the API token so make sure it doesn't end up in
+	// error messages sent back to clients.
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+
+	jobs.RequestFinished(ctx, server, err)
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	res.Body = &slotBody{ReadCloser: res.Body, release: release}
+	return res, nil
+}
+
 func (r *repository) formatApiUrl(servers []string, endpoint string, query string) (urls []string, err error) {
 	for _, id := range servers {
 		server, exists := r.serverMap[id]
@@ -73,136 +231,845 @@ func (r *repository) formatApiUrl(servers []string, endpoint string, query strin
 	return urls, nil
 }
 
-// Process the HTTP response from the server and return the resulting CacheResult.
-func processCacheResponse(response *http.Response) (*domain.CacheResult, error) {
+// Read the HTTP response from the server and decode it into result. The
+// response body is always closed. Responses that are not 200 OK or where
+// Technetium reports a status other than ok are returned as errors.
+func processResponse(response *http.Response, result any) error {
+	defer response.Body.Close()
+
 	body, err := io.ReadAll(response.Body)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	if response.StatusCode != http.StatusOK {
 		slog.Error("Response from server was not 200 OK", "requestUrl", response.Request.URL, "code", response.StatusCode, "body", body)
-		return nil, ErrStatusNotOk
+		return ErrStatusNotOk
 	}
 
-	var result domain.CacheResult
-	if err := json.Unmarshal(body, &result); err != nil {
-		return nil, err
+	var status domain.TechnetiumResponse
+	if err := json.Unmarshal(body, &status); err != nil {
+		return err
+	}
+
+	if status.Status != "ok" {
+		slog.Error(
+			"Got an error from Technetium DNS",
+			"error", status.ErrorMessage,
+			"trace", status.StackTrace,
+			"innerMessage", status.InnerErrorMessage,
+		)
+
+		return errors.New(status.ErrorMessage)
+	}
+
+	if err := json.Unmarshal(body, result); err != nil {
+		return err
 	}
 
 	slog.Info("Processed response", "result", result)
 
-	return &result, nil
+	return nil
+}
+
+// Wait for count results to arrive and decode each successful response into
+// a T. Servers that could not be reached or returned an error are collected
+// separately so that callers can still use the results from the servers that
+// did answer.
+func collectResults[T any](results chan technetiumResult, count int) (map[string]T, []domain.PerServerFail) {
+	succeeded := make(map[string]T)
+	failed := []domain.PerServerFail{}
+
+	for i := 0; i < count; i++ {
+		result := <-results
+		if result.err != nil {
+			slog.Error("Failed to make request", "server", result.id, "error", result.err)
+			failed = append(failed, domain.PerServerFail{Id: result.id, Err: result.err})
+			continue
+		}
+
+		var response T
+		if err := processResponse(result.response, &response); err != nil {
+			failed = append(failed, domain.PerServerFail{Id: result.id, Err: err})
+			continue
+		}
+
+		succeeded[result.id] = response
+	}
+
+	return succeeded, failed
 }
 
-// Get the cached results for a set of servers
-func (r *repository) GetCache(searchDomain string, servers []string) (map[string]domain.CacheResult, error) {
+// Get the cached results for a set of servers. Results are returned for
+// every server that answered, along with the servers that failed.
+func (r *repository) GetCache(ctx context.Context, searchDomain string, servers []string) (map[string]domain.CacheResult, []domain.PerServerFail, error) {
 	urls, err := r.formatApiUrl(servers, "/api/cache/list", "domain="+searchDomain)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cache, failed := collectResults[domain.CacheResult](r.makeTechnetiumRequests(ctx, servers, urls), len(urls))
+	return cache, failed, nil
+}
+
+func (r *repository) DeleteCacheEntry(ctx context.Context, zone string, servers []string) ([]domain.PerServerFail, error) {
+	urls, err := r.formatApiUrl(servers, "/api/cache/delete", "domain="+zone)
+	if err != nil {
+		return nil, err
+	}
+
+	_, failed := collectResults[domain.TechnetiumResponse](r.makeTechnetiumRequests(ctx, servers, urls), len(urls))
+	return failed, nil
+}
+
+// Remove every entry from the cache of the servers
+func (r *repository) FlushCache(ctx context.Context, servers []string) ([]domain.PerServerFail, error) {
+	urls, err := r.formatApiUrl(servers, "/api/cache/flush", "")
+	if err != nil {
+		return nil, err
+	}
+
+	_, failed := collectResults[domain.TechnetiumResponse](r.makeTechnetiumRequests(ctx, servers, urls), len(urls))
+	return failed, nil
+}
+
+// Ask each of the servers to resolve name using its own resolver
+func (r *repository) Resolve(ctx context.Context, name string, typ string, servers []string) (map[string]domain.ResolveResult, []domain.PerServerFail, error) {
+	query := url.Values{}
+	query.Set("server", "this-server")
+	query.Set("domain", name)
+	query.Set("type", typ)
+
+	urls, err := r.formatApiUrl(servers, "/api/dnsClient/resolve", query.Encode())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	results, failed := collectResults[domain.ResolveResult](r.makeTechnetiumRequests(ctx, servers, urls), len(urls))
+	return results, failed, nil
+}
+
+// Get the DNSSEC status of a zone and the private keys used to sign it
+func (r *repository) GetDnssecProperties(ctx context.Context, zone string, servers []string) (map[string]domain.DnssecPropertiesResult, []domain.PerServerFail, error) {
+	query := url.Values{}
+	query.Set("zone", zone)
+
+	urls, err := r.formatApiUrl(servers, "/api/zones/dnssec/properties/get", query.Encode())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	results, failed := collectResults[domain.DnssecPropertiesResult](r.makeTechnetiumRequests(ctx, servers, urls), len(urls))
+	return results, failed, nil
+}
+
+// Get the DS records that the parent zone should hold for each key signing
+// key of a zone
+func (r *repository) GetDsRecords(ctx context.Context, zone string, servers []string) (map[string]domain.DsRecordsResult, []domain.PerServerFail, error) {
+	query := url.Values{}
+	query.Set("zone", zone)
+
+	urls, err := r.formatApiUrl(servers, "/api/zones/dnssec/viewDS", query.Encode())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	results, failed := collectResults[domain.DsRecordsResult](r.makeTechnetiumRequests(ctx, servers, urls), len(urls))
+	return results, failed, nil
+}
+
+// Sign a zone on each of the servers. Every server generates its own keys.
+func (r *repository) SignZone(ctx context.Context, zone string, options DnssecSignOptions, servers []string) ([]domain.PerServerFail, error) {
+	query := url.Values{}
+	query.Set("zone", zone)
+	query.Set("algorithm", options.Algorithm)
+	if options.Algorithm == "RSA" {
+		query.Set("hashAlgorithm", options.HashAlgorithm)
+		query.Set("kskKeySize", strconv.Itoa(options.KskKeySize))
+		query.Set("zskKeySize", strconv.Itoa(options.ZskKeySize))
+	} else {
+		query.Set("curve", options.Curve)
+	}
+	query.Set("dnsKeyTtl", strconv.Itoa(options.DnsKeyTtl))
+	query.Set("zskRolloverDays", strconv.Itoa(options.ZskRolloverDays))
+	query.Set("nxProof", options.NxProof)
+	if options.NxProof == "NSEC3" {
+		query.Set("iterations", strconv.Itoa(options.Iterations))
+		query.Set("saltLength", strconv.Itoa(options.SaltLength))
+	}
+
+	urls, err := r.formatApiUrl(servers, "/api/zones/dnssec/sign", query.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	_, failed := collectResults[domain.TechnetiumResponse](r.makeTechnetiumRequests(ctx, servers, urls), len(urls))
+	return failed, nil
+}
+
+// Remove DNSSEC from a zone on each of the servers
+func (r *repository) UnsignZone(ctx context.Context, zone string, servers []string) ([]domain.PerServerFail, error) {
+	query := url.Values{}
+	query.Set("zone", zone)
+
+	urls, err := r.formatApiUrl(servers, "/api/zones/dnssec/unsign", query.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	_, failed := collectResults[domain.TechnetiumResponse](r.makeTechnetiumRequests(ctx, servers, urls), len(urls))
+	return failed, nil
+}
+
+// Start rolling over the key with keyTag on each of the servers
+func (r *repository) RolloverDnsKey(ctx context.Context, zone string, keyTag int, servers []string) ([]domain.PerServerFail, error) {
+	query := url.Values{}
+	query.Set("zone", zone)
+	query.Set("keyTag", strconv.Itoa(keyTag))
+
+	urls, err := r.formatApiUrl(servers, "/api/zones/dnssec/properties/rolloverDnsKey", query.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	_, failed := collectResults[domain.TechnetiumResponse](r.makeTechnetiumRequests(ctx, servers, urls), len(urls))
+	return failed, nil
+}
+
+// Get the records of a zone from a server as a zone file. Technetium sends
+// the zone file as plain text but reports errors as JSON.
+func (r *repository) ExportZone(ctx context.Context, zone string, server string) (string, []domain.PerServerFail, error) {
+	query := url.Values{}
+	query.Set("zone", zone)
+
+	urls, err := r.formatApiUrl([]string{server}, "/api/zones/export", query.Encode())
+	if err != nil {
+		return "", nil, err
+	}
+
+	result := <-r.makeTechnetiumRequests(ctx, []string{server}, urls)
+	if result.err != nil {
+		return "", []domain.PerServerFail{{Id: server, Err: result.err}}, nil
+	}
+
+	if strings.HasPrefix(result.response.Header.Get("Content-Type"), "application/json") || result.response.StatusCode != http.StatusOK {
+		var status domain.TechnetiumResponse
+		if err := processResponse(result.response, &status); err != nil {
+			return "", []domain.PerServerFail{{Id: server, Err: err}}, nil
+		}
+		return "", []domain.PerServerFail{{Id: server, Err: errors.New("server did not return a zone file")}}, nil
+	}
+
+	defer result.response.Body.Close()
+	body, err := io.ReadAll(result.response.Body)
+	if err != nil {
+		return "", []domain.PerServerFail{{Id: server, Err: err}}, nil
+	}
+
+	return string(body), nil, nil
+}
+
+// Import the records in a zone file into a zone on each of the servers.
+// If overwrite is set, existing records with the same name and type are
+// replaced rather than added to.
+func (r *repository) ImportZone(ctx context.Context, zone string, zoneFile string, overwrite bool, servers []string) ([]domain.PerServerFail, error) {
+	query := url.Values{}
+	query.Set("zone", zone)
+	query.Set("overwrite", strconv.FormatBool(overwrite))
+
+	urls, err := r.formatApiUrl(servers, "/api/zones/import", query.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	_, failed := collectResults[domain.TechnetiumResponse](r.postTechnetiumRequests(ctx, servers, urls, "text/plain", []byte(zoneFile)), len(urls))
+	return failed, nil
+}
+
+// List the zones on each of the servers
+func (r *repository) ListZones(ctx context.Context, servers []string) (map[string]domain.ZoneListResult, []domain.PerServerFail, error) {
+	urls, err := r.formatApiUrl(servers, "/api/zones/list", "")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	results, failed := collectResults[domain.ZoneListResult](r.makeTechnetiumRequests(ctx, servers, urls), len(urls))
+	return results, failed, nil
+}
+
+// Get every record in a zone, including those of its subdomains
+func (r *repository) GetZoneRecords(ctx context.Context, zone string, servers []string) (map[string]domain.ZoneRecordsResult, []domain.PerServerFail, error) {
+	query := url.Values{}
+	query.Set("zone", zone)
+	query.Set("domain", zone)
+	query.Set("listZone", "true")
+
+	urls, err := r.formatApiUrl(servers, "/api/zones/records/get", query.Encode())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	results, failed := collectResults[domain.ZoneRecordsResult](r.makeTechnetiumRequests(ctx, servers, urls), len(urls))
+	return results, failed, nil
+}
+
+// Create an empty zone of the given type on each of the servers
+func (r *repository) CreateZone(ctx context.Context, zone string, typ string, servers []string) ([]domain.PerServerFail, error) {
+	query := url.Values{}
+	query.Set("zone", zone)
+	query.Set("type", typ)
+
+	urls, err := r.formatApiUrl(servers, "/api/zones/create", query.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	_, failed := collectResults[domain.TechnetiumResponse](r.makeTechnetiumRequests(ctx, servers, urls), len(urls))
+	return failed, nil
+}
+
+// Create a conditional forwarder zone on each of the servers. Technetium
+// needs the first forwarder of the zone to create it.
+func (r *repository) CreateForwarderZone(ctx context.Context, zone string, protocol string, address string, servers []string) ([]domain.PerServerFail, error) {
+	query := url.Values{}
+	query.Set("zone", zone)
+	query.Set("type", "Forwarder")
+	query.Set("protocol", protocol)
+	query.Set("forwarder", address)
+
+	urls, err := r.formatApiUrl(servers, "/api/zones/create", query.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	_, failed := collectResults[domain.TechnetiumResponse](r.makeTechnetiumRequests(ctx, servers, urls), len(urls))
+	return failed, nil
+}
+
+// Delete a zone and all of its records from each of the servers
+func (r *repository) DeleteZone(ctx context.Context, zone string, servers []string) ([]domain.PerServerFail, error) {
+	query := url.Values{}
+	query.Set("zone", zone)
+
+	urls, err := r.formatApiUrl(servers, "/api/zones/delete", query.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	_, failed := collectResults[domain.TechnetiumResponse](r.makeTechnetiumRequests(ctx, servers, urls), len(urls))
+	return failed, nil
+}
+
+// Add a record to a zone on each of the servers. data holds the type
+// specific parameters, such as ipAddress for an A record. If overwrite is
+// set, every existing record with the same name and type is replaced.
+func (r *repository) AddRecord(ctx context.Context, zone string, name string, typ string, ttl int, data map[string]string, overwrite bool, servers []string) ([]domain.PerServerFail, error) {
+	query := url.Values{}
+	for key, value := range data {
+		query.Set(key, value)
+	}
+	query.Set("zone", zone)
+	query.Set("domain", name)
+	query.Set("type", typ)
+	query.Set("ttl", strconv.Itoa(ttl))
+	query.Set("overwrite", strconv.FormatBool(overwrite))
+
+	urls, err := r.formatApiUrl(servers, "/api/zones/records/add", query.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	_, failed := collectResults[domain.TechnetiumResponse](r.makeTechnetiumRequests(ctx, servers, urls), len(urls))
+	return failed, nil
+}
+
+// Delete the record with the given data from a zone on each of the servers
+func (r *repository) DeleteRecord(ctx context.Context, zone string, name string, typ string, data map[string]string, servers []string) ([]domain.PerServerFail, error) {
+	query := url.Values{}
+	for key, value := range data {
+		query.Set(key, value)
+	}
+	query.Set("zone", zone)
+	query.Set("domain", name)
+	query.Set("type", typ)
 
+	urls, err := r.formatApiUrl(servers, "/api/zones/records/delete", query.Encode())
 	if err != nil {
 		return nil, err
 	}
 
-	results := makeTechnetiumRequests(servers, urls)
-	cache := make(map[string]domain.CacheResult)
+	_, failed := collectResults[domain.TechnetiumResponse](r.makeTechnetiumRequests(ctx, servers, urls), len(urls))
+	return failed, nil
+}
+
+// Get the domains on the blocked or allowed list of each of the servers.
+// Technetium exports the lists as plain text with one domain per line.
+func (r *repository) GetDomainList(ctx context.Context, list string, servers []string) (map[string][]string, []domain.PerServerFail, error) {
+	urls, err := r.formatApiUrl(servers, "/api/"+list+"/export", "")
+	if err != nil {
+		return nil, nil, err
+	}
 
+	results := r.makeTechnetiumRequests(ctx, servers, urls)
+	lists := make(map[string][]string)
+	failed := []domain.PerServerFail{}
 	for range urls {
 		result := <-results
 		if result.err != nil {
-			slog.Error("Failed to make request", "server", result.id, "error", result.err)
-			return nil, result.err
+			failed = append(failed, domain.PerServerFail{Id: result.id, Err: result.err})
+			continue
+		}
+
+		if strings.HasPrefix(result.response.Header.Get("Content-Type"), "application/json") || result.response.StatusCode != http.StatusOK {
+			var status domain.TechnetiumResponse
+			err := processResponse(result.response, &status)
+			if err == nil {
+				err = errors.New("server did not return a domain list")
+			}
+			failed = append(failed, domain.PerServerFail{Id: result.id, Err: err})
+			continue
 		}
 
-		response, err := processCacheResponse(result.response)
+		body, err := io.ReadAll(result.response.Body)
+		result.response.Body.Close()
 		if err != nil {
-			return nil, err
+			failed = append(failed, domain.PerServerFail{Id: result.id, Err: err})
+			continue
 		}
 
-		cache[result.id] = *response
+		domains := []string{}
+		for _, line := range strings.Split(string(body), "\n") {
+			line = strings.TrimSpace(line)
+			if line != "" && !strings.HasPrefix(line, "#") {
+				domains = append(domains, line)
+			}
+		}
+		lists[result.id] = domains
+	}
+
+	return lists, failed, nil
+}
 
-		if response.Status != "ok" {
-			slog.Error(
-				"Got an error from Technetium DNS",
-				"error", response.ErrorMessage,
-				"trace", response.StackTrace,
-				"innerMessage", response.InnerErrorMessage,
-			)
+// Add a domain to the blocked or allowed list of each of the servers
+func (r *repository) AddToDomainList(ctx context.Context, list string, name string, servers []string) ([]domain.PerServerFail, error) {
+	query := url.Values{}
+	query.Set("domain", name)
 
-			return nil, errors.New(response.ErrorMessage)
+	urls, err := r.formatApiUrl(servers, "/api/"+list+"/add", query.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	_, failed := collectResults[domain.TechnetiumResponse](r.makeTechnetiumRequests(ctx, servers, urls), len(urls))
+	return failed, nil
+}
+
+// Remove a domain from the blocked or allowed list of each of the servers
+func (r *repository) RemoveFromDomainList(ctx context.Context, list string, name string, servers []string) ([]domain.PerServerFail, error) {
+	query := url.Values{}
+	query.Set("domain", name)
+
+	urls, err := r.formatApiUrl(servers, "/api/"+list+"/delete", query.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	_, failed := collectResults[domain.TechnetiumResponse](r.makeTechnetiumRequests(ctx, servers, urls), len(urls))
+	return failed, nil
+}
+
+// Check that the API of each server is answering. Technetium has no
+// endpoint for this so the smallest set of dashboard stats is requested.
+func (r *repository) Ping(ctx context.Context, servers []string) ([]domain.PerServerFail, error) {
+	urls, err := r.formatApiUrl(servers, "/api/dashboard/stats/get", "type=LastHour")
+	if err != nil {
+		return nil, err
+	}
+
+	_, failed := collectResults[domain.TechnetiumResponse](r.makeTechnetiumRequests(ctx, servers, urls), len(urls))
+	return failed, nil
+}
+
+// Make each of the servers download its block list URLs again straight
+// away rather than waiting for its next update
+func (r *repository) UpdateBlockLists(ctx context.Context, servers []string) ([]domain.PerServerFail, error) {
+	urls, err := r.formatApiUrl(servers, "/api/settings/forceUpdateBlockLists", "")
+	if err != nil {
+		return nil, err
+	}
+
+	_, failed := collectResults[domain.TechnetiumResponse](r.makeTechnetiumRequests(ctx, servers, urls), len(urls))
+	return failed, nil
+}
+
+// Make each of the servers transfer a secondary or stub zone from its
+// primary again
+func (r *repository) ResyncZone(ctx context.Context, zone string, servers []string) ([]domain.PerServerFail, error) {
+	query := url.Values{}
+	query.Set("zone", zone)
+
+	urls, err := r.formatApiUrl(servers, "/api/zones/resync", query.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	_, failed := collectResults[domain.TechnetiumResponse](r.makeTechnetiumRequests(ctx, servers, urls), len(urls))
+	return failed, nil
+}
+
+// List the DHCP scopes of each of the servers
+func (r *repository) ListDhcpScopes(ctx context.Context, servers []string) (map[string]domain.DhcpScopeListResult, []domain.PerServerFail, error) {
+	urls, err := r.formatApiUrl(servers, "/api/dhcp/scopes/list", "")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	results, failed := collectResults[domain.DhcpScopeListResult](r.makeTechnetiumRequests(ctx, servers, urls), len(urls))
+	return results, failed, nil
+}
+
+// Create a DHCP scope on each of the servers, or update it if it already
+// exists. Lists are sent in the pipe and comma separated forms Technetium
+// expects.
+func (r *repository) SetDhcpScope(ctx context.Context, name string, settings domain.DhcpScopeSettings, servers []string) ([]domain.PerServerFail, error) {
+	query := url.Values{}
+	query.Set("name", name)
+	query.Set("startingAddress", settings.StartingAddress)
+	query.Set("endingAddress", settings.EndingAddress)
+	query.Set("subnetMask", settings.SubnetMask)
+	if settings.LeaseTimeDays != 0 || settings.LeaseTimeHours != 0 || settings.LeaseTimeMinutes != 0 {
+		query.Set("leaseTimeDays", strconv.Itoa(settings.LeaseTimeDays))
+		query.Set("leaseTimeHours", strconv.Itoa(settings.LeaseTimeHours))
+		query.Set("leaseTimeMinutes", strconv.Itoa(settings.LeaseTimeMinutes))
+	}
+	if settings.DomainName != nil {
+		query.Set("domainName", *settings.DomainName)
+	}
+	if settings.RouterAddress != nil {
+		query.Set("routerAddress", *settings.RouterAddress)
+	}
+	if settings.UseThisDnsServer != nil {
+		query.Set("useThisDnsServer", strconv.FormatBool(*settings.UseThisDnsServer))
+	}
+	if settings.DnsServers != nil {
+		query.Set("dnsServers", strings.Join(settings.DnsServers, ","))
+	}
+	if settings.AllowOnlyReservedLeases != nil {
+		query.Set("allowOnlyReservedLeases", strconv.FormatBool(*settings.AllowOnlyReservedLeases))
+	}
+
+	if settings.Exclusions != nil {
+		exclusions := []string{}
+		for _, exclusion := range settings.Exclusions {
+			exclusions = append(exclusions, exclusion.StartingAddress, exclusion.EndingAddress)
 		}
+		query.Set("exclusions", strings.Join(exclusions, "|"))
 	}
 
-	return cache, nil
+	if settings.ReservedLeases != nil {
+		reserved := []string{}
+		for _, lease := range settings.ReservedLeases {
+			reserved = append(reserved, lease.HostName, lease.HardwareAddress, lease.Address, lease.Comments)
+		}
+		query.Set("reservedLeases", strings.Join(reserved, "|"))
+	}
+
+	urls, err := r.formatApiUrl(servers, "/api/dhcp/scopes/set", query.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	_, failed := collectResults[domain.TechnetiumResponse](r.makeTechnetiumRequests(ctx, servers, urls), len(urls))
+	return failed, nil
 }
 
-// Process the HTTP response from the server and return the resulting TechnetiumResponse.
-func processDeleteResponse(response *http.Response) (*domain.TechnetiumResponse, error) {
-	body, err := io.ReadAll(response.Body)
+// Start or stop handing out leases from a DHCP scope on each of the servers
+func (r *repository) SetDhcpScopeEnabled(ctx context.Context, name string, enabled bool, servers []string) ([]domain.PerServerFail, error) {
+	endpoint := "/api/dhcp/scopes/disable"
+	if enabled {
+		endpoint = "/api/dhcp/scopes/enable"
+	}
+
+	urls, err := r.formatApiUrl(servers, endpoint, "name="+url.QueryEscape(name))
 	if err != nil {
 		return nil, err
 	}
 
-	if response.StatusCode != http.StatusOK {
-		slog.Error("Response from server was not 200 OK", "requestUrl", response.Request.URL, "code", response.StatusCode, "body", body)
-		return nil, ErrStatusNotOk
+	_, failed := collectResults[domain.TechnetiumResponse](r.makeTechnetiumRequests(ctx, servers, urls), len(urls))
+	return failed, nil
+}
+
+// List the DHCP leases of every scope on each of the servers
+func (r *repository) ListDhcpLeases(ctx context.Context, servers []string) (map[string]domain.DhcpLeaseListResult, []domain.PerServerFail, error) {
+	urls, err := r.formatApiUrl(servers, "/api/dhcp/leases/list", "")
+	if err != nil {
+		return nil, nil, err
 	}
 
-	var result domain.TechnetiumResponse
-	if err := json.Unmarshal(body, &result); err != nil {
+	results, failed := collectResults[domain.DhcpLeaseListResult](r.makeTechnetiumRequests(ctx, servers, urls), len(urls))
+	return results, failed, nil
+}
+
+func dhcpLeaseQuery(scope string, hardwareAddress string) string {
+	query := url.Values{}
+	query.Set("name", scope)
+	query.Set("hardwareAddress", hardwareAddress)
+	return query.Encode()
+}
+
+// Remove the lease of a client from a DHCP scope on each of the servers
+func (r *repository) RemoveDhcpLease(ctx context.Context, scope string, hardwareAddress string, servers []string) ([]domain.PerServerFail, error) {
+	urls, err := r.formatApiUrl(servers, "/api/dhcp/leases/remove", dhcpLeaseQuery(scope, hardwareAddress))
+	if err != nil {
 		return nil, err
 	}
 
-	slog.Info("Processed response", "result", result)
+	_, failed := collectResults[domain.TechnetiumResponse](r.makeTechnetiumRequests(ctx, servers, urls), len(urls))
+	return failed, nil
+}
 
-	return &result, nil
+// Turn the dynamic lease of a client into a reserved lease on each of the
+// servers
+func (r *repository) ReserveDhcpLease(ctx context.Context, scope string, hardwareAddress string, servers []string) ([]domain.PerServerFail, error) {
+	urls, err := r.formatApiUrl(servers, "/api/dhcp/leases/convertToReserved", dhcpLeaseQuery(scope, hardwareAddress))
+	if err != nil {
+		return nil, err
+	}
+
+	_, failed := collectResults[domain.TechnetiumResponse](r.makeTechnetiumRequests(ctx, servers, urls), len(urls))
+	return failed, nil
 }
 
-func (r *repository) DeleteCacheEntry(zone string, servers []string) ([]domain.PerServerFail, error) {
-	urls, err := r.formatApiUrl(servers, "/api/cache/delete", "domain="+zone)
+// Get the settings of each of the servers
+func (r *repository) GetSettings(ctx context.Context, servers []string) (map[string]domain.SettingsResult, []domain.PerServerFail, error) {
+	urls, err := r.formatApiUrl(servers, "/api/settings/get", "")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	results, failed := collectResults[domain.SettingsResult](r.makeTechnetiumRequests(ctx, servers, urls), len(urls))
+	return results, failed, nil
+}
+
+// Change settings on each of the servers. Settings that aren't given are
+// left as they are. They are sent as a form as the full set of settings
+// can be too long for a URL.
+func (r *repository) SetSettings(ctx context.Context, settings url.Values, servers []string) ([]domain.PerServerFail, error) {
+	urls, err := r.formatApiUrl(servers, "/api/settings/set", "")
 	if err != nil {
 		return nil, err
 	}
 
-	results := makeTechnetiumRequests(servers, urls)
+	_, failed := collectResults[domain.TechnetiumResponse](r.postTechnetiumRequests(ctx, servers, urls, "application/x-www-form-urlencoded", []byte(settings.Encode())), len(urls))
+	return failed, nil
+}
 
-	errs := []domain.PerServerFail{}
+// List the DNS apps installed on each of the servers
+func (r *repository) ListApps(ctx context.Context, servers []string) (map[string]domain.AppListResult, []domain.PerServerFail, error) {
+	urls, err := r.formatApiUrl(servers, "/api/apps/list", "")
+	if err != nil {
+		return nil, nil, err
+	}
 
-	for _, server := range servers {
-		result := <-results
-		if result.err != nil {
-			slog.Error("Failed to make request", "server", result.id, "error", result.err)
-			errs = append(errs, domain.PerServerFail{Id: server, Err: err})
-			continue
+	results, failed := collectResults[domain.AppListResult](r.makeTechnetiumRequests(ctx, servers, urls), len(urls))
+	return results, failed, nil
+}
+
+// Encode a file upload as a multipart form, returning the body and its
+// content type
+func multipartFile(field string, fileName string, data []byte) ([]byte, string, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	file, err := form.CreateFormFile(field, fileName)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := file.Write(data); err != nil {
+		return nil, "", err
+	}
+	if err := form.Close(); err != nil {
+		return nil, "", err
+	}
+	return body.Bytes(), form.FormDataContentType(), nil
+}
+
+// Stream data as the only file of a multipart form in the same way as
+// multipartFile. The form is written as it is read, and done receives the
+// error from reading data once the form has been written or abandoned by
+// closing the body.
+func multipartStream(field string, fileName string, data io.Reader) (io.ReadCloser, string, chan error) {
+	reader, writer := io.Pipe()
+	form := multipart.NewWriter(writer)
+	done := make(chan error, 1)
+
+	go func() {
+		file, err := form.CreateFormFile(field, fileName)
+		if err == nil {
+			_, err = io.Copy(file, data)
 		}
+		if err == nil {
+			err = form.Close()
+		}
+		writer.CloseWithError(err)
+		done <- err
+	}()
 
-		response, err := processDeleteResponse(result.response)
-		if err != nil {
-			errs = append(errs, domain.PerServerFail{Id: server, Err: err})
-			continue
+	return reader, form.FormDataContentType(), done
+}
+
+// Install an app from its zip archive on each of the servers, or update it
+// if update is set. Technetium takes the archive as a file in a multipart
+// form.
+func (r *repository) InstallApp(ctx context.Context, name string, archive []byte, update bool, servers []string) ([]domain.PerServerFail, error) {
+	query := url.Values{}
+	query.Set("name", name)
+
+	endpoint := "/api/apps/install"
+	if update {
+		endpoint = "/api/apps/update"
+	}
+
+	urls, err := r.formatApiUrl(servers, endpoint, query.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	body, contentType, err := multipartFile("fileAppZip", name+".zip", archive)
+	if err != nil {
+		return nil, err
+	}
+
+	_, failed := collectResults[domain.TechnetiumResponse](r.postTechnetiumRequests(ctx, servers, urls, contentType, body), len(urls))
+	return failed, nil
+}
+
+func (r *repository) UninstallApp(ctx context.Context, name string, servers []string) ([]domain.PerServerFail, error) {
+	query := url.Values{}
+	query.Set("name", name)
+
+	urls, err := r.formatApiUrl(servers, "/api/apps/uninstall", query.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	_, failed := collectResults[domain.TechnetiumResponse](r.makeTechnetiumRequests(ctx, servers, urls), len(urls))
+	return failed, nil
+}
+
+func (r *repository) GetAppConfig(ctx context.Context, name string, servers []string) (map[string]domain.AppConfigResult, []domain.PerServerFail, error) {
+	query := url.Values{}
+	query.Set("name", name)
+
+	urls, err := r.formatApiUrl(servers, "/api/apps/config/get", query.Encode())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	results, failed := collectResults[domain.AppConfigResult](r.makeTechnetiumRequests(ctx, servers, urls), len(urls))
+	return results, failed, nil
+}
+
+// Replace the config of an app on each of the servers. The config is sent
+// as a form as it can be too long for a URL.
+func (r *repository) SetAppConfig(ctx context.Context, name string, config string, servers []string) ([]domain.PerServerFail, error) {
+	query := url.Values{}
+	query.Set("name", name)
+
+	urls, err := r.formatApiUrl(servers, "/api/apps/config/set", query.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("config", config)
+
+	_, failed := collectResults[domain.TechnetiumResponse](r.postTechnetiumRequests(ctx, servers, urls, "application/x-www-form-urlencoded", []byte(form.Encode())), len(urls))
+	return failed, nil
+}
+
+// Parts of the server included in backups and restored from them. Logs are
+// only included when asked for as they can be large.
+var backupParts = []string{"blockLists", "scopes", "apps", "stats", "zones", "allowedZones", "blockedZones", "dnsSettings", "logSettings", "authConfig"}
+
+// Get a zip archive of the configuration of server. The archive is
+// streamed from the server and must be closed once it has been read.
+func (r *repository) BackupSettings(ctx context.Context, server string, logs bool) (io.ReadCloser, []domain.PerServerFail, error) {
+	query := url.Values{}
+	for _, part := range backupParts {
+		query.Set(part, "true")
+	}
+	query.Set("logs", strconv.FormatBool(logs))
+
+	urls, err := r.formatApiUrl([]string{server}, "/api/settings/backup", query.Encode())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	response, err := r.streamTechnetiumRequest(ctx, server, urls[0], "", nil)
+	if err != nil {
+		return nil, []domain.PerServerFail{{Id: server, Err: err}}, nil
+	}
+
+	if strings.HasPrefix(response.Header.Get("Content-Type"), "application/json") || response.StatusCode != http.StatusOK {
+		var status domain.TechnetiumResponse
+		if err := processResponse(response, &status); err != nil {
+			return nil, []domain.PerServerFail{{Id: server, Err: err}}, nil
 		}
+		return nil, []domain.PerServerFail{{Id: server, Err: errors.New("server did not return a backup")}}, nil
+	}
+
+	return response.Body, nil, nil
+}
+
+// Restore server from a backup archive, streaming it to the server as it
+// is read. Existing files that aren't in the backup are deleted if
+// deleteExisting is set. An error reading the archive is returned as an
+// error rather than as a failure of the server.
+func (r *repository) RestoreSettings(ctx context.Context, server string, archive io.Reader, deleteExisting bool) ([]domain.PerServerFail, error) {
+	query := url.Values{}
+	for _, part := range backupParts {
+		query.Set(part, "true")
+	}
+	query.Set("logs", "true")
+	query.Set("deleteExistingFiles", strconv.FormatBool(deleteExisting))
+
+	urls, err := r.formatApiUrl([]string{server}, "/api/settings/restore", query.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	body, contentType, done := multipartStream("fileBackupZip", "backup.zip", archive)
+	response, err := r.streamTechnetiumRequest(ctx, server, urls[0], contentType, body)
 
-		if response.Status != "ok" {
-			slog.Error(
-				"Got an error from Technetium DNS",
-				"error", response.ErrorMessage,
-				"trace", response.StackTrace,
-				"innerMessage", response.InnerErrorMessage,
-			)
-
-			errs = append(errs, domain.PerServerFail{
-				Id:  server,
-				Err: errors.New(response.ErrorMessage),
-			})
+	// The archive may be the body of a request to this API, so it must no
+	// longer be in use once this returns
+	body.Close()
+	if readErr := <-done; readErr != nil && !errors.Is(readErr, io.ErrClosedPipe) {
+		if response != nil {
+			response.Body.Close()
 		}
+		return nil, readErr
 	}
 
-	return errs, nil
+	if err != nil {
+		return []domain.PerServerFail{{Id: server, Err: err}}, nil
+	}
+	if err := processResponse(response, &domain.TechnetiumResponse{}); err != nil {
+		return []domain.PerServerFail{{Id: server, Err: err}}, nil
+	}
+	return nil, nil
+}
+
+// Return the current upstream concurrency limits and queueing counters
+func (r *repository) GetUpstreamStats() domain.UpstreamStats {
+	return r.limiter.stats()
 }
 
-func NewRepository(servers []config.Server) Repository {
+func NewRepository(servers []config.Server, concurrency config.Concurrency) Repository {
 	repository := &repository{
 		servers:   servers,
 		serverMap: make(map[string]config.Server),
+		limiter:   newLimiter(concurrency.Global, concurrency.PerRequest),
 	}
 
 	for i := range repository.servers {
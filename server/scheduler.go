@@ -0,0 +1,359 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/SidingsMedia/unified-control-rdns/config"
+	"github.com/SidingsMedia/unified-control-rdns/server/cron"
+	"github.com/SidingsMedia/unified-control-rdns/server/model"
+)
+
+// Runs kept in the history of each schedule
+const maxScheduleRuns = 50
+
+type scheduled struct {
+	config     config.Schedule
+	expression *cron.Expression
+
+	// Holds a value for the whole of a run so that runs never overlap
+	running chan struct{}
+
+	mu   sync.Mutex
+	next time.Time
+	// Newest first
+	runs []model.ScheduleRun
+}
+
+// Part of an operation that is sent to every server at once
+type scheduleStep struct {
+	// What the step acts on, such as the domain being deleted
+	target string
+	run    func(ctx context.Context, servers []string) (*model.PerServerFail, error)
+}
+
+// Runs operations on the servers on cron schedules
+type Scheduler struct {
+	// Service the operations are run through so that they are published
+	// like any other change. Set by NewService.
+	service   *service
+	schedules []*scheduled
+}
+
+// Break the operation of a schedule into the steps that make it up
+func (s *Scheduler) steps(schedule config.Schedule) []scheduleStep {
+	steps := []scheduleStep{}
+	switch schedule.Operation {
+	case model.ScheduleCacheDelete:
+		for _, name := range schedule.Domains {
+			name := name
+			steps = append(steps, scheduleStep{target: name, run: func(ctx context.Context, servers []string) (*model.PerServerFail, error) {
+				return s.service.DeleteCacheEntry(ctx, name, servers)
+			}})
+		}
+	case model.ScheduleCacheFlush:
+		steps = append(steps, scheduleStep{run: s.service.FlushCache})
+	case model.ScheduleBlockListRefresh:
+		steps = append(steps, scheduleStep{run: s.service.updateBlockLists})
+	case model.ScheduleZoneSync:
+		for _, zone := range schedule.Zones {
+			zone := zone
+			steps = append(steps, scheduleStep{target: zone, run: func(ctx context.Context, servers []string) (*model.PerServerFail, error) {
+				return s.service.resyncZone(ctx, zone, servers)
+			}})
+		}
+	case model.ScheduleBackup:
+		steps = append(steps, scheduleStep{run: s.service.storeBackups})
+	}
+	return steps
+}
+
+// Run the operation of a schedule once on each of its servers
+func (s *Scheduler) perform(ctx context.Context, schedule config.Schedule) model.ScheduleRun {
+	servers := schedule.Servers
+	if len(servers) == 0 {
+		for _, server := range s.service.repository.GetServers() {
+			servers = append(servers, server.Id)
+		}
+	}
+
+	return runSteps(ctx, servers, s.steps(schedule))
+}
+
+// Run each of the steps of an operation on the servers. A step that
+// returns an error is recorded as failing on every server and the steps
+// after it are still run.
+func runSteps(ctx context.Context, servers []string, steps []scheduleStep) model.ScheduleRun {
+	run := model.ScheduleRun{StartedAt: time.Now().UTC(), Status: model.RunSucceeded}
+
+	failed := []model.AffectedServer{}
+	for _, step := range steps {
+		stepFailed, err := step.run(ctx, servers)
+		if err != nil {
+			stepFailed = &model.PerServerFail{
+				GeneralError: model.GeneralError{
+					Code:    http.StatusInternalServerError,
+					Message: err.Error(),
+				},
+				AffectedServers: make([]model.AffectedServer, len(servers)),
+			}
+			for i, server := range servers {
+				stepFailed.AffectedServers[i] = model.AffectedServer{Id: server, Message: err.Error()}
+			}
+		}
+
+		if stepFailed == nil {
+			continue
+		}
+
+		// Say which part of the operation failed if there are several
+		for _, fail := range stepFailed.AffectedServers {
+			if step.target != "" && len(steps) > 1 {
+				fail.Message = step.target + ": " + fail.Message
+			}
+			failed = append(failed, fail)
+		}
+		run.Failure = stepFailed
+	}
+
+	switch {
+	case len(failed) == 0:
+	case len(failed) == len(steps)*len(servers):
+		run.Status = model.RunFailed
+	default:
+		run.Status = model.RunPartial
+	}
+	if run.Failure != nil {
+		run.Failure.AffectedServers = failed
+	}
+	run.FinishedAt = time.Now().UTC()
+	return run
+}
+
+// Run a schedule and record the outcome. Runs started by the schedule are
+// skipped if the previous run hasn't finished, while manual runs wait for
+// it until ctx is done. False is returned if the schedule wasn't run.
+func (s *Scheduler) execute(ctx context.Context, schedule *scheduled, manual bool) (model.ScheduleRun, bool) {
+	select {
+	case schedule.running <- struct{}{}:
+	default:
+		if !manual {
+			slog.Warn("Skipped scheduled operation as the previous run hasn't finished", "id", schedule.config.Id)
+			return model.ScheduleRun{}, false
+		}
+
+		select {
+		case schedule.running <- struct{}{}:
+		case <-ctx.Done():
+			return model.ScheduleRun{}, false
+		}
+	}
+	defer func() { <-schedule.running }()
+
+	runCtx, cancel := context.WithTimeout(WithRequestSlots(ctx), schedule.config.Timeout)
+	defer cancel()
+
+	slog.Info("Running scheduled operation", "id", schedule.config.Id, "operation", schedule.config.Operation)
+	run := s.perform(runCtx, schedule.config)
+	run.Manual = manual
+
+	if run.Failure != nil {
+		slog.Error("Scheduled operation failed", "id", schedule.config.Id, "status", run.Status, "error", run.Failure.Message, "servers", run.Failure.AffectedServers)
+	} else {
+		slog.Info("Scheduled operation finished", "id", schedule.config.Id)
+	}
+
+	schedule.mu.Lock()
+	schedule.runs = slices.Insert(schedule.runs, 0, run)
+	if len(schedule.runs) > maxScheduleRuns {
+		schedule.runs = schedule.runs[:maxScheduleRuns]
+	}
+	schedule.mu.Unlock()
+
+	return run, true
+}
+
+func (s *Scheduler) find(id string) (*scheduled, error) {
+	for _, schedule := range s.schedules {
+		if schedule.config.Id == id {
+			return schedule, nil
+		}
+	}
+	return nil, ErrScheduleNotFound
+}
+
+// Every schedule along with when it next runs and how it last went
+func (s *Scheduler) Schedules() []model.Schedule {
+	schedules := []model.Schedule{}
+	for _, schedule := range s.schedules {
+		schedule.mu.Lock()
+		described := model.Schedule{
+			Id:        schedule.config.Id,
+			Cron:      schedule.config.Cron,
+			Operation: schedule.config.Operation,
+			Servers:   slices.Clone(schedule.config.Servers),
+			Domains:   schedule.config.Domains,
+			Zones:     schedule.config.Zones,
+		}
+		if described.Servers == nil {
+			described.Servers = []string{}
+		}
+		if !schedule.next.IsZero() {
+			next := schedule.next.UTC()
+			described.NextRun = &next
+		}
+		if len(schedule.runs) > 0 {
+			last := schedule.runs[0]
+			described.LastRun = &last
+		}
+		schedule.mu.Unlock()
+
+		schedules = append(schedules, described)
+	}
+	return schedules
+}
+
+// Recent runs of a schedule, newest first
+func (s *Scheduler) Runs(id string) ([]model.ScheduleRun, error) {
+	schedule, err := s.find(id)
+	if err != nil {
+		return nil, err
+	}
+
+	schedule.mu.Lock()
+	defer schedule.mu.Unlock()
+	return slices.Clone(schedule.runs), nil
+}
+
+// Run a schedule straight away, waiting for any run already in progress
+// to finish first. The error from ctx is returned if it's done before then.
+func (s *Scheduler) RunNow(ctx context.Context, id string) (model.ScheduleRun, error) {
+	schedule, err := s.find(id)
+	if err != nil {
+		return model.ScheduleRun{}, err
+	}
+
+	run, ran := s.execute(ctx, schedule, true)
+	if !ran {
+		return model.ScheduleRun{}, ctx.Err()
+	}
+	return run, nil
+}
+
+// Run each schedule whenever its expression fires until ctx is cancelled
+func (s *Scheduler) Run(ctx context.Context) {
+	for {
+		now := time.Now()
+		var wake time.Time
+		for _, schedule := range s.schedules {
+			schedule.mu.Lock()
+			if !schedule.next.IsZero() && !schedule.next.After(now) {
+				schedule.next = schedule.expression.Next(now)
+				go s.execute(ctx, schedule, false)
+			}
+			next := schedule.next
+			schedule.mu.Unlock()
+
+			if !next.IsZero() && (wake.IsZero() || next.Before(wake)) {
+				wake = next
+			}
+		}
+
+		if wake.IsZero() {
+			<-ctx.Done()
+			return
+		}
+
+		timer := time.NewTimer(time.Until(wake))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// Check a schedule from the configuration file. backups says whether a
+// backup directory is configured.
+func checkSchedule(schedule config.Schedule, ids []string, backups bool) error {
+	if schedule.Id == "" {
+		return fmt.Errorf("id is required")
+	}
+
+	if _, err := cron.Parse(schedule.Cron); err != nil {
+		return fmt.Errorf("cron: %w", err)
+	}
+
+	for _, server := range schedule.Servers {
+		if !slices.Contains(ids, server) {
+			return fmt.Errorf("servers: %s is not a configured server", server)
+		}
+	}
+
+	switch schedule.Operation {
+	case model.ScheduleCacheDelete:
+		if len(schedule.Domains) == 0 {
+			return fmt.Errorf("domains are required for %s", schedule.Operation)
+		}
+	case model.ScheduleZoneSync:
+		if len(schedule.Zones) == 0 {
+			return fmt.Errorf("zones are required for %s", schedule.Operation)
+		}
+	case model.ScheduleBackup:
+		if !backups {
+			return fmt.Errorf("backups.directory is required for %s", schedule.Operation)
+		}
+	case model.ScheduleCacheFlush, model.ScheduleBlockListRefresh:
+	default:
+		return fmt.Errorf("operation: unknown operation %q", schedule.Operation)
+	}
+
+	return nil
+}
+
+// Create a scheduler for the schedules in the configuration file, checking
+// that each is valid. Backups are kept in store, which may be nil if no
+// schedule takes backups. Nil is returned if there are no schedules. The
+// scheduler must be passed to NewService with WithScheduler before it's
+// run.
+func NewScheduler(repository Repository, schedules []config.Schedule, store *BackupStore) (*Scheduler, error) {
+	if len(schedules) == 0 {
+		return nil, nil
+	}
+
+	ids := []string{}
+	for _, server := range repository.GetServers() {
+		ids = append(ids, server.Id)
+	}
+
+	scheduler := &Scheduler{}
+	now := time.Now()
+	for i, schedule := range schedules {
+		if err := checkSchedule(schedule, ids, store != nil); err != nil {
+			return nil, fmt.Errorf("schedules[%d]: %w", i, err)
+		}
+		if _, err := scheduler.find(schedule.Id); err == nil {
+			return nil, fmt.Errorf("schedules[%d]: id %s is used more than once", i, schedule.Id)
+		}
+
+		expression, _ := cron.Parse(schedule.Cron)
+		scheduler.schedules = append(scheduler.schedules, &scheduled{
+			config:     schedule,
+			expression: expression,
+			running:    make(chan struct{}, 1),
+			next:       expression.Next(now),
+			runs:       []model.ScheduleRun{},
+		})
+	}
+
+	return scheduler, nil
+}
@@ -0,0 +1,54 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/SidingsMedia/unified-control-rdns/server/model"
+)
+
+func TestRunStepsAfterError(t *testing.T) {
+	ran := false
+	steps := []scheduleStep{
+		{target: "a.test", run: func(ctx context.Context, servers []string) (*model.PerServerFail, error) {
+			return &model.PerServerFail{
+				GeneralError:    model.GeneralError{Code: http.StatusInternalServerError, Message: "failed"},
+				AffectedServers: []model.AffectedServer{{Id: "b", Message: "refused"}},
+			}, nil
+		}},
+		{target: "b.test", run: func(ctx context.Context, servers []string) (*model.PerServerFail, error) {
+			return nil, errors.New("zone is missing")
+		}},
+		{target: "c.test", run: func(ctx context.Context, servers []string) (*model.PerServerFail, error) {
+			ran = true
+			return nil, nil
+		}},
+	}
+
+	run := runSteps(context.Background(), []string{"a", "b"}, steps)
+	if !ran {
+		t.Errorf("expected the steps after the error to run")
+	}
+	if run.Status != model.RunPartial || run.Failure == nil {
+		t.Fatalf("expected the run to partially succeed, got %+v", run)
+	}
+
+	expected := []model.AffectedServer{
+		{Id: "b", Message: "a.test: refused"},
+		{Id: "a", Message: "b.test: zone is missing"},
+		{Id: "b", Message: "b.test: zone is missing"},
+	}
+	if len(run.Failure.AffectedServers) != len(expected) {
+		t.Fatalf("expected the failures of both steps, got %+v", run.Failure.AffectedServers)
+	}
+	for i, fail := range run.Failure.AffectedServers {
+		if fail != expected[i] {
+			t.Errorf("expected failure %d to be %+v, got %+v", i, expected[i], fail)
+		}
+	}
+}
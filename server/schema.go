@@ -3,7 +3,190 @@
 
 package server
 
+import "time"
+
+// Largest desired state accepted by apply
+const maxDesiredStateSize = 10 << 20
+
+// Events kept for each event stream before it is treated as too slow and
+// starts missing them
+const eventStreamBuffer = 100
+
+// Gap between comments sent to keep an idle event stream open
+const eventStreamKeepAlive = 15 * time.Second
+
+// Gap between snapshots of the upstream statistics on an event stream, unless
+// the client asks for another
+const defaultStatsInterval = 30 * time.Second
+
+// Deepest level of subdomains that can be walked when listing or purging
+// the cache
+const maxCacheDepth = 10
+
+// Largest app archive accepted by install
+const maxAppArchiveSize = 64 << 20
+
+// Largest app config accepted
+const maxAppConfigSize = 1 << 20
+
+// Largest backup accepted by restore
+const maxBackupSize = 512 << 20
+
 type GetCacheRequest struct {
 	Domain  string   `form:"domain"`
 	Servers []string `form:"server" binding:"required"`
+	Fresh   bool     `form:"fresh"`
+	Type    string   `form:"type"`
+	Depth   int      `form:"depth" binding:"min=0,max=10"`
+	Match   string   `form:"match"`
+}
+
+// Most domains that can be deleted from the cache in one bulk delete
+const maxBulkDeleteDomains = 1000
+
+type DeleteCacheRequest struct {
+	Domain  string   `form:"domain"`
+	Servers []string `form:"server" binding:"required"`
+	Async   bool     `form:"async"`
+}
+
+type BulkDeleteCacheRequest struct {
+	Async bool `form:"async"`
+}
+
+type PurgeCacheRequest struct {
+	Domain  string   `form:"domain"`
+	Servers []string `form:"server" binding:"required"`
+	Match   string   `form:"match"`
+	Depth   *int     `form:"depth" binding:"omitempty,min=0,max=10"`
+	DryRun  bool     `form:"dryRun"`
+	Async   bool     `form:"async"`
+}
+
+type ResolveRequest struct {
+	Name    string   `form:"name" binding:"required"`
+	Type    string   `form:"type"`
+	Servers []string `form:"server" binding:"required"`
+}
+
+type FlushCacheRequest struct {
+	Servers []string `form:"server" binding:"required"`
+	Async   bool     `form:"async"`
+}
+
+type DnssecStatusRequest struct {
+	Servers []string `form:"server" binding:"required"`
+}
+
+type DsRecordsRequest struct {
+	Servers []string `form:"server" binding:"required"`
+}
+
+type SignZoneRequest struct {
+	Servers         []string `form:"server" binding:"required"`
+	Algorithm       string   `form:"algorithm" binding:"required,oneof=RSA ECDSA EDDSA"`
+	HashAlgorithm   string   `form:"hashAlgorithm" binding:"omitempty,oneof=MD5 SHA1 SHA256 SHA512"`
+	KskKeySize      int      `form:"kskKeySize" binding:"omitempty,min=1024,max=4096"`
+	ZskKeySize      int      `form:"zskKeySize" binding:"omitempty,min=1024,max=4096"`
+	Curve           string   `form:"curve" binding:"omitempty,oneof=P256 P384 ED25519 ED448"`
+	DnsKeyTtl       int      `form:"dnsKeyTtl" binding:"omitempty,min=1,max=604800"`
+	ZskRolloverDays int      `form:"zskRolloverDays" binding:"omitempty,min=0,max=365"`
+	NxProof         string   `form:"nxProof" binding:"omitempty,oneof=NSEC NSEC3"`
+	Iterations      int      `form:"iterations" binding:"omitempty,min=0,max=50"`
+	SaltLength      int      `form:"saltLength" binding:"omitempty,min=0,max=32"`
+	Async           bool     `form:"async"`
+}
+
+type UnsignZoneRequest struct {
+	Servers []string `form:"server" binding:"required"`
+	Async   bool     `form:"async"`
+}
+
+type RolloverDnsKeyRequest struct {
+	Servers []string `form:"server" binding:"required"`
+	KeyTag  *int     `form:"keyTag" binding:"required,min=0,max=65535"`
+	Async   bool     `form:"async"`
+}
+
+type ExportZoneRequest struct {
+	Server string `form:"server" binding:"required"`
+}
+
+type ImportZoneRequest struct {
+	Servers   []string `form:"server" binding:"required"`
+	Overwrite bool     `form:"overwrite"`
+	Async     bool     `form:"async"`
+}
+
+type ApplyRequest struct {
+	DryRun bool `form:"dryRun"`
+	Async  bool `form:"async"`
+}
+
+type EventsRequest struct {
+	Servers       []string `form:"server"`
+	Types         []string `form:"type" binding:"dive,oneof=cache.deleted cache.purged cache.flushed server.down server.up zone.imported dnssec.signed dnssec.unsigned dnssec.rolledover state.applied dhcp.scope.updated dhcp.scope.enabled dhcp.scope.disabled dhcp.lease.removed dhcp.lease.reserved settings.changed forwarders.changed forwarders.zone.updated forwarders.zone.deleted app.installed app.uninstalled app.config.changed server.restored backup.created stats"`
+	StatsInterval int      `form:"statsInterval" binding:"omitempty,min=1,max=3600"`
+}
+
+type DhcpScopesRequest struct {
+	Servers []string `form:"server" binding:"required"`
+}
+
+type DhcpLeasesRequest struct {
+	Servers []string `form:"server" binding:"required"`
+	Scope   string   `form:"scope"`
+}
+
+// Changes to DHCP scopes and leases
+type DhcpChangeRequest struct {
+	Servers []string `form:"server" binding:"required"`
+	Async   bool     `form:"async"`
+}
+
+type SettingsDiffRequest struct {
+	Servers []string `form:"server" binding:"required"`
+	Keys    []string `form:"key"`
+}
+
+type SetSettingsRequest struct {
+	Servers []string `form:"server" binding:"required"`
+	Async   bool     `form:"async"`
+}
+
+type ForwardersRequest struct {
+	Servers []string `form:"server" binding:"required"`
+}
+
+// Changes to the global forwarders and conditional forwarder zones
+type ForwarderChangeRequest struct {
+	Servers []string `form:"server" binding:"required"`
+	Async   bool     `form:"async"`
+}
+
+type AppsRequest struct {
+	Servers []string `form:"server" binding:"required"`
+}
+
+// Changes to the DNS apps installed on the servers and their config
+type AppChangeRequest struct {
+	Servers []string `form:"server" binding:"required"`
+	Async   bool     `form:"async"`
+}
+
+type BackupRequest struct {
+	// Keep the backup in the backup store rather than sending it back
+	Store bool `form:"store"`
+	// Include the query logs of the server
+	Logs bool `form:"logs"`
+}
+
+type RestoreRequest struct {
+	// Delete existing files, such as zones, that aren't in the backup
+	DeleteExisting bool `form:"deleteExisting"`
+	Async          bool `form:"async"`
+}
+
+type ListBackupsRequest struct {
+	Server string `form:"server"`
 }
@@ -4,22 +4,220 @@
 package server
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
 	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/SidingsMedia/unified-control-rdns/config"
+	"github.com/SidingsMedia/unified-control-rdns/server/desired"
+	"github.com/SidingsMedia/unified-control-rdns/server/domain"
+	"github.com/SidingsMedia/unified-control-rdns/server/events"
+	"github.com/SidingsMedia/unified-control-rdns/server/jobs"
 	"github.com/SidingsMedia/unified-control-rdns/server/model"
+	"github.com/SidingsMedia/unified-control-rdns/server/probe"
 	mapset "github.com/deckarep/golang-set/v2"
 	"github.com/jinzhu/copier"
 )
 
 type Service interface {
 	ListServers() model.List[model.Server]
-	GetCache(domain string, servers []string) (*model.CacheResponse, error)
-	DeleteCacheEntry(zone string, servers []string) (*model.PerServerFail, error)
+	GetCache(ctx context.Context, domain string, servers []string, filter CacheFilter) (*model.CacheResponse, error)
+	DeleteCacheEntry(ctx context.Context, zone string, servers []string) (*model.PerServerFail, error)
+	DeleteCacheEntries(ctx context.Context, request model.CacheDeleteRequest) (*model.CacheDeleteResponse, error)
+	FlushCache(ctx context.Context, servers []string) (*model.PerServerFail, error)
+	Resolve(ctx context.Context, name string, typ string, servers []string) (*model.ResolveResponse, error)
+	PurgeCache(ctx context.Context, domain string, servers []string, filter CacheFilter, dryRun bool) (*model.CachePurgeResponse, error)
+	GetUpstreamStats() model.UpstreamStats
+	GetProbes(id string) (*model.ProbeResponse, error)
+	RunProbes(ctx context.Context, id string) (*model.ProbeResponse, error)
+	GetDnssecStatus(ctx context.Context, zone string, servers []string) (*model.DnssecStatusResponse, error)
+	GetDsRecords(ctx context.Context, zone string, servers []string) (*model.DsResponse, error)
+	SignZone(ctx context.Context, zone string, servers []string, options DnssecSignOptions) (*model.PerServerFail, error)
+	UnsignZone(ctx context.Context, zone string, servers []string) (*model.PerServerFail, error)
+	RolloverDnsKey(ctx context.Context, zone string, keyTag int, servers []string) (*model.PerServerFail, error)
+	ExportZone(ctx context.Context, zone string, server string) (string, *model.PerServerFail, error)
+	ImportZone(ctx context.Context, zone string, zoneFile string, overwrite bool, servers []string) (*model.PerServerFail, error)
+	Apply(ctx context.Context, state *desired.State, dryRun bool) (*model.ApplyResponse, error)
+	GetDrift() (*model.DriftResponse, error)
+	CheckDrift(ctx context.Context) (*model.DriftResponse, error)
+	SubscribeEvents(buffer int) (<-chan model.Event, func())
+	StatsEvent() model.Event
+	StartJob(operation string, servers []string, run jobs.Func) model.Job
+	GetJob(id string) (*model.Job, error)
+	CancelJob(ctx context.Context, id string) (*model.Job, error)
+	ListDhcpScopes(ctx context.Context, servers []string) (*model.DhcpScopesResponse, error)
+	SetDhcpScope(ctx context.Context, name string, settings model.DhcpScopeSettings, servers []string) (*model.PerServerFail, error)
+	SetDhcpScopeEnabled(ctx context.Context, name string, enabled bool, servers []string) (*model.PerServerFail, error)
+	ListDhcpLeases(ctx context.Context, scope string, servers []string) (*model.DhcpLeasesResponse, error)
+	RemoveDhcpLease(ctx context.Context, scope string, hardwareAddress string, servers []string) (*model.PerServerFail, error)
+	ReserveDhcpLease(ctx context.Context, scope string, hardwareAddress string, servers []string) (*model.PerServerFail, error)
+	ListSchedules() model.List[model.Schedule]
+	GetScheduleRuns(id string) (*model.List[model.ScheduleRun], error)
+	RunSchedule(ctx context.Context, id string) (*model.ScheduleRun, error)
+	GetServerSettings(ctx context.Context, id string) (*model.ServerSettings, *model.PerServerFail, error)
+	DiffSettings(ctx context.Context, keys []string, servers []string) (*model.SettingsDiffResponse, error)
+	SetSettings(ctx context.Context, settings map[string]any, servers []string) (*model.PerServerFail, error)
+	GetForwarders(ctx context.Context, servers []string) (*model.ForwardersResponse, error)
+	SetForwarders(ctx context.Context, settings model.ForwarderSettings, servers []string) (*model.PerServerFail, error)
+	SetForwarderZone(ctx context.Context, zone string, forwarders []model.Forwarder, servers []string) (*model.PerServerFail, error)
+	DeleteForwarderZone(ctx context.Context, zone string, servers []string) (*model.PerServerFail, error)
+	ListApps(ctx context.Context, servers []string) (*model.AppsResponse, error)
+	InstallApp(ctx context.Context, name string, archive []byte, servers []string) (*model.PerServerFail, error)
+	UninstallApp(ctx context.Context, name string, servers []string) (*model.PerServerFail, error)
+	GetAppConfig(ctx context.Context, name string, servers []string) (*model.AppConfigResponse, error)
+	SetAppConfig(ctx context.Context, name string, config json.RawMessage, servers []string) (*model.PerServerFail, error)
+	BackupServer(ctx context.Context, id string, logs bool) (io.ReadCloser, *model.PerServerFail, error)
+	StoreBackup(ctx context.Context, id string, logs bool) (*model.Backup, *model.PerServerFail, error)
+	RestoreServer(ctx context.Context, id string, archive io.Reader, deleteExisting bool) (*model.PerServerFail, error)
+	ListBackups(server string) (*model.List[model.Backup], error)
+	GetBackup(server string, name string) (io.ReadCloser, int64, error)
+}
+
+// Narrows down the records returned from the cache
+type CacheFilter struct {
+	// Only include records of this type. All types are included if empty.
+	Type string
+	// Number of levels of subdomains to walk down from the domain
+	Depth int
+	// Only include records with names matching this glob pattern
+	Match string
+}
+
+// Check if a record should be included in the response
+func (f CacheFilter) includes(name string, typ string) bool {
+	if f.Type != "" && !strings.EqualFold(f.Type, typ) {
+		return false
+	}
+
+	if f.Match != "" {
+		matched, _ := path.Match(strings.ToLower(f.Match), strings.ToLower(strings.TrimSuffix(name, ".")))
+		return matched
+	}
+
+	return true
+}
+
+// How a zone should be signed. Zero values are replaced with the defaults
+// used by the Technetium web console.
+type DnssecSignOptions struct {
+	// One of RSA, ECDSA or EDDSA
+	Algorithm string
+	// Hash and key sizes used by RSA keys
+	HashAlgorithm string
+	KskKeySize    int
+	ZskKeySize    int
+	// Curve used by ECDSA and EDDSA keys
+	Curve           string
+	DnsKeyTtl       int
+	ZskRolloverDays int
+	// NSEC or NSEC3
+	NxProof    string
+	Iterations int
+	SaltLength int
+}
+
+// Fill in any options that weren't given
+func (o DnssecSignOptions) withDefaults() DnssecSignOptions {
+	switch o.Algorithm {
+	case "RSA":
+		if o.HashAlgorithm == "" {
+			o.HashAlgorithm = "SHA256"
+		}
+		if o.KskKeySize == 0 {
+			o.KskKeySize = 2048
+		}
+		if o.ZskKeySize == 0 {
+			o.ZskKeySize = 1024
+		}
+	case "ECDSA":
+		if o.Curve == "" {
+			o.Curve = "P256"
+		}
+	case "EDDSA":
+		if o.Curve == "" {
+			o.Curve = "ED25519"
+		}
+	}
+
+	if o.DnsKeyTtl == 0 {
+		o.DnsKeyTtl = 86400
+	}
+	if o.ZskRolloverDays == 0 {
+		o.ZskRolloverDays = 30
+	}
+	if o.NxProof == "" {
+		o.NxProof = "NSEC"
+	}
+
+	return o
 }
 
 type service struct {
 	repository Repository
+	prober     *probe.Prober
+	drift      *DriftReconciler
+	events     *events.Bus
+	jobs       *jobs.Manager
+	scheduler  *Scheduler
+	backups    *BackupStore
+}
+
+// Optional subsystem made available to the service
+type ServiceOption func(s *service)
+
+// Enable the probe endpoints using results from prober
+func WithProber(prober *probe.Prober) ServiceOption {
+	return func(s *service) {
+		s.prober = prober
+	}
+}
+
+// Enable the drift endpoints using reports from reconciler. Does nothing if
+// reconciler is nil.
+func WithDriftReconciler(reconciler *DriftReconciler) ServiceOption {
+	return func(s *service) {
+		s.drift = reconciler
+	}
+}
+
+// Publish events about operations on the servers to bus
+func WithEvents(bus *events.Bus) ServiceOption {
+	return func(s *service) {
+		s.events = bus
+	}
+}
+
+// Run jobs with manager rather than with the default settings
+func WithJobs(manager *jobs.Manager) ServiceOption {
+	return func(s *service) {
+		s.jobs = manager
+	}
+}
+
+// Enable the schedule endpoints using scheduler. Does nothing if scheduler
+// is nil.
+func WithScheduler(scheduler *Scheduler) ServiceOption {
+	return func(s *service) {
+		s.scheduler = scheduler
+	}
+}
+
+// Enable storing backups in store. Does nothing if store is nil.
+func WithBackups(store *BackupStore) ServiceOption {
+	return func(s *service) {
+		s.backups = store
+	}
 }
 
 // func (service *Service) <Handler>(<model> *model.<Model>) error {
@@ -27,6 +225,79 @@ type service struct {
 // 	return nil
 // }
 
+// Convert the per server failures reported by the repository into the
+// form returned to clients.
+func toAffectedServers(failed []domain.PerServerFail) []model.AffectedServer {
+	affected := make([]model.AffectedServer, len(failed))
+	for i, fail := range failed {
+		affected[i] = model.AffectedServer{Id: fail.Id, Message: fail.Err.Error()}
+	}
+	return affected
+}
+
+// Build the response for an operation performed on several servers. Nil
+// is returned if none of the servers failed.
+func toPerServerFail(failed []domain.PerServerFail) *model.PerServerFail {
+	if len(failed) == 0 {
+		return nil
+	}
+
+	return &model.PerServerFail{
+		GeneralError: model.GeneralError{
+			Code:    http.StatusInternalServerError,
+			Message: "Operation partially succeeded. Some errors occurred",
+		},
+		AffectedServers: toAffectedServers(failed),
+	}
+}
+
+// Identify servers in an event by both their id and name
+func toEventServers(servers []domain.Server, ids []string) []model.EventServer {
+	eventServers := make([]model.EventServer, len(ids))
+	for i, id := range ids {
+		eventServers[i] = model.EventServer{Id: id}
+		for _, server := range servers {
+			if server.Id == id {
+				eventServers[i].Name = server.Name
+			}
+		}
+	}
+	return eventServers
+}
+
+// Publish an event for an operation performed on several servers
+func (s service) publish(typ string, name string, servers []string, failed []domain.PerServerFail) {
+	s.publishEvent(model.Event{Type: typ, Domain: name}, servers, failed)
+}
+
+// Publish an event for an operation on something other than a domain
+func (s service) publishTarget(typ string, target string, servers []string, failed []domain.PerServerFail) {
+	s.publishEvent(model.Event{Type: typ, Target: target}, servers, failed)
+}
+
+func (s service) publishEvent(event model.Event, servers []string, failed []domain.PerServerFail) {
+	if s.events == nil {
+		return
+	}
+
+	event.Servers = toEventServers(s.repository.GetServers(), servers)
+	event.Failure = toPerServerFail(failed)
+	s.events.Publish(event)
+}
+
+// Receive every event published from now on, see [events.Bus.Subscribe]
+func (s service) SubscribeEvents(buffer int) (<-chan model.Event, func()) {
+	return s.events.Subscribe(buffer)
+}
+
+// Snapshot of the upstream request statistics to send as an event
+func (s service) StatsEvent() model.Event {
+	stats := s.GetUpstreamStats()
+	event := model.Event{Type: model.EventStats, Servers: []model.EventServer{}, Stats: &stats}
+	events.Stamp(&event)
+	return event
+}
+
 func (s service) ListServers() model.List[model.Server] {
 	servers := s.repository.GetServers()
 
@@ -36,8 +307,141 @@ func (s service) ListServers() model.List[model.Server] {
 	return model.List[model.Server]{Results: responseServers}
 }
 
-func (s service) GetCache(domain string, servers []string) (*model.CacheResponse, error) {
-	cache, err := s.repository.GetCache(domain, servers)
+// Call work for each index below n, with no more calls running at once than
+// a single API request may have upstream requests in flight. The calls share
+// the request's slot pool, so running any more would only leave them
+// queueing.
+func (s service) forEach(n int, work func(i int)) {
+	slots := make(chan struct{}, max(s.repository.GetUpstreamStats().PerRequestLimit, 1))
+	var wg sync.WaitGroup
+
+	for i := 0; i < n; i++ {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			work(i)
+		}(i)
+	}
+
+	wg.Wait()
+}
+
+// Fetch the cache of the servers for searchDomain and then walk down the
+// zones each server reports to depth levels below it. The zones at each
+// level are fetched concurrently, with a request only made to the servers
+// that reported a zone. A server that fails for searchDomain is reported as
+// failed. One that fails for a zone below it is only missing that subtree,
+// which is reported as incomplete, and the rest of its results are kept.
+func (s service) walkCache(ctx context.Context, searchDomain string, servers []string, depth int) (map[string][]domain.CacheResult, []domain.PerServerFail, []model.CacheZoneError, error) {
+	cache, failed, err := s.repository.GetCache(ctx, searchDomain, servers)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	results := make(map[string][]domain.CacheResult)
+	incomplete := []model.CacheZoneError{}
+
+	type visit struct {
+		server string
+		zone   string
+	}
+	visited := mapset.NewSet[visit]()
+
+	// Zones to fetch at the next level and the servers to fetch them from
+	next := make(map[string][]string)
+	addLevel := func(server string, result domain.CacheResult) {
+		results[server] = append(results[server], result)
+		for _, zone := range result.Response.Zones {
+			if visited.Add(visit{server: server, zone: zone}) {
+				next[zone] = append(next[zone], server)
+			}
+		}
+	}
+
+	for _, server := range servers {
+		if result, ok := cache[server]; ok {
+			addLevel(server, result)
+		}
+	}
+
+	for level := 0; level < depth && len(next) > 0; level++ {
+		type zoneResult struct {
+			cache  map[string]domain.CacheResult
+			failed []domain.PerServerFail
+			err    error
+		}
+
+		zones := make([]string, 0, len(next))
+		for zone := range next {
+			zones = append(zones, zone)
+		}
+		slices.Sort(zones)
+
+		levelResults := make([]zoneResult, len(zones))
+		s.forEach(len(zones), func(i int) {
+			cache, failed, err := s.repository.GetCache(ctx, zones[i], next[zones[i]])
+			levelResults[i] = zoneResult{cache: cache, failed: failed, err: err}
+		})
+
+		levelServers := next
+		next = make(map[string][]string)
+		for i, result := range levelResults {
+			if result.err != nil {
+				return nil, nil, nil, result.err
+			}
+
+			for _, fail := range result.failed {
+				incomplete = append(incomplete, model.CacheZoneError{
+					Zone:    zones[i],
+					Id:      fail.Id,
+					Message: fail.Err.Error(),
+				})
+			}
+
+			for _, server := range levelServers[zones[i]] {
+				if zoneCache, ok := result.cache[server]; ok {
+					addLevel(server, zoneCache)
+				}
+			}
+		}
+	}
+
+	// Keep the order stable between requests
+	slices.SortFunc(failed, func(a, b domain.PerServerFail) int {
+		return slices.Index(servers, a.Id) - slices.Index(servers, b.Id)
+	})
+	slices.SortFunc(incomplete, func(a, b model.CacheZoneError) int {
+		if c := strings.Compare(a.Zone, b.Zone); c != 0 {
+			return c
+		}
+		return slices.Index(servers, a.Id) - slices.Index(servers, b.Id)
+	})
+
+	return results, failed, incomplete, nil
+}
+
+// Find the domain to start listing from for a glob pattern. This is the
+// part of the pattern after the last label containing a wildcard.
+func patternDomain(pattern string) string {
+	labels := strings.Split(strings.TrimSuffix(pattern, "."), ".")
+	for i := len(labels) - 1; i >= 0; i-- {
+		if strings.ContainsAny(labels[i], "*?[") {
+			return strings.Join(labels[i+1:], ".")
+		}
+	}
+	return strings.Join(labels, ".")
+}
+
+func (s service) GetCache(ctx context.Context, searchDomain string, servers []string, filter CacheFilter) (*model.CacheResponse, error) {
+	if searchDomain == "" && filter.Match != "" {
+		searchDomain = patternDomain(filter.Match)
+	}
+
+	cache, failed, incomplete, err := s.walkCache(ctx, searchDomain, servers, filter.Depth)
 	if err != nil {
 		return nil, err
 	}
@@ -51,11 +455,15 @@ func (s service) GetCache(domain string, servers []string) (*model.CacheResponse
 	zones := mapset.NewSet[string]()
 
 	for _, server := range servers {
-		zones.Append(cache[server].Response.Zones...)
+		for _, result := range cache[server] {
+			zones.Append(result.Response.Zones...)
+
+			for _, entry := range result.Response.Records {
+				key := cacheKey{name: entry.Name, typ: entry.Type}
+				if key.name == "" && key.typ == "" || !filter.includes(entry.Name, entry.Type) {
+					continue
+				}
 
-		for _, entry := range cache[server].Response.Records {
-			key := cacheKey{name: entry.Name, typ: entry.Type}
-			if !(key.name == "" && key.typ == "") {
 				if _, exists := combinedCache[key]; exists {
 					combinedCache[key].CachedResult = append(
 						combinedCache[key].CachedResult,
@@ -84,8 +492,10 @@ func (s service) GetCache(domain string, servers []string) (*model.CacheResponse
 	slices.Sort(zoneList)
 
 	response := model.CacheResponse{
-		Entries: make([]model.CacheEntry, len(combinedCache)),
-		Zones:   zoneList,
+		PartialFailure: model.PartialFailure{Errors: toAffectedServers(failed)},
+		Entries:        make([]model.CacheEntry, len(combinedCache)),
+		Zones:          zoneList,
+		Incomplete:     incomplete,
 	}
 
 	i := 0
@@ -94,35 +504,1868 @@ func (s service) GetCache(domain string, servers []string) (*model.CacheResponse
 		i++
 	}
 
+	// Keep the order stable between requests so that unchanged results
+	// produce the same ETag
+	slices.SortFunc(response.Entries, func(a, b model.CacheEntry) int {
+		if c := strings.Compare(a.Name, b.Name); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Type, b.Type)
+	})
+
 	return &response, nil
 }
 
-func (s service) DeleteCacheEntry(zone string, servers []string) (*model.PerServerFail, error) {
-	srvFail, err := s.repository.DeleteCacheEntry(zone, servers)
+func (s service) DeleteCacheEntry(ctx context.Context, zone string, servers []string) (*model.PerServerFail, error) {
+	srvFail, err := s.repository.DeleteCacheEntry(ctx, zone, servers)
 	if err != nil {
 		return nil, err
 	}
 
-	if len(srvFail) == 0 {
-		return nil, nil
+	s.publish(model.EventCacheDeleted, zone, servers, srvFail)
+	return toPerServerFail(srvFail), nil
+}
+
+// Servers in the order they were first given, without repeats
+func uniqueServers(servers []string) []string {
+	unique := []string{}
+	for _, server := range servers {
+		if !slices.Contains(unique, server) {
+			unique = append(unique, server)
+		}
 	}
+	return unique
+}
 
-	response := model.PerServerFail{
-		GeneralError: model.GeneralError{
-			Code:    http.StatusInternalServerError,
-			Message: "Operation partially succeeded. Some errors occurred",
-		},
-		AffectedServers: make([]model.AffectedServer, len(srvFail)),
+// Delete many domains from the cache, each from its own servers or from
+// the servers of the request. Every server is checked to exist before
+// anything is deleted. The domains share the request's upstream slots.
+func (s service) DeleteCacheEntries(ctx context.Context, request model.CacheDeleteRequest) (*model.CacheDeleteResponse, error) {
+	known := make(map[string]bool)
+	for _, server := range s.repository.GetServers() {
+		known[server.Id] = true
 	}
 
-	for i, fail := range srvFail {
-		response.AffectedServers[i] = model.AffectedServer{Id: fail.Id, Message: fail.Err.Error()}
+	requestServers := uniqueServers(request.Servers)
+	servers := make([][]string, len(request.Domains))
+	for i, entry := range request.Domains {
+		servers[i] = uniqueServers(entry.Servers)
+		if len(servers[i]) == 0 {
+			servers[i] = requestServers
+		}
+		for _, server := range servers[i] {
+			if !known[server] {
+				return nil, ErrServerNotFound
+			}
+		}
+	}
+
+	response := model.CacheDeleteResponse{Domains: make([]model.CacheDeletedDomain, len(request.Domains))}
+	errs := make([]error, len(request.Domains))
+
+	s.forEach(len(request.Domains), func(i int) {
+		name := request.Domains[i].Domain
+		failed, err := s.repository.DeleteCacheEntry(ctx, name, servers[i])
+		if err != nil {
+			errs[i] = err
+			return
+		}
+		s.publish(model.EventCacheDeleted, name, servers[i], failed)
+
+		deleted := model.CacheDeletedDomain{Domain: name, Servers: make([]model.CacheDeleteResult, len(servers[i]))}
+		for j, server := range servers[i] {
+			deleted.Servers[j] = model.CacheDeleteResult{Id: server, Deleted: true}
+			for _, fail := range failed {
+				if fail.Id == server {
+					deleted.Servers[j] = model.CacheDeleteResult{Id: server, Message: fail.Err.Error()}
+				}
+			}
+		}
+		response.Domains[i] = deleted
+	})
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Report each server that failed once, with the first domain it failed on
+	failures := make(map[string]bool)
+	failed := []domain.PerServerFail{}
+	for _, deleted := range response.Domains {
+		for _, result := range deleted.Servers {
+			if result.Deleted {
+				response.Deleted++
+				continue
+			}
+
+			response.Failed++
+			if !failures[result.Id] {
+				failures[result.Id] = true
+				failed = append(failed, domain.PerServerFail{
+					Id:  result.Id,
+					Err: fmt.Errorf("failed to delete %s: %s", deleted.Domain, result.Message),
+				})
+			}
+		}
 	}
+
+	response.Errors = toAffectedServers(failed)
 	return &response, nil
 }
 
-func NewService(repository Repository) Service {
-	return &service{
-		repository: repository,
+// Delete every cached name below domain, or matching the filter, from the
+// servers. The names to delete are found by walking the cache listing of
+// each server so that only the servers holding a name are asked to delete
+// it. The deletes share the request's upstream slots. Names that fail to
+// be deleted from a server are listed apart from those that were. If dryRun
+// is set, the names are returned without being deleted.
+func (s service) PurgeCache(ctx context.Context, searchDomain string, servers []string, filter CacheFilter, dryRun bool) (*model.CachePurgeResponse, error) {
+	if searchDomain == "" && filter.Match != "" {
+		searchDomain = patternDomain(filter.Match)
+	}
+
+	cache, failed, incomplete, err := s.walkCache(ctx, searchDomain, servers, filter.Depth)
+	if err != nil {
+		return nil, err
+	}
+
+	// Servers holding each name
+	holders := make(map[string][]string)
+	response := model.CachePurgeResponse{DryRun: dryRun, Servers: []model.PurgedServer{}, Incomplete: incomplete}
+	for _, server := range servers {
+		results, ok := cache[server]
+		if !ok {
+			continue
+		}
+
+		names := mapset.NewThreadUnsafeSet[string]()
+		for _, result := range results {
+			for _, record := range result.Response.Records {
+				if record.Name != "" && filter.includes(record.Name, "") {
+					names.Add(record.Name)
+				}
+			}
+		}
+
+		purged := model.PurgedServer{Id: server, Names: names.ToSlice()}
+		slices.Sort(purged.Names)
+		response.Servers = append(response.Servers, purged)
+
+		for _, name := range purged.Names {
+			holders[name] = append(holders[name], server)
+		}
+	}
+
+	if !dryRun {
+		names := make([]string, 0, len(holders))
+		for name := range holders {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+
+		type deleteResult struct {
+			failed []domain.PerServerFail
+			err    error
+		}
+
+		results := make([]deleteResult, len(names))
+		s.forEach(len(names), func(i int) {
+			failed, err := s.repository.DeleteCacheEntry(ctx, names[i], holders[names[i]])
+			results[i] = deleteResult{failed: failed, err: err}
+		})
+
+		// Names that failed to be deleted from each server
+		nameFailures := make(map[string][]model.PurgeFailure)
+		failures := make(map[string]bool)
+		for _, fail := range failed {
+			failures[fail.Id] = true
+		}
+
+		for i, result := range results {
+			if result.err != nil {
+				return nil, result.err
+			}
+
+			for _, fail := range result.failed {
+				nameFailures[fail.Id] = append(nameFailures[fail.Id], model.PurgeFailure{
+					Name:    names[i],
+					Message: fail.Err.Error(),
+				})
+
+				if !failures[fail.Id] {
+					failures[fail.Id] = true
+					failed = append(failed, domain.PerServerFail{
+						Id:  fail.Id,
+						Err: fmt.Errorf("failed to delete %s: %w", names[i], fail.Err),
+					})
+				}
+			}
+		}
+
+		for i := range response.Servers {
+			purged := &response.Servers[i]
+			purged.Failed = nameFailures[purged.Id]
+			purged.Names = slices.DeleteFunc(purged.Names, func(name string) bool {
+				return slices.ContainsFunc(purged.Failed, func(fail model.PurgeFailure) bool {
+					return fail.Name == name
+				})
+			})
+		}
+
+		s.publish(model.EventCachePurged, searchDomain, servers, failed)
+	}
+
+	response.Errors = toAffectedServers(failed)
+	return &response, nil
+}
+
+// Names of the header flags set in a DNS response
+func datagramFlags(datagram domain.DnsDatagram) []string {
+	flags := []string{}
+	for _, flag := range []struct {
+		name string
+		set  bool
+	}{
+		{"AA", datagram.AuthoritativeAnswer},
+		{"TC", datagram.Truncation},
+		{"RD", datagram.RecursionDesired},
+		{"RA", datagram.RecursionAvailable},
+		{"AD", datagram.AuthenticData},
+		{"CD", datagram.CheckingDisabled},
+	} {
+		if flag.set {
+			flags = append(flags, flag.name)
+		}
+	}
+	return flags
+}
+
+// Parse a round trip time reported by Technetium such as "12.34 ms"
+func parseRoundTripTime(rtt string) *float64 {
+	value, unit, _ := strings.Cut(strings.TrimSpace(rtt), " ")
+	latency, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil
+	}
+
+	if unit == "s" {
+		latency *= 1000
+	}
+	return &latency
+}
+
+func (s service) Resolve(ctx context.Context, name string, typ string, servers []string) (*model.ResolveResponse, error) {
+	results, failed, err := s.repository.Resolve(ctx, name, typ, servers)
+	if err != nil {
+		return nil, err
+	}
+
+	type answerKey struct {
+		name string
+		typ  string
+	}
+
+	response := model.ResolveResponse{
+		PartialFailure: model.PartialFailure{Errors: toAffectedServers(failed)},
+		Name:           name,
+		Type:           typ,
+		Agreed:         true,
+		Servers:        []model.ResolvedServer{},
+		Answers:        []model.ResolvedAnswer{},
+	}
+
+	answers := make(map[answerKey]*model.ResolvedAnswer)
+	// Data of each answer returned by each server, used to check that the
+	// servers agree
+	data := make(map[answerKey]map[string][]string)
+
+	for _, server := range servers {
+		result, ok := results[server]
+		if !ok {
+			continue
+		}
+
+		datagram := result.Response.Result
+		response.Servers = append(response.Servers, model.ResolvedServer{
+			Id:        server,
+			Rcode:     datagram.Rcode,
+			Flags:     datagramFlags(datagram),
+			LatencyMs: parseRoundTripTime(datagram.Metadata.RoundTripTime),
+		})
+
+		if datagram.Rcode != response.Servers[0].Rcode {
+			response.Agreed = false
+		}
+
+		for _, record := range datagram.Answer {
+			key := answerKey{name: strings.ToLower(strings.TrimSuffix(record.Name, ".")), typ: record.Type}
+			if _, exists := answers[key]; !exists {
+				answers[key] = &model.ResolvedAnswer{Name: key.name, Type: key.typ}
+				data[key] = make(map[string][]string)
+			}
+
+			answers[key].ResolvedResult = append(answers[key].ResolvedResult, model.ResolvedResult{
+				Id:    server,
+				RData: record.RData,
+				Ttl:   fmt.Sprint(record.Ttl),
+			})
+			data[key][server] = append(data[key][server], fmt.Sprint(record.RData))
+		}
+	}
+
+	for key, answer := range answers {
+		answer.Agreed = len(data[key]) == len(response.Servers)
+
+		var first []string
+		for _, values := range data[key] {
+			slices.Sort(values)
+			if first == nil {
+				first = values
+			} else if !slices.Equal(first, values) {
+				answer.Agreed = false
+			}
+		}
+
+		if !answer.Agreed {
+			response.Agreed = false
+		}
+		response.Answers = append(response.Answers, *answer)
+	}
+
+	slices.SortFunc(response.Answers, func(a, b model.ResolvedAnswer) int {
+		if c := strings.Compare(a.Name, b.Name); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Type, b.Type)
+	})
+
+	return &response, nil
+}
+
+func (s service) FlushCache(ctx context.Context, servers []string) (*model.PerServerFail, error) {
+	srvFail, err := s.repository.FlushCache(ctx, servers)
+	if err != nil {
+		return nil, err
+	}
+
+	s.publish(model.EventCacheFlushed, "", servers, srvFail)
+	return toPerServerFail(srvFail), nil
+}
+
+func (s service) GetUpstreamStats() model.UpstreamStats {
+	stats := s.repository.GetUpstreamStats()
+
+	return model.UpstreamStats{
+		GlobalLimit:     stats.GlobalLimit,
+		PerRequestLimit: stats.PerRequestLimit,
+		Queued:          stats.Queued,
+		InFlight:        stats.InFlight,
+		Completed:       stats.Completed,
+		AverageWaitMs:   float64(stats.AverageWait) / float64(time.Millisecond),
+		MaxWaitMs:       float64(stats.MaxWait) / float64(time.Millisecond),
+	}
+}
+
+func (s service) GetDnssecStatus(ctx context.Context, zone string, servers []string) (*model.DnssecStatusResponse, error) {
+	results, failed, err := s.repository.GetDnssecProperties(ctx, zone, servers)
+	if err != nil {
+		return nil, err
+	}
+
+	response := model.DnssecStatusResponse{
+		PartialFailure: model.PartialFailure{Errors: toAffectedServers(failed)},
+		Zone:           zone,
+		Agreed:         true,
+		Servers:        []model.DnssecServerStatus{},
+	}
+
+	for _, server := range servers {
+		result, ok := results[server]
+		if !ok {
+			continue
+		}
+
+		status := model.DnssecServerStatus{
+			Id:        server,
+			Status:    result.Response.DnssecStatus,
+			DnsKeyTtl: result.Response.DnsKeyTtl,
+			Keys:      make([]model.DnssecKey, len(result.Response.DnssecPrivateKeys)),
+		}
+		for i, key := range result.Response.DnssecPrivateKeys {
+			status.Keys[i] = model.DnssecKey{
+				KeyTag:         key.KeyTag,
+				KeyType:        key.KeyType,
+				Algorithm:      key.Algorithm,
+				State:          key.State,
+				StateChangedOn: key.StateChangedOn,
+				StateReadyBy:   key.StateReadyBy,
+				Retiring:       key.IsRetiring,
+				RolloverDays:   key.RolloverDays,
+			}
+		}
+
+		response.Servers = append(response.Servers, status)
+		if status.Status != response.Servers[0].Status {
+			response.Agreed = false
+		}
+	}
+
+	return &response, nil
+}
+
+// DNSSEC algorithm numbers from the IANA registry keyed by the names
+// Technetium uses
+var dnssecAlgorithms = map[string]int{
+	"RSAMD5":           1,
+	"DSA":              3,
+	"RSASHA1":          5,
+	"DSANSEC3SHA1":     6,
+	"RSASHA1NSEC3SHA1": 7,
+	"RSASHA256":        8,
+	"RSASHA512":        10,
+	"ECCGOST":          12,
+	"ECDSAP256SHA256":  13,
+	"ECDSAP384SHA384":  14,
+	"ED25519":          15,
+	"ED448":            16,
+}
+
+// DS digest type numbers from the IANA registry
+var dsDigestTypes = map[string]int{
+	"SHA1":   1,
+	"SHA256": 2,
+	"GOST":   3,
+	"SHA384": 4,
+}
+
+// Format a DS record for zone in presentation format. An empty string is
+// returned if the algorithm or digest type isn't known.
+func formatDsRecord(zone string, keyTag int, algorithm string, digestType string, digest string) string {
+	algorithmNumber, ok := dnssecAlgorithms[strings.ToUpper(strings.ReplaceAll(algorithm, "-", ""))]
+	if !ok {
+		return ""
+	}
+
+	digestNumber, ok := dsDigestTypes[strings.ToUpper(strings.ReplaceAll(digestType, "-", ""))]
+	if !ok {
+		return ""
+	}
+
+	return fmt.Sprintf("%s. IN DS %d %d %d %s", strings.TrimSuffix(zone, "."), keyTag, algorithmNumber, digestNumber, strings.ToUpper(digest))
+}
+
+// Gather the DS records from each server into a single set. Records are
+// matched by their digest so that a record published by every server
+// appears once, listing each of the servers.
+func (s service) GetDsRecords(ctx context.Context, zone string, servers []string) (*model.DsResponse, error) {
+	results, failed, err := s.repository.GetDsRecords(ctx, zone, servers)
+	if err != nil {
+		return nil, err
+	}
+
+	response := model.DsResponse{
+		PartialFailure: model.PartialFailure{Errors: toAffectedServers(failed)},
+		Zone:           zone,
+		Agreed:         true,
+		Records:        []model.DsRecord{},
+	}
+
+	type recordKey struct {
+		keyTag     int
+		digestType string
+		digest     string
+	}
+
+	records := make(map[recordKey]*model.DsRecord)
+	answered := 0
+	for _, server := range servers {
+		result, ok := results[server]
+		if !ok {
+			continue
+		}
+		answered++
+
+		for _, ds := range result.Response.DsRecords {
+			for _, digest := range ds.Digests {
+				key := recordKey{keyTag: ds.KeyTag, digestType: digest.DigestType, digest: strings.ToUpper(digest.Digest)}
+				if _, exists := records[key]; !exists {
+					records[key] = &model.DsRecord{
+						KeyTag:     ds.KeyTag,
+						Algorithm:  ds.Algorithm,
+						DigestType: digest.DigestType,
+						Digest:     key.digest,
+						Record:     formatDsRecord(zone, ds.KeyTag, ds.Algorithm, digest.DigestType, digest.Digest),
+					}
+				}
+
+				records[key].Servers = append(records[key].Servers, model.DsServer{Id: server, KeyState: ds.DnsKeyState})
+			}
+		}
+	}
+
+	for _, record := range records {
+		if len(record.Servers) != answered {
+			response.Agreed = false
+		}
+		response.Records = append(response.Records, *record)
+	}
+
+	slices.SortFunc(response.Records, func(a, b model.DsRecord) int {
+		if a.KeyTag != b.KeyTag {
+			return a.KeyTag - b.KeyTag
+		}
+		if c := strings.Compare(a.DigestType, b.DigestType); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Digest, b.Digest)
+	})
+
+	return &response, nil
+}
+
+func (s service) SignZone(ctx context.Context, zone string, servers []string, options DnssecSignOptions) (*model.PerServerFail, error) {
+	failed, err := s.repository.SignZone(ctx, zone, options.withDefaults(), servers)
+	if err != nil {
+		return nil, err
+	}
+
+	s.publish(model.EventDnssecSigned, zone, servers, failed)
+	return toPerServerFail(failed), nil
+}
+
+func (s service) UnsignZone(ctx context.Context, zone string, servers []string) (*model.PerServerFail, error) {
+	failed, err := s.repository.UnsignZone(ctx, zone, servers)
+	if err != nil {
+		return nil, err
+	}
+
+	s.publish(model.EventDnssecUnsigned, zone, servers, failed)
+	return toPerServerFail(failed), nil
+}
+
+func (s service) RolloverDnsKey(ctx context.Context, zone string, keyTag int, servers []string) (*model.PerServerFail, error) {
+	failed, err := s.repository.RolloverDnsKey(ctx, zone, keyTag, servers)
+	if err != nil {
+		return nil, err
+	}
+
+	s.publish(model.EventKeyRolledOver, zone, servers, failed)
+	return toPerServerFail(failed), nil
+}
+
+// Get a zone from a single server as a zone file
+func (s service) ExportZone(ctx context.Context, zone string, server string) (string, *model.PerServerFail, error) {
+	zoneFile, failed, err := s.repository.ExportZone(ctx, zone, server)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(failed) > 0 {
+		return "", &model.PerServerFail{
+			GeneralError: model.GeneralError{
+				Code:    http.StatusBadGateway,
+				Message: "Failed to export zone",
+			},
+			AffectedServers: toAffectedServers(failed),
+		}, nil
+	}
+
+	return zoneFile, nil, nil
+}
+
+// Check a zone file and import it into the zone on each of the servers.
+// Nothing is sent to the servers if any line of the file is invalid, in
+// which case a *ZoneFileError is returned.
+func (s service) ImportZone(ctx context.Context, zone string, zoneFile string, overwrite bool, servers []string) (*model.PerServerFail, error) {
+	records, err := parseZoneFile(zone, zoneFile)
+	if err != nil {
+		return nil, err
+	}
+
+	failed, err := s.repository.ImportZone(ctx, zone, formatZoneFile(records), overwrite, servers)
+	if err != nil {
+		return nil, err
+	}
+
+	s.publish(model.EventZoneImported, zone, servers, failed)
+	return toPerServerFail(failed), nil
+}
+
+// Read the parts of a server's configuration that are managed by state
+func (s service) liveState(ctx context.Context, state *desired.State, server string) (desired.Live, error) {
+	servers := []string{server}
+	live := desired.Live{Zones: make(map[string]desired.LiveZone)}
+
+	zones, failed, err := s.repository.ListZones(ctx, servers)
+	if err != nil {
+		return live, err
+	}
+	if len(failed) > 0 {
+		return live, fmt.Errorf("failed to list zones: %w", failed[0].Err)
+	}
+
+	for _, zone := range zones[server].Response.Zones {
+		name := strings.ToLower(zone.Name)
+		if !slices.ContainsFunc(state.Zones, func(declared desired.Zone) bool {
+			return declared.Name == name && slices.Contains(declared.Servers, server)
+		}) {
+			continue
+		}
+
+		records, failed, err := s.repository.GetZoneRecords(ctx, zone.Name, servers)
+		if err != nil {
+			return live, err
+		}
+		if len(failed) > 0 {
+			return live, fmt.Errorf("failed to get records of %s: %w", name, failed[0].Err)
+		}
+
+		// Group the values of each name and type into one record
+		liveZone := desired.LiveZone{Type: zone.Type}
+		sets := make(map[string]int)
+		for _, record := range records[server].Response.Records {
+			value, ok := desired.FormatRData(record.Type, record.RData)
+			if !ok {
+				continue
+			}
+
+			recordName := strings.ToLower(strings.TrimSuffix(record.Name, "."))
+			key := recordName + " " + record.Type
+			index, exists := sets[key]
+			if !exists {
+				index = len(liveZone.Records)
+				sets[key] = index
+				liveZone.Records = append(liveZone.Records, desired.Record{Name: recordName, Type: record.Type, Ttl: record.Ttl})
+			}
+			liveZone.Records[index].Values = append(liveZone.Records[index].Values, value)
+		}
+		live.Zones[name] = liveZone
+	}
+
+	if slices.Contains(state.Servers, server) {
+		for _, list := range []struct {
+			name     string
+			declared []string
+			live     *[]string
+		}{
+			{BlockedList, state.Blocked, &live.Blocked},
+			{AllowedList, state.Allowed, &live.Allowed},
+		} {
+			if list.declared == nil {
+				continue
+			}
+
+			domains, failed, err := s.repository.GetDomainList(ctx, list.name, servers)
+			if err != nil {
+				return live, err
+			}
+			if len(failed) > 0 {
+				return live, fmt.Errorf("failed to get %s list: %w", list.name, failed[0].Err)
+			}
+
+			for _, name := range domains[server] {
+				*list.live = append(*list.live, strings.ToLower(strings.TrimSuffix(name, ".")))
+			}
+		}
+	}
+
+	return live, nil
+}
+
+// Make a single planned change on a server
+func (s service) applyChange(ctx context.Context, change desired.Change, server string) ([]domain.PerServerFail, error) {
+	servers := []string{server}
+
+	switch change.Kind {
+	case desired.KindZone:
+		return s.repository.CreateZone(ctx, change.Zone, change.Type, servers)
+	case desired.KindBlocked, desired.KindAllowed:
+		if change.Action == desired.ActionDelete {
+			return s.repository.RemoveFromDomainList(ctx, change.Kind, change.Name, servers)
+		}
+		return s.repository.AddToDomainList(ctx, change.Kind, change.Name, servers)
+	}
+
+	if change.Action == desired.ActionDelete {
+		for _, value := range change.Before.Values {
+			data, err := desired.RecordData(change.Type, value)
+			if err != nil {
+				return []domain.PerServerFail{{Id: server, Err: err}}, nil
+			}
+
+			failed, err := s.repository.DeleteRecord(ctx, change.Zone, change.Name, change.Type, data, servers)
+			if err != nil || len(failed) > 0 {
+				return failed, err
+			}
+		}
+		return nil, nil
+	}
+
+	// The first value replaces the whole record set, so values that are no
+	// longer wanted are removed along with it
+	for i, value := range change.After.Values {
+		data, err := desired.RecordData(change.Type, value)
+		if err != nil {
+			return []domain.PerServerFail{{Id: server, Err: err}}, nil
+		}
+
+		failed, err := s.repository.AddRecord(ctx, change.Zone, change.Name, change.Type, change.After.Ttl, data, i == 0, servers)
+		if err != nil || len(failed) > 0 {
+			return failed, err
+		}
+	}
+	return nil, nil
+}
+
+func toPlannedRecordSet(set *desired.RecordSet) *model.PlannedRecordSet {
+	if set == nil {
+		return nil
+	}
+	return &model.PlannedRecordSet{Ttl: set.Ttl, Values: set.Values}
+}
+
+// Plan and, unless dryRun is set, make the changes needed to bring one
+// server in line with state. Changes are made in order and the first
+// failure stops the rest from being made. If drift is set, only the
+// changes to zones and lists in enforce mode are made and the mode of each
+// change is reported.
+func (s service) applyServer(ctx context.Context, state *desired.State, server string, dryRun bool, drift bool) (model.ServerPlan, error) {
+	plan := model.ServerPlan{Id: server, Changes: []model.PlannedChange{}}
+
+	live, err := s.liveState(ctx, state, server)
+	if err != nil {
+		return plan, err
+	}
+
+	var failure error
+	for _, change := range desired.Plan(state, server, live) {
+		planned := model.PlannedChange{
+			Action: change.Action,
+			Kind:   change.Kind,
+			Zone:   change.Zone,
+			Name:   change.Name,
+			Type:   change.Type,
+			Before: toPlannedRecordSet(change.Before),
+			After:  toPlannedRecordSet(change.After),
+			Status: "planned",
+		}
+		if drift {
+			planned.Mode = change.Mode
+		}
+
+		switch {
+		case dryRun, drift && change.Mode != desired.ModeEnforce:
+		case failure != nil:
+			planned.Status = "skipped"
+		default:
+			failed, err := s.applyChange(ctx, change, server)
+			if err == nil && len(failed) > 0 {
+				err = failed[0].Err
+			}
+
+			if err != nil {
+				planned.Status = "failed"
+				planned.Error = err.Error()
+				failure = fmt.Errorf("failed to %s %s %s: %w", change.Action, change.Kind, change.Name, err)
+			} else {
+				planned.Status = "applied"
+			}
+		}
+
+		plan.Changes = append(plan.Changes, planned)
+	}
+
+	return plan, failure
+}
+
+// Work on every server named in a validated state at the same time. The
+// servers share the upstream slots of the request that ctx belongs to, so
+// a state naming many servers can't take more than its share.
+func (s service) apply(ctx context.Context, state *desired.State, dryRun bool, drift bool) ([]model.ServerPlan, []domain.PerServerFail) {
+	servers := state.AllServers()
+	plans := make([]model.ServerPlan, len(servers))
+	errs := make([]error, len(servers))
+	s.forEach(len(servers), func(i int) {
+		plans[i], errs[i] = s.applyServer(ctx, state, servers[i], dryRun, drift)
+	})
+
+	failed := []domain.PerServerFail{}
+	for i, server := range servers {
+		if errs[i] != nil {
+			failed = append(failed, domain.PerServerFail{Id: server, Err: errs[i]})
+		}
+	}
+
+	return plans, failed
+}
+
+// Bring every server named in state in line with it. Servers that failed,
+// either while reading their current state or making a change, are listed
+// in the errors.
+func (s service) Apply(ctx context.Context, state *desired.State, dryRun bool) (*model.ApplyResponse, error) {
+	ids := []string{}
+	for _, server := range s.repository.GetServers() {
+		ids = append(ids, server.Id)
+	}
+	if err := state.Validate(ids); err != nil {
+		return nil, err
+	}
+
+	plans, failed := s.apply(ctx, state, dryRun, false)
+
+	response := model.ApplyResponse{DryRun: dryRun, Servers: plans}
+	for _, plan := range plans {
+		response.Changes += len(plan.Changes)
+	}
+	response.Errors = toAffectedServers(failed)
+	if !dryRun {
+		s.publish(model.EventStateApplied, "", state.AllServers(), failed)
+	}
+	return &response, nil
+}
+
+// Run an operation in the background, see [jobs.Manager.Start]
+func (s service) StartJob(operation string, servers []string, run jobs.Func) model.Job {
+	return s.jobs.Start(operation, servers, run)
+}
+
+func (s service) GetJob(id string) (*model.Job, error) {
+	job, err := s.jobs.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Cancel a running job, waiting for it to stop
+func (s service) CancelJob(ctx context.Context, id string) (*model.Job, error) {
+	job, err := s.jobs.Cancel(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Get the outcome of the most recent drift check
+func (s service) GetDrift() (*model.DriftResponse, error) {
+	if s.drift == nil {
+		return nil, ErrDriftNotEnabled
+	}
+
+	report := s.drift.Report()
+	return &report, nil
+}
+
+// Check for drift straight away rather than waiting for the next interval
+func (s service) CheckDrift(ctx context.Context) (*model.DriftResponse, error) {
+	if s.drift == nil {
+		return nil, ErrDriftNotEnabled
+	}
+
+	report, err := s.drift.Check(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// List the DHCP scopes of the servers, tagged with the server each is on
+func (s service) ListDhcpScopes(ctx context.Context, servers []string) (*model.DhcpScopesResponse, error) {
+	results, failed, err := s.repository.ListDhcpScopes(ctx, servers)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &model.DhcpScopesResponse{Scopes: []model.DhcpScope{}}
+	for _, server := range servers {
+		result, ok := results[server]
+		if !ok {
+			continue
+		}
+
+		for _, scope := range result.Response.Scopes {
+			response.Scopes = append(response.Scopes, model.DhcpScope{
+				Server:           server,
+				Name:             scope.Name,
+				Enabled:          scope.Enabled,
+				StartingAddress:  scope.StartingAddress,
+				EndingAddress:    scope.EndingAddress,
+				SubnetMask:       scope.SubnetMask,
+				NetworkAddress:   scope.NetworkAddress,
+				BroadcastAddress: scope.BroadcastAddress,
+				InterfaceAddress: scope.InterfaceAddress,
+			})
+		}
+	}
+
+	response.Errors = toAffectedServers(failed)
+	return response, nil
+}
+
+// Convert the settings of a scope to those sent to Technetium, keeping nil
+// lists nil so that they aren't changed
+func dhcpScopeSettings(settings model.DhcpScopeSettings) domain.DhcpScopeSettings {
+	scope := domain.DhcpScopeSettings{
+		StartingAddress:         settings.StartingAddress,
+		EndingAddress:           settings.EndingAddress,
+		SubnetMask:              settings.SubnetMask,
+		LeaseTimeDays:           settings.LeaseTimeDays,
+		LeaseTimeHours:          settings.LeaseTimeHours,
+		LeaseTimeMinutes:        settings.LeaseTimeMinutes,
+		DomainName:              settings.DomainName,
+		RouterAddress:           settings.RouterAddress,
+		UseThisDnsServer:        settings.UseThisDnsServer,
+		DnsServers:              settings.DnsServers,
+		AllowOnlyReservedLeases: settings.AllowOnlyReservedLeases,
+	}
+
+	if settings.Exclusions != nil {
+		scope.Exclusions = make([]domain.DhcpExclusion, len(settings.Exclusions))
+		for i, exclusion := range settings.Exclusions {
+			scope.Exclusions[i] = domain.DhcpExclusion{StartingAddress: exclusion.StartingAddress, EndingAddress: exclusion.EndingAddress}
+		}
+	}
+	if settings.ReservedLeases != nil {
+		scope.ReservedLeases = make([]domain.DhcpReservedLease, len(settings.ReservedLeases))
+		for i, lease := range settings.ReservedLeases {
+			scope.ReservedLeases[i] = domain.DhcpReservedLease{
+				HostName:        lease.HostName,
+				HardwareAddress: lease.HardwareAddress,
+				Address:         lease.Address,
+				Comments:        lease.Comments,
+			}
+		}
+	}
+	return scope
+}
+
+func (s service) SetDhcpScope(ctx context.Context, name string, settings model.DhcpScopeSettings, servers []string) (*model.PerServerFail, error) {
+	failed, err := s.repository.SetDhcpScope(ctx, name, dhcpScopeSettings(settings), servers)
+	if err != nil {
+		return nil, err
+	}
+
+	s.publishTarget(model.EventDhcpScopeUpdated, name, servers, failed)
+	return toPerServerFail(failed), nil
+}
+
+func (s service) SetDhcpScopeEnabled(ctx context.Context, name string, enabled bool, servers []string) (*model.PerServerFail, error) {
+	failed, err := s.repository.SetDhcpScopeEnabled(ctx, name, enabled, servers)
+	if err != nil {
+		return nil, err
+	}
+
+	event := model.EventDhcpScopeDisabled
+	if enabled {
+		event = model.EventDhcpScopeEnabled
+	}
+	s.publishTarget(event, name, servers, failed)
+	return toPerServerFail(failed), nil
+}
+
+// Merge the DHCP leases of the servers into one list ordered by scope and
+// address, tagging each with the server that handed it out. If scope is
+// set, only leases from scopes with that name are included.
+func (s service) ListDhcpLeases(ctx context.Context, scope string, servers []string) (*model.DhcpLeasesResponse, error) {
+	results, failed, err := s.repository.ListDhcpLeases(ctx, servers)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &model.DhcpLeasesResponse{Leases: []model.DhcpLease{}}
+	for _, server := range servers {
+		result, ok := results[server]
+		if !ok {
+			continue
+		}
+
+		for _, lease := range result.Response.Leases {
+			if scope != "" && !strings.EqualFold(lease.Scope, scope) {
+				continue
+			}
+
+			response.Leases = append(response.Leases, model.DhcpLease{
+				Server:           server,
+				Scope:            lease.Scope,
+				Type:             lease.Type,
+				HardwareAddress:  lease.HardwareAddress,
+				ClientIdentifier: lease.ClientIdentifier,
+				Address:          lease.Address,
+				HostName:         lease.HostName,
+				LeaseObtained:    lease.LeaseObtained,
+				LeaseExpires:     lease.LeaseExpires,
+			})
+		}
+	}
+
+	slices.SortStableFunc(response.Leases, func(a model.DhcpLease, b model.DhcpLease) int {
+		if a.Scope != b.Scope {
+			return strings.Compare(a.Scope, b.Scope)
+		}
+		// Unparsable addresses sort first as the zero Addr
+		addrA, _ := netip.ParseAddr(a.Address)
+		addrB, _ := netip.ParseAddr(b.Address)
+		return addrA.Compare(addrB)
+	})
+
+	response.Errors = toAffectedServers(failed)
+	return response, nil
+}
+
+func (s service) RemoveDhcpLease(ctx context.Context, scope string, hardwareAddress string, servers []string) (*model.PerServerFail, error) {
+	failed, err := s.repository.RemoveDhcpLease(ctx, scope, hardwareAddress, servers)
+	if err != nil {
+		return nil, err
+	}
+
+	s.publishTarget(model.EventDhcpLeaseRemoved, scope+"/"+hardwareAddress, servers, failed)
+	return toPerServerFail(failed), nil
+}
+
+func (s service) ReserveDhcpLease(ctx context.Context, scope string, hardwareAddress string, servers []string) (*model.PerServerFail, error) {
+	failed, err := s.repository.ReserveDhcpLease(ctx, scope, hardwareAddress, servers)
+	if err != nil {
+		return nil, err
+	}
+
+	s.publishTarget(model.EventDhcpLeaseReserved, scope+"/"+hardwareAddress, servers, failed)
+	return toPerServerFail(failed), nil
+}
+
+func (s service) ListSchedules() model.List[model.Schedule] {
+	if s.scheduler == nil {
+		return model.List[model.Schedule]{Results: []model.Schedule{}}
+	}
+
+	return model.List[model.Schedule]{Results: s.scheduler.Schedules()}
+}
+
+// Get the recent runs of a schedule, newest first
+func (s service) GetScheduleRuns(id string) (*model.List[model.ScheduleRun], error) {
+	if s.scheduler == nil {
+		return nil, ErrScheduleNotFound
+	}
+
+	runs, err := s.scheduler.Runs(id)
+	if err != nil {
+		return nil, err
+	}
+	return &model.List[model.ScheduleRun]{Results: runs}, nil
+}
+
+// Have the servers refresh their block lists from their sources
+func (s service) updateBlockLists(ctx context.Context, servers []string) (*model.PerServerFail, error) {
+	failed, err := s.repository.UpdateBlockLists(ctx, servers)
+	if err != nil {
+		return nil, err
+	}
+	return toPerServerFail(failed), nil
+}
+
+// Have the servers resync a secondary or stub zone from its primary
+func (s service) resyncZone(ctx context.Context, zone string, servers []string) (*model.PerServerFail, error) {
+	failed, err := s.repository.ResyncZone(ctx, zone, servers)
+	if err != nil {
+		return nil, err
+	}
+	return toPerServerFail(failed), nil
+}
+
+// Run a schedule straight away rather than waiting for it to fire
+func (s service) RunSchedule(ctx context.Context, id string) (*model.ScheduleRun, error) {
+	if s.scheduler == nil {
+		return nil, ErrScheduleNotFound
+	}
+
+	run, err := s.scheduler.RunNow(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// Check that a server exists and can be probed
+func (s service) checkProbed(id string) error {
+	if !slices.ContainsFunc(s.repository.GetServers(), func(server domain.Server) bool {
+		return server.Id == id
+	}) {
+		return ErrServerNotFound
+	}
+
+	if s.prober == nil || !s.prober.Probed(id) {
+		return ErrProbesNotEnabled
+	}
+
+	return nil
+}
+
+func toProbeResponse(id string, results []probe.Result) *model.ProbeResponse {
+	response := &model.ProbeResponse{
+		Id:      id,
+		Results: make([]model.ProbeResult, len(results)),
+	}
+	if len(results) == 0 {
+		return response
+	}
+
+	healthy := true
+	response.Healthy = &healthy
+
+	for i, result := range results {
+		response.Results[i] = model.ProbeResult{
+			Name:      result.Name,
+			Type:      result.Type,
+			Protocol:  result.Protocol,
+			Rcode:     result.Rcode,
+			Answers:   result.Answers,
+			Correct:   result.Correct,
+			LatencyMs: float64(result.Latency) / float64(time.Millisecond),
+			Time:      result.Time,
+		}
+
+		if result.Error != nil {
+			response.Results[i].Error = result.Error.Error()
+			healthy = false
+		} else if result.Correct != nil && !*result.Correct {
+			healthy = false
+		}
+	}
+
+	return response
+}
+
+func (s service) GetProbes(id string) (*model.ProbeResponse, error) {
+	if err := s.checkProbed(id); err != nil {
+		return nil, err
+	}
+
+	return toProbeResponse(id, s.prober.Results(id)), nil
+}
+
+func (s service) RunProbes(ctx context.Context, id string) (*model.ProbeResponse, error) {
+	if err := s.checkProbed(id); err != nil {
+		return nil, err
+	}
+
+	return toProbeResponse(id, s.prober.ProbeServer(ctx, id)), nil
+}
+
+func NewService(repository Repository, options ...ServiceOption) Service {
+	s := &service{
+		repository: repository,
+		events:     events.NewBus(),
+		jobs:       jobs.NewManager(config.Jobs{Timeout: config.DefaultJobTimeout, Retention: config.DefaultJobRetention}),
+	}
+
+	for _, option := range options {
+		option(s)
+	}
+
+	// Corrections and scheduled operations are made through the service so
+	// that they are published like any other change
+	if s.drift != nil {
+		s.drift.service = s
+	}
+	if s.scheduler != nil {
+		s.scheduler.service = s
+	}
+
+	return s
+}
+
+// Settings that are expected to differ between servers, such as the
+// addresses they listen on, so are left out of a diff unless asked for
+var serverSpecificSettings = []string{
+	"version",
+	"uptimestamp",
+	"dnsServerDomain",
+	"dnsServerLocalEndPoints",
+	"dnsServerIPv4SourceAddresses",
+	"dnsServerIPv6SourceAddresses",
+	"dnsTlsCertificatePath",
+	"dnsTlsCertificatePassword",
+	"webServiceLocalAddresses",
+	"webServiceHttpPort",
+	"webServiceEnableTls",
+	"webServiceTlsPort",
+	"webServiceUseSelfSignedTlsCertificate",
+	"webServiceTlsCertificatePath",
+	"webServiceTlsCertificatePassword",
+	"blockListNextUpdatedOn",
+}
+
+func (s service) GetServerSettings(ctx context.Context, id string) (*model.ServerSettings, *model.PerServerFail, error) {
+	results, failed, err := s.repository.GetSettings(ctx, []string{id})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(failed) > 0 {
+		return nil, &model.PerServerFail{
+			GeneralError: model.GeneralError{
+				Code:    http.StatusBadGateway,
+				Message: "Failed to get settings",
+			},
+			AffectedServers: toAffectedServers(failed),
+		}, nil
+	}
+
+	settings := results[id].Response
+	if settings == nil {
+		settings = map[string]any{}
+	}
+	return &model.ServerSettings{Id: id, Settings: settings}, nil, nil
+}
+
+// Compare the settings of the servers, listing each setting that isn't
+// the same on all of them along with which servers have which value. Only
+// the given keys are compared if there are any, otherwise every setting
+// apart from those specific to a server is.
+func (s service) DiffSettings(ctx context.Context, keys []string, servers []string) (*model.SettingsDiffResponse, error) {
+	results, failed, err := s.repository.GetSettings(ctx, servers)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &model.SettingsDiffResponse{Servers: []string{}, Differences: []model.SettingDifference{}}
+	for _, server := range servers {
+		if _, ok := results[server]; ok {
+			response.Servers = append(response.Servers, server)
+		}
+	}
+
+	if len(keys) == 0 {
+		for _, server := range response.Servers {
+			for key := range results[server].Response {
+				if !slices.Contains(keys, key) && !slices.Contains(serverSpecificSettings, key) {
+					keys = append(keys, key)
+				}
+			}
+		}
+	}
+	keys = slices.Clone(keys)
+	slices.Sort(keys)
+	keys = slices.Compact(keys)
+
+	for _, key := range keys {
+		values := []model.SettingValue{}
+		// Values are compared by their JSON encoding, which orders the
+		// keys of objects
+		encoded := []string{}
+		for _, server := range response.Servers {
+			value := results[server].Response[key]
+			valueJson, err := json.Marshal(value)
+			if err != nil {
+				return nil, err
+			}
+
+			i := slices.Index(encoded, string(valueJson))
+			if i == -1 {
+				encoded = append(encoded, string(valueJson))
+				values = append(values, model.SettingValue{Servers: []string{}, Value: value})
+				i = len(values) - 1
+			}
+			values[i].Servers = append(values[i].Servers, server)
+		}
+
+		if len(values) > 1 {
+			response.Differences = append(response.Differences, model.SettingDifference{Key: key, Values: values})
+		}
+	}
+
+	response.Errors = toAffectedServers(failed)
+	return response, nil
+}
+
+// Setting that can't be sent to the settings API, which only takes
+// strings, booleans, numbers and lists of these
+type SettingError struct {
+	Field     string
+	Condition string
+}
+
+func (e *SettingError) Error() string {
+	return fmt.Sprintf("setting %s is not valid: %s", e.Field, e.Condition)
+}
+
+// Format a scalar setting, or an item of a list, in the form the settings
+// API takes it
+func formatScalar(field string, value any) (string, error) {
+	switch value := value.(type) {
+	case string:
+		return value, nil
+	case bool:
+		return strconv.FormatBool(value), nil
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64), nil
+	}
+	return "", &SettingError{Field: field, Condition: "scalar"}
+}
+
+// Format a setting in the form the settings API takes it. Lists are comma
+// separated and an empty list is cleared with "false".
+func formatSetting(key string, value any) (string, error) {
+	switch value := value.(type) {
+	case nil:
+		return "", &SettingError{Field: key, Condition: "required"}
+	case []any:
+		if len(value) == 0 {
+			return "false", nil
+		}
+
+		items := make([]string, len(value))
+		for i, item := range value {
+			formatted, err := formatScalar(fmt.Sprintf("%s[%d]", key, i), item)
+			if err != nil {
+				return "", err
+			}
+			items[i] = formatted
+		}
+		return strings.Join(items, ","), nil
+	}
+	return formatScalar(key, value)
+}
+
+// Format each of the settings, returning a *SettingError for the first
+// setting in key order that can't be sent
+func formatSettings(settings map[string]any) (url.Values, error) {
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	values := url.Values{}
+	for _, key := range keys {
+		value, err := formatSetting(key, settings[key])
+		if err != nil {
+			return nil, err
+		}
+		values.Set(key, value)
+	}
+	return values, nil
+}
+
+// Change the given settings on the servers, leaving the rest as they are
+func (s service) SetSettings(ctx context.Context, settings map[string]any, servers []string) (*model.PerServerFail, error) {
+	values, err := formatSettings(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	failed, err := s.repository.SetSettings(ctx, values, servers)
+	if err != nil {
+		return nil, err
+	}
+
+	s.publish(model.EventSettingsChanged, "", servers, failed)
+	return toPerServerFail(failed), nil
+}
+
+// Type of zone Technetium uses for conditional forwarding
+const forwarderZoneType = "Forwarder"
+
+// Remove the servers that failed from a list of servers
+func withoutFailed(servers []string, failed []domain.PerServerFail) []string {
+	return slices.DeleteFunc(slices.Clone(servers), func(server string) bool {
+		return slices.ContainsFunc(failed, func(fail domain.PerServerFail) bool { return fail.Id == server })
+	})
+}
+
+// Data of the FWD record for a forwarder
+func forwarderData(forwarder model.Forwarder) map[string]string {
+	return map[string]string{"protocol": forwarder.Protocol, "forwarder": forwarder.Address}
+}
+
+// Merge the global forwarders and conditional forwarder zones of the
+// servers into one list of which domains are forwarded where, and by which
+// servers. Forwarders are listed by domain, in the order they are tried.
+func (s service) GetForwarders(ctx context.Context, servers []string) (*model.ForwardersResponse, error) {
+	settings, failed, err := s.repository.GetSettings(ctx, servers)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := []model.ForwardingRule{}
+	add := func(name string, forwarder model.Forwarder, server string) {
+		for i := range rules {
+			if rules[i].Domain == name && rules[i].Forwarder == forwarder {
+				if !slices.Contains(rules[i].Servers, server) {
+					rules[i].Servers = append(rules[i].Servers, server)
+				}
+				return
+			}
+		}
+		rules = append(rules, model.ForwardingRule{Domain: name, Forwarder: forwarder, Servers: []string{server}})
+	}
+
+	answered := withoutFailed(servers, failed)
+	for _, server := range answered {
+		protocol, _ := settings[server].Response["forwarderProtocol"].(string)
+		forwarders, _ := settings[server].Response["forwarders"].([]any)
+		for _, forwarder := range forwarders {
+			add(".", model.Forwarder{Protocol: protocol, Address: fmt.Sprint(forwarder)}, server)
+		}
+	}
+
+	zones, zonesFailed, err := s.repository.ListZones(ctx, answered)
+	if err != nil {
+		return nil, err
+	}
+	failed = append(failed, zonesFailed...)
+
+	// Servers with each forwarder zone, in the order the zones are first
+	// seen
+	names := []string{}
+	zoneServers := make(map[string][]string)
+	for _, server := range withoutFailed(answered, zonesFailed) {
+		for _, zone := range zones[server].Response.Zones {
+			if zone.Type != forwarderZoneType {
+				continue
+			}
+
+			name := strings.ToLower(zone.Name)
+			if _, ok := zoneServers[name]; !ok {
+				names = append(names, name)
+			}
+			zoneServers[name] = append(zoneServers[name], server)
+		}
+	}
+
+	for _, name := range names {
+		records, recordsFailed, err := s.repository.GetZoneRecords(ctx, name, zoneServers[name])
+		if err != nil {
+			return nil, err
+		}
+
+		// Servers are only reported once, however many zones they fail on
+		for _, fail := range recordsFailed {
+			if !slices.ContainsFunc(failed, func(existing domain.PerServerFail) bool { return existing.Id == fail.Id }) {
+				failed = append(failed, fail)
+			}
+		}
+
+		for _, server := range zoneServers[name] {
+			result, ok := records[server]
+			if !ok {
+				continue
+			}
+
+			for _, record := range result.Response.Records {
+				if record.Type != "FWD" || record.Disabled {
+					continue
+				}
+				add(strings.ToLower(record.Name), model.Forwarder{
+					Protocol: fmt.Sprint(record.RData["protocol"]),
+					Address:  fmt.Sprint(record.RData["forwarder"]),
+				}, server)
+			}
+		}
+	}
+
+	slices.SortStableFunc(rules, func(a model.ForwardingRule, b model.ForwardingRule) int {
+		return strings.Compare(a.Domain, b.Domain)
+	})
+
+	return &model.ForwardersResponse{
+		PartialFailure: model.PartialFailure{Errors: toAffectedServers(failed)},
+		Rules:          rules,
+	}, nil
+}
+
+// Replace the global forwarders of the servers. An empty list of
+// forwarders makes the servers resolve queries recursively.
+func (s service) SetForwarders(ctx context.Context, settings model.ForwarderSettings, servers []string) (*model.PerServerFail, error) {
+	// Like other lists, the forwarders are cleared with "false"
+	values := url.Values{}
+	values.Set("forwarders", "false")
+	if len(settings.Forwarders) > 0 {
+		values.Set("forwarders", strings.Join(settings.Forwarders, ","))
+	}
+	if settings.Protocol != "" {
+		values.Set("forwarderProtocol", settings.Protocol)
+	}
+
+	failed, err := s.repository.SetSettings(ctx, values, servers)
+	if err != nil {
+		return nil, err
+	}
+
+	s.publish(model.EventForwardersChanged, "", servers, failed)
+	return toPerServerFail(failed), nil
+}
+
+// Find the servers that have a zone and those that don't, failing the
+// servers where it exists but isn't a conditional forwarder zone
+func (s service) findForwarderZone(ctx context.Context, zone string, servers []string) ([]string, []string, []domain.PerServerFail, error) {
+	zones, failed, err := s.repository.ListZones(ctx, servers)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	existing, missing := []string{}, []string{}
+	for _, server := range withoutFailed(servers, failed) {
+		index := slices.IndexFunc(zones[server].Response.Zones, func(candidate domain.Zone) bool {
+			return strings.EqualFold(candidate.Name, zone)
+		})
+
+		switch {
+		case index == -1:
+			missing = append(missing, server)
+		case zones[server].Response.Zones[index].Type != forwarderZoneType:
+			failed = append(failed, domain.PerServerFail{
+				Id:  server,
+				Err: fmt.Errorf("%s is a %s zone rather than a conditional forwarder zone", zone, zones[server].Response.Zones[index].Type),
+			})
+		default:
+			existing = append(existing, server)
+		}
+	}
+
+	return existing, missing, failed, nil
+}
+
+// Make the servers forward zone to forwarders, creating the conditional
+// forwarder zone where it doesn't exist and replacing the forwarders
+// where it does
+func (s service) SetForwarderZone(ctx context.Context, zone string, forwarders []model.Forwarder, servers []string) (*model.PerServerFail, error) {
+	existing, missing, failed, err := s.findForwarderZone(ctx, zone, servers)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(missing) > 0 {
+		createFailed, err := s.repository.CreateForwarderZone(ctx, zone, forwarders[0].Protocol, forwarders[0].Address, missing)
+		if err != nil {
+			return nil, err
+		}
+		failed = append(failed, createFailed...)
+	}
+
+	// The first forwarder replaces those the zone already has. TTLs aren't
+	// used for forwarding.
+	if len(existing) > 0 {
+		addFailed, err := s.repository.AddRecord(ctx, zone, zone, "FWD", 0, forwarderData(forwarders[0]), true, existing)
+		if err != nil {
+			return nil, err
+		}
+		failed = append(failed, addFailed...)
+	}
+
+	remaining := withoutFailed(append(existing, missing...), failed)
+	for _, forwarder := range forwarders[1:] {
+		if len(remaining) == 0 {
+			break
+		}
+
+		addFailed, err := s.repository.AddRecord(ctx, zone, zone, "FWD", 0, forwarderData(forwarder), false, remaining)
+		if err != nil {
+			return nil, err
+		}
+		failed = append(failed, addFailed...)
+		remaining = withoutFailed(remaining, addFailed)
+	}
+
+	s.publish(model.EventForwarderZoneUpdated, zone, servers, failed)
+	return toPerServerFail(failed), nil
+}
+
+// Delete a conditional forwarder zone from the servers. Servers without
+// the zone are left as they are.
+func (s service) DeleteForwarderZone(ctx context.Context, zone string, servers []string) (*model.PerServerFail, error) {
+	existing, _, failed, err := s.findForwarderZone(ctx, zone, servers)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(existing) > 0 {
+		deleteFailed, err := s.repository.DeleteZone(ctx, zone, existing)
+		if err != nil {
+			return nil, err
+		}
+		failed = append(failed, deleteFailed...)
+	}
+
+	s.publish(model.EventForwarderZoneDeleted, zone, servers, failed)
+	return toPerServerFail(failed), nil
+}
+
+// Compare two dotted version numbers such as 2.1 and 10.0, comparing parts
+// that aren't numbers as strings
+func compareVersions(a string, b string) int {
+	partsA, partsB := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < min(len(partsA), len(partsB)); i++ {
+		numberA, errA := strconv.Atoi(partsA[i])
+		numberB, errB := strconv.Atoi(partsB[i])
+		if errA == nil && errB == nil {
+			if numberA != numberB {
+				return numberA - numberB
+			}
+		} else if compared := strings.Compare(partsA[i], partsB[i]); compared != 0 {
+			return compared
+		}
+	}
+	return len(partsA) - len(partsB)
+}
+
+// List the DNS apps installed on the servers, along with which version
+// each server has and which servers don't have the app at all
+func (s service) ListApps(ctx context.Context, servers []string) (*model.AppsResponse, error) {
+	results, failed, err := s.repository.ListApps(ctx, servers)
+	if err != nil {
+		return nil, err
+	}
+
+	answered := withoutFailed(servers, failed)
+	apps := []model.App{}
+	for _, server := range answered {
+		for _, installed := range results[server].Response.Apps {
+			i := slices.IndexFunc(apps, func(app model.App) bool { return strings.EqualFold(app.Name, installed.Name) })
+			if i == -1 {
+				apps = append(apps, model.App{Name: installed.Name, Versions: []model.AppVersion{}})
+				i = len(apps) - 1
+			}
+
+			j := slices.IndexFunc(apps[i].Versions, func(version model.AppVersion) bool { return version.Version == installed.Version })
+			if j == -1 {
+				apps[i].Versions = append(apps[i].Versions, model.AppVersion{Version: installed.Version})
+				j = len(apps[i].Versions) - 1
+			}
+			apps[i].Versions[j].Servers = append(apps[i].Versions[j].Servers, server)
+		}
+	}
+
+	for i := range apps {
+		slices.SortFunc(apps[i].Versions, func(a model.AppVersion, b model.AppVersion) int {
+			return compareVersions(b.Version, a.Version)
+		})
+
+		apps[i].Missing = []string{}
+		for _, server := range answered {
+			if !slices.ContainsFunc(apps[i].Versions, func(version model.AppVersion) bool { return slices.Contains(version.Servers, server) }) {
+				apps[i].Missing = append(apps[i].Missing, server)
+			}
+		}
+	}
+	slices.SortFunc(apps, func(a model.App, b model.App) int {
+		return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	})
+
+	return &model.AppsResponse{
+		PartialFailure: model.PartialFailure{Errors: toAffectedServers(failed)},
+		Apps:           apps,
+	}, nil
+}
+
+// Find the servers that have an app installed and those that don't
+func (s service) findApp(ctx context.Context, name string, servers []string) ([]string, []string, []domain.PerServerFail, error) {
+	results, failed, err := s.repository.ListApps(ctx, servers)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	installed, missing := []string{}, []string{}
+	for _, server := range withoutFailed(servers, failed) {
+		if slices.ContainsFunc(results[server].Response.Apps, func(app domain.App) bool { return strings.EqualFold(app.Name, name) }) {
+			installed = append(installed, server)
+		} else {
+			missing = append(missing, server)
+		}
+	}
+
+	return installed, missing, failed, nil
+}
+
+// Install an app from its zip archive on the servers that don't have it
+// and update it on those that do
+func (s service) InstallApp(ctx context.Context, name string, archive []byte, servers []string) (*model.PerServerFail, error) {
+	installed, missing, failed, err := s.findApp(ctx, name, servers)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, step := range []struct {
+		servers []string
+		update  bool
+	}{{missing, false}, {installed, true}} {
+		if len(step.servers) == 0 {
+			continue
+		}
+
+		stepFailed, err := s.repository.InstallApp(ctx, name, archive, step.update, step.servers)
+		if err != nil {
+			return nil, err
+		}
+		failed = append(failed, stepFailed...)
+	}
+
+	s.publishTarget(model.EventAppInstalled, name, servers, failed)
+	return toPerServerFail(failed), nil
+}
+
+// Uninstall an app from the servers. Servers without the app are left as
+// they are.
+func (s service) UninstallApp(ctx context.Context, name string, servers []string) (*model.PerServerFail, error) {
+	installed, _, failed, err := s.findApp(ctx, name, servers)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(installed) > 0 {
+		uninstallFailed, err := s.repository.UninstallApp(ctx, name, installed)
+		if err != nil {
+			return nil, err
+		}
+		failed = append(failed, uninstallFailed...)
+	}
+
+	s.publishTarget(model.EventAppUninstalled, name, servers, failed)
+	return toPerServerFail(failed), nil
+}
+
+// Get the config of an app from each of the servers
+func (s service) GetAppConfig(ctx context.Context, name string, servers []string) (*model.AppConfigResponse, error) {
+	results, failed, err := s.repository.GetAppConfig(ctx, name, servers)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &model.AppConfigResponse{Configs: []model.AppConfig{}}
+	for _, server := range withoutFailed(servers, failed) {
+		config := json.RawMessage("null")
+		if value := results[server].Response.Config; value != nil && json.Valid([]byte(*value)) {
+			config = json.RawMessage(*value)
+		} else if value != nil {
+			config, err = json.Marshal(*value)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		response.Configs = append(response.Configs, model.AppConfig{Server: server, Config: config})
+	}
+
+	response.Errors = toAffectedServers(failed)
+	return response, nil
+}
+
+// Replace the config of an app on the servers
+func (s service) SetAppConfig(ctx context.Context, name string, config json.RawMessage, servers []string) (*model.PerServerFail, error) {
+	failed, err := s.repository.SetAppConfig(ctx, name, string(config), servers)
+	if err != nil {
+		return nil, err
+	}
+
+	s.publishTarget(model.EventAppConfigChanged, name, servers, failed)
+	return toPerServerFail(failed), nil
+}
+
+// Take a backup of the configuration of a server as a zip archive, which
+// is streamed from the server and must be closed once it has been read
+func (s service) BackupServer(ctx context.Context, id string, logs bool) (io.ReadCloser, *model.PerServerFail, error) {
+	archive, failed, err := s.repository.BackupSettings(ctx, id, logs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(failed) > 0 {
+		return nil, &model.PerServerFail{
+			GeneralError: model.GeneralError{
+				Code:    http.StatusBadGateway,
+				Message: "Failed to back up server",
+			},
+			AffectedServers: toAffectedServers(failed),
+		}, nil
+	}
+
+	return archive, nil, nil
+}
+
+// Take a backup of a server and keep it in the backup store
+func (s service) StoreBackup(ctx context.Context, id string, logs bool) (*model.Backup, *model.PerServerFail, error) {
+	if s.backups == nil {
+		return nil, nil, ErrBackupsNotEnabled
+	}
+
+	taken := time.Now()
+	archive, failed, err := s.BackupServer(ctx, id, logs)
+	if err != nil || failed != nil {
+		return nil, failed, err
+	}
+	defer archive.Close()
+
+	backup, err := s.backups.Save(id, archive, taken)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.publishTarget(model.EventBackupCreated, backup.Name, []string{id}, nil)
+	return &backup, nil, nil
+}
+
+// Back up each of the servers into the backup store one at a time,
+// reporting those that couldn't be backed up or stored
+func (s service) storeBackups(ctx context.Context, servers []string) (*model.PerServerFail, error) {
+	if s.backups == nil {
+		return nil, ErrBackupsNotEnabled
+	}
+
+	affected := []model.AffectedServer{}
+	for _, server := range servers {
+		_, failed, err := s.StoreBackup(ctx, server, false)
+		if errors.Is(err, ErrServerNotFound) {
+			return nil, err
+		} else if err != nil {
+			affected = append(affected, model.AffectedServer{Id: server, Message: err.Error()})
+		} else if failed != nil {
+			affected = append(affected, failed.AffectedServers...)
+		}
+	}
+
+	if len(affected) == 0 {
+		return nil, nil
+	}
+	return &model.PerServerFail{
+		GeneralError: model.GeneralError{
+			Code:    http.StatusInternalServerError,
+			Message: "Operation partially succeeded. Some errors occurred",
+		},
+		AffectedServers: affected,
+	}, nil
+}
+
+// Restore a server from a backup archive, which is streamed to the server
+// as it is read
+func (s service) RestoreServer(ctx context.Context, id string, archive io.Reader, deleteExisting bool) (*model.PerServerFail, error) {
+	failed, err := s.repository.RestoreSettings(ctx, id, archive, deleteExisting)
+	if err != nil {
+		return nil, err
+	}
+
+	s.publish(model.EventServerRestored, "", []string{id}, failed)
+	return toPerServerFail(failed), nil
+}
+
+// List the stored backups of a server, or of every server if server is
+// empty, newest first
+func (s service) ListBackups(server string) (*model.List[model.Backup], error) {
+	if s.backups == nil {
+		return nil, ErrBackupsNotEnabled
+	}
+
+	backups, err := s.backups.List(server)
+	if err != nil {
+		return nil, err
+	}
+	return &model.List[model.Backup]{Results: backups}, nil
+}
+
+// Open a stored backup for reading, returning its size along with it
+func (s service) GetBackup(server string, name string) (io.ReadCloser, int64, error) {
+	if s.backups == nil {
+		return nil, 0, ErrBackupsNotEnabled
 	}
+	return s.backups.Open(server, name)
 }
@@ -0,0 +1,160 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package technetiumtest
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+type App struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	// Config of the app, or nil if it has none
+	Config *string `json:"-"`
+}
+
+// Current state of an installed app
+func (s *Server) App(name string) (App, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, app := range s.fixture.Apps {
+		if strings.EqualFold(app.Name, name) {
+			return app, true
+		}
+	}
+	return App{}, false
+}
+
+func findApp(fixture *Fixture, name string) (int, error) {
+	for i, app := range fixture.Apps {
+		if strings.EqualFold(app.Name, name) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("DNS application was not found: %s", name)
+}
+
+// Read an uploaded app archive. Real apps get their version from the
+// assembly, whereas the fake reads it from a version.txt file in the
+// archive. The default config comes from dnsApp.config as with Technetium.
+func readAppArchive(r *http.Request, name string) (App, error) {
+	file, _, err := r.FormFile("fileAppZip")
+	if err != nil {
+		return App{}, errors.New("DNS application zip file is missing.")
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return App{}, err
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return App{}, errors.New("The uploaded file is not a valid zip archive.")
+	}
+
+	app := App{Name: name, Version: "1.0"}
+	for _, entry := range archive.File {
+		if entry.Name != "version.txt" && entry.Name != "dnsApp.config" {
+			continue
+		}
+
+		contents, err := entry.Open()
+		if err != nil {
+			return App{}, err
+		}
+		value, err := io.ReadAll(contents)
+		contents.Close()
+		if err != nil {
+			return App{}, err
+		}
+
+		if entry.Name == "version.txt" {
+			app.Version = strings.TrimSpace(string(value))
+		} else {
+			config := string(value)
+			app.Config = &config
+		}
+	}
+	return app, nil
+}
+
+func (s *Server) registerApps() {
+	s.Handle("/api/apps/list", func(r *http.Request, fixture *Fixture) (any, error) {
+		apps := fixture.Apps
+		if apps == nil {
+			apps = []App{}
+		}
+		return map[string]any{"apps": apps}, nil
+	})
+
+	s.Handle("/api/apps/install", func(r *http.Request, fixture *Fixture) (any, error) {
+		name := r.URL.Query().Get("name")
+		if _, err := findApp(fixture, name); err == nil {
+			return nil, fmt.Errorf("DNS application already exists: %s", name)
+		}
+
+		app, err := readAppArchive(r, name)
+		if err != nil {
+			return nil, err
+		}
+		fixture.Apps = append(fixture.Apps, app)
+		return nil, nil
+	})
+
+	// Updating keeps the config the app already has
+	s.Handle("/api/apps/update", func(r *http.Request, fixture *Fixture) (any, error) {
+		i, err := findApp(fixture, r.URL.Query().Get("name"))
+		if err != nil {
+			return nil, err
+		}
+
+		app, err := readAppArchive(r, fixture.Apps[i].Name)
+		if err != nil {
+			return nil, err
+		}
+		fixture.Apps[i].Version = app.Version
+		return nil, nil
+	})
+
+	s.Handle("/api/apps/uninstall", func(r *http.Request, fixture *Fixture) (any, error) {
+		i, err := findApp(fixture, r.URL.Query().Get("name"))
+		if err != nil {
+			return nil, err
+		}
+		fixture.Apps = slices.Delete(fixture.Apps, i, i+1)
+		return nil, nil
+	})
+
+	s.Handle("/api/apps/config/get", func(r *http.Request, fixture *Fixture) (any, error) {
+		i, err := findApp(fixture, r.URL.Query().Get("name"))
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"config": fixture.Apps[i].Config}, nil
+	})
+
+	s.Handle("/api/apps/config/set", func(r *http.Request, fixture *Fixture) (any, error) {
+		i, err := findApp(fixture, r.URL.Query().Get("name"))
+		if err != nil {
+			return nil, err
+		}
+		if err := r.ParseForm(); err != nil {
+			return nil, err
+		}
+
+		config := r.PostForm.Get("config")
+		fixture.Apps[i].Config = &config
+		return nil, nil
+	})
+}
@@ -0,0 +1,169 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package technetiumtest
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+type DhcpScope struct {
+	Name             string `json:"name"`
+	Enabled          bool   `json:"enabled"`
+	StartingAddress  string `json:"startingAddress"`
+	EndingAddress    string `json:"endingAddress"`
+	SubnetMask       string `json:"subnetMask"`
+	NetworkAddress   string `json:"networkAddress"`
+	BroadcastAddress string `json:"broadcastAddress"`
+	// Other options the scope has been set with, as sent to the API
+	Options map[string]string `json:"-"`
+}
+
+type DhcpLease struct {
+	Scope            string `json:"scope"`
+	Type             string `json:"type"`
+	HardwareAddress  string `json:"hardwareAddress"`
+	ClientIdentifier string `json:"clientIdentifier"`
+	Address          string `json:"address"`
+	HostName         string `json:"hostName"`
+	LeaseObtained    string `json:"leaseObtained"`
+	LeaseExpires     string `json:"leaseExpires"`
+}
+
+// Current state of a DHCP scope
+func (s *Server) DhcpScope(name string) (DhcpScope, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, scope := range s.fixture.DhcpScopes {
+		if scope.Name == name {
+			return scope, true
+		}
+	}
+	return DhcpScope{}, false
+}
+
+// Leases currently handed out by the server
+func (s *Server) DhcpLeases() []DhcpLease {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.fixture.DhcpLeases)
+}
+
+func findDhcpScope(fixture *Fixture, name string) (*DhcpScope, error) {
+	for i := range fixture.DhcpScopes {
+		if fixture.DhcpScopes[i].Name == name {
+			return &fixture.DhcpScopes[i], nil
+		}
+	}
+	return nil, fmt.Errorf("DHCP scope does not exist: %s", name)
+}
+
+// Find the lease of a client in a scope, comparing hardware addresses in
+// any of the forms net.ParseMAC accepts
+func findDhcpLease(fixture *Fixture, r *http.Request) (int, error) {
+	query := r.URL.Query()
+	if _, err := findDhcpScope(fixture, query.Get("name")); err != nil {
+		return 0, err
+	}
+
+	wanted, err := net.ParseMAC(query.Get("hardwareAddress"))
+	if err != nil {
+		return 0, errors.New("Invalid hardware address.")
+	}
+
+	for i, lease := range fixture.DhcpLeases {
+		address, err := net.ParseMAC(lease.HardwareAddress)
+		if err == nil && lease.Scope == query.Get("name") && address.String() == wanted.String() {
+			return i, nil
+		}
+	}
+	return 0, errors.New("No such lease was found.")
+}
+
+func (s *Server) registerDhcp() {
+	s.Handle("/api/dhcp/scopes/list", func(r *http.Request, fixture *Fixture) (any, error) {
+		scopes := fixture.DhcpScopes
+		if scopes == nil {
+			scopes = []DhcpScope{}
+		}
+		return map[string]any{"scopes": scopes}, nil
+	})
+
+	s.Handle("/api/dhcp/scopes/set", func(r *http.Request, fixture *Fixture) (any, error) {
+		query := r.URL.Query()
+		scope, err := findDhcpScope(fixture, query.Get("name"))
+		if err != nil {
+			if query.Get("startingAddress") == "" || query.Get("endingAddress") == "" || query.Get("subnetMask") == "" {
+				return nil, errors.New("Parameter 'startingAddress' missing.")
+			}
+			fixture.DhcpScopes = append(fixture.DhcpScopes, DhcpScope{Name: query.Get("name")})
+			scope = &fixture.DhcpScopes[len(fixture.DhcpScopes)-1]
+		}
+
+		// Options that aren't sent keep their value, as in Technetium
+		if scope.Options == nil {
+			scope.Options = make(map[string]string)
+		}
+		for key := range query {
+			switch key {
+			case "token", "name":
+			case "startingAddress":
+				scope.StartingAddress = query.Get(key)
+			case "endingAddress":
+				scope.EndingAddress = query.Get(key)
+			case "subnetMask":
+				scope.SubnetMask = query.Get(key)
+			default:
+				scope.Options[key] = query.Get(key)
+			}
+		}
+		return nil, nil
+	})
+
+	for _, action := range []string{"enable", "disable"} {
+		enabled := action == "enable"
+		s.Handle("/api/dhcp/scopes/"+action, func(r *http.Request, fixture *Fixture) (any, error) {
+			scope, err := findDhcpScope(fixture, r.URL.Query().Get("name"))
+			if err != nil {
+				return nil, err
+			}
+			scope.Enabled = enabled
+			return nil, nil
+		})
+	}
+
+	s.Handle("/api/dhcp/leases/list", func(r *http.Request, fixture *Fixture) (any, error) {
+		leases := fixture.DhcpLeases
+		if leases == nil {
+			leases = []DhcpLease{}
+		}
+		return map[string]any{"leases": leases}, nil
+	})
+
+	s.Handle("/api/dhcp/leases/remove", func(r *http.Request, fixture *Fixture) (any, error) {
+		i, err := findDhcpLease(fixture, r)
+		if err != nil {
+			return nil, err
+		}
+		fixture.DhcpLeases = slices.Delete(fixture.DhcpLeases, i, i+1)
+		return nil, nil
+	})
+
+	s.Handle("/api/dhcp/leases/convertToReserved", func(r *http.Request, fixture *Fixture) (any, error) {
+		i, err := findDhcpLease(fixture, r)
+		if err != nil {
+			return nil, err
+		}
+		if strings.EqualFold(fixture.DhcpLeases[i].Type, "Reserved") {
+			return nil, errors.New("The lease is already reserved.")
+		}
+		fixture.DhcpLeases[i].Type = "Reserved"
+		return nil, nil
+	})
+}
@@ -0,0 +1,231 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package technetiumtest
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SidingsMedia/unified-control-rdns/config"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Fake of the DNS service of a Technetium server. It answers A, AAAA and
+// TXT questions over UDP, TCP, DNS over TLS and DNS over HTTPS.
+type DnsServer struct {
+	// Address for plain DNS over UDP and TCP
+	Address string
+	// Address for DNS over TLS
+	TlsAddress string
+	// URL for DNS over HTTPS
+	HttpsUrl string
+
+	mu      sync.Mutex
+	answers map[string][]string
+	delay   time.Duration
+	queries atomic.Int64
+}
+
+// Replace the answers given by the server. Answers are keyed by name and
+// type, such as "example.com A". Questions without an answer get NxDomain.
+func (s *DnsServer) SetAnswers(answers map[string][]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.answers = answers
+}
+
+// Wait this long before answering each query
+func (s *DnsServer) SetDelay(delay time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delay = delay
+}
+
+// Number of queries the server has received over every protocol
+func (s *DnsServer) Queries() int {
+	return int(s.queries.Load())
+}
+
+// Config entry for the DNS service. The certificate is self signed so
+// isn't verified.
+func (s *DnsServer) Config() *config.DnsAddress {
+	return &config.DnsAddress{
+		Address:            s.Address,
+		Tls:                s.TlsAddress,
+		Https:              s.HttpsUrl,
+		InsecureSkipVerify: true,
+	}
+}
+
+func (s *DnsServer) answer(query []byte) ([]byte, error) {
+	s.queries.Add(1)
+
+	var message dnsmessage.Message
+	if err := message.Unpack(query); err != nil {
+		return nil, err
+	}
+	if len(message.Questions) != 1 {
+		return nil, errors.New("expected a single question")
+	}
+
+	s.mu.Lock()
+	delay := s.delay
+	question := message.Questions[0]
+	name := strings.ToLower(strings.TrimSuffix(question.Name.String(), "."))
+	answers, exists := s.answers[name+" "+strings.TrimPrefix(question.Type.String(), "Type")]
+	s.mu.Unlock()
+
+	time.Sleep(delay)
+
+	message.Header.Response = true
+	message.Header.RecursionAvailable = true
+	message.Header.RCode = dnsmessage.RCodeSuccess
+	if !exists {
+		message.Header.RCode = dnsmessage.RCodeNameError
+	}
+
+	header := dnsmessage.ResourceHeader{Name: question.Name, Type: question.Type, Class: dnsmessage.ClassINET, TTL: 60}
+	for _, answer := range answers {
+		var body dnsmessage.ResourceBody
+		switch question.Type {
+		case dnsmessage.TypeA:
+			var a [4]byte
+			copy(a[:], net.ParseIP(answer).To4())
+			body = &dnsmessage.AResource{A: a}
+		case dnsmessage.TypeAAAA:
+			var aaaa [16]byte
+			copy(aaaa[:], net.ParseIP(answer).To16())
+			body = &dnsmessage.AAAAResource{AAAA: aaaa}
+		case dnsmessage.TypeTXT:
+			body = &dnsmessage.TXTResource{TXT: []string{answer}}
+		default:
+			return nil, errors.New("unsupported question type")
+		}
+		message.Answers = append(message.Answers, dnsmessage.Resource{Header: header, Body: body})
+	}
+
+	return message.Pack()
+}
+
+func (s *DnsServer) serveUdp(conn net.PacketConn) {
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		response, err := s.answer(buf[:n])
+		if err != nil {
+			continue
+		}
+		conn.WriteTo(response, addr)
+	}
+}
+
+// Serve length prefixed queries as used by TCP and DNS over TLS
+func (s *DnsServer) serveStream(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			defer conn.Close()
+			for {
+				var length uint16
+				if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
+					return
+				}
+
+				query := make([]byte, length)
+				if _, err := io.ReadFull(conn, query); err != nil {
+					return
+				}
+
+				response, err := s.answer(query)
+				if err != nil {
+					return
+				}
+
+				prefixed := make([]byte, 2+len(response))
+				binary.BigEndian.PutUint16(prefixed, uint16(len(response)))
+				copy(prefixed[2:], response)
+				if _, err := conn.Write(prefixed); err != nil {
+					return
+				}
+			}
+		}()
+	}
+}
+
+func (s *DnsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/dns-message" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	query, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	response, err := s.answer(query)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/dns-message")
+	w.Write(response)
+}
+
+// Start a fake DNS service on the loopback interface answering with
+// answers. The server is closed when the test finishes.
+func NewDnsServer(t testing.TB, answers map[string][]string) *DnsServer {
+	server := &DnsServer{answers: answers}
+
+	packetConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { packetConn.Close() })
+	server.Address = packetConn.LocalAddr().String()
+
+	// Use the same port for TCP so that one address covers both
+	listener, err := net.Listen("tcp", server.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	https := httptest.NewTLSServer(server)
+	t.Cleanup(https.Close)
+	server.HttpsUrl = https.URL + "/dns-query"
+
+	tlsListener, err := tls.Listen("tcp", "127.0.0.1:0", https.TLS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { tlsListener.Close() })
+	server.TlsAddress = tlsListener.Addr().String()
+
+	go server.serveUdp(packetConn)
+	go server.serveStream(listener)
+	go server.serveStream(tlsListener)
+
+	return server
+}
@@ -0,0 +1,155 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package technetiumtest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Technetium names for the algorithms that can be chosen when signing
+var signingAlgorithms = map[string]string{
+	"ECDSA P256":    "ECDSAP256SHA256",
+	"ECDSA P384":    "ECDSAP384SHA384",
+	"EDDSA ED25519": "ED25519",
+	"EDDSA ED448":   "ED448",
+}
+
+// Find the zone named by the zone parameter of the request
+func findZone(r *http.Request, fixture *Fixture) (*Zone, error) {
+	name := r.URL.Query().Get("zone")
+	for i := range fixture.Zones {
+		if strings.EqualFold(fixture.Zones[i].Name, name) {
+			return &fixture.Zones[i], nil
+		}
+	}
+	return nil, fmt.Errorf("No such zone was found: %s", name)
+}
+
+// Generate a key with a random tag and a digest unique to the server
+func (s *Server) newDnssecKey(zone string, keyType string, algorithm string) DnssecKey {
+	key := DnssecKey{
+		KeyTag:         rand.Intn(65536),
+		KeyType:        keyType,
+		Algorithm:      algorithm,
+		State:          "Generated",
+		StateChangedOn: time.Now().UTC(),
+	}
+
+	if keyType == "ZoneSigningKey" {
+		key.RolloverDays = 30
+	} else {
+		sum := sha256.Sum256([]byte(s.URL + zone + strconv.Itoa(key.KeyTag)))
+		key.Digest = strings.ToUpper(hex.EncodeToString(sum[:]))
+	}
+	return key
+}
+
+func (s *Server) registerDnssec() {
+	s.Handle("/api/zones/dnssec/properties/get", func(r *http.Request, fixture *Fixture) (any, error) {
+		zone, err := findZone(r, fixture)
+		if err != nil {
+			return nil, err
+		}
+
+		return map[string]any{
+			"name":              zone.Name,
+			"type":              zone.Type,
+			"internal":          zone.Internal,
+			"disabled":          zone.Disabled,
+			"dnssecStatus":      zone.DnssecStatus,
+			"dnsKeyTtl":         86400,
+			"dnssecPrivateKeys": fixture.DnssecKeys[zone.Name],
+		}, nil
+	})
+
+	s.Handle("/api/zones/dnssec/viewDS", func(r *http.Request, fixture *Fixture) (any, error) {
+		zone, err := findZone(r, fixture)
+		if err != nil {
+			return nil, err
+		}
+
+		records := []map[string]any{}
+		for _, key := range fixture.DnssecKeys[zone.Name] {
+			if key.KeyType != "KeySigningKey" {
+				continue
+			}
+			records = append(records, map[string]any{
+				"keyTag":      key.KeyTag,
+				"dnsKeyState": key.State,
+				"algorithm":   key.Algorithm,
+				"publicKey":   "AwEAAQ==",
+				"digests":     []map[string]any{{"digestType": "SHA256", "digest": key.Digest}},
+			})
+		}
+
+		return map[string]any{"name": zone.Name, "dnssecStatus": zone.DnssecStatus, "dsRecords": records}, nil
+	})
+
+	s.Handle("/api/zones/dnssec/sign", func(r *http.Request, fixture *Fixture) (any, error) {
+		zone, err := findZone(r, fixture)
+		if err != nil {
+			return nil, err
+		}
+		if zone.DnssecStatus != "" && zone.DnssecStatus != "Unsigned" {
+			return nil, fmt.Errorf("Cannot sign zone: the zone is already signed.")
+		}
+
+		query := r.URL.Query()
+		algorithm := "RSASHA256"
+		if query.Get("algorithm") != "RSA" {
+			var ok bool
+			algorithm, ok = signingAlgorithms[query.Get("algorithm")+" "+query.Get("curve")]
+			if !ok {
+				return nil, fmt.Errorf("Unsupported algorithm or curve.")
+			}
+		}
+
+		zone.DnssecStatus = "SignedWith" + query.Get("nxProof")
+		fixture.DnssecKeys[zone.Name] = []DnssecKey{
+			s.newDnssecKey(zone.Name, "KeySigningKey", algorithm),
+			s.newDnssecKey(zone.Name, "ZoneSigningKey", algorithm),
+		}
+		return nil, nil
+	})
+
+	s.Handle("/api/zones/dnssec/unsign", func(r *http.Request, fixture *Fixture) (any, error) {
+		zone, err := findZone(r, fixture)
+		if err != nil {
+			return nil, err
+		}
+		if zone.DnssecStatus == "" || zone.DnssecStatus == "Unsigned" {
+			return nil, fmt.Errorf("Cannot unsign zone: the zone is not signed.")
+		}
+
+		zone.DnssecStatus = "Unsigned"
+		delete(fixture.DnssecKeys, zone.Name)
+		return nil, nil
+	})
+
+	s.Handle("/api/zones/dnssec/properties/rolloverDnsKey", func(r *http.Request, fixture *Fixture) (any, error) {
+		zone, err := findZone(r, fixture)
+		if err != nil {
+			return nil, err
+		}
+
+		keyTag, _ := strconv.Atoi(r.URL.Query().Get("keyTag"))
+		keys := fixture.DnssecKeys[zone.Name]
+		index := slices.IndexFunc(keys, func(key DnssecKey) bool { return key.KeyTag == keyTag })
+		if index < 0 {
+			return nil, fmt.Errorf("No DNSSEC private key was found with key tag: %d", keyTag)
+		}
+
+		keys[index].IsRetiring = true
+		fixture.DnssecKeys[zone.Name] = append(keys, s.newDnssecKey(zone.Name, keys[index].KeyType, keys[index].Algorithm))
+		return nil, nil
+	})
+}
@@ -0,0 +1,172 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package technetiumtest
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Current value of a setting
+func (s *Server) Setting(key string) (any, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	value, ok := s.fixture.Settings[key]
+	return value, ok
+}
+
+// Parse a setting sent to the API into the same type as its current value.
+// Lists are comma separated and cleared with "false".
+func parseSetting(current any, value string) any {
+	switch current.(type) {
+	case bool:
+		parsed, _ := strconv.ParseBool(value)
+		return parsed
+	case float64:
+		parsed, _ := strconv.ParseFloat(value, 64)
+		return parsed
+	case []any:
+		list := []any{}
+		if value == "false" {
+			return list
+		}
+		for _, item := range strings.Split(value, ",") {
+			list = append(list, item)
+		}
+		return list
+	}
+	return value
+}
+
+// Zones and their records as stored in a backup
+type backupZones struct {
+	Zones   []Zone              `json:"zones"`
+	Records map[string][]Record `json:"records"`
+}
+
+// Write a backup of the parts of fixture asked for in the query. Real
+// backups hold the files Technetium keeps on disk, whereas the fake keeps
+// the settings and zones as JSON.
+func writeBackup(w io.Writer, r *http.Request, fixture *Fixture) error {
+	archive := zip.NewWriter(w)
+	files := map[string]any{}
+	if r.URL.Query().Get("dnsSettings") == "true" {
+		files["dns.config.json"] = fixture.Settings
+	}
+	if r.URL.Query().Get("zones") == "true" {
+		files["zones.json"] = backupZones{Zones: fixture.Zones, Records: fixture.Records}
+	}
+
+	for name, contents := range files {
+		file, err := archive.Create(name)
+		if err != nil {
+			return err
+		}
+		if err := json.NewEncoder(file).Encode(contents); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// Restore the parts of a backup asked for in the query into fixture.
+// Zones that aren't in the backup are only deleted with
+// deleteExistingFiles.
+func restoreBackup(r *http.Request, fixture *Fixture) error {
+	file, _, err := r.FormFile("fileBackupZip")
+	if err != nil {
+		return errors.New("Parameter 'fileBackupZip' missing.")
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return fmt.Errorf("The backup file is not a valid zip archive.")
+	}
+
+	query := r.URL.Query()
+	for _, entry := range archive.File {
+		contents, err := entry.Open()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case entry.Name == "dns.config.json" && query.Get("dnsSettings") == "true":
+			err = json.NewDecoder(contents).Decode(&fixture.Settings)
+		case entry.Name == "zones.json" && query.Get("zones") == "true":
+			var backup backupZones
+			if err = json.NewDecoder(contents).Decode(&backup); err != nil {
+				break
+			}
+
+			if query.Get("deleteExistingFiles") == "true" {
+				fixture.Zones = nil
+				fixture.Records = make(map[string][]Record)
+			}
+			for _, zone := range backup.Zones {
+				name := zone.Name
+				fixture.Zones = append(slices.DeleteFunc(fixture.Zones, func(existing Zone) bool { return existing.Name == name }), zone)
+				fixture.Records[name] = backup.Records[name]
+			}
+		}
+		contents.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) registerSettings() {
+	s.Handle("/api/settings/get", func(r *http.Request, fixture *Fixture) (any, error) {
+		return fixture.Settings, nil
+	})
+
+	// Technetium takes the settings as a form and responds with all of
+	// them once they have been changed
+	s.Handle("/api/settings/set", func(r *http.Request, fixture *Fixture) (any, error) {
+		if err := r.ParseForm(); err != nil {
+			return nil, err
+		}
+
+		if fixture.Settings == nil {
+			fixture.Settings = make(map[string]any)
+		}
+		for key := range r.PostForm {
+			fixture.Settings[key] = parseSetting(fixture.Settings[key], r.PostForm.Get(key))
+		}
+		return maps.Clone(fixture.Settings), nil
+	})
+
+	// Like a zone export, a successful backup is a file rather than JSON
+	s.mux.HandleFunc("/api/settings/backup", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/zip")
+		writeBackup(w, r, &s.fixture)
+	})
+
+	s.Handle("/api/settings/restore", func(r *http.Request, fixture *Fixture) (any, error) {
+		if err := restoreBackup(r, fixture); err != nil {
+			return nil, err
+		}
+		return maps.Clone(fixture.Settings), nil
+	})
+}
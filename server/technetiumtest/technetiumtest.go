@@ -0,0 +1,394 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+// Package technetiumtest provides an in process fake of the Technetium DNS
+// HTTP API for use in tests. Each fake is seeded from a Fixture and can be
+// told to misbehave in the ways real servers do, such as responding slowly,
+// with a bad status code or with malformed JSON.
+package technetiumtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SidingsMedia/unified-control-rdns/config"
+)
+
+type CacheRecord struct {
+	Name  string         `json:"name"`
+	Type  string         `json:"type"`
+	Ttl   string         `json:"ttl"`
+	RData map[string]any `json:"rData"`
+}
+
+type Zone struct {
+	Name         string `json:"name"`
+	Type         string `json:"type"`
+	Internal     bool   `json:"internal"`
+	DnssecStatus string `json:"dnssecStatus"`
+	Disabled     bool   `json:"disabled"`
+}
+
+type Record struct {
+	Name     string         `json:"name"`
+	Type     string         `json:"type"`
+	Ttl      int            `json:"ttl"`
+	RData    map[string]any `json:"rData"`
+	Disabled bool           `json:"disabled"`
+}
+
+// Record in the answer section of a DNS response
+type DnsRecord struct {
+	Name  string         `json:"Name"`
+	Type  string         `json:"Type"`
+	Ttl   int            `json:"TTL"`
+	RData map[string]any `json:"RDATA"`
+}
+
+// DNSSEC private key of a signed zone
+type DnssecKey struct {
+	KeyTag         int       `json:"keyTag"`
+	KeyType        string    `json:"keyType"`
+	Algorithm      string    `json:"algorithm"`
+	State          string    `json:"state"`
+	StateChangedOn time.Time `json:"stateChangedOn"`
+	IsRetiring     bool      `json:"isRetiring"`
+	RolloverDays   int       `json:"rolloverDays"`
+	// SHA256 digest of the DS record. Only used for key signing keys.
+	Digest string `json:"-"`
+}
+
+// Initial state of a fake server
+type Fixture struct {
+	Cache   []CacheRecord
+	Zones   []Zone
+	Records map[string][]Record
+	Stats   map[string]any
+	// Answers returned by the resolver keyed by name and type, such as
+	// "example.com A". Questions without an answer get NxDomain.
+	Answers map[string][]DnsRecord
+	// Keys of signed zones keyed by zone name
+	DnssecKeys map[string][]DnssecKey
+	// Domains on the blocked and allowed lists
+	Blocked []string
+	Allowed []string
+	// DHCP scopes and the leases handed out from them
+	DhcpScopes []DhcpScope
+	DhcpLeases []DhcpLease
+	// Values returned by the settings API
+	Settings map[string]any
+	// Installed DNS apps
+	Apps []App
+}
+
+// Ways in which a fake server can misbehave. The zero value behaves
+// normally.
+type Failure struct {
+	// Only fail requests to paths starting with this prefix. Applies to
+	// every path if empty.
+	Path string
+	// Only fail requests with this query parameter, given as key=value.
+	// Applies to every request if empty.
+	Query string
+	// Wait this long before responding
+	Delay time.Duration
+	// Respond with this HTTP status code
+	StatusCode int
+	// Respond with a body that isn't valid JSON
+	MalformedJson bool
+	// Respond with a Technetium error status and this message
+	ErrorMessage string
+}
+
+type Server struct {
+	*httptest.Server
+
+	Token string
+
+	mu       sync.Mutex
+	fixture  Fixture
+	failure  Failure
+	requests []string
+	mux      *http.ServeMux
+
+	// Requests being handled now and the most there have been at once
+	inFlight    int
+	maxInFlight int
+}
+
+// Make the server misbehave until it is given another Failure. Pass the
+// zero value to restore normal behaviour.
+func (s *Server) SetFailure(failure Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failure = failure
+}
+
+// Paths of every request the server has received, in order
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.requests)
+}
+
+// Most requests the server has been handling at the same time
+func (s *Server) MaxInFlight() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.maxInFlight
+}
+
+// Records currently in a zone
+func (s *Server) Records(zone string) []Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.fixture.Records[zone])
+}
+
+// Domains currently on the blocked list
+func (s *Server) Blocked() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.fixture.Blocked)
+}
+
+// Names of every record currently in the cache
+func (s *Server) CachedNames() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := []string{}
+	for _, record := range s.fixture.Cache {
+		if !slices.Contains(names, record.Name) {
+			names = append(names, record.Name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Config entry for this server that can be passed to the repository
+func (s *Server) Config(id string) config.Server {
+	return config.Server{Target: s.URL, Name: id, Token: s.Token, Id: id}
+}
+
+// Register an additional API endpoint. The handler is called with the
+// server lock held and returns the value for the response field of the
+// Technetium response, or an error which is sent as an error status.
+func (s *Server) Handle(path string, handler func(r *http.Request, fixture *Fixture) (any, error)) {
+	s.mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		response, err := handler(r, &s.fixture)
+		s.mu.Unlock()
+
+		if err != nil {
+			writeJson(w, map[string]any{"status": "error", "errorMessage": err.Error()})
+			return
+		}
+		writeJson(w, map[string]any{"status": "ok", "response": response})
+	})
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, r.URL.Path)
+	failure := s.failure
+	s.inFlight++
+	s.maxInFlight = max(s.maxInFlight, s.inFlight)
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		s.inFlight--
+		s.mu.Unlock()
+	}()
+
+	key, value, _ := strings.Cut(failure.Query, "=")
+	if (failure.Path == "" || strings.HasPrefix(r.URL.Path, failure.Path)) &&
+		(failure.Query == "" || r.URL.Query().Get(key) == value) {
+		if failure.Delay > 0 {
+			select {
+			case <-time.After(failure.Delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		if failure.StatusCode != 0 {
+			w.WriteHeader(failure.StatusCode)
+			w.Write([]byte("failure"))
+			return
+		}
+
+		if failure.MalformedJson {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"status": "ok", "response": {`))
+			return
+		}
+
+		if failure.ErrorMessage != "" {
+			writeJson(w, map[string]any{"status": "error", "errorMessage": failure.ErrorMessage})
+			return
+		}
+	}
+
+	if r.URL.Query().Get("token") != s.Token {
+		writeJson(w, map[string]any{"status": "invalid-token", "errorMessage": "Invalid token or session expired."})
+		return
+	}
+
+	s.mux.ServeHTTP(w, r)
+}
+
+func writeJson(w http.ResponseWriter, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
+
+// Check if name is domain or one of its subdomains. An empty domain is
+// the root so contains every name.
+func inDomain(name string, domain string) bool {
+	name = strings.ToLower(name)
+	domain = strings.ToLower(domain)
+	return domain == "" || name == domain || strings.HasSuffix(name, "."+domain)
+}
+
+func (s *Server) registerDefaults() {
+	s.Handle("/api/cache/list", func(r *http.Request, fixture *Fixture) (any, error) {
+		domain := strings.ToLower(strings.TrimSuffix(r.URL.Query().Get("domain"), "."))
+
+		records := []CacheRecord{}
+		zones := []string{}
+		for _, record := range fixture.Cache {
+			name := strings.ToLower(record.Name)
+			if name == domain {
+				records = append(records, record)
+				continue
+			}
+
+			// Technetium lists the direct children of the domain as zones
+			if inDomain(name, domain) {
+				child := strings.TrimSuffix(name, "."+domain)
+				if domain == "" {
+					child = name
+				}
+				labels := strings.Split(child, ".")
+				zone := labels[len(labels)-1]
+				if domain != "" {
+					zone += "." + domain
+				}
+				if !slices.Contains(zones, zone) {
+					zones = append(zones, zone)
+				}
+			}
+		}
+
+		return map[string]any{"domain": domain, "zones": zones, "records": records}, nil
+	})
+
+	s.Handle("/api/cache/delete", func(r *http.Request, fixture *Fixture) (any, error) {
+		domain := strings.TrimSuffix(r.URL.Query().Get("domain"), ".")
+		fixture.Cache = slices.DeleteFunc(fixture.Cache, func(record CacheRecord) bool {
+			return inDomain(record.Name, domain)
+		})
+		return nil, nil
+	})
+
+	s.Handle("/api/cache/flush", func(r *http.Request, fixture *Fixture) (any, error) {
+		fixture.Cache = nil
+		return nil, nil
+	})
+
+	s.Handle("/api/zones/list", func(r *http.Request, fixture *Fixture) (any, error) {
+		return map[string]any{"zones": fixture.Zones}, nil
+	})
+
+	s.Handle("/api/zones/records/get", func(r *http.Request, fixture *Fixture) (any, error) {
+		zone := r.URL.Query().Get("zone")
+		if zone == "" {
+			zone = r.URL.Query().Get("domain")
+		}
+
+		for _, candidate := range fixture.Zones {
+			if strings.EqualFold(candidate.Name, zone) {
+				return map[string]any{"zone": candidate, "records": fixture.Records[candidate.Name]}, nil
+			}
+		}
+		return nil, fmt.Errorf("No such zone was found: %s", zone)
+	})
+
+	s.Handle("/api/dnsClient/resolve", func(r *http.Request, fixture *Fixture) (any, error) {
+		name := strings.ToLower(strings.TrimSuffix(r.URL.Query().Get("domain"), "."))
+		answers, exists := fixture.Answers[name+" "+strings.ToUpper(r.URL.Query().Get("type"))]
+
+		rcode := "NoError"
+		if !exists {
+			rcode = "NxDomain"
+		}
+
+		return map[string]any{"result": map[string]any{
+			"Metadata":           map[string]any{"NameServer": "this-server", "Protocol": "Udp", "RoundTripTime": "1.50 ms"},
+			"RecursionDesired":   true,
+			"RecursionAvailable": true,
+			"RCODE":              rcode,
+			"Answer":             answers,
+		}}, nil
+	})
+
+	s.Handle("/api/dashboard/stats/get", func(r *http.Request, fixture *Fixture) (any, error) {
+		return map[string]any{"stats": fixture.Stats}, nil
+	})
+
+	s.Handle("/api/settings/forceUpdateBlockLists", func(r *http.Request, fixture *Fixture) (any, error) {
+		return nil, nil
+	})
+}
+
+// Start a fake Technetium server seeded with fixture. The server is closed
+// when the test finishes.
+func NewServer(t testing.TB, fixture Fixture) *Server {
+	server := &Server{
+		Token:   "token",
+		fixture: fixture,
+		mux:     http.NewServeMux(),
+	}
+
+	// Copy the fixture so that changes made through the API aren't seen by
+	// other servers sharing it
+	server.fixture.Cache = slices.Clone(fixture.Cache)
+	server.fixture.Zones = slices.Clone(fixture.Zones)
+	server.fixture.Records = make(map[string][]Record)
+	for zone, records := range fixture.Records {
+		server.fixture.Records[zone] = slices.Clone(records)
+	}
+	server.fixture.Blocked = slices.Clone(fixture.Blocked)
+	server.fixture.Allowed = slices.Clone(fixture.Allowed)
+	server.fixture.DhcpScopes = slices.Clone(fixture.DhcpScopes)
+	server.fixture.DhcpLeases = slices.Clone(fixture.DhcpLeases)
+	server.fixture.Settings = maps.Clone(fixture.Settings)
+	server.fixture.Apps = slices.Clone(fixture.Apps)
+	server.fixture.DnssecKeys = make(map[string][]DnssecKey)
+	for zone, keys := range fixture.DnssecKeys {
+		server.fixture.DnssecKeys[zone] = slices.Clone(keys)
+	}
+
+	server.registerDefaults()
+	server.registerDnssec()
+	server.registerZones()
+	server.registerDomainLists()
+	server.registerDhcp()
+	server.registerSettings()
+	server.registerApps()
+	server.Server = httptest.NewServer(server)
+	t.Cleanup(server.Close)
+
+	return server
+}
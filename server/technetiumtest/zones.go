@@ -0,0 +1,315 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package technetiumtest
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// Format the data of a record in presentation format
+func formatRData(record Record) string {
+	data := record.RData
+	switch record.Type {
+	case "A", "AAAA":
+		return fmt.Sprint(data["ipAddress"])
+	case "CNAME":
+		return dns.Fqdn(fmt.Sprint(data["cname"]))
+	case "NS":
+		return dns.Fqdn(fmt.Sprint(data["nameServer"]))
+	case "MX":
+		return fmt.Sprintf("%v %s", data["preference"], dns.Fqdn(fmt.Sprint(data["exchange"])))
+	case "TXT":
+		return fmt.Sprintf("%q", data["text"])
+	}
+
+	if value, ok := data["value"]; ok {
+		return fmt.Sprint(value)
+	}
+
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	values := make([]string, len(keys))
+	for i, key := range keys {
+		values[i] = fmt.Sprint(data[key])
+	}
+	return strings.Join(values, " ")
+}
+
+// Convert a parsed record into the form Technetium returns
+func toRecord(rr dns.RR) Record {
+	header := rr.Header()
+	record := Record{
+		Name: strings.TrimSuffix(header.Name, "."),
+		Type: dns.TypeToString[header.Rrtype],
+		Ttl:  int(header.Ttl),
+	}
+
+	switch rr := rr.(type) {
+	case *dns.A:
+		record.RData = map[string]any{"ipAddress": rr.A.String()}
+	case *dns.AAAA:
+		record.RData = map[string]any{"ipAddress": rr.AAAA.String()}
+	case *dns.CNAME:
+		record.RData = map[string]any{"cname": strings.TrimSuffix(rr.Target, ".")}
+	case *dns.NS:
+		record.RData = map[string]any{"nameServer": strings.TrimSuffix(rr.Ns, ".")}
+	case *dns.MX:
+		record.RData = map[string]any{"preference": int(rr.Preference), "exchange": strings.TrimSuffix(rr.Mx, ".")}
+	case *dns.TXT:
+		record.RData = map[string]any{"text": strings.Join(rr.Txt, "")}
+	default:
+		value := strings.TrimPrefix(rr.String(), header.String())
+		record.RData = map[string]any{"value": value}
+	}
+
+	return record
+}
+
+// Query parameters that aren't part of the record data
+var recordParams = []string{"token", "zone", "domain", "type", "ttl", "overwrite"}
+
+// Record data fields that Technetium returns as numbers
+var numericFields = []string{"preference", "priority", "weight", "port", "flags"}
+
+// Build the record data from the parameters of an add or delete request
+func recordData(r *http.Request) map[string]any {
+	data := make(map[string]any)
+	for key, values := range r.URL.Query() {
+		if slices.Contains(recordParams, key) {
+			continue
+		}
+
+		if number, err := strconv.Atoi(values[0]); err == nil && slices.Contains(numericFields, key) {
+			data[key] = number
+		} else {
+			data[key] = values[0]
+		}
+	}
+	return data
+}
+
+// Check if record has the name and type given in the request
+func sameRecordSet(r *http.Request, record Record) bool {
+	return strings.EqualFold(record.Name, strings.TrimSuffix(r.URL.Query().Get("domain"), ".")) &&
+		strings.EqualFold(record.Type, r.URL.Query().Get("type"))
+}
+
+// Check if the data of record matches data
+func sameData(record Record, data map[string]any) bool {
+	for key, value := range data {
+		if fmt.Sprint(record.RData[key]) != fmt.Sprint(value) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Server) registerZones() {
+	s.Handle("/api/zones/create", func(r *http.Request, fixture *Fixture) (any, error) {
+		name := strings.TrimSuffix(r.URL.Query().Get("zone"), ".")
+		if _, err := findZone(r, fixture); err == nil {
+			return nil, fmt.Errorf("Zone already exists: %s", name)
+		}
+
+		query := r.URL.Query()
+		zone := Zone{Name: name, Type: query.Get("type"), DnssecStatus: "Unsigned"}
+		if zone.Type == "Forwarder" && query.Get("forwarder") == "" {
+			return nil, fmt.Errorf("Parameter 'forwarder' missing.")
+		}
+		fixture.Zones = append(fixture.Zones, zone)
+
+		// Like Technetium, primary zones start with an SOA and NS record
+		// and forwarder zones with the forwarder they were created with
+		fixture.Records[name] = nil
+		switch zone.Type {
+		case "Primary":
+			fixture.Records[name] = []Record{
+				{Name: name, Type: "SOA", Ttl: 900, RData: map[string]any{"primaryNameServer": "ns.fake.test", "responsiblePerson": "hostadmin.fake.test", "serial": 1}},
+				{Name: name, Type: "NS", Ttl: 3600, RData: map[string]any{"nameServer": "ns.fake.test"}},
+			}
+		case "Forwarder":
+			fixture.Records[name] = []Record{
+				{Name: name, Type: "FWD", RData: map[string]any{"protocol": query.Get("protocol"), "forwarder": query.Get("forwarder")}},
+			}
+		}
+		return map[string]any{"domain": name}, nil
+	})
+
+	s.Handle("/api/zones/delete", func(r *http.Request, fixture *Fixture) (any, error) {
+		zone, err := findZone(r, fixture)
+		if err != nil {
+			return nil, err
+		}
+
+		name := zone.Name
+		fixture.Zones = slices.DeleteFunc(fixture.Zones, func(existing Zone) bool { return existing.Name == name })
+		delete(fixture.Records, name)
+		return nil, nil
+	})
+
+	s.Handle("/api/zones/resync", func(r *http.Request, fixture *Fixture) (any, error) {
+		zone, err := findZone(r, fixture)
+		if err != nil {
+			return nil, err
+		}
+
+		switch zone.Type {
+		case "Secondary", "Stub", "SecondaryForwarder":
+			return nil, nil
+		}
+		return nil, fmt.Errorf("Only Secondary, Stub, and Secondary Forwarder zones support resync.")
+	})
+
+	s.Handle("/api/zones/records/add", func(r *http.Request, fixture *Fixture) (any, error) {
+		zone, err := findZone(r, fixture)
+		if err != nil {
+			return nil, err
+		}
+
+		ttl, _ := strconv.Atoi(r.URL.Query().Get("ttl"))
+		record := Record{
+			Name:  strings.ToLower(strings.TrimSuffix(r.URL.Query().Get("domain"), ".")),
+			Type:  strings.ToUpper(r.URL.Query().Get("type")),
+			Ttl:   ttl,
+			RData: recordData(r),
+		}
+		if !inDomain(record.Name, zone.Name) {
+			return nil, fmt.Errorf("The domain name %s is not within the zone %s", record.Name, zone.Name)
+		}
+
+		records := fixture.Records[zone.Name]
+		if r.URL.Query().Get("overwrite") == "true" {
+			records = slices.DeleteFunc(records, func(existing Record) bool { return sameRecordSet(r, existing) })
+		} else if slices.ContainsFunc(records, func(existing Record) bool {
+			return sameRecordSet(r, existing) && sameData(existing, record.RData)
+		}) {
+			return nil, fmt.Errorf("Cannot add record: record already exists.")
+		}
+
+		fixture.Records[zone.Name] = append(records, record)
+		return map[string]any{"zone": zone, "addedRecord": record}, nil
+	})
+
+	s.Handle("/api/zones/records/delete", func(r *http.Request, fixture *Fixture) (any, error) {
+		zone, err := findZone(r, fixture)
+		if err != nil {
+			return nil, err
+		}
+
+		data := recordData(r)
+		records := fixture.Records[zone.Name]
+		remaining := slices.DeleteFunc(slices.Clone(records), func(existing Record) bool {
+			return sameRecordSet(r, existing) && sameData(existing, data)
+		})
+		if len(remaining) == len(records) {
+			return nil, fmt.Errorf("Cannot delete record: no such record exists.")
+		}
+
+		fixture.Records[zone.Name] = remaining
+		return nil, nil
+	})
+
+	// Unlike the rest of the API, a successful export is plain text
+	s.mux.HandleFunc("/api/zones/export", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		zone, err := findZone(r, &s.fixture)
+		if err != nil {
+			writeJson(w, map[string]any{"status": "error", "errorMessage": err.Error()})
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintf(w, ";Exported from fake server\n$ORIGIN %s.\n", zone.Name)
+		for _, record := range s.fixture.Records[zone.Name] {
+			fmt.Fprintf(w, "%s.\t%d\tIN\t%s\t%s\n", record.Name, record.Ttl, record.Type, formatRData(record))
+		}
+	})
+
+	s.Handle("/api/zones/import", func(r *http.Request, fixture *Fixture) (any, error) {
+		if r.Method != http.MethodPost {
+			return nil, fmt.Errorf("Zone file must be sent in the request body.")
+		}
+
+		zone, err := findZone(r, fixture)
+		if err != nil {
+			return nil, err
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		imported := []Record{}
+		parser := dns.NewZoneParser(strings.NewReader(string(body)), zone.Name, "")
+		for rr, ok := parser.Next(); ok; rr, ok = parser.Next() {
+			imported = append(imported, toRecord(rr))
+		}
+		if err := parser.Err(); err != nil {
+			return nil, err
+		}
+
+		records := fixture.Records[zone.Name]
+		if r.URL.Query().Get("overwrite") == "true" {
+			records = slices.DeleteFunc(records, func(existing Record) bool {
+				return slices.ContainsFunc(imported, func(record Record) bool {
+					return strings.EqualFold(record.Name, existing.Name) && record.Type == existing.Type
+				})
+			})
+		}
+
+		fixture.Records[zone.Name] = append(records, imported...)
+		return nil, nil
+	})
+}
+
+func (s *Server) registerDomainLists() {
+	lists := map[string]func(fixture *Fixture) *[]string{
+		"blocked": func(fixture *Fixture) *[]string { return &fixture.Blocked },
+		"allowed": func(fixture *Fixture) *[]string { return &fixture.Allowed },
+	}
+
+	for name, list := range lists {
+		name, list := name, list
+
+		// Exported lists are plain text with one domain per line
+		s.mux.HandleFunc("/api/"+name+"/export", func(w http.ResponseWriter, r *http.Request) {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+
+			w.Header().Set("Content-Type", "text/plain")
+			for _, domain := range *list(&s.fixture) {
+				fmt.Fprintln(w, domain)
+			}
+		})
+
+		s.Handle("/api/"+name+"/add", func(r *http.Request, fixture *Fixture) (any, error) {
+			domain := strings.ToLower(strings.TrimSuffix(r.URL.Query().Get("domain"), "."))
+			if !slices.Contains(*list(fixture), domain) {
+				*list(fixture) = append(*list(fixture), domain)
+			}
+			return nil, nil
+		})
+
+		s.Handle("/api/"+name+"/delete", func(r *http.Request, fixture *Fixture) (any, error) {
+			domain := strings.ToLower(strings.TrimSuffix(r.URL.Query().Get("domain"), "."))
+			*list(fixture) = slices.DeleteFunc(*list(fixture), func(existing string) bool { return existing == domain })
+			return nil, nil
+		})
+	}
+}
@@ -0,0 +1,205 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package server
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/SidingsMedia/unified-control-rdns/server/model"
+	"github.com/miekg/dns"
+)
+
+// Largest zone file accepted for import
+const maxZoneFileSize = 10 << 20
+
+// Problems found in a zone file, each tied to the line it was found on
+type ZoneFileError struct {
+	Lines []model.ZoneFileLineError
+}
+
+func (e *ZoneFileError) Error() string {
+	return fmt.Sprintf("zone file has %d invalid lines", len(e.Lines))
+}
+
+// A single record or directive of a zone file, which may span several
+// lines if it uses parentheses
+type zoneFileEntry struct {
+	line int
+	text string
+}
+
+// Split a zone file into its entries. Newlines inside parentheses or quoted
+// strings don't end an entry, and neither do those in comments.
+func splitZoneFile(text string) []zoneFileEntry {
+	entries := []zoneFileEntry{}
+
+	var current strings.Builder
+	line, start := 1, 1
+	depth := 0
+	quoted, escaped, comment := false, false, false
+
+	flush := func() {
+		if strings.TrimSpace(stripZoneComment(current.String())) != "" {
+			entries = append(entries, zoneFileEntry{line: start, text: current.String()})
+		}
+		current.Reset()
+	}
+
+	for _, char := range text {
+		if current.Len() == 0 {
+			start = line
+		}
+
+		switch {
+		case char == '\n':
+			comment = false
+			line++
+			if depth == 0 && !quoted {
+				flush()
+				continue
+			}
+		case comment:
+		case escaped:
+			escaped = false
+		case char == '\\':
+			escaped = true
+		case char == '"':
+			quoted = !quoted
+		case quoted:
+		case char == ';':
+			comment = true
+		case char == '(':
+			depth++
+		case char == ')' && depth > 0:
+			depth--
+		}
+
+		current.WriteRune(char)
+	}
+	flush()
+
+	return entries
+}
+
+// Remove a trailing comment from a single line, ignoring semicolons in
+// quoted strings
+func stripZoneComment(line string) string {
+	quoted, escaped := false, false
+	for i, char := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case char == '\\':
+			escaped = true
+		case char == '"':
+			quoted = !quoted
+		case char == ';' && !quoted:
+			return line[:i]
+		}
+	}
+	return line
+}
+
+var parseErrorLine = regexp.MustCompile(`^dns: (.*) at line: (\d+):\d+$`)
+
+// Turn an error from the zone parser into one for the line of the zone
+// file it was found on. Errors from the parser give the line within the
+// text that was parsed, which starts after offset lines of directives.
+func toLineError(entry zoneFileEntry, offset int, err error) model.ZoneFileLineError {
+	match := parseErrorLine.FindStringSubmatch(err.Error())
+	if match == nil {
+		return model.ZoneFileLineError{Line: entry.line, Message: err.Error()}
+	}
+
+	line, _ := strconv.Atoi(match[2])
+	line = entry.line + line - offset - 1
+	if line < entry.line {
+		line = entry.line
+	}
+	return model.ZoneFileLineError{Line: line, Message: match[1]}
+}
+
+// Parse and validate a zone file for zone. Each entry is parsed on its own
+// so that every invalid line can be reported rather than only the first.
+// Records outside of the zone are rejected.
+func parseZoneFile(zone string, text string) ([]dns.RR, error) {
+	origin := dns.Fqdn(zone)
+	ttl := ""
+	previousOwner := ""
+
+	records := []dns.RR{}
+	lines := []model.ZoneFileLineError{}
+
+	for _, entry := range splitZoneFile(text) {
+		// Directives and the owner of the previous record are carried
+		// between entries by repeating them ahead of each one
+		header := "$ORIGIN " + origin + "\n"
+		if ttl != "" {
+			header += "$TTL " + ttl + "\n"
+		}
+		offset := strings.Count(header, "\n")
+
+		body := entry.text
+		if (body[0] == ' ' || body[0] == '\t') && previousOwner != "" {
+			body = previousOwner + body
+		}
+
+		parser := dns.NewZoneParser(strings.NewReader(header+body+"\n"), origin, "")
+		parsed := []dns.RR{}
+		for record, ok := parser.Next(); ok; record, ok = parser.Next() {
+			parsed = append(parsed, record)
+		}
+		if err := parser.Err(); err != nil {
+			lines = append(lines, toLineError(entry, offset, err))
+			continue
+		}
+
+		fields := strings.Fields(stripZoneComment(entry.text))
+		switch strings.ToUpper(fields[0]) {
+		case "$ORIGIN":
+			if dns.IsFqdn(fields[1]) {
+				origin = fields[1]
+			} else {
+				origin = fields[1] + "." + origin
+			}
+			continue
+		case "$TTL":
+			ttl = fields[1]
+			continue
+		}
+
+		for _, record := range parsed {
+			if !dns.IsSubDomain(dns.Fqdn(zone), record.Header().Name) {
+				lines = append(lines, model.ZoneFileLineError{
+					Line:    entry.line,
+					Message: fmt.Sprintf("%s is outside of the zone %s", record.Header().Name, zone),
+				})
+				continue
+			}
+
+			records = append(records, record)
+			previousOwner = record.Header().Name
+		}
+	}
+
+	if len(lines) > 0 {
+		return nil, &ZoneFileError{Lines: lines}
+	}
+
+	return records, nil
+}
+
+// Format records as a zone file with one record per line and every name
+// fully qualified
+func formatZoneFile(records []dns.RR) string {
+	var builder strings.Builder
+	for _, record := range records {
+		builder.WriteString(record.String())
+		builder.WriteByte('\n')
+	}
+	return builder.String()
+}
@@ -0,0 +1,84 @@
+// SPDX-FileCopyrightText: 2025 Sidings Media
+// SPDX-License-Identifier: MIT
+
+package server
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/SidingsMedia/unified-control-rdns/server/model"
+)
+
+func TestParseZoneFile(t *testing.T) {
+	zoneFile := `; Example zone
+$TTL 1h
+@	IN	SOA	ns1 hostmaster (
+		2025010101 ; serial
+		3600 900 604800 300 )
+	IN	NS	ns1
+ns1	IN	A	192.0.2.1
+www	300	IN	CNAME	@
+$ORIGIN mail.example.com.
+@	IN	MX	10 mx1
+	IN	TXT	"v=spf1 -all; really"
+`
+
+	records, err := parseZoneFile("example.com", zoneFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"example.com.\t3600\tIN\tSOA\tns1.example.com. hostmaster.example.com. 2025010101 3600 900 604800 300",
+		"example.com.\t3600\tIN\tNS\tns1.example.com.",
+		"ns1.example.com.\t3600\tIN\tA\t192.0.2.1",
+		"www.example.com.\t300\tIN\tCNAME\texample.com.",
+		"mail.example.com.\t3600\tIN\tMX\t10 mx1.mail.example.com.",
+		"mail.example.com.\t3600\tIN\tTXT\t\"v=spf1 -all; really\"",
+	}
+
+	actual := []string{}
+	for _, record := range records {
+		actual = append(actual, record.String())
+	}
+	if !slices.Equal(actual, expected) {
+		t.Errorf("unexpected records\n%q\nexpected\n%q", actual, expected)
+	}
+}
+
+func TestParseZoneFileReportsEveryLine(t *testing.T) {
+	zoneFile := `$TTL 3600
+www	IN	A	192.0.2.300
+ok	IN	A	192.0.2.1
+multi	IN	SOA	ns1 hostmaster (
+		1 2 3
+		4 bad )
+$INCLUDE other.zone
+other.example.net.	IN	A	192.0.2.1
+`
+
+	_, err := parseZoneFile("example.com", zoneFile)
+
+	var zoneFileErr *ZoneFileError
+	if !errors.As(err, &zoneFileErr) {
+		t.Fatalf("expected a zone file error, got %v", err)
+	}
+
+	lines := []int{}
+	for _, line := range zoneFileErr.Lines {
+		lines = append(lines, line.Line)
+		if line.Message == "" {
+			t.Errorf("expected a message for line %d", line.Line)
+		}
+	}
+
+	if !slices.Equal(lines, []int{2, 6, 7, 8}) {
+		t.Errorf("unexpected lines with errors %+v", zoneFileErr.Lines)
+	}
+
+	if zoneFileErr.Lines[3] != (model.ZoneFileLineError{Line: 8, Message: "other.example.net. is outside of the zone example.com"}) {
+		t.Errorf("unexpected error for record outside zone %+v", zoneFileErr.Lines[3])
+	}
+}